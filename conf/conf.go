@@ -9,15 +9,11 @@
 package conf
 
 import (
-	"crypto/tls"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
-	"net"
-	"net/smtp"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -27,18 +23,51 @@ import (
 const (
 	defaultSessionLifeTime       = 2880
 	defaultTokenLifeTime         = 43200
+	defaultIDTokenLifeTime       = 60
+	defaultRefreshLifeTime       = 525600
+	defaultRefreshIdleTime       = 129600
 	defaultGrantReqLifeTime      = 15
+	defaultResetCodeLifeTime     = 60
+	defaultEmailChangeLifeTime   = 1440
 	defaultUnusedAccountLifeTime = 10080
 	defaultCleanerInterval       = 15
 	defaultMailQueueInterval     = 1
 	defaultTmpSshKeyLifeTime     = 5
 )
 
-// Default smtp settings
+// Default smtp settings, the unit of RetryDelay and MaxRetryDelay is minute
 const (
-	defaultPort = 587
+	defaultPort          = 587
+	defaultTLSPort       = 465
+	defaultSendmailPath  = "/usr/sbin/sendmail"
+	defaultMailDirectory = "maildir"
+	defaultMaxAttempts   = 10
+	defaultRetryDelay    = 1
+	defaultMaxRetryDelay = 1440
 )
 
+// Default security settings, the token pepper of the example configuration is publicly
+// known and must be replaced
+const (
+	defaultTwoFactorIssuer = "GIN"
+	exampleTokenPepper     = "change-this-to-a-long-random-secret"
+)
+
+// Default rate limit settings, the unit of Window and LockoutTime is minute and
+// the unit of MaxDelay is second
+const (
+	defaultRateLimitWindow       = 15
+	defaultMaxAttemptsPerIP      = 100
+	defaultMaxFailuresPerAccount = 10
+	defaultDelayAfterFailures    = 3
+	defaultMaxDelay              = 60
+	defaultLockoutTime           = 30
+	defaultMaxResetsPerAccount   = 3
+)
+
+// Scope registered clients may request by default
+const defaultRegistrationScope = "openid account-read repo-read repo-write"
+
 var (
 	resourcesPath     string
 	configPath        string
@@ -74,7 +103,13 @@ type ServerConfig struct {
 	BaseURL               string
 	SessionLifeTime       time.Duration
 	TokenLifeTime         time.Duration
+	IDTokenLifeTime       time.Duration
+	RefreshTokenLifeTime  time.Duration
+	RefreshTokenIdleTime  time.Duration
+	RefreshTokenRotation  bool
 	GrantReqLifeTime      time.Duration
+	ResetCodeLifeTime     time.Duration
+	EmailChangeLifeTime   time.Duration
 	UnusedAccountLifeTime time.Duration
 	TmpSshKeyLifeTime     time.Duration
 	CleanerInterval       time.Duration
@@ -84,6 +119,51 @@ type ServerConfig struct {
 var serverConfig *ServerConfig
 var serverConfigLock = sync.Mutex{}
 
+// SecurityConfig contains settings concerning the protection of accounts and stored secrets.
+// TokenPepper is the secret key used to hash tokens, codes and client secrets before they are
+// stored in the database. Accounts which request one of the TwoFactorScopes during login must
+// use two-factor authentication. TwoFactorIssuer is the issuer shown in authenticator apps.
+type SecurityConfig struct {
+	TokenPepper     []byte
+	TwoFactorScopes []string
+	TwoFactorIssuer string
+}
+
+var securityConfig *SecurityConfig
+var securityConfigLock = sync.Mutex{}
+
+// RateLimitConfig contains the limits for failed logins and password reset requests. All limits
+// apply to a sliding Window. A client IP address may cause MaxAttemptsPerIP failed logins or reset
+// requests. After DelayAfterFailures failed logins of an account every further attempt is delayed
+// progressively (1s, 2s, 4s, ...) up to MaxDelay. After MaxFailuresPerAccount failed logins the
+// account is locked for LockoutTime. MaxResetsPerAccount limits the password reset requests per account.
+type RateLimitConfig struct {
+	Window                time.Duration
+	MaxAttemptsPerIP      int
+	MaxFailuresPerAccount int
+	DelayAfterFailures    int
+	MaxDelay              time.Duration
+	LockoutTime           time.Duration
+	MaxResetsPerAccount   int
+}
+
+var rateLimitConfig *RateLimitConfig
+var rateLimitConfigLock = sync.Mutex{}
+
+// RegistrationConfig contains the settings for the dynamic registration of clients (RFC 7591), which
+// is only possible if Enabled is true. A registration request must either present one of the
+// InitialAccessTokens as bearer token or only use redirect URIs on one of the AllowedHosts.
+// Registered clients can not request scopes other than the listed Scope.
+type RegistrationConfig struct {
+	Enabled             bool
+	InitialAccessTokens []string
+	AllowedHosts        []string
+	Scope               []string
+}
+
+var registrationConfig *RegistrationConfig
+var registrationConfigLock = sync.Mutex{}
+
 // DbConfig contains data needed to connect to a SQL database.
 // The struct contains yaml annotations in order to be compatible with gooses
 // database configuration file (resources/conf/dbconf.yml)
@@ -95,18 +175,29 @@ type DbConfig struct {
 var dbConfig *DbConfig
 var dbConfigLock = sync.Mutex{}
 
-// SmtpCredentials contains the credentials required to send e-mails
-// via smtp. Mode constitutes a switch whether e-mails should actually be sent or not.
-// Supported values of Mode are: print and skip; print will write the content of
-// any e-mail to the commandline / log, skip will skip over any e-mail sending process.
-// For any other value of "Mode" e-mails will be sent.
+// SmtpCredentials contains the settings required to send e-mails. Mode selects the transport
+// used to deliver e-mails: sendmail pipes e-mails to the binary at SendmailPath, file drops e-mails
+// into the maildir Directory, memory keeps e-mails in memory (for tests), print will write the
+// content of any e-mail to the commandline / log and skip will skip over any e-mail sending process.
+// For any other value of "Mode" e-mails will be sent via smtp. TLS is either starttls (default),
+// which requires the server to support STARTTLS, tls for implicit TLS or none. Auth is one of plain,
+// login, cram-md5 or none; by default plain is used if a Username is configured.
+// E-mails which could not be sent are retried after RetryDelay, the delay doubles with every
+// failed attempt up to MaxRetryDelay. After MaxAttempts failed attempts an e-mail is marked as failed.
 type SmtpCredentials struct {
-	From     string
-	Username string
-	Password string
-	Host     string
-	Port     int
-	Mode     string
+	From          string
+	Username      string
+	Password      string
+	Host          string
+	Port          int
+	Mode          string
+	TLS           string
+	Auth          string
+	SendmailPath  string
+	Directory     string
+	MaxAttempts   int
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
 }
 
 var smtpCred *SmtpCredentials
@@ -140,7 +231,13 @@ func GetServerConfig() *ServerConfig {
 				BaseURL               string `yaml:"BaseURL"`
 				SessionLifeTime       int    `yaml:"SessionLifeTime"`
 				TokenLifeTime         int    `yaml:"TokenLifeTime"`
+				IDTokenLifeTime       int    `yaml:"IDTokenLifeTime"`
+				RefreshTokenLifeTime  int    `yaml:"RefreshTokenLifeTime"`
+				RefreshTokenIdleTime  int    `yaml:"RefreshTokenIdleTime"`
+				RefreshTokenRotation  bool   `yaml:"RefreshTokenRotation"`
 				GrantReqLifeTime      int    `yaml:"GrantReqLifeTime"`
+				ResetCodeLifeTime     int    `yaml:"ResetCodeLifeTime"`
+				EmailChangeLifeTime   int    `yaml:"EmailChangeLifeTime"`
 				UnusedAccountLifeTime int    `yaml:"UnusedAccountLifeTime"`
 				TmpSshKeyLifeTime     int    `yaml:"TmpSshKeyLifeTime"`
 				CleanerInterval       int    `yaml:"CleanerInterval"`
@@ -166,9 +263,24 @@ func GetServerConfig() *ServerConfig {
 		if config.Http.TokenLifeTime == 0 {
 			config.Http.TokenLifeTime = defaultTokenLifeTime
 		}
+		if config.Http.IDTokenLifeTime == 0 {
+			config.Http.IDTokenLifeTime = defaultIDTokenLifeTime
+		}
+		if config.Http.RefreshTokenLifeTime == 0 {
+			config.Http.RefreshTokenLifeTime = defaultRefreshLifeTime
+		}
+		if config.Http.RefreshTokenIdleTime == 0 {
+			config.Http.RefreshTokenIdleTime = defaultRefreshIdleTime
+		}
 		if config.Http.GrantReqLifeTime == 0 {
 			config.Http.GrantReqLifeTime = defaultGrantReqLifeTime
 		}
+		if config.Http.ResetCodeLifeTime == 0 {
+			config.Http.ResetCodeLifeTime = defaultResetCodeLifeTime
+		}
+		if config.Http.EmailChangeLifeTime == 0 {
+			config.Http.EmailChangeLifeTime = defaultEmailChangeLifeTime
+		}
 		if config.Http.UnusedAccountLifeTime == 0 {
 			config.Http.UnusedAccountLifeTime = defaultUnusedAccountLifeTime
 		}
@@ -188,7 +300,13 @@ func GetServerConfig() *ServerConfig {
 			BaseURL:               config.Http.BaseURL,
 			SessionLifeTime:       time.Duration(config.Http.SessionLifeTime) * time.Minute,
 			TokenLifeTime:         time.Duration(config.Http.TokenLifeTime) * time.Minute,
+			IDTokenLifeTime:       time.Duration(config.Http.IDTokenLifeTime) * time.Minute,
+			RefreshTokenLifeTime:  time.Duration(config.Http.RefreshTokenLifeTime) * time.Minute,
+			RefreshTokenIdleTime:  time.Duration(config.Http.RefreshTokenIdleTime) * time.Minute,
+			RefreshTokenRotation:  config.Http.RefreshTokenRotation,
 			GrantReqLifeTime:      time.Duration(config.Http.GrantReqLifeTime) * time.Minute,
+			ResetCodeLifeTime:     time.Duration(config.Http.ResetCodeLifeTime) * time.Minute,
+			EmailChangeLifeTime:   time.Duration(config.Http.EmailChangeLifeTime) * time.Minute,
 			UnusedAccountLifeTime: time.Duration(config.Http.UnusedAccountLifeTime) * time.Minute,
 			TmpSshKeyLifeTime:     time.Duration(config.Http.TmpSshKeyLifeTime) * time.Minute,
 			CleanerInterval:       time.Duration(config.Http.CleanerInterval) * time.Minute,
@@ -199,6 +317,160 @@ func GetServerConfig() *ServerConfig {
 	return serverConfig
 }
 
+// GetSecurityConfig loads the security settings from a yaml file when called the first time.
+// Panics if no token pepper is configured, since changing the pepper invalidates all stored values.
+func GetSecurityConfig() *SecurityConfig {
+	securityConfigLock.Lock()
+	defer securityConfigLock.Unlock()
+
+	if securityConfig == nil {
+		content, err := ioutil.ReadFile(filepath.Join(configPath, serverConfigFile))
+		if err != nil {
+			panic(err)
+		}
+
+		config := &struct {
+			Security struct {
+				TokenPepper     string   `yaml:"TokenPepper"`
+				TwoFactorScopes []string `yaml:"TwoFactorScopes"`
+				TwoFactorIssuer string   `yaml:"TwoFactorIssuer"`
+			}
+		}{}
+		err = yaml.Unmarshal(content, config)
+		if err != nil {
+			panic(err)
+		}
+
+		if config.Security.TokenPepper == "" {
+			panic("No token pepper found in server configuration")
+		}
+		if config.Security.TwoFactorIssuer == "" {
+			config.Security.TwoFactorIssuer = defaultTwoFactorIssuer
+		}
+
+		securityConfig = &SecurityConfig{
+			TokenPepper:     []byte(config.Security.TokenPepper),
+			TwoFactorScopes: config.Security.TwoFactorScopes,
+			TwoFactorIssuer: config.Security.TwoFactorIssuer,
+		}
+	}
+
+	return securityConfig
+}
+
+// CheckSecurityConfig returns an error if the token pepper is still the publicly known
+// value of the example configuration.
+func CheckSecurityConfig() error {
+	if string(GetSecurityConfig().TokenPepper) == exampleTokenPepper {
+		return fmt.Errorf("The token pepper '%s' of the example configuration must be replaced", exampleTokenPepper)
+	}
+	return nil
+}
+
+// GetRateLimitConfig loads the rate limit settings from a yaml file when called the first time.
+// Missing settings are replaced by default values.
+func GetRateLimitConfig() *RateLimitConfig {
+	rateLimitConfigLock.Lock()
+	defer rateLimitConfigLock.Unlock()
+
+	if rateLimitConfig == nil {
+		content, err := ioutil.ReadFile(filepath.Join(configPath, serverConfigFile))
+		if err != nil {
+			panic(err)
+		}
+
+		config := &struct {
+			RateLimit struct {
+				Window                int `yaml:"Window"`
+				MaxAttemptsPerIP      int `yaml:"MaxAttemptsPerIP"`
+				MaxFailuresPerAccount int `yaml:"MaxFailuresPerAccount"`
+				DelayAfterFailures    int `yaml:"DelayAfterFailures"`
+				MaxDelay              int `yaml:"MaxDelay"`
+				LockoutTime           int `yaml:"LockoutTime"`
+				MaxResetsPerAccount   int `yaml:"MaxResetsPerAccount"`
+			} `yaml:"ratelimit"`
+		}{}
+		err = yaml.Unmarshal(content, config)
+		if err != nil {
+			panic(err)
+		}
+
+		if config.RateLimit.Window == 0 {
+			config.RateLimit.Window = defaultRateLimitWindow
+		}
+		if config.RateLimit.MaxAttemptsPerIP == 0 {
+			config.RateLimit.MaxAttemptsPerIP = defaultMaxAttemptsPerIP
+		}
+		if config.RateLimit.MaxFailuresPerAccount == 0 {
+			config.RateLimit.MaxFailuresPerAccount = defaultMaxFailuresPerAccount
+		}
+		if config.RateLimit.DelayAfterFailures == 0 {
+			config.RateLimit.DelayAfterFailures = defaultDelayAfterFailures
+		}
+		if config.RateLimit.MaxDelay == 0 {
+			config.RateLimit.MaxDelay = defaultMaxDelay
+		}
+		if config.RateLimit.LockoutTime == 0 {
+			config.RateLimit.LockoutTime = defaultLockoutTime
+		}
+		if config.RateLimit.MaxResetsPerAccount == 0 {
+			config.RateLimit.MaxResetsPerAccount = defaultMaxResetsPerAccount
+		}
+
+		rateLimitConfig = &RateLimitConfig{
+			Window:                time.Duration(config.RateLimit.Window) * time.Minute,
+			MaxAttemptsPerIP:      config.RateLimit.MaxAttemptsPerIP,
+			MaxFailuresPerAccount: config.RateLimit.MaxFailuresPerAccount,
+			DelayAfterFailures:    config.RateLimit.DelayAfterFailures,
+			MaxDelay:              time.Duration(config.RateLimit.MaxDelay) * time.Second,
+			LockoutTime:           time.Duration(config.RateLimit.LockoutTime) * time.Minute,
+			MaxResetsPerAccount:   config.RateLimit.MaxResetsPerAccount,
+		}
+	}
+
+	return rateLimitConfig
+}
+
+// GetRegistrationConfig loads the client registration settings from a yaml file when called the first time.
+// If no scope is configured the default scope is used.
+func GetRegistrationConfig() *RegistrationConfig {
+	registrationConfigLock.Lock()
+	defer registrationConfigLock.Unlock()
+
+	if registrationConfig == nil {
+		content, err := ioutil.ReadFile(filepath.Join(configPath, serverConfigFile))
+		if err != nil {
+			panic(err)
+		}
+
+		config := &struct {
+			Registration struct {
+				Enabled             bool     `yaml:"Enabled"`
+				InitialAccessTokens []string `yaml:"InitialAccessTokens"`
+				AllowedHosts        []string `yaml:"AllowedHosts"`
+				Scope               []string `yaml:"Scope"`
+			}
+		}{}
+		err = yaml.Unmarshal(content, config)
+		if err != nil {
+			panic(err)
+		}
+
+		if len(config.Registration.Scope) == 0 {
+			config.Registration.Scope = strings.Fields(defaultRegistrationScope)
+		}
+
+		registrationConfig = &RegistrationConfig{
+			Enabled:             config.Registration.Enabled,
+			InitialAccessTokens: config.Registration.InitialAccessTokens,
+			AllowedHosts:        config.Registration.AllowedHosts,
+			Scope:               config.Registration.Scope,
+		}
+	}
+
+	return registrationConfig
+}
+
 // GetDbConfig loads a database configuration from a yaml file when called the first time.
 // Returns a struct with configuration information.
 func GetDbConfig() *DbConfig {
@@ -232,6 +504,15 @@ func GetResourceFile(p ...string) string {
 	return filepath.Join(tmp...)
 }
 
+// GetConfigFile returns the path to a file in the configuration directory.
+// The path will be constructed from the configuration path and all given path elements in p.
+func GetConfigFile(p ...string) string {
+	tmp := make([]string, 1, len(p)+1)
+	tmp[0] = configPath
+	tmp = append(tmp, p...)
+	return filepath.Join(tmp...)
+}
+
 // GetClientsConfigFile returns the path to the clients configuration file.
 func GetClientsConfigFile() string {
 	return filepath.Join(configPath, clientsConfigFile)
@@ -251,12 +532,19 @@ func GetSmtpCredentials() *SmtpCredentials {
 
 		credentials := &struct {
 			Smtp struct {
-				From     string `yaml:"From"`
-				Username string `yaml:"Username"`
-				Password string `yaml:"Password"`
-				Host     string `yaml:"Host"`
-				Port     int    `yaml:"Port"`
-				Mode     string `yaml:"Mode"`
+				From          string `yaml:"From"`
+				Username      string `yaml:"Username"`
+				Password      string `yaml:"Password"`
+				Host          string `yaml:"Host"`
+				Port          int    `yaml:"Port"`
+				Mode          string `yaml:"Mode"`
+				TLS           string `yaml:"TLS"`
+				Auth          string `yaml:"Auth"`
+				SendmailPath  string `yaml:"SendmailPath"`
+				Directory     string `yaml:"Directory"`
+				MaxAttempts   int    `yaml:"MaxAttempts"`
+				RetryDelay    int    `yaml:"RetryDelay"`
+				MaxRetryDelay int    `yaml:"MaxRetryDelay"`
 			}
 		}{}
 		err = yaml.Unmarshal(content, credentials)
@@ -264,78 +552,61 @@ func GetSmtpCredentials() *SmtpCredentials {
 			panic(err)
 		}
 
-		if credentials.Smtp.Port == 0 {
+		credentials.Smtp.TLS = strings.ToLower(credentials.Smtp.TLS)
+		if credentials.Smtp.TLS == "" {
+			credentials.Smtp.TLS = "starttls"
+		}
+		if !(credentials.Smtp.TLS == "starttls" || credentials.Smtp.TLS == "tls" || credentials.Smtp.TLS == "none") {
+			panic(fmt.Sprintf("Invalid smtp TLS setting '%s', expected one of 'starttls', 'tls' or 'none'",
+				credentials.Smtp.TLS))
+		}
+		if credentials.Smtp.Port == 0 && credentials.Smtp.TLS == "tls" {
+			credentials.Smtp.Port = defaultTLSPort
+		} else if credentials.Smtp.Port == 0 {
 			credentials.Smtp.Port = defaultPort
 		}
+		credentials.Smtp.Auth = strings.ToLower(credentials.Smtp.Auth)
+		if credentials.Smtp.Auth == "" && credentials.Smtp.Username == "" && credentials.Smtp.Password == "" {
+			credentials.Smtp.Auth = "none"
+		} else if credentials.Smtp.Auth == "" {
+			credentials.Smtp.Auth = "plain"
+		}
+		if credentials.Smtp.SendmailPath == "" {
+			credentials.Smtp.SendmailPath = defaultSendmailPath
+		}
+		if credentials.Smtp.Directory == "" {
+			credentials.Smtp.Directory = defaultMailDirectory
+		}
+		if credentials.Smtp.MaxAttempts == 0 {
+			credentials.Smtp.MaxAttempts = defaultMaxAttempts
+		}
+		if credentials.Smtp.RetryDelay == 0 {
+			credentials.Smtp.RetryDelay = defaultRetryDelay
+		}
+		if credentials.Smtp.MaxRetryDelay == 0 {
+			credentials.Smtp.MaxRetryDelay = defaultMaxRetryDelay
+		}
 
 		smtpCred = &SmtpCredentials{
-			From:     credentials.Smtp.From,
-			Username: credentials.Smtp.Username,
-			Password: credentials.Smtp.Password,
-			Host:     credentials.Smtp.Host,
-			Port:     credentials.Smtp.Port,
-			Mode:     credentials.Smtp.Mode,
+			From:          credentials.Smtp.From,
+			Username:      credentials.Smtp.Username,
+			Password:      credentials.Smtp.Password,
+			Host:          credentials.Smtp.Host,
+			Port:          credentials.Smtp.Port,
+			Mode:          strings.ToLower(credentials.Smtp.Mode),
+			TLS:           credentials.Smtp.TLS,
+			Auth:          credentials.Smtp.Auth,
+			SendmailPath:  credentials.Smtp.SendmailPath,
+			Directory:     credentials.Smtp.Directory,
+			MaxAttempts:   credentials.Smtp.MaxAttempts,
+			RetryDelay:    time.Duration(credentials.Smtp.RetryDelay) * time.Minute,
+			MaxRetryDelay: time.Duration(credentials.Smtp.MaxRetryDelay) * time.Minute,
 		}
 	}
 
 	return smtpCred
 }
 
-// NoAuth is a minimal implementation of the smtp.Auth interface.
-type NoAuth struct{}
-
-// Start always returns proto = "" to indicate, that the authentication can be skipped.
-func (a *NoAuth) Start(server *smtp.ServerInfo) (proto string, toServer []byte, err error) {
-	return "", nil, nil
-}
-
-// Next always returns toServer = nil to indicate, that the authentication can be skipped.
-func (a *NoAuth) Next(fromServer []byte, more bool) (toServer []byte, err error) {
-	return nil, nil
-}
-
-// SmtpCheck tests whether a connection to the specified smtp server can be established
-// with the provided credentials and will panic if it cannot.
-func SmtpCheck() error {
-	cred := GetSmtpCredentials()
-	if strings.ToLower(cred.Mode) == "skip" || strings.ToLower(cred.Mode) == "print" {
-		return nil
-	}
-
-	addr := cred.Host + ":" + strconv.Itoa(cred.Port)
-	netCon, err := net.DialTimeout("tcp", addr, time.Second*10)
-	if err != nil {
-		return err
-	}
-	defer netCon.Close()
-
-	c, err := smtp.NewClient(netCon, cred.Host)
-	if err != nil {
-		return err
-	}
-
-	var auth smtp.Auth
-	if cred.Username == "" && cred.Password == "" {
-		auth = &NoAuth{}
-	} else {
-		auth = smtp.PlainAuth("", cred.Username, cred.Password, cred.Host)
-		if ok, _ := c.Extension("STARTTLS"); ok {
-			config := &tls.Config{ServerName: cred.Host}
-			if err = c.StartTLS(config); err != nil {
-				return err
-			}
-		}
-		if err = c.Auth(auth); err != nil {
-			return err
-		}
-	}
-
-	if err = c.Quit(); err != nil {
-		return err
-	}
-	return nil
-}
-
 // GetLogLocation loads log file locations from a yaml file when called the first time.
 // Returns a struct with the log file locations.
 func GetLogLocation() *LogLocations {
@@ -9,7 +9,11 @@
 package conf
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 const httpHost = "localhost"
@@ -30,6 +34,69 @@ func TestGetServerConfig(t *testing.T) {
 	}
 }
 
+func TestGetSecurityConfig(t *testing.T) {
+	config := GetSecurityConfig()
+	if len(config.TokenPepper) == 0 {
+		t.Error("Token pepper expected to be set")
+	}
+	if config.TwoFactorIssuer != "GIN" {
+		t.Errorf("Two-factor issuer expected to be 'GIN' but was '%s'", config.TwoFactorIssuer)
+	}
+}
+
+func TestCheckSecurityConfig(t *testing.T) {
+	if CheckSecurityConfig() == nil {
+		t.Error("The token pepper of the example configuration should be rejected")
+	}
+
+	dir, err := ioutil.TempDir("", "gin-auth-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, serverConfigFile), []byte("security:\n  TokenPepper: secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	securityConfigLock.Lock()
+	path, config := configPath, securityConfig
+	configPath, securityConfig = dir, nil
+	securityConfigLock.Unlock()
+	defer func() {
+		securityConfigLock.Lock()
+		configPath, securityConfig = path, config
+		securityConfigLock.Unlock()
+	}()
+
+	if err := CheckSecurityConfig(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetRateLimitConfig(t *testing.T) {
+	config := GetRateLimitConfig()
+	if config.Window != 15*time.Minute {
+		t.Errorf("Window expected to be 15m but was '%s'", config.Window)
+	}
+	if config.MaxFailuresPerAccount != 10 {
+		t.Errorf("MaxFailuresPerAccount expected to be 10 but was %d", config.MaxFailuresPerAccount)
+	}
+	if config.MaxDelay != time.Minute {
+		t.Errorf("MaxDelay expected to be 1m but was '%s'", config.MaxDelay)
+	}
+}
+
+func TestGetRegistrationConfig(t *testing.T) {
+	config := GetRegistrationConfig()
+	if config.Enabled {
+		t.Error("Registration expected to be disabled")
+	}
+	if len(config.Scope) != 4 {
+		t.Errorf("Scope expected to have 4 elements but has %d", len(config.Scope))
+	}
+}
+
 func TestGetDbConfig(t *testing.T) {
 	config := GetDbConfig()
 	if config.Driver != "postgres" {
@@ -45,35 +112,44 @@ func TestGetSmtpCredentials(t *testing.T) {
 	if creds.Port != smtpPort {
 		t.Errorf("Port expected to be '%d' but was '%d'\n", smtpPort, creds.Port)
 	}
+	if creds.MaxAttempts != 10 {
+		t.Errorf("MaxAttempts expected to be '10' but was '%d'\n", creds.MaxAttempts)
+	}
+	if creds.TLS != "starttls" || creds.Auth != "none" {
+		t.Errorf("TLS 'starttls' and Auth 'none' expected but were '%s' and '%s'\n", creds.TLS, creds.Auth)
+	}
+	if creds.RetryDelay != time.Minute {
+		t.Errorf("RetryDelay expected to be '%s' but was '%s'\n", time.Minute, creds.RetryDelay)
+	}
 }
 
-func TestSmtpCheck(t *testing.T) {
-	creds := GetSmtpCredentials()
-	creds.Mode = "print"
-
-	err := SmtpCheck()
+func TestGetSmtpCredentialsInvalidTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gin-auth-conf")
 	if err != nil {
-		t.Errorf("Smtp check error on print: %s\n", err.Error())
+		t.Fatal(err)
 	}
-
-	creds.Mode = "skip"
-	err = SmtpCheck()
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, serverConfigFile), []byte("smtp:\n  TLS: ssl\n"), 0600)
 	if err != nil {
-		t.Errorf("Smtp check error on skip: %s\n", err.Error())
+		t.Fatal(err)
 	}
 
-	creds.Host = "nowhere"
-	creds.Mode = "somethingElse"
-	err = SmtpCheck()
-	if err == nil {
-		t.Error("Expected smtp connection error")
-	}
+	smtpCredLock.Lock()
+	path, creds := configPath, smtpCred
+	configPath, smtpCred = dir, nil
+	smtpCredLock.Unlock()
+	defer func() {
+		smtpCredLock.Lock()
+		configPath, smtpCred = path, creds
+		smtpCredLock.Unlock()
+	}()
 
-	creds.Mode = ""
-	err = SmtpCheck()
-	if err == nil {
-		t.Error("Expected smtp connection error")
-	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Panic expected for an unknown TLS setting")
+		}
+	}()
+	GetSmtpCredentials()
 }
 
 func TestGetExternals(t *testing.T) {
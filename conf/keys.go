@@ -0,0 +1,234 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package conf
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Default settings for signing keys
+const (
+	defaultSigningAlgorithm = "RS256"
+	defaultSigningKeyFile   = "jwt-signing-key.pem"
+)
+
+// SigningKey is the key used to sign JWT access tokens. Supported algorithms
+// are RS256 (RSA) and ES256 (ECDSA using P-256).
+type SigningKey struct {
+	Algorithm string
+	KeyID     string
+	Key       crypto.Signer
+}
+
+var signingKey *SigningKey
+var signingKeyLock = sync.Mutex{}
+
+// GetSigningKey loads the key for signing JWT access tokens when called the first time.
+// The algorithm and the key file are read from the server configuration. If the key file
+// does not exist, a new key is generated and stored in the file.
+func GetSigningKey() *SigningKey {
+	signingKeyLock.Lock()
+	defer signingKeyLock.Unlock()
+
+	if signingKey == nil {
+		content, err := ioutil.ReadFile(filepath.Join(configPath, serverConfigFile))
+		if err != nil {
+			panic(err)
+		}
+
+		config := &struct {
+			Jwt struct {
+				Algorithm string `yaml:"Algorithm"`
+				KeyFile   string `yaml:"KeyFile"`
+			}
+		}{}
+		err = yaml.Unmarshal(content, config)
+		if err != nil {
+			panic(err)
+		}
+
+		if config.Jwt.Algorithm == "" {
+			config.Jwt.Algorithm = defaultSigningAlgorithm
+		}
+		if config.Jwt.KeyFile == "" {
+			config.Jwt.KeyFile = defaultSigningKeyFile
+		}
+		if !filepath.IsAbs(config.Jwt.KeyFile) {
+			config.Jwt.KeyFile = filepath.Join(configPath, config.Jwt.KeyFile)
+		}
+
+		signingKey, err = loadSigningKey(config.Jwt.KeyFile, config.Jwt.Algorithm)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return signingKey
+}
+
+// loadSigningKey reads a PEM encoded private key from a file. If the file does not exist
+// a new key matching the algorithm is generated and written to the file.
+func loadSigningKey(path, algorithm string) (*SigningKey, error) {
+	if algorithm != "RS256" && algorithm != "ES256" {
+		return nil, fmt.Errorf("Unsupported signing algorithm %s", algorithm)
+	}
+
+	var key crypto.Signer
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		var block *pem.Block
+		key, block, err = generateSigningKey(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		key, err = parseSigningKey(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != "RS256" {
+			return nil, fmt.Errorf("RSA key can not be used with algorithm %s", algorithm)
+		}
+	case *ecdsa.PrivateKey:
+		if algorithm != "ES256" || k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ECDSA key can not be used with algorithm %s", algorithm)
+		}
+	}
+
+	signing := &SigningKey{Algorithm: algorithm, Key: key}
+	signing.KeyID = signing.thumbprint()
+	return signing, nil
+}
+
+// generateSigningKey creates a new private key for the given algorithm and
+// returns it together with its PEM representation.
+func generateSigningKey(algorithm string) (crypto.Signer, *pem.Block, error) {
+	if algorithm == "ES256" {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, nil
+}
+
+// parseSigningKey decodes a PEM encoded RSA or ECDSA private key in PKCS#1,
+// SEC 1 or PKCS#8 format.
+func parseSigningKey(content []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("Signing key file does not contain a PEM encoded key")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+	}
+	return nil, fmt.Errorf("Unsupported signing key type %s", block.Type)
+}
+
+// PublicJWK returns the public part of the signing key as JSON Web Key (RFC 7517).
+func (key *SigningKey) PublicJWK() map[string]string {
+	jwk := map[string]string{
+		"kid": key.KeyID,
+		"alg": key.Algorithm,
+		"use": "sig",
+	}
+	for k, v := range key.publicParams() {
+		jwk[k] = v
+	}
+	return jwk
+}
+
+// publicParams returns the required public parameters of the key as defined
+// by RFC 7518 section 6.
+func (key *SigningKey) publicParams() map[string]string {
+	enc := base64.RawURLEncoding
+	switch k := key.Key.(type) {
+	case *rsa.PrivateKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   enc.EncodeToString(k.N.Bytes()),
+			"e":   enc.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case *ecdsa.PrivateKey:
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		xBytes, yBytes := k.X.Bytes(), k.Y.Bytes()
+		copy(x[32-len(xBytes):], xBytes)
+		copy(y[32-len(yBytes):], yBytes)
+		return map[string]string{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   enc.EncodeToString(x),
+			"y":   enc.EncodeToString(y),
+		}
+	}
+	return map[string]string{}
+}
+
+// thumbprint computes the JWK thumbprint of the key as defined by RFC 7638.
+func (key *SigningKey) thumbprint() string {
+	p := key.publicParams()
+	var members string
+	if p["kty"] == "EC" {
+		members = fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`, p["crv"], p["kty"], p["x"], p["y"])
+	} else {
+		members = fmt.Sprintf(`{"e":"%s","kty":"%s","n":"%s"}`, p["e"], p["kty"], p["n"])
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package conf
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSigningKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gin-auth-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		path := filepath.Join(dir, alg+".pem")
+
+		// generate new key
+		key, err := loadSigningKey(path, alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.Algorithm != alg {
+			t.Errorf("Algorithm '%s' expected but was '%s'", alg, key.Algorithm)
+		}
+		if key.KeyID == "" {
+			t.Error("Key ID should not be empty")
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Error("Key file was not created")
+		}
+
+		// load existing key
+		loaded, err := loadSigningKey(path, alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.KeyID != key.KeyID {
+			t.Error("Loaded key differs from generated key")
+		}
+
+		jwk := loaded.PublicJWK()
+		if jwk["kid"] != key.KeyID || jwk["alg"] != alg || jwk["use"] != "sig" {
+			t.Errorf("Unexpected JWK: %v", jwk)
+		}
+		if _, ok := jwk["d"]; ok {
+			t.Error("JWK must not contain private parameters")
+		}
+	}
+
+	// key does not match the algorithm
+	_, err = loadSigningKey(filepath.Join(dir, "RS256.pem"), "ES256")
+	if err == nil {
+		t.Error("Loading a RSA key for ES256 should fail")
+	}
+
+	// unsupported algorithm
+	_, err = loadSigningKey(filepath.Join(dir, "HS256.pem"), "HS256")
+	if err == nil {
+		t.Error("Unsupported algorithm should fail")
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// example from RFC 7638 section 3.1
+	const n = "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+	const thumbprint = "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &SigningKey{
+		Algorithm: "RS256",
+		Key:       &rsa.PrivateKey{PublicKey: rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: 65537}},
+	}
+	if tp := key.thumbprint(); tp != thumbprint {
+		t.Errorf("Thumbprint '%s' expected but was '%s'", thumbprint, tp)
+	}
+}
@@ -30,10 +30,16 @@ func MakeUrl(pathFormat string, param ...interface{}) string {
 }
 
 // MakeTemplate loads a template using the default layout and the given content template file.
-func MakeTemplate(name string) *template.Template {
-	layout := path.Join(resourcesPath, "templates", "layout.html")
-	content := path.Join(resourcesPath, "templates", name)
-	tmpl, err := template.ParseFiles(layout, content)
+// Partials are additional template files which define blocks shared by several pages.
+func MakeTemplate(name string, partials ...string) *template.Template {
+	files := []string{
+		path.Join(resourcesPath, "templates", "layout.html"),
+		path.Join(resourcesPath, "templates", name),
+	}
+	for _, partial := range partials {
+		files = append(files, path.Join(resourcesPath, "templates", partial))
+	}
+	tmpl, err := template.ParseFiles(files...)
 	if err != nil {
 		panic(err)
 	}
@@ -10,21 +10,39 @@ package data
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/G-Node/gin-auth/conf"
 	"github.com/G-Node/gin-auth/util"
 )
 
-// AccessToken represents an OAuth access token
+// AccessToken represents an OAuth access token.
+// If the access token was issued together with or in exchange for a refresh
+// token, RefreshToken refers to this refresh token.
 type AccessToken struct {
-	Token       string // This is just a random string not the JWT token
-	Scope       util.StringSet
-	Expires     time.Time
-	ClientUUID  string
-	AccountUUID sql.NullString
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	Token        string // This is just a random string not the JWT token, stored as keyed hash
+	JTI          string // Non-secret random id of the token used as jti claim of a JWT
+	Scope        util.StringSet
+	Expires      time.Time
+	ClientUUID   string
+	AccountUUID  sql.NullString
+	RefreshToken sql.NullString
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// AccessTokenClaims are the claims of an access token issued as signed JWT.
+// The jti claim contains the JTI of the token stored in the database.
+type AccessTokenClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub,omitempty"`
+	ClientID  string `json:"client_id"`
+	Scope     string `json:"scope"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+	JTI       string `json:"jti"`
 }
 
 // ListAccessTokens returns all access tokens sorted by creation time.
@@ -46,7 +64,20 @@ func GetAccessToken(token string) (*AccessToken, bool) {
 	const q = `SELECT * FROM AccessTokens WHERE token=$1 AND expires > now()`
 
 	accessToken := &AccessToken{}
-	err := database.Get(accessToken, q, token)
+	err := database.Get(accessToken, q, hashToken(token))
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return accessToken, err == nil
+}
+
+// getAccessTokenByJTI returns a access token by its non-secret id.
+func getAccessTokenByJTI(jti string) (*AccessToken, bool) {
+	const q = `SELECT * FROM AccessTokens WHERE jti=$1 AND expires > now()`
+
+	accessToken := &AccessToken{}
+	err := database.Get(accessToken, q, jti)
 	if err != nil && err != sql.ErrNoRows {
 		panic(err)
 	}
@@ -54,11 +85,32 @@ func GetAccessToken(token string) (*AccessToken, bool) {
 	return accessToken, err == nil
 }
 
+// FindAccessToken returns the access token for a value presented by a client. The value is either
+// an opaque token or a signed JWT as returned by Encode, whose jti claim contains the id of the
+// token. Returns false if the signature of a JWT is invalid or if no such access token exists.
+func FindAccessToken(value string) (*AccessToken, bool) {
+	if strings.Count(value, ".") != 2 {
+		return GetAccessToken(value)
+	}
+
+	key := conf.GetSigningKey()
+	claims := &AccessTokenClaims{}
+	err := util.VerifyJWT(value, key.Algorithm, key.Key.Public(), claims)
+	if err != nil || claims.JTI == "" || time.Unix(claims.ExpiresAt, 0).Before(time.Now()) {
+		return nil, false
+	}
+
+	return getAccessTokenByJTI(claims.JTI)
+}
+
 // Create stores a new access token in the database.
-// If the token is empty a random token will be generated.
+// If the token is empty a random token will be generated. Only the hash of the token
+// is stored, but the plain token remains accessible via Token. The JTI is generated
+// by the database.
 func (tok *AccessToken) Create() error {
-	const q = `INSERT INTO AccessTokens (token, scope, expires, clientUUID, accountUUID, createdAt, updatedAt)
-	           VALUES ($1, $2, $3, $4, $5, now(), now())
+	const q = `INSERT INTO AccessTokens (token, scope, expires, clientUUID, accountUUID, refreshToken,
+	                                     createdAt, updatedAt)
+	           VALUES ($1, $2, $3, $4, $5, $6, now(), now())
 	           RETURNING *`
 
 	tok.Expires = time.Now().Add(conf.GetServerConfig().TokenLifeTime)
@@ -66,7 +118,12 @@ func (tok *AccessToken) Create() error {
 		tok.Token = util.RandomToken()
 	}
 
-	return database.Get(tok, q, tok.Token, tok.Scope, tok.Expires, tok.ClientUUID, tok.AccountUUID)
+	token := tok.Token
+	err := database.Get(tok, q, storedToken(tok.Token), tok.Scope, tok.Expires, tok.ClientUUID, tok.AccountUUID,
+		storedNullToken(tok.RefreshToken))
+	tok.Token = token
+
+	return err
 }
 
 // UpdateExpirationTime updates the expiration time and stores
@@ -76,13 +133,42 @@ func (tok *AccessToken) UpdateExpirationTime() error {
 	           WHERE token=$2
 	           RETURNING *`
 
-	return database.Get(tok, q, time.Now().Add(conf.GetServerConfig().TokenLifeTime), tok.Token)
+	token := tok.Token
+	err := database.Get(tok, q, time.Now().Add(conf.GetServerConfig().TokenLifeTime), storedToken(tok.Token))
+	tok.Token = token
+
+	return err
 }
 
 // Delete removes an access token from the database.
 func (tok *AccessToken) Delete() error {
 	const q = `DELETE FROM AccessTokens WHERE token=$1`
 
-	_, err := database.Exec(q, tok.Token)
+	_, err := database.Exec(q, storedToken(tok.Token))
 	return err
 }
+
+// Encode returns the value of the access token that is handed out to the client. Depending
+// on the token format of the client this is either the token itself or a signed JWT.
+func (tok *AccessToken) Encode() (string, error) {
+	client, ok := GetClient(tok.ClientUUID)
+	if !ok {
+		return "", errors.New("Unable to find client associated with the token")
+	}
+	if !client.IssuesJWT() {
+		return tok.Token, nil
+	}
+
+	claims := &AccessTokenClaims{
+		Issuer:    conf.GetServerConfig().BaseURL,
+		Subject:   tok.AccountUUID.String,
+		ClientID:  client.Name,
+		Scope:     strings.Join(tok.Scope.Strings(), " "),
+		ExpiresAt: tok.Expires.Unix(),
+		IssuedAt:  tok.CreatedAt.Unix(),
+		JTI:       tok.JTI,
+	}
+
+	key := conf.GetSigningKey()
+	return util.SignJWT(claims, key.Algorithm, key.KeyID, key.Key)
+}
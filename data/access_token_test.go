@@ -9,10 +9,12 @@
 package data
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"database/sql"
+	"github.com/G-Node/gin-auth/conf"
 	"github.com/G-Node/gin-auth/util"
 )
 
@@ -155,3 +157,64 @@ func TestAccessTokenDelete(t *testing.T) {
 		t.Error("Access token should not exist")
 	}
 }
+
+func TestAccessTokenEncode(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	// opaque token
+	tok, ok := GetAccessToken(accessTokenAlice)
+	if !ok {
+		t.Fatal("Access token does not exist")
+	}
+	value, err := tok.Encode()
+	if err != nil {
+		t.Error(err)
+	}
+	if value != accessTokenAlice {
+		t.Errorf("Encoded opaque token expected to be '%s' but was '%s'", accessTokenAlice, value)
+	}
+
+	// JWT
+	database.MustExec("UPDATE Clients SET tokenFormat = 'jwt' WHERE uuid = $1", uuidClientGin)
+	value, err = tok.Encode()
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Count(value, ".") != 2 {
+		t.Errorf("Encoded token expected to be a JWT but was '%s'", value)
+	}
+	claims := &AccessTokenClaims{}
+	key := conf.GetSigningKey()
+	err = util.VerifyJWT(value, key.Algorithm, key.Key.Public(), claims)
+	if err != nil {
+		t.Error(err)
+	}
+	if claims.JTI == "" || claims.JTI != tok.JTI || claims.JTI == tok.Token {
+		t.Errorf("The jti claim expected to be '%s' but was '%s'", tok.JTI, claims.JTI)
+	}
+
+	check, ok := FindAccessToken(value)
+	if !ok {
+		t.Error("Unable to find access token by JWT")
+	} else if check.Token != hashToken(accessTokenAlice) {
+		t.Errorf("Access token '%s' expected but was '%s'", hashToken(accessTokenAlice), check.Token)
+	}
+
+	parts := strings.Split(value, ".")
+	parts[2] = parts[2][:len(parts[2])-4] + "AAAA"
+	_, ok = FindAccessToken(strings.Join(parts, "."))
+	if ok {
+		t.Error("JWT with invalid signature should not be accepted")
+	}
+
+	// revoked JWT
+	err = tok.Delete()
+	if err != nil {
+		t.Error(err)
+	}
+	_, ok = FindAccessToken(value)
+	if ok {
+		t.Error("Revoked JWT should not be accepted")
+	}
+}
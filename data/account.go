@@ -39,8 +39,8 @@ type Account struct {
 	City                string
 	Country             string
 	IsAffiliationPublic bool
+	Language            string
 	ActivationCode      sql.NullString
-	ResetPWCode         sql.NullString
 	IsDisabled          bool
 	CreatedAt           time.Time
 	UpdatedAt           time.Time
@@ -89,8 +89,7 @@ func GetAccount(uuid string) (*Account, bool) {
 	return account, err == nil
 }
 
-// GetAccountByLogin returns an active account (non disabled, no activation code, no reset password code)
-// with matching login.
+// GetAccountByLogin returns an active account (non disabled, no activation code) with matching login.
 // Returns false if no account with such login exists.
 func GetAccountByLogin(login string) (*Account, bool) {
 	const q = `SELECT * FROM ActiveAccounts a WHERE a.login=$1`
@@ -104,14 +103,14 @@ func GetAccountByLogin(login string) (*Account, bool) {
 	return account, err == nil
 }
 
-// GetAccountByCredential returns an active account (non disabled, no activation code,
-// no reset password code) with matching login or email address.
-// Returns false if no account with such login or email address exists.
-func GetAccountByCredential(id string) (*Account, bool) {
-	const q = `SELECT * FROM ActiveAccounts WHERE login=$1 or email=$1`
+// GetAnyAccountByLogin returns an account with matching login regardless of whether the account
+// is disabled or waiting for its activation.
+// Returns false if no account with such login exists.
+func GetAnyAccountByLogin(login string) (*Account, bool) {
+	const q = `SELECT * FROM Accounts a WHERE a.login=$1`
 
 	account := &Account{}
-	err := database.Get(account, q, id)
+	err := database.Get(account, q, login)
 	if err != nil && err != sql.ErrNoRows {
 		panic(err)
 	}
@@ -119,13 +118,14 @@ func GetAccountByCredential(id string) (*Account, bool) {
 	return account, err == nil
 }
 
-// GetAccountByActivationCode returns an account with matching activation code.
-// Returns false if no account with the activation code can be found.
-func GetAccountByActivationCode(code string) (*Account, bool) {
-	const q = `SELECT * FROM Accounts WHERE activationCode=$1 AND NOT isDisabled`
+// GetAccountByCredential returns an active account (non disabled, no activation code)
+// with matching login or email address.
+// Returns false if no account with such login or email address exists.
+func GetAccountByCredential(id string) (*Account, bool) {
+	const q = `SELECT * FROM ActiveAccounts WHERE login=$1 or email=$1`
 
 	account := &Account{}
-	err := database.Get(account, q, code)
+	err := database.Get(account, q, id)
 	if err != nil && err != sql.ErrNoRows {
 		panic(err)
 	}
@@ -133,13 +133,13 @@ func GetAccountByActivationCode(code string) (*Account, bool) {
 	return account, err == nil
 }
 
-// GetAccountByResetPWCode returns an account with matching reset password code.
-// Returns false if no account with the reset password code can be found.
-func GetAccountByResetPWCode(code string) (*Account, bool) {
-	const q = `SELECT * FROM Accounts WHERE resetPWCode=$1 AND NOT isDisabled`
+// GetAccountByActivationCode returns an account with matching activation code.
+// Returns false if no account with the activation code can be found.
+func GetAccountByActivationCode(code string) (*Account, bool) {
+	const q = `SELECT * FROM Accounts WHERE activationCode=$1 AND NOT isDisabled`
 
 	account := &Account{}
-	err := database.Get(account, q, code)
+	err := database.Get(account, q, hashToken(code))
 	if err != nil && err != sql.ErrNoRows {
 		panic(err)
 	}
@@ -161,23 +161,6 @@ func GetAccountDisabled(uuid string) (*Account, bool) {
 	return account, err == nil
 }
 
-// SetPasswordReset updates the password reset code with a new token, if an
-// account can be found, that is non disabled and has either email or login of a provided credential.
-// Returns false, if no non-disabled account with the credential as email or login can be found.
-func SetPasswordReset(credential string) (*Account, bool) {
-	const q = `UPDATE Accounts SET resetpwcode=$2
-		   WHERE NOT isdisabled AND (login=$1 OR email=$1) RETURNING *`
-
-	code := util.RandomToken()
-	account := &Account{}
-	err := database.Get(account, q, credential, code)
-	if err != nil && err != sql.ErrNoRows {
-		panic(err)
-	}
-
-	return account, err == nil
-}
-
 // SetPassword hashes the plain text password and
 // sets PWHash to the new value.
 func (acc *Account) SetPassword(plain string) error {
@@ -210,10 +193,8 @@ func (acc *Account) UpdatePassword(plain string) error {
 	return err
 }
 
-// UpdateEmail checks validity of a new e-mail address and updates the current account
-// with a valid new e-mail address.
-// The normal account update does not include the e-mail address for safety reasons.
-func (acc *Account) UpdateEmail(email string) error {
+// checkEmail checks whether an e-mail address is valid and not used by any account.
+func checkEmail(email string) error {
 	if !(len(email) > 2) || !strings.Contains(email, "@") {
 		return &util.ValidationError{
 			Message:     "Invalid e-mail address",
@@ -238,33 +219,71 @@ func (acc *Account) UpdateEmail(email string) error {
 			Message:     "E-Mail address already exists",
 			FieldErrors: map[string]string{"email": "Please choose a different e-mail address"}}
 	}
+	return nil
+}
+
+var loginRegex = regexp.MustCompile(`^[a-zA-Z0-9-_]+$`)
+
+// UpdateLogin checks the validity of a new login and changes the login of the account.
+// Like the e-mail address, the login is not changed by the normal account update.
+func (acc *Account) UpdateLogin(login string) error {
+	if !loginRegex.MatchString(login) {
+		return &util.ValidationError{
+			Message:     "Invalid login",
+			FieldErrors: map[string]string{"login": "Please use only the following characters: 'a-zA-Z0-9-_'"}}
+	}
+	if len(login) > 512 {
+		return &util.ValidationError{
+			Message:     "Invalid login",
+			FieldErrors: map[string]string{"login": "Login too long, please shorten to 512 characters"}}
+	}
+	exists := &struct {
+		Login bool
+	}{}
 
-	const q = `UPDATE Accounts SET email=$1 WHERE uuid=$2 RETURNING *`
-	err = database.Get(acc, q, email, acc.UUID)
+	const check = `SELECT (SELECT COUNT(*) FROM accounts WHERE login = $1) <> 0 AS login`
+	err := database.Get(exists, check, login)
+	if err != nil {
+		panic(err)
+	}
+	if exists.Login {
+		return &util.ValidationError{
+			Message:     "Login already exists",
+			FieldErrors: map[string]string{"login": "Please choose a different login"}}
+	}
+
+	const q = `UPDATE Accounts SET login=$1, updatedAt=now() WHERE uuid=$2 RETURNING *`
+	err = database.Get(acc, q, login, acc.UUID)
 	if err != nil {
 		panic(err)
 	}
 
-	acc.Email = email
 	return nil
 }
 
 // Create stores the account as new Account in the database.
-// If the UUID string is empty a new UUID will be generated.
+// If the UUID string is empty a new UUID will be generated. Only the hash of the activation
+// code is stored, but the plain code remains accessible via ActivationCode.
+// If the Language is empty, the default language is used.
 func (acc *Account) Create() error {
 	const q = `INSERT INTO Accounts (uuid, login, pwHash, email, isEmailPublic, title, firstName, middleName, lastName,
-	                                 institute, department, city, country, isAffiliationPublic, activationCode,
+	                                 institute, department, city, country, isAffiliationPublic, language, activationCode,
 	                                 createdAt, updatedAt)
-	           VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, now(), now())
+	           VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, now(), now())
 	           RETURNING *`
 
 	if acc.UUID == "" {
 		acc.UUID = uuid.NewRandom().String()
 	}
+	if acc.Language == "" {
+		acc.Language = util.DefaultLanguage
+	}
 
+	code := acc.ActivationCode
 	err := database.Get(acc, q, acc.UUID, acc.Login, acc.PWHash, acc.Email, acc.IsEmailPublic, acc.Title, acc.FirstName,
 		acc.MiddleName, acc.LastName, acc.Institute, acc.Department, acc.City, acc.Country, acc.IsAffiliationPublic,
-		acc.ActivationCode)
+		acc.Language, storedNullToken(acc.ActivationCode))
+	acc.ActivationCode = code
 
 	// TODO There is a lot of room for improvement here concerning errors about constraints for certain fields
 	return err
@@ -289,17 +308,24 @@ func (acc *Account) SSHKeys() []SSHKey {
 // Field ActivationCode is not set via this update function, since this field fulfills a special role.
 // It can only be set to a value once by account create and can only be set to null via its own function.
 // Fields password and email are not set via this update function, since they require sufficient scope to change.
+// Returns a validation error if the Language is not a valid language tag.
 func (acc *Account) Update() error {
 	const q = `UPDATE Accounts
 	           SET (isemailpublic, title, firstName, middleName, lastName, institute,
-	                department, city, country, isaffiliationpublic, resetPWCode, isDisabled, updatedAt) =
+	                department, city, country, isaffiliationpublic, language, isDisabled, updatedAt) =
 	               ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now())
 	           WHERE uuid=$13
 	           RETURNING *`
 
+	if !util.ValidLanguage(acc.Language) {
+		return &util.ValidationError{
+			Message:     "Invalid language",
+			FieldErrors: map[string]string{"language": "Please use a language tag like 'en' or 'de-AT'"}}
+	}
+
 	err := database.Get(acc, q, acc.IsEmailPublic, acc.Title, acc.FirstName, acc.MiddleName,
 		acc.LastName, acc.Institute, acc.Department, acc.City, acc.Country, acc.IsAffiliationPublic,
-		acc.ResetPWCode, acc.IsDisabled, acc.UUID)
+		acc.Language, acc.IsDisabled, acc.UUID)
 
 	// TODO There is a lot of room for improvement here concerning errors about constraints for certain fields
 	return err
@@ -318,11 +344,153 @@ func (acc *Account) RemoveActivationCode() error {
 	return err
 }
 
+// RenewActivationCode replaces the activation code of an account which was not yet activated.
+// Only the hash of the new code is stored, but the plain code is accessible via ActivationCode.
+// Returns an error if the account is already active.
+func (acc *Account) RenewActivationCode() error {
+	const q = `UPDATE Accounts SET activationCode=$1, updatedAt=now()
+	           WHERE uuid=$2 AND activationCode IS NOT NULL
+	           RETURNING *`
+
+	code := util.RandomToken()
+	err := database.Get(acc, q, hashToken(code), acc.UUID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("Account is already activated")
+	}
+	if err != nil {
+		return err
+	}
+	acc.ActivationCode = sql.NullString{String: code, Valid: true}
+
+	return nil
+}
+
+// SetDisabled disables or enables an account. Disabling an account also terminates all its
+// sessions and revokes all its tokens and pending grant requests.
+func (acc *Account) SetDisabled(disabled bool) error {
+	const (
+		qAccount  = `UPDATE Accounts SET isDisabled=$1, updatedAt=now() WHERE uuid=$2`
+		qGrant    = `DELETE FROM GrantRequests WHERE accountUUID=$1`
+		qSessions = `DELETE FROM Sessions WHERE accountUUID=$1`
+		qAccess   = `DELETE FROM AccessTokens WHERE accountUUID=$1`
+		qRefresh  = `DELETE FROM RefreshTokens WHERE accountUUID=$1`
+	)
+
+	tx := database.MustBegin()
+	_, err := tx.Exec(qAccount, disabled, acc.UUID)
+	if err == nil && disabled {
+		_, err = tx.Exec(qGrant, acc.UUID)
+		if err == nil {
+			_, err = tx.Exec(qSessions, acc.UUID)
+		}
+		if err == nil {
+			_, err = tx.Exec(qAccess, acc.UUID)
+		}
+		if err == nil {
+			_, err = tx.Exec(qRefresh, acc.UUID)
+		}
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	err = tx.Commit()
+	if err == nil {
+		acc.IsDisabled = disabled
+	}
+	return err
+}
+
+// ForcePasswordReset invalidates the password of an account, removes its security keys, terminates
+// all its sessions and tokens and creates a new password reset code. The account can not be used to
+// sign in until the password was reset. The plain code is accessible via Code of the returned reset.
+func (acc *Account) ForcePasswordReset() (*PasswordReset, error) {
+	const (
+		qAccount = `UPDATE Accounts SET pwHash='', updatedAt=now() WHERE uuid=$1`
+		qKeys    = `DELETE FROM WebAuthnCredentials WHERE accountUUID=$1`
+	)
+
+	tx := database.MustBegin()
+	_, err := tx.Exec(qAccount, acc.UUID)
+	if err == nil {
+		_, err = tx.Exec(qKeys, acc.UUID)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	acc.PWHash = ""
+
+	err = acc.Logout()
+	if err != nil {
+		return nil, err
+	}
+
+	return acc.CreatePasswordReset()
+}
+
+// Delete removes an account together with its SSH keys, sessions, tokens, grant requests and
+// client approvals. Two-factor secrets, security keys and lockouts are removed by the database.
+func (acc *Account) Delete() error {
+	const (
+		qGrant     = `DELETE FROM GrantRequests WHERE accountUUID=$1`
+		qSessions  = `DELETE FROM Sessions WHERE accountUUID=$1`
+		qAccess    = `DELETE FROM AccessTokens WHERE accountUUID=$1`
+		qRefresh   = `DELETE FROM RefreshTokens WHERE accountUUID=$1`
+		qApprovals = `DELETE FROM ClientApprovals WHERE accountUUID=$1`
+		qKeys      = `DELETE FROM SSHKeys WHERE accountUUID=$1`
+		qAccount   = `DELETE FROM Accounts WHERE uuid=$1`
+	)
+
+	tx := database.MustBegin()
+	_, err := tx.Exec(qGrant, acc.UUID)
+	if err == nil {
+		_, err = tx.Exec(qSessions, acc.UUID)
+	}
+	if err == nil {
+		_, err = tx.Exec(qAccess, acc.UUID)
+	}
+	if err == nil {
+		_, err = tx.Exec(qRefresh, acc.UUID)
+	}
+	if err == nil {
+		_, err = tx.Exec(qApprovals, acc.UUID)
+	}
+	if err == nil {
+		_, err = tx.Exec(qKeys, acc.UUID)
+	}
+	if err == nil {
+		_, err = tx.Exec(qAccount, acc.UUID)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // Validate the content of an Account.
 // First name, last name, login, email, institute, department, city and country must not be empty;
 // Title, first name, middle name last name, login, email, institute, department, city
 // and country must not be longer than 521 characters;
-// A given login and e-mail address must not exist in the database; An e-mail address must contain an "@".
+// A given login and e-mail address must not exist in the database; An e-mail address must contain an "@";
+// A given language must be a language tag like "en" or "de-AT".
 func (acc *Account) Validate() *util.ValidationError {
 	valErr := &util.ValidationError{FieldErrors: make(map[string]string)}
 
@@ -371,6 +539,9 @@ func (acc *Account) Validate() *util.ValidationError {
 	if len(acc.Country) > fieldLength {
 		valErr.FieldErrors["country"] = lenMessage
 	}
+	if acc.Language != "" && !util.ValidLanguage(acc.Language) {
+		valErr.FieldErrors["language"] = "Please use a language tag like 'en' or 'de-AT'"
+	}
 
 	exists := &struct {
 		Login bool
@@ -442,17 +613,31 @@ func (am *AccountMarshaler) MarshalJSON() ([]byte, error) {
 			IsPublic:   am.Account.IsAffiliationPublic,
 		}
 	}
-	return json.Marshal(jsonData)
+	if !am.WithMail {
+		return json.Marshal(jsonData)
+	}
+	// the preferred language of e-mails is only shown together with the e-mail address
+	return json.Marshal(&struct {
+		*gin.Account
+		Language string `json:"language"`
+	}{jsonData, am.Account.Language})
 }
 
 // UnmarshalJSON implements Unmarshaler for AccountMarshaler.
-// Only parses updatable fields: Title, FirstName, MiddleName and LastName
+// Only parses updatable fields: Title, FirstName, MiddleName, LastName and Language
 func (am *AccountMarshaler) UnmarshalJSON(bytes []byte) error {
 	jsonData := &gin.Account{}
 	err := json.Unmarshal(bytes, jsonData)
 	if err != nil {
 		return err
 	}
+	language := &struct {
+		Language *string `json:"language"`
+	}{}
+	err = json.Unmarshal(bytes, language)
+	if err != nil {
+		return err
+	}
 
 	if am.Account == nil {
 		am.Account = &Account{}
@@ -485,5 +670,9 @@ func (am *AccountMarshaler) UnmarshalJSON(bytes []byte) error {
 		am.Account.IsAffiliationPublic = jsonData.Affiliation.IsPublic
 	}
 
+	if language.Language != nil {
+		am.Account.Language = *language.Language
+	}
+
 	return nil
 }
@@ -27,8 +27,8 @@ func TestListAccounts(t *testing.T) {
 	InitTestDb(t)
 
 	accounts := ListAccounts()
-	if len(accounts) != 3 {
-		t.Error("Three accounts expected in list")
+	if len(accounts) != 4 {
+		t.Error("Four accounts expected in list")
 	}
 }
 
@@ -49,8 +49,14 @@ func TestGetAccount(t *testing.T) {
 		t.Error("Account should not exist")
 	}
 
+	// accounts with a pending password reset remain active
+	_, ok = GetAccount("test0002-1234-6789-1234-678901234567")
+	if !ok {
+		t.Error("Account with pending password reset should exist")
+	}
+
 	// Test whole barrage of inactive accounts
-	inactiveUUID := []string{"test0001", "test0002", "test0003", "test0004", "test0005", "test0006"}
+	inactiveUUID := []string{"test0001", "test0003", "test0004", "test0005", "test0006"}
 	suffix := "-1234-6789-1234-678901234567"
 	for _, v := range inactiveUUID {
 		currUUID := v + suffix
@@ -79,7 +85,7 @@ func TestGetAccountByLogin(t *testing.T) {
 	}
 
 	// Test whole barrage of inactive accounts
-	inactiveLogin := []string{"inact_log1", "inact_log2", "inact_log3", "inact_log4", "inact_log5", "inact_log6"}
+	inactiveLogin := []string{"inact_log1", "inact_log3", "inact_log4", "inact_log5", "inact_log6"}
 	for _, v := range inactiveLogin {
 		_, ok = GetAccountByLogin(v)
 		if ok {
@@ -117,8 +123,7 @@ func TestGetAccountByCredential(t *testing.T) {
 	}
 
 	// Test whole barrage of inactive accounts
-	inactiveLogin := []string{"inact_log1", "inact_log2", "inact_log3", "inact_log4",
-		"inact_log5", "inact_log6"}
+	inactiveLogin := []string{"inact_log1", "inact_log3", "inact_log4", "inact_log5", "inact_log6"}
 	for _, v := range inactiveLogin {
 		_, ok = GetAccountByCredential(v)
 		if ok {
@@ -159,38 +164,6 @@ func TestGetAccountByActivationCode(t *testing.T) {
 	}
 }
 
-func TestGetAccountByResetPWCode(t *testing.T) {
-	defer util.FailOnPanic(t)
-	InitTestDb(t)
-
-	const enabledUUID = "test0002-1234-6789-1234-678901234567"
-	const enabledCode = "rc_a"
-	const disabledCode = "rc_c"
-
-	acc, ok := GetAccountByResetPWCode(enabledCode)
-	if !ok {
-		t.Error("Account does not exist")
-	}
-	if acc.UUID != enabledUUID {
-		t.Errorf("UUID was expected to be '%s'", enabledUUID)
-	}
-
-	_, ok = GetAccountByResetPWCode(disabledCode)
-	if ok {
-		t.Error("Account should not exist")
-	}
-
-	_, ok = GetAccountByResetPWCode("")
-	if ok {
-		t.Error("Account should not exist")
-	}
-
-	_, ok = GetAccountByResetPWCode("iDoNotExist")
-	if ok {
-		t.Error("Account should not exist")
-	}
-}
-
 func TestGetAccountDisabled(t *testing.T) {
 	defer util.FailOnPanic(t)
 	InitTestDb(t)
@@ -212,62 +185,6 @@ func TestGetAccountDisabled(t *testing.T) {
 	}
 }
 
-func TestSetPasswordReset(t *testing.T) {
-	defer util.FailOnPanic(t)
-	InitTestDb(t)
-
-	const disabledLogin = "inact_log4"
-	const disabledEmail = "email4@example.com"
-	const enabledLogin = "inact_log1"
-	const enabledEmail = "email1@example.com"
-
-	// Test empty credential
-	_, ok := SetPasswordReset("")
-	if ok {
-		t.Error("Account should not have been updated using an empty credential")
-	}
-
-	// Test non existing credential
-	_, ok = SetPasswordReset("iDoNotExist")
-	if ok {
-		t.Error("Account should not have been updated using non existing credential")
-	}
-
-	// Test valid login of disabled account
-	_, ok = SetPasswordReset(disabledLogin)
-	if ok {
-		t.Error("Account should not have been updated using disabled account login")
-	}
-
-	// Test valid email of disabled account
-	_, ok = SetPasswordReset(disabledEmail)
-	if ok {
-		t.Error("Account should not have been updated using disabled account email")
-	}
-
-	// Test valid update using login
-	account, ok := SetPasswordReset(enabledLogin)
-	if !ok {
-		t.Errorf("Account should have been updated using valid account login '%s'", enabledLogin)
-	}
-	if account.ResetPWCode.String == "" {
-		t.Errorf("Account should have reset pw code, but was empty (using login '%s')", enabledLogin)
-	}
-
-	// Test valid update using email
-	old := account.ResetPWCode.String
-	account, ok = SetPasswordReset(enabledEmail)
-	if !ok {
-		t.Errorf("Account should have been updated using valid account email '%s'", enabledEmail)
-	}
-	if account.ResetPWCode.String == "" {
-		t.Errorf("Account should have reset pw code, but was empty (using email '%s')", enabledEmail)
-	}
-	if account.ResetPWCode.String == old {
-		t.Errorf("Account should have new reset pw code, but was unchanged (using email '%s')", enabledEmail)
-	}
-}
-
 func TestAccount_SetPassword(t *testing.T) {
 	acc := &Account{}
 	err := acc.SetPassword("foobar")
@@ -317,7 +234,7 @@ func TestAccount_UpdatePassword(t *testing.T) {
 	}
 }
 
-func TestAccount_UpdateEmail(t *testing.T) {
+func TestCheckEmail(t *testing.T) {
 	InitTestDb(t)
 	const short = "a"
 	const missing = "aaaa"
@@ -328,7 +245,7 @@ func TestAccount_UpdateEmail(t *testing.T) {
 		t.Error("Account does not exist")
 	}
 
-	err := acc.UpdateEmail(short)
+	err := checkEmail(short)
 	if reflect.TypeOf(err).String() != "*util.ValidationError" {
 		t.Errorf("Expected valid e-mail address error but got: '%s', '%s'",
 			reflect.TypeOf(err).String(), err.Error())
@@ -337,7 +254,7 @@ func TestAccount_UpdateEmail(t *testing.T) {
 		t.Errorf("Expected valid e-mail address error but got: '%s'", err.Error())
 	}
 
-	err = acc.UpdateEmail(missing)
+	err = checkEmail(missing)
 	if reflect.TypeOf(err).String() != "*util.ValidationError" {
 		t.Errorf("Expected valid e-mail address error but got: '%s', '%s'",
 			reflect.TypeOf(err).String(), err.Error())
@@ -354,7 +271,7 @@ func TestAccount_UpdateEmail(t *testing.T) {
 	}
 	js := strings.Join(s, "")
 
-	err = acc.UpdateEmail(js)
+	err = checkEmail(js)
 	if reflect.TypeOf(err).String() != "*util.ValidationError" {
 		t.Errorf("Expected e-mail address too long error but got: '%s', '%s'",
 			reflect.TypeOf(err).String(), err.Error())
@@ -363,7 +280,7 @@ func TestAccount_UpdateEmail(t *testing.T) {
 		t.Errorf("Expected e-mail address too long error but got: '%s'", err.Error())
 	}
 
-	err = acc.UpdateEmail(acc.Email)
+	err = checkEmail(acc.Email)
 	if reflect.TypeOf(err).String() != "*util.ValidationError" {
 		t.Errorf("Expected choose different e-mail address error but got: '%s', '%s'",
 			reflect.TypeOf(err).String(), err.Error())
@@ -373,17 +290,10 @@ func TestAccount_UpdateEmail(t *testing.T) {
 		t.Errorf("Expected choose different e-mail address error but got: '%s'", err.Error())
 	}
 
-	err = acc.UpdateEmail(valid)
+	err = checkEmail(valid)
 	if err != nil {
 		t.Errorf("Encountered unexpected error: '%s'", err.Error())
 	}
-	acc, ok = GetAccount(uuidAlice)
-	if !ok {
-		t.Error("Account does not exist")
-	}
-	if acc.Email != valid {
-		t.Errorf("Expected e-mail address to be '%s', but was '%s'", valid, acc.Email)
-	}
 }
 
 func TestAccount_Create(t *testing.T) {
@@ -406,6 +316,9 @@ func TestAccount_Create(t *testing.T) {
 	if check.Login != "theo" {
 		t.Error("Login was expected to be 'theo'")
 	}
+	if check.Language != "en" {
+		t.Errorf("Default language 'en' expected but was '%s'", check.Language)
+	}
 }
 
 func TestAccount_SSHKeys(t *testing.T) {
@@ -434,13 +347,13 @@ func TestAccount_Update(t *testing.T) {
 	newFirstName := "I am actually not Alice"
 	newMiddleName := "and my last name is"
 	newLastName := "Badchild"
-	newResetPWCode := "reset password code"
 	newInstitute := "institute"
 	newDepartment := "department"
 	newCity := "Kierling"
 	newCountry := "Iceland"
 	newEmailPublic := true
 	newAffiliationPublic := true
+	newLanguage := "de"
 
 	acc, ok := GetAccount(uuidAlice)
 	if !ok {
@@ -462,6 +375,7 @@ func TestAccount_Update(t *testing.T) {
 	acc.Country = newCountry
 	acc.IsEmailPublic = newEmailPublic
 	acc.IsAffiliationPublic = newAffiliationPublic
+	acc.Language = newLanguage
 
 	err = acc.Update()
 	if err != nil {
@@ -509,19 +423,16 @@ func TestAccount_Update(t *testing.T) {
 	if acc.IsAffiliationPublic != newAffiliationPublic {
 		t.Error("IsAffiliationPublic was not updated")
 	}
+	if acc.Language != newLanguage {
+		t.Error("Language was not updated")
+	}
 
-	acc.ResetPWCode = sql.NullString{String: newResetPWCode, Valid: true}
+	acc.Language = "../en"
 	err = acc.Update()
-	if err != nil {
-		t.Error(err)
-	}
-	acc, ok = GetAccountByResetPWCode(newResetPWCode)
-	if !ok {
-		t.Error("Password reset code update failed")
-	}
-	if acc.ResetPWCode.String != newResetPWCode {
-		t.Error("Reset password code was not updated")
+	if err == nil {
+		t.Error("Invalid language should not be accepted")
 	}
+	acc.Language = newLanguage
 
 	acc.IsDisabled = true
 	err = acc.Update()
@@ -565,6 +476,168 @@ func TestAccount_RemoveActivationCode(t *testing.T) {
 	}
 }
 
+func TestGetAnyAccountByLogin(t *testing.T) {
+	InitTestDb(t)
+
+	for _, login := range []string{"alice", "inact_log1", "inact_log2", "inact_log4"} {
+		if _, ok := GetAnyAccountByLogin(login); !ok {
+			t.Errorf("Account '%s' expected to exist", login)
+		}
+	}
+	if _, ok := GetAnyAccountByLogin("doesnotexist"); ok {
+		t.Error("Account should not exist")
+	}
+}
+
+func TestAccount_UpdateLogin(t *testing.T) {
+	InitTestDb(t)
+
+	acc, ok := GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+
+	err := acc.UpdateLogin("not valid")
+	if _, ok := err.(*util.ValidationError); !ok {
+		t.Errorf("Expected validation error but got '%v'", err)
+	}
+	err = acc.UpdateLogin("bob")
+	if _, ok := err.(*util.ValidationError); !ok {
+		t.Errorf("Expected validation error but got '%v'", err)
+	}
+
+	err = acc.UpdateLogin("alix")
+	if err != nil {
+		t.Error(err)
+	}
+	if acc.Login != "alix" {
+		t.Errorf("Login expected to be 'alix' but was '%s'", acc.Login)
+	}
+	if _, ok := GetAccountByLogin("alix"); !ok {
+		t.Error("Account expected to exist with the new login")
+	}
+	if _, ok := GetAccountByLogin("alice"); ok {
+		t.Error("Account should not exist with the old login")
+	}
+}
+
+func TestAccount_RenewActivationCode(t *testing.T) {
+	InitTestDb(t)
+
+	acc, ok := GetAnyAccountByLogin("inact_log1")
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+	err := acc.RenewActivationCode()
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := GetAccountByActivationCode("ac_a"); ok {
+		t.Error("Old activation code should be invalid")
+	}
+	if _, ok := GetAccountByActivationCode(acc.ActivationCode.String); !ok {
+		t.Error("New activation code should be valid")
+	}
+
+	// active account
+	acc, ok = GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+	err = acc.RenewActivationCode()
+	if err == nil {
+		t.Error("Error expected for an active account")
+	}
+}
+
+func TestAccount_SetDisabled(t *testing.T) {
+	InitTestDb(t)
+
+	acc, ok := GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+
+	err := acc.SetDisabled(true)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := GetAccount(uuidAlice); ok {
+		t.Error("Disabled account should not be active")
+	}
+	if _, ok := GetAccountDisabled(uuidAlice); !ok {
+		t.Error("Account expected to be disabled")
+	}
+	if len(ListSessionsForAccount(uuidAlice)) != 0 {
+		t.Error("Sessions of a disabled account should be removed")
+	}
+	if _, ok := GetRefreshToken("YYPTDSVZ"); ok {
+		t.Error("Refresh tokens of a disabled account should be removed")
+	}
+
+	err = acc.SetDisabled(false)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := GetAccount(uuidAlice); !ok {
+		t.Error("Enabled account should be active")
+	}
+}
+
+func TestAccount_ForcePasswordReset(t *testing.T) {
+	InitTestDb(t)
+
+	acc, ok := GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+	registerSoftAuthenticator(t, acc)
+
+	reset, err := acc.ForcePasswordReset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, ok = GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+	if acc.VerifyPassword("testtest") {
+		t.Error("Password should be invalidated")
+	}
+	if _, ok := GetAccountByResetCode(reset.Code); !ok {
+		t.Error("Reset code should be valid")
+	}
+	if len(ListSessionsForAccount(uuidAlice)) != 0 {
+		t.Error("Sessions should be removed")
+	}
+	if acc.HasWebAuthn() {
+		t.Error("Security keys should be removed")
+	}
+}
+
+func TestAccount_Delete(t *testing.T) {
+	InitTestDb(t)
+
+	acc, ok := GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+
+	err := acc.Delete()
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := GetAnyAccountByLogin("alice"); ok {
+		t.Error("Account should be removed")
+	}
+	if len(ListClientApprovalsForAccount(uuidAlice)) != 0 {
+		t.Error("Approvals should be removed")
+	}
+	if len(ListSessionsForAccount(uuidAlice)) != 0 {
+		t.Error("Sessions should be removed")
+	}
+}
+
 func TestValidate(t *testing.T) {
 	InitTestDb(t)
 
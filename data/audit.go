@@ -0,0 +1,141 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Types of audit events
+const (
+	AuditLogin             = "login"
+	AuditLoginFailure      = "login_failure"
+	AuditTokenIssued       = "token_issued"
+	AuditTokenRevoked      = "token_revoked"
+	AuditTokenReuse        = "token_reuse"
+	AuditPasswordChange    = "password_change"
+	AuditPasswordReset     = "password_reset"
+	AuditEmailChange       = "email_change"
+	AuditKeyAdd            = "key_add"
+	AuditKeyDelete         = "key_delete"
+	AuditTwoFactorEnrol    = "two_factor_enrol"
+	AuditTwoFactorEnable   = "two_factor_enable"
+	AuditTwoFactorDisable  = "two_factor_disable"
+	AuditSecurityKeyAdd    = "security_key_add"
+	AuditSecurityKeyDelete = "security_key_delete"
+	AuditSessionEnd        = "session_end"
+	AuditApproval          = "approval"
+	AuditApprovalRevoke    = "approval_revoke"
+	AuditAdmin             = "admin"
+)
+
+// Page sizes of audit event listings
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+// AuditEvent records a security relevant event. The actor is the account which caused the
+// event, the target the account affected by it. For events caused by a user both are the same.
+type AuditEvent struct {
+	ID         int64
+	Type       string
+	ActorUUID  sql.NullString
+	TargetUUID sql.NullString
+	ClientUUID sql.NullString
+	IP         string
+	Detail     string
+	CreatedAt  time.Time
+}
+
+// AuditFilter selects audit events. Empty fields are ignored, Account matches events where the
+// account is either actor or target. Limit and Offset are used for pagination.
+type AuditFilter struct {
+	Type       string
+	ActorUUID  string
+	TargetUUID string
+	ClientUUID string
+	Account    string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+// RecordAuditEvent stores a new audit event. Empty UUIDs are stored as NULL.
+func RecordAuditEvent(eventType, ip, actorUUID, targetUUID, clientUUID, detail string) {
+	const q = `INSERT INTO AuditEvents (type, actorUUID, targetUUID, clientUUID, ip, detail, createdAt)
+	           VALUES ($1, $2, $3, $4, $5, $6, now())`
+
+	if len(detail) > 1024 {
+		detail = detail[:1024]
+	}
+	database.MustExec(q, eventType,
+		sql.NullString{String: actorUUID, Valid: actorUUID != ""},
+		sql.NullString{String: targetUUID, Valid: targetUUID != ""},
+		sql.NullString{String: clientUUID, Valid: clientUUID != ""},
+		ip, detail)
+}
+
+// ListAuditEvents returns all audit events matching the filter, latest first.
+func ListAuditEvents(filter *AuditFilter) []AuditEvent {
+	const q = `SELECT * FROM AuditEvents
+	           WHERE ($1 = '' OR type = $1) AND ($2 = '' OR actorUUID = $2) AND ($3 = '' OR targetUUID = $3)
+	             AND ($4 = '' OR clientUUID = $4) AND ($5 = '' OR actorUUID = $5 OR targetUUID = $5)
+	             AND createdAt >= $6 AND createdAt < $7
+	           ORDER BY createdAt DESC, id DESC LIMIT $8 OFFSET $9`
+
+	until := filter.Until
+	if until.IsZero() {
+		until = time.Now().Add(time.Hour)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = auditDefaultLimit
+	}
+	if limit > auditMaxLimit {
+		limit = auditMaxLimit
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	events := make([]AuditEvent, 0)
+	err := database.Select(&events, q, filter.Type, filter.ActorUUID, filter.TargetUUID, filter.ClientUUID,
+		filter.Account, filter.Since, until, limit, offset)
+	if err != nil {
+		panic(err)
+	}
+
+	return events
+}
+
+// MarshalJSON implements Marshaler for AuditEvent.
+func (event *AuditEvent) MarshalJSON() ([]byte, error) {
+	nullable := func(s sql.NullString) *string {
+		if !s.Valid {
+			return nil
+		}
+		return &s.String
+	}
+	return json.Marshal(&struct {
+		ID         int64     `json:"id"`
+		Type       string    `json:"type"`
+		ActorUUID  *string   `json:"actor_uuid"`
+		TargetUUID *string   `json:"target_uuid"`
+		ClientUUID *string   `json:"client_uuid"`
+		IP         string    `json:"ip"`
+		Detail     string    `json:"detail"`
+		CreatedAt  time.Time `json:"created_at"`
+	}{event.ID, event.Type, nullable(event.ActorUUID), nullable(event.TargetUUID), nullable(event.ClientUUID),
+		event.IP, event.Detail, event.CreatedAt})
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/G-Node/gin-auth/util"
+)
+
+func TestListAuditEvents(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	events := ListAuditEvents(&AuditFilter{})
+	if len(events) != 4 {
+		t.Fatalf("Exactly 4 audit events expected but was %d", len(events))
+	}
+	if events[0].CreatedAt.Before(events[len(events)-1].CreatedAt) {
+		t.Error("Latest events expected first")
+	}
+
+	events = ListAuditEvents(&AuditFilter{Type: AuditLogin})
+	if len(events) != 2 {
+		t.Errorf("Exactly 2 login events expected but was %d", len(events))
+	}
+
+	events = ListAuditEvents(&AuditFilter{ActorUUID: uuidBob})
+	if len(events) != 2 {
+		t.Errorf("Exactly 2 events of bob expected but was %d", len(events))
+	}
+
+	events = ListAuditEvents(&AuditFilter{Account: uuidAlice})
+	if len(events) != 3 {
+		t.Errorf("Exactly 3 events concerning alice expected but was %d", len(events))
+	}
+
+	events = ListAuditEvents(&AuditFilter{Since: time.Now().Add(-time.Hour)})
+	if len(events) != 2 {
+		t.Errorf("Exactly 2 recent events expected but was %d", len(events))
+	}
+
+	events = ListAuditEvents(&AuditFilter{Until: time.Now().Add(-time.Hour)})
+	if len(events) != 2 {
+		t.Errorf("Exactly 2 old events expected but was %d", len(events))
+	}
+
+	first := ListAuditEvents(&AuditFilter{Limit: 3})
+	second := ListAuditEvents(&AuditFilter{Limit: 3, Offset: 3})
+	if len(first) != 3 || len(second) != 1 {
+		t.Fatalf("Pages with 3 and 1 events expected but were %d and %d", len(first), len(second))
+	}
+	if second[0].ID == first[2].ID {
+		t.Error("Pages should not overlap")
+	}
+}
+
+func TestRecordAuditEvent(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	RecordAuditEvent(AuditKeyAdd, testIP, uuidAlice, uuidAlice, "", "SHA256:foo")
+
+	events := ListAuditEvents(&AuditFilter{Type: AuditKeyAdd})
+	if len(events) != 1 {
+		t.Fatalf("Exactly one event expected but was %d", len(events))
+	}
+	event := events[0]
+	if event.ActorUUID.String != uuidAlice || event.TargetUUID.String != uuidAlice {
+		t.Error("Actor and target expected to be alice")
+	}
+	if event.ClientUUID.Valid {
+		t.Error("Client expected to be NULL")
+	}
+	if event.IP != testIP || event.Detail != "SHA256:foo" {
+		t.Errorf("Unexpected event '%v'", event)
+	}
+}
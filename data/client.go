@@ -10,28 +10,66 @@ package data
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/G-Node/gin-auth/conf"
 	"github.com/G-Node/gin-auth/util"
 	"github.com/jmoiron/sqlx"
 	"github.com/pborman/uuid"
 	"gopkg.in/yaml.v2"
 )
 
+// Sources by which clients are managed. Clients managed by the file are defined in clients.yml
+// and synced at startup, clients managed by the API are created and changed at runtime. Clients
+// managed by registration were registered dynamically and can manage their own registration.
+const (
+	ClientManagedFile         = "file"
+	ClientManagedAPI          = "api"
+	ClientManagedRegistration = "registration"
+)
+
+// DeviceCodeGrantType is the grant type of the device authorization grant (RFC 8628).
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// GrantTypes contains all grant types a client can be allowed to use. All of them are used at
+// the token endpoint except "implicit", which is issued by the authorization endpoint. Clients
+// without configured grant types may use all of them.
+var GrantTypes = util.NewStringSet("authorization_code", "implicit", "refresh_token", "password", "client_credentials",
+	DeviceCodeGrantType)
+
+// responseGrantTypes maps the response types of grant requests to the respective grant types.
+var responseGrantTypes = map[string]string{
+	"code":   "authorization_code",
+	"token":  "implicit",
+	"owner":  "password",
+	"client": "client_credentials",
+}
+
 // Client object stored in the database
 type Client struct {
-	UUID             string
-	Name             string
-	Secret           string
-	ScopeProvidedMap map[string]string
-	ScopeWhitelist   util.StringSet
-	ScopeBlacklist   util.StringSet
-	RedirectURIs     util.StringSet
-	CreatedAt        time.Time
-	UpdatedAt        time.Time
+	UUID              string
+	Name              string
+	DisplayName       string
+	Secret            string // stored as keyed hash
+	ScopeProvidedMap  map[string]string
+	ScopeWhitelist    util.StringSet
+	ScopeBlacklist    util.StringSet
+	ScopeRegistered   util.StringSet
+	RedirectURIs      util.StringSet
+	RequirePKCE       bool
+	TokenFormat       string
+	GrantTypes        util.StringSet
+	ManagedBy         string
+	RegistrationToken sql.NullString // stored as keyed hash
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
 }
 
 // ListClients returns all registered OAuth clients ordered by name
@@ -75,11 +113,11 @@ func GetClientByName(name string) (*Client, bool) {
 	return getClient(q, name)
 }
 
-func getClient(q, parameter string) (*Client, bool) {
+func getClient(q string, args ...interface{}) (*Client, bool) {
 	const qScope = `SELECT name, description FROM ClientScopeProvided WHERE clientUUID = $1`
 
 	client := &Client{ScopeProvidedMap: make(map[string]string)}
-	err := database.Get(client, q, parameter)
+	err := database.Get(client, q, args...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, false
@@ -163,6 +201,64 @@ func (client *Client) ScopeProvided() util.StringSet {
 	return util.NewStringSet(scope...)
 }
 
+// IsPublic returns true if the client has no secret and is therefore not able
+// to authenticate itself (e.g. native or single-page applications).
+func (client *Client) IsPublic() bool {
+	return client.Secret == ""
+}
+
+// VerifySecret checks in constant time whether a secret presented by the client matches the
+// stored hash of the client secret. Public clients only match an empty secret.
+func (client *Client) VerifySecret(secret string) bool {
+	if client.IsPublic() {
+		return secret == ""
+	}
+	return compareToken(secret, client.Secret)
+}
+
+// RequiresPKCE returns true if authorization code requests of this client must
+// provide a PKCE code challenge. This is always the case for public clients.
+func (client *Client) RequiresPKCE() bool {
+	return client.RequirePKCE || client.IsPublic()
+}
+
+// IssuesJWT returns true if access tokens issued to this client are signed JWTs
+// instead of opaque tokens.
+func (client *Client) IssuesJWT() bool {
+	return client.TokenFormat == "jwt"
+}
+
+// AllowsGrantType returns true if the client may use the given grant type.
+func (client *Client) AllowsGrantType(grantType string) bool {
+	return client.GrantTypes.Contains(grantType)
+}
+
+// Title returns the name of the client shown to users, which is the display name of
+// dynamically registered clients and the client name otherwise.
+func (client *Client) Title() string {
+	if client.DisplayName != "" {
+		return client.DisplayName
+	}
+	return client.Name
+}
+
+// AllowsScope returns true if the client may request the given scope. Dynamically registered
+// clients are limited to the scope of their registration as far as it is still allowed for
+// registered clients by the configuration. Blacklisted scopes are checked separately.
+func (client *Client) AllowsScope(scope util.StringSet) bool {
+	if client.ManagedBy != ClientManagedRegistration {
+		return true
+	}
+	allowed := util.NewStringSet(conf.GetRegistrationConfig().Scope...)
+	return client.ScopeRegistered.Intersect(allowed).IsSuperset(scope)
+}
+
+// IsFileManaged returns true if the client is defined in the clients configuration file.
+// Such clients are overwritten at startup and can therefore not be changed via the client API.
+func (client *Client) IsFileManaged() bool {
+	return client.ManagedBy == ClientManagedFile
+}
+
 // ApprovalForAccount gets a client approval for this client which was
 // approved for a specific account.
 func (client *Client) ApprovalForAccount(accountUUID string) (*ClientApproval, bool) {
@@ -186,6 +282,9 @@ func (client *Client) Approve(accountUUID string, scope util.StringSet) (err err
 	if scope.Intersect(client.ScopeBlacklist).Len() > 0 {
 		return errors.New("Blacklisted scope")
 	}
+	if !client.AllowsScope(scope) {
+		return errors.New("Scope not registered")
+	}
 
 	scope = scope.Difference(client.ScopeWhitelist)
 	if scope.Len() == 0 {
@@ -215,21 +314,39 @@ func (client *Client) Approve(accountUUID string, scope util.StringSet) (err err
 // grant request for this client. Grant types are defined by RFC6749 "OAuth 2.0 Authorization Framework"
 // Supported grant types are: "code" (authorization code), "token" (implicit request),
 // "owner" (resource owner password credentials), "client" (client credentials)
-func (client *Client) CreateGrantRequest(responseType, redirectURI, state string, scope util.StringSet) (*GrantRequest, error) {
-	if !(responseType == "code" || responseType == "token" || responseType == "owner" || responseType == "client") {
-		return nil, errors.New("Response type expected to be one of the following: 'code', 'token', 'owner', 'client'")
-	}
+// The respective grant type must be allowed for the client.
+// A code challenge and method as defined by RFC7636 (PKCE) may be given for "code" requests. For
+// clients that require PKCE the code challenge is mandatory. Supported methods are "S256" and "plain",
+// if no method is given "plain" is assumed.
+// The redirect URI is validated first. All further errors are of the type OAuthError, such that they
+// can be redirected to the client.
+func (client *Client) CreateGrantRequest(responseType, redirectURI, state string, scope util.StringSet,
+	challenge, challengeMethod string) (*GrantRequest, error) {
 	if !client.RedirectURIs.Contains(redirectURI) {
 		return nil, fmt.Errorf("Redirect URI invalid: '%s'", redirectURI)
 	}
+	if responseType == "" {
+		return nil, &OAuthError{OAuthInvalidRequest, "Missing response type"}
+	}
+	if !(responseType == "code" || responseType == "token" || responseType == "owner" || responseType == "client") {
+		return nil, &OAuthError{OAuthUnsupportedResponseType,
+			"Response type expected to be one of the following: 'code', 'token', 'owner', 'client'"}
+	}
+	if !client.AllowsGrantType(responseGrantTypes[responseType]) {
+		return nil, &OAuthError{OAuthUnauthorizedClient,
+			fmt.Sprintf("Response type '%s' is not allowed for this client", responseType)}
+	}
 	if !CheckScope(scope) {
-		return nil, errors.New("Invalid scope")
+		return nil, &OAuthError{OAuthInvalidScope, "Invalid scope"}
 	}
 	if scope.Intersect(client.ScopeBlacklist).Len() > 0 {
-		return nil, errors.New("Blacklisted scope")
+		return nil, &OAuthError{OAuthInvalidScope, "Blacklisted scope"}
+	}
+	if !client.AllowsScope(scope) {
+		return nil, &OAuthError{OAuthInvalidScope, "Scope not registered"}
 	}
 	if state == "" {
-		return nil, errors.New("Missing client state")
+		return nil, &OAuthError{OAuthInvalidRequest, "Missing client state"}
 	}
 
 	request := &GrantRequest{
@@ -238,6 +355,29 @@ func (client *Client) CreateGrantRequest(responseType, redirectURI, state string
 		State:          state,
 		ScopeRequested: scope,
 		ClientUUID:     client.UUID}
+
+	if challenge != "" {
+		if responseType != "code" {
+			return nil, &OAuthError{OAuthInvalidRequest, "Code challenge is only supported for response type 'code'"}
+		}
+		if challengeMethod == "" {
+			challengeMethod = "plain"
+		}
+		if !(challengeMethod == "S256" || challengeMethod == "plain") {
+			return nil, &OAuthError{OAuthInvalidRequest,
+				"Code challenge method expected to be one of the following: 'S256', 'plain'"}
+		}
+		if !pkceRegex.MatchString(challenge) {
+			return nil, &OAuthError{OAuthInvalidRequest, "Invalid code challenge"}
+		}
+		request.CodeChallenge = sql.NullString{String: challenge, Valid: true}
+		request.CodeChallengeMethod = sql.NullString{String: challengeMethod, Valid: true}
+	} else if challengeMethod != "" {
+		return nil, &OAuthError{OAuthInvalidRequest, "Missing code challenge"}
+	} else if responseType == "code" && client.RequiresPKCE() {
+		return nil, &OAuthError{OAuthInvalidRequest, "Code challenge required"}
+	}
+
 	err := request.Create()
 
 	return request, err
@@ -254,8 +394,10 @@ func (client *Client) delete(tx *sqlx.Tx) error {
 
 // create stores a new client in the database.
 func (client *Client) create(tx *sqlx.Tx) error {
-	const q = `INSERT INTO Clients (uuid, name, secret, scopeWhitelist, scopeBlacklist, redirectURIs, createdAt, updatedAt)
-	           VALUES ($1, $2, $3, $4, $5, $6, now(), now())
+	const q = `INSERT INTO Clients (uuid, name, secret, scopeWhitelist, scopeBlacklist, redirectURIs, requirePKCE,
+	                                tokenFormat, grantTypes, managedBy, registrationToken, displayName,
+	                                scopeRegistered, createdAt, updatedAt)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, now(), now())
 	           RETURNING *`
 	const qScope = `INSERT INTO ClientScopeProvided (clientUUID, name, description)
 	                VALUES ($1, $2, $3)`
@@ -263,9 +405,19 @@ func (client *Client) create(tx *sqlx.Tx) error {
 	if client.UUID == "" {
 		client.UUID = uuid.NewRandom().String()
 	}
+	if client.TokenFormat == "" {
+		client.TokenFormat = "opaque"
+	}
+	if client.GrantTypes.Len() == 0 {
+		client.GrantTypes = util.NewStringSet(GrantTypes.Strings()...)
+	}
+	if client.ManagedBy == "" {
+		client.ManagedBy = ClientManagedFile
+	}
 
-	err := tx.Get(client, q, client.UUID, client.Name, client.Secret, client.ScopeWhitelist,
-		client.ScopeBlacklist, client.RedirectURIs)
+	err := tx.Get(client, q, client.UUID, client.Name, storedToken(client.Secret), client.ScopeWhitelist,
+		client.ScopeBlacklist, client.RedirectURIs, client.RequirePKCE, client.TokenFormat, client.GrantTypes,
+		client.ManagedBy, storedNullToken(client.RegistrationToken), client.DisplayName, client.ScopeRegistered)
 	if err == nil {
 		for k, v := range client.ScopeProvidedMap {
 			_, err = tx.Exec(qScope, client.UUID, k, v)
@@ -306,16 +458,28 @@ func (client *Client) createScope(tx *sqlx.Tx) error {
 // updates all client database fields and adds new scopes with data from this Client.
 func (client *Client) update(tx *sqlx.Tx) error {
 	const q = `UPDATE Clients
-	           SET name=$2, secret=$3, scopeWhitelist=$4, scopeBlacklist=$5, redirectURIs=$6, updatedAt=now()
+	           SET name=$2, secret=$3, scopeWhitelist=$4, scopeBlacklist=$5, redirectURIs=$6, requirePKCE=$7,
+	               tokenFormat=$8, grantTypes=$9, managedBy=$10, displayName=$11, scopeRegistered=$12, updatedAt=now()
 	           WHERE uuid=$1`
 
+	if client.TokenFormat == "" {
+		client.TokenFormat = "opaque"
+	}
+	if client.GrantTypes.Len() == 0 {
+		client.GrantTypes = util.NewStringSet(GrantTypes.Strings()...)
+	}
+	if client.ManagedBy == "" {
+		client.ManagedBy = ClientManagedFile
+	}
+
 	err := client.deleteScope(tx)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(q, client.UUID, client.Name, client.Secret, client.ScopeWhitelist,
-		client.ScopeBlacklist, client.RedirectURIs)
+	_, err = tx.Exec(q, client.UUID, client.Name, storedToken(client.Secret), client.ScopeWhitelist,
+		client.ScopeBlacklist, client.RedirectURIs, client.RequirePKCE, client.TokenFormat, client.GrantTypes,
+		client.ManagedBy, client.DisplayName, client.ScopeRegistered)
 	if err != nil {
 		return err
 	}
@@ -327,6 +491,227 @@ func (client *Client) update(tx *sqlx.Tx) error {
 	return err
 }
 
+var (
+	clientNameRegex = regexp.MustCompile(`^[a-zA-Z0-9\-_.]{2,512}$`)
+	scopeNameRegex  = regexp.MustCompile(`^[a-zA-Z0-9\-_.:]{1,512}$`)
+)
+
+// Validate checks a client that is created or changed via the client API. The name must be unique,
+// scopes provided by the client must not be provided by other clients and whitelisted or blacklisted
+// scopes must be provided by some client. Redirect URIs must be absolute URLs without fragment.
+func (client *Client) Validate() *util.ValidationError {
+	const qName = `SELECT COUNT(*) FROM Clients WHERE name=$1 AND uuid<>$2`
+	const qScope = `SELECT name FROM ClientScopeProvided WHERE clientUUID<>$1`
+
+	valErr := &util.ValidationError{FieldErrors: make(map[string]string)}
+
+	if !clientNameRegex.MatchString(client.Name) {
+		valErr.FieldErrors["name"] = "Please use 2 to 512 of the following characters: 'a-zA-Z0-9-_.'"
+	} else {
+		var count int
+		err := database.Get(&count, qName, client.Name, client.UUID)
+		if err != nil {
+			panic(err)
+		}
+		if count > 0 {
+			valErr.FieldErrors["name"] = "Please choose a different name"
+		}
+	}
+
+	names := []string{}
+	err := database.Select(&names, qScope, client.UUID)
+	if err != nil {
+		panic(err)
+	}
+	otherScope := util.NewStringSet(names...)
+
+	for name, description := range client.ScopeProvidedMap {
+		if !scopeNameRegex.MatchString(name) {
+			valErr.FieldErrors["scope_provided"] = fmt.Sprintf("Invalid scope name '%s'", name)
+		} else if otherScope.Contains(name) {
+			valErr.FieldErrors["scope_provided"] = fmt.Sprintf("Scope '%s' is provided by another client", name)
+		} else if description == "" || len(description) > 1024 {
+			valErr.FieldErrors["scope_provided"] = fmt.Sprintf("Please add a short description for scope '%s'", name)
+		}
+	}
+
+	known := otherScope.Union(client.ScopeProvided())
+	if !known.IsSuperset(client.ScopeWhitelist) {
+		valErr.FieldErrors["scope_whitelist"] = "Only provided scopes can be whitelisted"
+	}
+	if !known.IsSuperset(client.ScopeBlacklist) {
+		valErr.FieldErrors["scope_blacklist"] = "Only provided scopes can be blacklisted"
+	} else if client.ScopeWhitelist.Intersect(client.ScopeBlacklist).Len() > 0 {
+		valErr.FieldErrors["scope_blacklist"] = "Scopes can not be whitelisted and blacklisted at the same time"
+	}
+
+	for uri := range client.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+			valErr.FieldErrors["redirect_uris"] = fmt.Sprintf("Invalid redirect URI '%s'", uri)
+		}
+	}
+
+	if !GrantTypes.IsSuperset(client.GrantTypes) {
+		valErr.FieldErrors["grant_types"] = "Grant types expected to be any of the following: " +
+			strings.Join(GrantTypes.Strings(), ", ")
+	}
+
+	if !(client.TokenFormat == "" || client.TokenFormat == "opaque" || client.TokenFormat == "jwt") {
+		valErr.FieldErrors["token_format"] = "Token format expected to be one of the following: 'opaque', 'jwt'"
+	}
+
+	if len(valErr.FieldErrors) > 0 {
+		valErr.Message = "Client requirements are not met"
+	}
+
+	return valErr
+}
+
+// Create stores a new client that is managed via the client API. If the UUID is empty a
+// new random UUID is created. The secret is expected in plain text, only its hash is stored.
+func (client *Client) Create() error {
+	client.ManagedBy = ClientManagedAPI
+
+	tx := database.MustBegin()
+	err := client.create(tx)
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Update stores all changes of the client including the provided scope.
+func (client *Client) Update() error {
+	tx := database.MustBegin()
+	err := client.update(tx)
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RotateSecret replaces the secret of a confidential client by a new random secret, which is
+// returned in plain text. The previous secret is invalid immediately.
+func (client *Client) RotateSecret() (string, error) {
+	const q = `UPDATE Clients SET (secret, updatedAt) = ($2, now()) WHERE uuid=$1
+	           RETURNING *`
+
+	if client.IsPublic() {
+		return "", errors.New("Public clients have no secret")
+	}
+
+	secret := util.RandomToken()
+	err := database.Get(client, q, client.UUID, storedToken(secret))
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// Delete removes the client from the database. Approvals, grant requests and tokens
+// of the client are removed as well.
+func (client *Client) Delete() error {
+	const q = `DELETE FROM Clients WHERE uuid=$1`
+
+	_, err := database.Exec(q, client.UUID)
+	return err
+}
+
+// ClientMarshaler handles JSON marshalling for Client. The secret is only serialized
+// if Secret contains the plain text secret, i.e. after the secret was created.
+type ClientMarshaler struct {
+	Client *Client
+	Secret string
+}
+
+// MarshalJSON implements Marshaler for ClientMarshaler
+func (cm *ClientMarshaler) MarshalJSON() ([]byte, error) {
+	scopeProvided := cm.Client.ScopeProvidedMap
+	if scopeProvided == nil {
+		scopeProvided = make(map[string]string)
+	}
+	return json.Marshal(&struct {
+		URL            string            `json:"url"`
+		UUID           string            `json:"uuid"`
+		Name           string            `json:"name"`
+		Secret         string            `json:"secret,omitempty"`
+		Public         bool              `json:"public"`
+		ManagedBy      string            `json:"managed_by"`
+		ScopeProvided  map[string]string `json:"scope_provided"`
+		ScopeWhitelist []string          `json:"scope_whitelist"`
+		ScopeBlacklist []string          `json:"scope_blacklist"`
+		RedirectURIs   []string          `json:"redirect_uris"`
+		RequirePKCE    bool              `json:"require_pkce"`
+		TokenFormat    string            `json:"token_format"`
+		GrantTypes     []string          `json:"grant_types"`
+		CreatedAt      time.Time         `json:"created_at"`
+		UpdatedAt      time.Time         `json:"updated_at"`
+	}{
+		URL:            conf.MakeUrl("/api/clients/%s", cm.Client.UUID),
+		UUID:           cm.Client.UUID,
+		Name:           cm.Client.Name,
+		Secret:         cm.Secret,
+		Public:         cm.Client.IsPublic(),
+		ManagedBy:      cm.Client.ManagedBy,
+		ScopeProvided:  scopeProvided,
+		ScopeWhitelist: cm.Client.ScopeWhitelist.Strings(),
+		ScopeBlacklist: cm.Client.ScopeBlacklist.Strings(),
+		RedirectURIs:   cm.Client.RedirectURIs.Strings(),
+		RequirePKCE:    cm.Client.RequirePKCE,
+		TokenFormat:    cm.Client.TokenFormat,
+		GrantTypes:     cm.Client.GrantTypes.Strings(),
+		CreatedAt:      cm.Client.CreatedAt,
+		UpdatedAt:      cm.Client.UpdatedAt,
+	})
+}
+
+// UnmarshalJSON implements Unmarshaler for Client.
+// Only parses fields that can be changed via the client API: Name, ScopeProvidedMap, ScopeWhitelist,
+// ScopeBlacklist, RedirectURIs, RequirePKCE, TokenFormat and GrantTypes. Missing fields are reset,
+// clients without grant types may use all grant types.
+func (client *Client) UnmarshalJSON(bytes []byte) error {
+	jsonData := &struct {
+		Name           string            `json:"name"`
+		ScopeProvided  map[string]string `json:"scope_provided"`
+		ScopeWhitelist []string          `json:"scope_whitelist"`
+		ScopeBlacklist []string          `json:"scope_blacklist"`
+		RedirectURIs   []string          `json:"redirect_uris"`
+		RequirePKCE    bool              `json:"require_pkce"`
+		TokenFormat    string            `json:"token_format"`
+		GrantTypes     []string          `json:"grant_types"`
+	}{}
+	err := json.Unmarshal(bytes, jsonData)
+	if err != nil {
+		return err
+	}
+
+	client.Name = jsonData.Name
+	client.ScopeProvidedMap = jsonData.ScopeProvided
+	if client.ScopeProvidedMap == nil {
+		client.ScopeProvidedMap = make(map[string]string)
+	}
+	client.ScopeWhitelist = util.NewStringSet(jsonData.ScopeWhitelist...)
+	client.ScopeBlacklist = util.NewStringSet(jsonData.ScopeBlacklist...)
+	client.RedirectURIs = util.NewStringSet(jsonData.RedirectURIs...)
+	client.RequirePKCE = jsonData.RequirePKCE
+	client.TokenFormat = jsonData.TokenFormat
+	client.GrantTypes = util.NewStringSet(jsonData.GrantTypes...)
+
+	return nil
+}
+
 // InitClients loads client information from a yaml configuration file
 // and updates the corresponding entries in the database.
 func InitClients(path string) {
@@ -344,6 +729,9 @@ func InitClients(path string) {
 		ScopeWhitelist []string          `yaml:"ScopeWhitelist"`
 		ScopeBlacklist []string          `yaml:"ScopeBlacklist"`
 		RedirectURIs   []string          `yaml:"RedirectURIs"`
+		RequirePKCE    bool              `yaml:"RequirePKCE"`
+		TokenFormat    string            `yaml:"TokenFormat"`
+		GrantTypes     []string          `yaml:"GrantTypes"`
 	}, 0)
 
 	err = yaml.Unmarshal(content, &confClients)
@@ -360,13 +748,18 @@ func InitClients(path string) {
 		clients[i].ScopeWhitelist = util.NewStringSet(cl.ScopeWhitelist...)
 		clients[i].ScopeBlacklist = util.NewStringSet(cl.ScopeBlacklist...)
 		clients[i].RedirectURIs = util.NewStringSet(cl.RedirectURIs...)
+		clients[i].RequirePKCE = cl.RequirePKCE
+		clients[i].TokenFormat = cl.TokenFormat
+		clients[i].GrantTypes = util.NewStringSet(cl.GrantTypes...)
 	}
 
 	updateClients(clients)
 }
 
 // updateDatabase updates the clients and clientScopeProvided tables
-// with the contents of []Client.
+// with the contents of []Client. Clients which are no longer present in the file are
+// removed unless they are managed by the client API. Clients present in the file are
+// always managed by the file, even if they were created via the API before.
 func updateClients(confClients []Client) {
 	clientIDs := make([]string, len(confClients), len(confClients))
 	for i, v := range confClients {
@@ -383,7 +776,7 @@ func updateClients(confClients []Client) {
 	if len(removeDbClients) > 0 {
 		for remID := range removeDbClients {
 			remClient, clientExists := GetClient(remID)
-			if clientExists {
+			if clientExists && remClient.IsFileManaged() {
 				err = remClient.delete(tx)
 				if err != nil {
 					break
@@ -393,6 +786,7 @@ func updateClients(confClients []Client) {
 	}
 
 	for _, cl := range confClients {
+		cl.ManagedBy = ClientManagedFile
 		if dbClientIDs.Contains(cl.UUID) {
 			err = cl.update(tx)
 		} else {
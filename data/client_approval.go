@@ -10,9 +10,13 @@ package data
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
 	"github.com/G-Node/gin-auth/util"
 	"github.com/pborman/uuid"
-	"time"
 )
 
 // ClientApproval contains information about scopes a user has already
@@ -41,6 +45,19 @@ func ListClientApprovals() []ClientApproval {
 	return approvals
 }
 
+// ListClientApprovalsForAccount returns all client approvals of an account ordered by creation time.
+func ListClientApprovalsForAccount(accountUUID string) []ClientApproval {
+	const q = `SELECT * FROM ClientApprovals WHERE accountUUID=$1 ORDER BY createdAt`
+
+	approvals := make([]ClientApproval, 0)
+	err := database.Select(&approvals, q, accountUUID)
+	if err != nil {
+		panic(err)
+	}
+
+	return approvals
+}
+
 // GetClientApproval retrieves an approval with a given UUID.
 // Returns false if no matching approval exists.
 func GetClientApproval(uuid string) (*ClientApproval, bool) {
@@ -87,3 +104,73 @@ func (app *ClientApproval) Delete() error {
 	_, err := database.Exec(q, app.UUID)
 	return err
 }
+
+// Client returns the client associated with the approval.
+func (app *ClientApproval) Client() *Client {
+	client, ok := GetClient(app.ClientUUID)
+	if !ok {
+		panic("Unable to retrieve client for approval")
+	}
+	return client
+}
+
+// Revoke removes an approval together with all access tokens, refresh tokens and pending grant
+// requests the client holds for the account of the approval.
+func (app *ClientApproval) Revoke() error {
+	const (
+		qRequests = `DELETE FROM GrantRequests WHERE clientUUID=$1 AND accountUUID=$2`
+		qAccess   = `DELETE FROM AccessTokens WHERE clientUUID=$1 AND accountUUID=$2`
+		qRefresh  = `DELETE FROM RefreshTokens WHERE clientUUID=$1 AND accountUUID=$2`
+		qApproval = `DELETE FROM ClientApprovals WHERE uuid=$1`
+	)
+
+	tx := database.MustBegin()
+	_, err := tx.Exec(qRequests, app.ClientUUID, app.AccountUUID)
+	if err == nil {
+		_, err = tx.Exec(qAccess, app.ClientUUID, app.AccountUUID)
+	}
+	if err == nil {
+		_, err = tx.Exec(qRefresh, app.ClientUUID, app.AccountUUID)
+	}
+	if err == nil {
+		_, err = tx.Exec(qApproval, app.UUID)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ClientApprovalMarshaler wraps a ClientApproval together with its Client and Account to
+// provide all information needed to marshal an approval.
+type ClientApprovalMarshaler struct {
+	Approval *ClientApproval
+	Client   *Client
+	Account  *Account
+}
+
+// MarshalJSON implements Marshaler for ClientApprovalMarshaler
+func (am *ClientApprovalMarshaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		URL        string    `json:"url"`
+		UUID       string    `json:"uuid"`
+		ClientID   string    `json:"client_id"`
+		ClientUUID string    `json:"client_uuid"`
+		Scope      []string  `json:"scope"`
+		CreatedAt  time.Time `json:"created_at"`
+		UpdatedAt  time.Time `json:"updated_at"`
+	}{
+		URL:        conf.MakeUrl("/api/accounts/%s/approvals/%s", am.Account.Login, am.Approval.UUID),
+		UUID:       am.Approval.UUID,
+		ClientID:   am.Client.Name,
+		ClientUUID: am.Client.UUID,
+		Scope:      am.Approval.Scope.Strings(),
+		CreatedAt:  am.Approval.CreatedAt,
+		UpdatedAt:  am.Approval.UpdatedAt,
+	})
+}
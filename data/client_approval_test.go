@@ -28,6 +28,21 @@ func TestListClientApprovals(t *testing.T) {
 	}
 }
 
+func TestListClientApprovalsForAccount(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	approvals := ListClientApprovalsForAccount(uuidAlice)
+	if len(approvals) != 2 {
+		t.Errorf("Two approvals expected but was %d", len(approvals))
+	}
+
+	approvals = ListClientApprovalsForAccount(uuidBob)
+	if len(approvals) != 0 {
+		t.Errorf("No approvals expected but was %d", len(approvals))
+	}
+}
+
 func TestGetClientApproval(t *testing.T) {
 	defer util.FailOnPanic(t)
 	InitTestDb(t)
@@ -123,3 +138,35 @@ func TestClientApprovalDelete(t *testing.T) {
 		t.Error("Approval should not exist")
 	}
 }
+
+func TestClientApprovalRevoke(t *testing.T) {
+	InitTestDb(t)
+
+	app, ok := GetClientApproval(approvalUuidAlice)
+	if !ok {
+		t.Fatal("Approval does not exist")
+	}
+
+	err := app.Revoke()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, ok = GetClientApproval(approvalUuidAlice); ok {
+		t.Error("Approval should not exist")
+	}
+	if _, ok = GetAccessToken(accessTokenAlice); ok {
+		t.Error("Access token should not exist")
+	}
+	if _, ok = GetRefreshToken(refreshTokenAlice); ok {
+		t.Error("Refresh token should not exist")
+	}
+	if _, ok = GetGrantRequest(grantReqTokenAlice); ok {
+		t.Error("Grant request should not exist")
+	}
+
+	// tokens of other accounts are not affected
+	if _, ok = GetRefreshToken("4FKJVX3K"); !ok {
+		t.Error("Refresh token of bob should still exist")
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
+	"github.com/pborman/uuid"
+)
+
+// Error codes for invalid client metadata as defined by RFC 7591
+const (
+	RegistrationInvalidRedirectURI = "invalid_redirect_uri"
+	RegistrationInvalidMetadata    = "invalid_client_metadata"
+)
+
+// Grant types, response types and authentication methods registered clients may use
+var (
+	registrationGrantTypes    = util.NewStringSet("authorization_code", "implicit", "refresh_token")
+	registrationResponseTypes = util.NewStringSet("code", "token")
+	registrationAuthMethods   = util.NewStringSet("client_secret_basic", "client_secret_post", "none")
+)
+
+var clientNameSlugRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ClientMetadata contains the metadata of a dynamically registered client as defined by RFC 7591.
+// Response types are derived from the grant types of the client.
+type ClientMetadata struct {
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	Scope                   string   `json:"scope"`
+}
+
+// RegistrationError is returned if the metadata of a client registration is invalid.
+// Code is one of the error codes defined by RFC 7591.
+type RegistrationError struct {
+	Code        string
+	Description string
+}
+
+// Error implements Go error
+func (err *RegistrationError) Error() string {
+	return err.Description
+}
+
+// check validates the metadata and sets defaults for missing values.
+func (meta *ClientMetadata) check() error {
+	meta.ClientName = strings.TrimSpace(meta.ClientName)
+	if len(meta.ClientName) > 512 {
+		return &RegistrationError{RegistrationInvalidMetadata, "Client name is too long"}
+	}
+
+	if meta.TokenEndpointAuthMethod == "" {
+		meta.TokenEndpointAuthMethod = "client_secret_basic"
+	}
+	if !registrationAuthMethods.Contains(meta.TokenEndpointAuthMethod) {
+		return &RegistrationError{RegistrationInvalidMetadata,
+			fmt.Sprintf("Unsupported token endpoint authentication method '%s'", meta.TokenEndpointAuthMethod)}
+	}
+
+	if len(meta.GrantTypes) == 0 {
+		meta.GrantTypes = []string{"authorization_code"}
+	}
+	grantTypes := util.NewStringSet(meta.GrantTypes...)
+	if !registrationGrantTypes.IsSuperset(grantTypes) {
+		return &RegistrationError{RegistrationInvalidMetadata, "Unsupported grant type"}
+	}
+
+	if len(meta.ResponseTypes) == 0 {
+		meta.ResponseTypes = make([]string, 0, 2)
+		if grantTypes.Contains("authorization_code") {
+			meta.ResponseTypes = append(meta.ResponseTypes, "code")
+		}
+		if grantTypes.Contains("implicit") {
+			meta.ResponseTypes = append(meta.ResponseTypes, "token")
+		}
+	}
+	responseTypes := util.NewStringSet(meta.ResponseTypes...)
+	if !registrationResponseTypes.IsSuperset(responseTypes) ||
+		responseTypes.Contains("code") != grantTypes.Contains("authorization_code") ||
+		responseTypes.Contains("token") != grantTypes.Contains("implicit") {
+		return &RegistrationError{RegistrationInvalidMetadata, "Response types do not match grant types"}
+	}
+
+	if responseTypes.Len() > 0 && len(meta.RedirectURIs) == 0 {
+		return &RegistrationError{RegistrationInvalidRedirectURI, "Redirect URIs are required"}
+	}
+
+	allowed := util.NewStringSet(conf.GetRegistrationConfig().Scope...)
+	if meta.Scope == "" {
+		meta.Scope = strings.Join(allowed.Strings(), " ")
+	}
+	scope := util.NewStringSet(strings.Fields(meta.Scope)...)
+	if !allowed.IsSuperset(scope) || !CheckScope(scope) {
+		return &RegistrationError{RegistrationInvalidMetadata, "Invalid scope"}
+	}
+
+	return nil
+}
+
+// apply sets the fields of a client according to the metadata. The client name is kept as display
+// name of the client and the scope is stored as registered scope. Validates the resulting client.
+func (meta *ClientMetadata) apply(client *Client) error {
+	err := meta.check()
+	if err != nil {
+		return err
+	}
+
+	client.DisplayName = meta.ClientName
+	client.RedirectURIs = util.NewStringSet(meta.RedirectURIs...)
+	client.ScopeProvidedMap = make(map[string]string)
+	client.ScopeWhitelist = util.NewStringSet()
+	client.ScopeBlacklist = util.NewStringSet()
+	client.ScopeRegistered = util.NewStringSet(strings.Fields(meta.Scope)...)
+	client.RequirePKCE = meta.TokenEndpointAuthMethod == "none"
+	client.TokenFormat = "opaque"
+	client.GrantTypes = util.NewStringSet(meta.GrantTypes...)
+
+	valErr := client.Validate()
+	if msg, ok := valErr.FieldErrors["redirect_uris"]; ok {
+		return &RegistrationError{RegistrationInvalidRedirectURI, msg}
+	}
+	if len(valErr.FieldErrors) > 0 {
+		return &RegistrationError{RegistrationInvalidMetadata, valErr.Message}
+	}
+
+	return nil
+}
+
+// clientIDFromName creates a unique client id (the name of the client) from a client name.
+func clientIDFromName(name string) string {
+	slug := strings.Trim(clientNameSlugRegex.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(slug) > 64 {
+		slug = slug[:64]
+	}
+	if slug == "" {
+		slug = "client"
+	}
+	return slug + "-" + strings.ToLower(util.RandomToken()[:8])
+}
+
+// RegisterClient creates a new client from the metadata of a registration request. A random client id
+// is derived from the client name. Unless the client is public a random secret is created. Returns the
+// client together with the plain text secret and registration access token.
+func RegisterClient(meta *ClientMetadata) (*Client, string, string, error) {
+	client := &Client{
+		UUID:      uuid.NewRandom().String(),
+		Name:      clientIDFromName(meta.ClientName),
+		ManagedBy: ClientManagedRegistration,
+	}
+	err := meta.apply(client)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	var secret string
+	if meta.TokenEndpointAuthMethod != "none" {
+		secret = util.RandomToken()
+		client.Secret = secret
+	}
+	token := util.RandomToken()
+	client.RegistrationToken = sql.NullString{String: token, Valid: true}
+
+	tx := database.MustBegin()
+	err = client.create(tx)
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return nil, "", "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return client, secret, token, nil
+}
+
+// GetRegisteredClient returns a dynamically registered client by its client id if the
+// registration access token matches. Returns false if no such client exists.
+func GetRegisteredClient(clientID, registrationToken string) (*Client, bool) {
+	const q = `SELECT * FROM Clients WHERE name=$1 AND registrationToken=$2`
+
+	client, ok := getClient(q, clientID, hashToken(registrationToken))
+	if !ok || client.ManagedBy != ClientManagedRegistration {
+		return nil, false
+	}
+	return client, true
+}
+
+// UpdateRegistration replaces the registered metadata of a client. The client id, secret and
+// authentication method of the client can not be changed.
+func (client *Client) UpdateRegistration(meta *ClientMetadata) error {
+	if meta.TokenEndpointAuthMethod == "" {
+		meta.TokenEndpointAuthMethod = client.Metadata().TokenEndpointAuthMethod
+	}
+	if (meta.TokenEndpointAuthMethod == "none") != client.IsPublic() {
+		return &RegistrationError{RegistrationInvalidMetadata, "The authentication method can not be changed"}
+	}
+
+	err := meta.apply(client)
+	if err != nil {
+		return err
+	}
+
+	return client.Update()
+}
+
+// Metadata returns the registered metadata of a client.
+func (client *Client) Metadata() *ClientMetadata {
+	method := "client_secret_basic"
+	if client.IsPublic() {
+		method = "none"
+	}
+
+	responseTypes := make([]string, 0, 2)
+	if client.AllowsGrantType("authorization_code") {
+		responseTypes = append(responseTypes, "code")
+	}
+	if client.AllowsGrantType("implicit") {
+		responseTypes = append(responseTypes, "token")
+	}
+
+	return &ClientMetadata{
+		ClientName:              client.DisplayName,
+		RedirectURIs:            client.RedirectURIs.Strings(),
+		TokenEndpointAuthMethod: method,
+		GrantTypes:              client.GrantTypes.Strings(),
+		ResponseTypes:           responseTypes,
+		Scope:                   strings.Join(client.ScopeRegistered.Strings(), " "),
+	}
+}
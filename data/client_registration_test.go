@@ -0,0 +1,142 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/util"
+)
+
+func TestRegisterClient(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	meta := &ClientMetadata{
+		ClientName:   "My Analysis Tool",
+		RedirectURIs: []string{"https://tool.example.com/callback"},
+		Scope:        "repo-read",
+	}
+	client, secret, token, err := RegisterClient(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == "" || token == "" {
+		t.Error("Secret and registration access token expected")
+	}
+	if client.ManagedBy != ClientManagedRegistration || client.IsFileManaged() {
+		t.Error("Client expected to be managed by registration")
+	}
+	if len(client.Name) != len("my-analysis-tool-")+8 {
+		t.Errorf("Unexpected client id '%s'", client.Name)
+	}
+	if meta.ClientName != "My Analysis Tool" || client.Title() != "My Analysis Tool" {
+		t.Errorf("Client name expected to be kept but was '%s'", client.DisplayName)
+	}
+	if meta.TokenEndpointAuthMethod != "client_secret_basic" || len(meta.GrantTypes) != 1 || len(meta.ResponseTypes) != 1 {
+		t.Errorf("Defaults expected for missing metadata: %v", meta)
+	}
+
+	check, ok := GetRegisteredClient(client.Name, token)
+	if !ok {
+		t.Fatal("Registered client does not exist")
+	}
+	if !check.VerifySecret(secret) {
+		t.Error("Secret expected to match")
+	}
+	if !check.AllowsScope(util.NewStringSet("repo-read")) || check.AllowsScope(util.NewStringSet("repo-write")) {
+		t.Error("Only the registered scope expected to be allowed")
+	}
+	if check.AllowsScope(util.NewStringSet("account-admin")) || check.ScopeBlacklist.Len() != 0 {
+		t.Error("Scope not registered expected to be denied without blacklist")
+	}
+	if check.GrantTypes.Len() != 1 || !check.AllowsGrantType("authorization_code") {
+		t.Error("Registered grant types expected to be stored")
+	}
+	if check.Metadata().Scope != "repo-read" || check.Metadata().ClientName != "My Analysis Tool" {
+		t.Errorf("Unexpected metadata '%v'", check.Metadata())
+	}
+	_, err = check.CreateGrantRequest("code", "https://tool.example.com/callback", "state",
+		util.NewStringSet("repo-write"), "", "")
+	if err == nil || !strings.Contains(err.Error(), "Scope not registered") {
+		t.Errorf("Error expected for scope not registered but was '%v'", err)
+	}
+	if _, ok = GetRegisteredClient(client.Name, "wrong"); ok {
+		t.Error("Client should not be returned for a wrong token")
+	}
+	if _, ok = GetRegisteredClient("gin", token); ok {
+		t.Error("Client should not be returned for a different client id")
+	}
+
+	// update
+	err = check.UpdateRegistration(&ClientMetadata{
+		RedirectURIs: []string{"https://tool.example.com/other"},
+		Scope:        "repo-read repo-write",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, _ = GetRegisteredClient(client.Name, token)
+	if !check.RedirectURIs.Contains("https://tool.example.com/other") || !check.ScopeRegistered.Contains("repo-write") {
+		t.Error("Registration was not updated")
+	}
+	if check.Metadata().ClientName != "" {
+		t.Errorf("Client name expected to be removed but was '%s'", check.Metadata().ClientName)
+	}
+	err = check.UpdateRegistration(&ClientMetadata{
+		RedirectURIs:            []string{"https://tool.example.com/other"},
+		TokenEndpointAuthMethod: "none",
+	})
+	if err == nil {
+		t.Error("Authentication method should not be changeable")
+	}
+
+	// public client
+	_, secret, _, err = RegisterClient(&ClientMetadata{
+		RedirectURIs:            []string{"http://localhost:9000/callback"},
+		TokenEndpointAuthMethod: "none",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != "" {
+		t.Error("Public clients expected to have no secret")
+	}
+}
+
+func TestRegisterClientInvalid(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	invalid := map[string]*ClientMetadata{
+		RegistrationInvalidRedirectURI: {RedirectURIs: []string{"not-a-uri"}},
+		RegistrationInvalidMetadata:    {RedirectURIs: []string{"https://tool.example.com"}, Scope: "account-admin"},
+	}
+	for code, meta := range invalid {
+		_, _, _, err := RegisterClient(meta)
+		regErr, ok := err.(*RegistrationError)
+		if !ok || regErr.Code != code {
+			t.Errorf("Registration error '%s' expected but was '%v'", code, err)
+		}
+	}
+
+	for _, meta := range []*ClientMetadata{
+		{},
+		{RedirectURIs: []string{"https://tool.example.com"}, GrantTypes: []string{"password"}},
+		{RedirectURIs: []string{"https://tool.example.com"}, ResponseTypes: []string{"token"}},
+		{RedirectURIs: []string{"https://tool.example.com"}, GrantTypes: []string{"client_credentials"}},
+		{RedirectURIs: []string{"https://tool.example.com"}, TokenEndpointAuthMethod: "private_key_jwt"},
+	} {
+		_, _, _, err := RegisterClient(meta)
+		if err == nil {
+			t.Errorf("Registration expected to fail: %v", meta)
+		}
+	}
+}
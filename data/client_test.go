@@ -247,39 +247,48 @@ func TestClient_CreateGrantRequest(t *testing.T) {
 	validState := util.RandomToken()
 	validRedirectURI := client.RedirectURIs.Strings()[0]
 	validScope := util.NewStringSet("repo-read")
+	validChallenge := "cfJ6pHaJqoo2OhoajaK2YC2F4X8CRi6_h-ECLXsDzhg"
 
 	// Test invalid response type
-	_, err := client.CreateGrantRequest("foo", validRedirectURI, validState, validScope)
+	_, err := client.CreateGrantRequest("foo", validRedirectURI, validState, validScope, "", "")
 	if err == nil || !strings.Contains(err.Error(), "Response type expected") {
 		t.Error("Error expected")
 	}
 
+	// Test response type not allowed for the client
+	restricted := *client
+	restricted.GrantTypes = util.NewStringSet("client_credentials")
+	_, err = restricted.CreateGrantRequest(validResponseType, validRedirectURI, validState, validScope, "", "")
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Error("Error expected")
+	}
+
 	// Test invalid redirect
-	_, err = client.CreateGrantRequest(validResponseType, "https://doesnotexist.com/callback", validState, validScope)
+	_, err = client.CreateGrantRequest(validResponseType, "https://doesnotexist.com/callback", validState, validScope, "", "")
 	if err == nil || !strings.Contains(err.Error(), "Redirect URI invalid") {
 		t.Error("Error expected")
 	}
 
 	// Test invalid scope
-	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, util.NewStringSet("foo-read"))
+	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, util.NewStringSet("foo-read"), "", "")
 	if err == nil || !strings.Contains(err.Error(), "Invalid scope") {
 		t.Error("Error expected")
 	}
 
 	// Test blacklisted scope
-	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, util.NewStringSet("account-admin"))
+	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, util.NewStringSet("account-admin"), "", "")
 	if err == nil || !strings.Contains(err.Error(), "Blacklisted scope") {
 		t.Error("Error expected")
 	}
 
 	// Test missing client state token
-	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, "", validScope)
+	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, "", validScope, "", "")
 	if err == nil || !strings.Contains(err.Error(), "Missing client state") {
 		t.Error("Error expected")
 	}
 
 	// all OK
-	request, err := client.CreateGrantRequest(validResponseType, validRedirectURI, validState, validScope)
+	request, err := client.CreateGrantRequest(validResponseType, validRedirectURI, validState, validScope, "", "")
 	if err != nil {
 		t.Error(err)
 	}
@@ -292,6 +301,93 @@ func TestClient_CreateGrantRequest(t *testing.T) {
 	if request.State != validState {
 		t.Error("State does not match")
 	}
+	if request.CodeChallenge.Valid {
+		t.Error("Code challenge should not be set")
+	}
+
+	// Test invalid code challenge method
+	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, validScope, validChallenge, "foo")
+	if err == nil || !strings.Contains(err.Error(), "Code challenge method expected") {
+		t.Error("Error expected")
+	}
+
+	// Test invalid code challenge
+	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, validScope, "tooshort", "S256")
+	if err == nil || !strings.Contains(err.Error(), "Invalid code challenge") {
+		t.Error("Error expected")
+	}
+
+	// Test code challenge method without challenge
+	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, validScope, "", "S256")
+	if err == nil || !strings.Contains(err.Error(), "Missing code challenge") {
+		t.Error("Error expected")
+	}
+
+	// Test code challenge with wrong response type
+	_, err = client.CreateGrantRequest("token", validRedirectURI, validState, validScope, validChallenge, "S256")
+	if err == nil || !strings.Contains(err.Error(), "only supported for response type") {
+		t.Error("Error expected")
+	}
+
+	// all OK with code challenge
+	request, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, validScope, validChallenge, "S256")
+	if err != nil {
+		t.Error(err)
+	}
+	if request.CodeChallenge.String != validChallenge || request.CodeChallengeMethod.String != "S256" {
+		t.Error("Code challenge does not match")
+	}
+
+	// all OK with code challenge and default method
+	request, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, validScope, validChallenge, "")
+	if err != nil {
+		t.Error(err)
+	}
+	if request.CodeChallengeMethod.String != "plain" {
+		t.Error("Code challenge method expected to be 'plain'")
+	}
+
+	// Test missing code challenge for clients requiring PKCE
+	client.RequirePKCE = true
+	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, validScope, "", "")
+	if err == nil || !strings.Contains(err.Error(), "Code challenge required") {
+		t.Error("Error expected")
+	}
+
+	// Test missing code challenge for public clients
+	client.RequirePKCE = false
+	client.Secret = ""
+	_, err = client.CreateGrantRequest(validResponseType, validRedirectURI, validState, validScope, "", "")
+	if err == nil || !strings.Contains(err.Error(), "Code challenge required") {
+		t.Error("Error expected")
+	}
+
+	// implicit requests of public clients do not require PKCE
+	_, err = client.CreateGrantRequest("token", validRedirectURI, validState, validScope, "", "")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClient_VerifySecret(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	client, ok := GetClient(uuidClientGin)
+	if !ok {
+		t.Fatal("Client does not exist")
+	}
+	if !client.VerifySecret("secret") {
+		t.Error("Client secret expected to match")
+	}
+	if client.VerifySecret("wrong") || client.VerifySecret("") || client.VerifySecret(client.Secret) {
+		t.Error("Wrong secret should not match")
+	}
+
+	client.Secret = ""
+	if !client.VerifySecret("") || client.VerifySecret("secret") {
+		t.Error("Public clients expected to only match an empty secret")
+	}
 }
 
 func TestClientScopeProvided(t *testing.T) {
@@ -370,9 +466,9 @@ func TestClient_create(t *testing.T) {
 		t.Errorf("DB client name '%s' does not match expected name '%s'",
 			check.Name, client.Name)
 	}
-	if check.Secret != client.Secret {
+	if check.Secret != hashToken("TestSecret") {
 		t.Errorf("DB client secret '%s' does not match expected secret '%s'",
-			check.Secret, client.Secret)
+			check.Secret, hashToken("TestSecret"))
 	}
 	if len(check.ScopeProvidedMap) != len(client.ScopeProvidedMap) {
 		t.Errorf("Number of DB scope entries (%d) differ from expected entries (%d)",
@@ -389,6 +485,9 @@ func TestClient_create(t *testing.T) {
 		t.Errorf("DB redirectURI '%v' entry does not contain expected entry '%s'",
 			check.RedirectURIs, testUri)
 	}
+	if check.TokenFormat != "opaque" {
+		t.Errorf("DB token format '%s' does not match default 'opaque'", check.TokenFormat)
+	}
 }
 
 // Tests various correct fails when trying to insert a client into the database.
@@ -551,9 +650,9 @@ func TestClient_update(t *testing.T) {
 		t.Errorf("DB client name '%s' does not match expected '%s'",
 			check.Name, clUpdate.Name)
 	}
-	if check.Secret != clUpdate.Secret {
+	if !check.VerifySecret(clUpdate.Secret) {
 		t.Errorf("DB client secret '%s' does not match expected '%s'",
-			check.Secret, clUpdate.Secret)
+			check.Secret, hashToken(clUpdate.Secret))
 	}
 	if check.RedirectURIs.Len() != clUpdate.RedirectURIs.Len() {
 		t.Errorf("Number of DB redirectURI entries (%d) differ from expected entries (%d)",
@@ -631,7 +730,7 @@ func TestClient_updateClients(t *testing.T) {
 	if !ok {
 		t.Error("Client was not created.")
 	}
-	if testClient.Secret != "AnotherTestSecret" {
+	if !testClient.VerifySecret("AnotherTestSecret") {
 		t.Error("Secret was not updated")
 	}
 	if testClient.RedirectURIs.Len() != 1 || !testClient.RedirectURIs.Contains(testUriUpdate) {
@@ -758,3 +857,205 @@ func TestClient_updateClientsFailUpdate(t *testing.T) {
 		t.Error("Number of clients does not match expected number.")
 	}
 }
+
+// Tests that clients managed via the client API are not removed by updateClients.
+func TestClient_updateClientsManagedByAPI(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	dbClients := ListClients()
+
+	apiClient := &Client{
+		Name:             "api-client",
+		Secret:           "secret",
+		ScopeProvidedMap: map[string]string{"api-scope": "API scope"},
+		RedirectURIs:     util.NewStringSet("https://example.com/login"),
+	}
+	err := apiClient.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updateClients(dbClients)
+
+	check, ok := GetClient(apiClient.UUID)
+	if !ok {
+		t.Fatal("Client managed by the API should not be removed")
+	}
+	if check.ManagedBy != ClientManagedAPI || check.IsFileManaged() {
+		t.Error("Client expected to be managed by the API")
+	}
+
+	// clients defined in the file take precedence
+	updateClients(append(dbClients, *check))
+
+	check, ok = GetClient(apiClient.UUID)
+	if !ok {
+		t.Fatal("Client does not exist")
+	}
+	if !check.IsFileManaged() {
+		t.Error("Client expected to be managed by the file")
+	}
+
+	updateClients(dbClients)
+
+	if _, ok = GetClient(apiClient.UUID); ok {
+		t.Error("Client managed by the file expected to be removed")
+	}
+}
+
+func TestClient_Validate(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	client := &Client{
+		Name:             "new-client",
+		ScopeProvidedMap: map[string]string{"new-scope": "New scope"},
+		ScopeWhitelist:   util.NewStringSet("new-scope", "repo-read"),
+		ScopeBlacklist:   util.NewStringSet("account-admin"),
+		RedirectURIs:     util.NewStringSet("https://example.com/login"),
+		TokenFormat:      "jwt",
+	}
+	valErr := client.Validate()
+	if len(valErr.FieldErrors) > 0 {
+		t.Errorf("Client expected to be valid: %v", valErr.FieldErrors)
+	}
+
+	invalid := &Client{
+		Name:             "wb",
+		ScopeProvidedMap: map[string]string{"repo-read": "Taken"},
+		ScopeWhitelist:   util.NewStringSet("does-not-exist"),
+		ScopeBlacklist:   util.NewStringSet("does-not-exist"),
+		RedirectURIs:     util.NewStringSet("/relative"),
+		TokenFormat:      "xml",
+	}
+	valErr = invalid.Validate()
+	for _, field := range []string{"name", "scope_provided", "scope_whitelist", "scope_blacklist", "redirect_uris", "token_format"} {
+		if _, ok := valErr.FieldErrors[field]; !ok {
+			t.Errorf("Field error for '%s' expected", field)
+		}
+	}
+	if valErr.Message == "" {
+		t.Error("Validation error message expected")
+	}
+
+	// a client may keep its own name and scope
+	existing, ok := GetClient(uuidClientGin)
+	if !ok {
+		t.Fatal("Client does not exist")
+	}
+	valErr = existing.Validate()
+	if len(valErr.FieldErrors) > 0 {
+		t.Errorf("Existing client expected to be valid: %v", valErr.FieldErrors)
+	}
+
+	client.ScopeWhitelist = util.NewStringSet("repo-read")
+	client.ScopeBlacklist = util.NewStringSet("repo-read")
+	valErr = client.Validate()
+	if _, ok := valErr.FieldErrors["scope_blacklist"]; !ok {
+		t.Error("Scope expected not to be whitelisted and blacklisted")
+	}
+}
+
+func TestClient_Create_Update_Delete(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	client := &Client{
+		Name:             "api-client",
+		Secret:           "first",
+		ScopeProvidedMap: map[string]string{"api-scope": "API scope"},
+		RedirectURIs:     util.NewStringSet("https://example.com/login"),
+	}
+	err := client.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.UUID == "" || client.ManagedBy != ClientManagedAPI {
+		t.Error("Client expected to have a UUID and to be managed by the API")
+	}
+
+	check, ok := GetClient(client.UUID)
+	if !ok {
+		t.Fatal("Client was not created")
+	}
+	if !check.VerifySecret("first") {
+		t.Error("Secret expected to match")
+	}
+
+	check.ScopeProvidedMap = map[string]string{"other-scope": "Other scope"}
+	check.TokenFormat = "jwt"
+	err = check.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check, ok = GetClient(client.UUID)
+	if !ok {
+		t.Fatal("Client does not exist")
+	}
+	if !check.IssuesJWT() || !check.ScopeProvided().Contains("other-scope") || check.ScopeProvided().Contains("api-scope") {
+		t.Error("Client was not updated")
+	}
+	if !check.VerifySecret("first") {
+		t.Error("Secret expected to be unchanged by an update")
+	}
+
+	secret, err := check.RotateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, _ = GetClient(client.UUID)
+	if check.VerifySecret("first") || !check.VerifySecret(secret) {
+		t.Error("Secret was not rotated")
+	}
+
+	err = check.Delete()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok = GetClient(client.UUID); ok {
+		t.Error("Client was not deleted")
+	}
+
+	public := &Client{Name: "public-client", RedirectURIs: util.NewStringSet("https://example.com/login")}
+	err = public.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = public.RotateSecret(); err == nil {
+		t.Error("Public clients expected to have no secret")
+	}
+}
+
+func TestClient_AllowsGrantType(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	client, ok := GetClient(uuidClientWB)
+	if !ok {
+		t.Fatal("Client does not exist")
+	}
+	for grantType := range GrantTypes {
+		if !client.AllowsGrantType(grantType) {
+			t.Errorf("Grant type '%s' expected to be allowed by default", grantType)
+		}
+	}
+
+	client.GrantTypes = util.NewStringSet("authorization_code", "refresh_token")
+	err := client.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, _ = GetClient(uuidClientWB)
+	if !client.AllowsGrantType("authorization_code") || client.AllowsGrantType("password") {
+		t.Error("Grant types were not stored")
+	}
+
+	client.GrantTypes = util.NewStringSet("authorization_code", "something")
+	valErr := client.Validate()
+	if _, ok := valErr.FieldErrors["grant_types"]; !ok {
+		t.Error("Unknown grant type expected to be invalid")
+	}
+}
@@ -51,17 +51,34 @@ func InitTestDb(t *testing.T) {
 		t.Fatal(err)
 	}
 	database.MustExec(string(fixtures))
+
+	// fixtures contain tokens and codes in plain text
+	HashStoredValues()
 }
 
 // RemoveExpired removes rows of expired entries from
-// AccessTokens, Sessions and GrantRequests database tables.
+// AccessTokens, RefreshTokens, Sessions, GrantRequests, WebAuthnChallenges, RateLimitEvents,
+// PasswordResets and EmailChanges database tables.
+// Refresh tokens expire after their absolute life time or if they were not used
+// within the configured idle time.
 func RemoveExpired() {
 	const delGrant = `DELETE from GrantRequests WHERE createdAt <= $1`
 	database.MustExec(delGrant, time.Now().Add(-1*conf.GetServerConfig().GrantReqLifeTime))
 
+	const delChallenge = `DELETE from WebAuthnChallenges WHERE createdAt <= $1`
+	database.MustExec(delChallenge, time.Now().Add(-1*conf.GetServerConfig().GrantReqLifeTime))
+
 	const q = `DELETE from AccessTokens WHERE expires <= now();
-		   DELETE from Sessions WHERE expires <= now();`
+		   DELETE from Sessions WHERE expires <= now();
+		   DELETE from PasswordResets WHERE expires <= now();
+		   DELETE from EmailChanges WHERE expires <= now();`
 	database.MustExec(q)
+
+	const delRefresh = `DELETE from RefreshTokens WHERE expires <= now() OR updatedAt <= $1`
+	database.MustExec(delRefresh, time.Now().Add(-1*conf.GetServerConfig().RefreshTokenIdleTime))
+
+	const delEvents = `DELETE from RateLimitEvents WHERE createdAt <= $1`
+	database.MustExec(delEvents, time.Now().Add(-1*conf.GetRateLimitConfig().Window))
 }
 
 // RemoveStaleAccounts removes all accounts that where registered,
@@ -69,7 +86,7 @@ func RemoveExpired() {
 func RemoveStaleAccounts() {
 	const q = `DELETE FROM Accounts WHERE
 	 	   NOT isdisabled AND
-	 	   resetpwcode IS NULL AND
+	 	   uuid NOT IN (SELECT accountUUID FROM PasswordResets) AND
 	 	   activationcode IS NOT NULL AND
 	 	   updatedat < $1`
 	database.MustExec(q, time.Now().Add(-1*conf.GetServerConfig().UnusedAccountLifeTime))
@@ -88,22 +105,32 @@ func RunCleaner() {
 	}()
 }
 
-// EmailDispatch checks e-mail queue database entries, handles the entries
+// EmailDispatch checks e-mail queue database entries which are due, handles the entries
 // according to the smtp mode setting and removes the entries after they successful handling.
+// Failed attempts are recorded and retried later with exponential backoff. Errors are logged
+// such that the dispatch continues with the next interval.
 func EmailDispatch() {
-	emails, err := GetQueuedEmails()
+	log := conf.GetLogEnv().Err
+	emails, err := GetDueEmails()
 	if err != nil {
-		panic(err)
+		log.Errorf("Error trying to fetch queued e-mails: %s\n", err.Error())
+		return
 	}
-	for _, email := range emails {
+	for i := range emails {
+		email := &emails[i]
 		err = email.Send()
 		if err != nil {
-			conf.GetLogEnv().Err.
-				Errorf("Error trying to send e-mail (Id %d): %s\n", email.Id, err.Error())
+			log.Errorf("Error trying to send e-mail (Id %d, attempt %d): %s\n", email.Id, email.Attempts+1, err.Error())
+			err = email.Fail(err)
+			if err != nil {
+				log.Errorf("Error trying to record failed e-mail (Id %d): %s\n", email.Id, err.Error())
+			} else if email.Status == EmailFailed {
+				log.Errorf("Giving up on e-mail (Id %d) after %d attempts\n", email.Id, email.Attempts)
+			}
 		} else {
 			err = email.Delete()
 			if err != nil {
-				panic(err)
+				log.Errorf("Error trying to remove sent e-mail (Id %d): %s\n", email.Id, err.Error())
 			}
 		}
 	}
@@ -10,6 +10,7 @@ package data
 
 import (
 	"testing"
+	"time"
 
 	"github.com/G-Node/gin-auth/conf"
 	"github.com/G-Node/gin-auth/util"
@@ -50,6 +51,22 @@ func TestEmailDispatch(t *testing.T) {
 		t.Errorf("Error fetching queued e-mails: '%s'\n", err.Error())
 	}
 	if len(emails) != 1 {
-		t.Errorf("Number of db entries do not match expected result: %d\n", len(emails))
+		t.Fatalf("Number of db entries do not match expected result: %d\n", len(emails))
+	}
+	if emails[0].Attempts != 1 || emails[0].LastError == "" {
+		t.Errorf("Failed attempt expected to be recorded: %d, '%s'", emails[0].Attempts, emails[0].LastError)
+	}
+	if !emails[0].NextAttempt.After(time.Now()) {
+		t.Error("Next attempt expected to be in the future")
+	}
+
+	// e-mails are not sent again before the next attempt is due
+	EmailDispatch()
+	check, ok := GetEmail(emails[0].Id)
+	if !ok {
+		t.Fatal("E-mail expected to exist")
+	}
+	if check.Attempts != 1 {
+		t.Errorf("No further attempt expected but was %d", check.Attempts)
 	}
 }
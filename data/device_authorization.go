@@ -0,0 +1,151 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
+)
+
+// Settings of device authorization requests, the unit of the intervals is second
+const (
+	deviceCodeInterval = 5
+	deviceCodeSlowDown = 5
+	userCodeLength     = 8
+)
+
+// NormalizeUserCode removes all characters, which are not part of user codes (e.g. dashes
+// or spaces), from a user code entered by a user.
+func NormalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(code))
+}
+
+// CreateDeviceRequest creates a new device authorization request (RFC 8628) with a random device
+// code and user code. The device polls the token endpoint with the device code, while the user
+// enters the user code in a browser, signs in and approves the request. Invalid requests cause
+// an OAuthError.
+func (client *Client) CreateDeviceRequest(scope util.StringSet) (*GrantRequest, error) {
+	if !client.AllowsGrantType(DeviceCodeGrantType) {
+		return nil, &OAuthError{OAuthUnauthorizedClient, "The device code grant is not allowed for this client"}
+	}
+	if !CheckScope(scope) {
+		return nil, &OAuthError{OAuthInvalidScope, "Invalid scope"}
+	}
+	if scope.Intersect(client.ScopeBlacklist).Len() > 0 {
+		return nil, &OAuthError{OAuthInvalidScope, "Blacklisted scope"}
+	}
+	if !client.AllowsScope(scope) {
+		return nil, &OAuthError{OAuthInvalidScope, "Scope not registered"}
+	}
+
+	request := &GrantRequest{
+		GrantType:      "device",
+		ScopeRequested: scope,
+		ClientUUID:     client.UUID,
+		DeviceCode:     sql.NullString{String: util.RandomToken(), Valid: true},
+		UserCode:       sql.NullString{String: util.RandomUserCode(userCodeLength), Valid: true},
+		PollInterval:   deviceCodeInterval,
+	}
+
+	err := request.Create()
+
+	return request, err
+}
+
+// GetGrantRequestByUserCode returns a device authorization request, which was not yet approved
+// by the user, with a given user code. Returns false if no request with a matching code exists.
+func GetGrantRequestByUserCode(code string) (*GrantRequest, bool) {
+	const q = `SELECT * FROM GrantRequests WHERE userCode=$1 AND grantType='device' AND createdAt > $2`
+
+	grantRequest := &GrantRequest{}
+	err := database.Get(grantRequest, q, NormalizeUserCode(code),
+		time.Now().Add(-1*conf.GetServerConfig().GrantReqLifeTime))
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return grantRequest, err == nil
+}
+
+// GetGrantRequestByDeviceCode returns a device authorization request with a given device code.
+// Returns false if no request with a matching code exists.
+func GetGrantRequestByDeviceCode(code string) (*GrantRequest, bool) {
+	const q = `SELECT * FROM GrantRequests WHERE deviceCode=$1 AND grantType='device' AND createdAt > $2`
+
+	grantRequest := &GrantRequest{}
+	err := database.Get(grantRequest, q, hashToken(code),
+		time.Now().Add(-1*conf.GetServerConfig().GrantReqLifeTime))
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return grantRequest, err == nil
+}
+
+// IsDeviceCodeExpired returns true if a device authorization request with a given device code
+// exists, but is expired. Expired requests are only known until they are removed by the cleaner.
+func IsDeviceCodeExpired(code string) bool {
+	const q = `SELECT COUNT(*) FROM GrantRequests WHERE deviceCode=$1 AND grantType='device' AND createdAt <= $2`
+
+	var count int
+	err := database.Get(&count, q, hashToken(code), time.Now().Add(-1*conf.GetServerConfig().GrantReqLifeTime))
+	if err != nil {
+		panic(err)
+	}
+
+	return count > 0
+}
+
+// Poll records a token request of the device, which started a device authorization request.
+// Returns false if the device polls more frequently than the poll interval, in which case the
+// interval is increased as required by RFC 8628 section 3.5.
+func (req *GrantRequest) Poll() (bool, error) {
+	const q = `UPDATE GrantRequests SET (pollInterval, polledAt) = ($1, now()) WHERE token=$2
+	           RETURNING pollInterval, polledAt`
+
+	ok := time.Since(req.PolledAt) >= time.Duration(req.PollInterval)*time.Second
+	interval := req.PollInterval
+	if !ok {
+		interval += deviceCodeSlowDown
+	}
+
+	err := database.QueryRowx(q, interval, req.Token).Scan(&req.PollInterval, &req.PolledAt)
+
+	return ok, err
+}
+
+// Deny marks a device authorization request as denied by the user. The user code is removed, such
+// that the request can not be approved any more. The request is kept until the device polls again.
+func (req *GrantRequest) Deny() error {
+	const q = `UPDATE GrantRequests SET (isDenied, userCode, updatedAt) = (TRUE, NULL, now()) WHERE token=$1`
+
+	_, err := database.Exec(q, req.Token)
+	if err != nil {
+		return err
+	}
+	req.IsDenied = true
+	req.UserCode = sql.NullString{}
+
+	return nil
+}
+
+// IsPending returns true if the user did not yet approve a device authorization request.
+// The user code is removed once the user approved the request on the approve page.
+func (req *GrantRequest) IsPending() bool {
+	return req.UserCode.Valid || !req.IsApproved()
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"testing"
+
+	"github.com/G-Node/gin-auth/util"
+)
+
+const (
+	deviceReqToken         = "DV3PQXWA"
+	deviceReqDeviceCode    = "DVC7ZLQN"
+	deviceReqUserCode      = "BDFGHJKL"
+	deviceReqApprovedToken = "DV8MRTYE"
+)
+
+func TestNormalizeUserCode(t *testing.T) {
+	if code := NormalizeUserCode(" bdfg-hjkl "); code != deviceReqUserCode {
+		t.Errorf("Code '%s' expected but was '%s'", deviceReqUserCode, code)
+	}
+}
+
+func TestClient_CreateDeviceRequest(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	client, ok := GetClient(uuidClientGin)
+	if !ok {
+		t.Fatal("Client does not exist")
+	}
+
+	_, err := client.CreateDeviceRequest(util.NewStringSet("foo-read"))
+	if err == nil {
+		t.Error("Error expected for an invalid scope")
+	}
+	_, err = client.CreateDeviceRequest(util.NewStringSet("account-admin"))
+	if err == nil {
+		t.Error("Error expected for a blacklisted scope")
+	}
+
+	request, err := client.CreateDeviceRequest(util.NewStringSet("repo-read"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.GrantType != "device" || len(request.UserCode.String) != 8 || request.PollInterval != 5 {
+		t.Errorf("Unexpected device request: %v", request)
+	}
+
+	check, ok := GetGrantRequestByDeviceCode(request.DeviceCode.String)
+	if !ok || check.Token != request.Token {
+		t.Error("Device request expected to be found by its device code")
+	}
+	if check.DeviceCode.String == request.DeviceCode.String {
+		t.Error("Device code should not be stored in plain text")
+	}
+	if _, ok = GetGrantRequestByUserCode(request.UserCode.String); !ok {
+		t.Error("Device request expected to be found by its user code")
+	}
+
+	client.GrantTypes = util.NewStringSet("authorization_code")
+	_, err = client.CreateDeviceRequest(util.NewStringSet("repo-read"))
+	if err == nil {
+		t.Error("Error expected if the device code grant is not allowed")
+	}
+}
+
+func TestGetGrantRequestByUserCode(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	request, ok := GetGrantRequestByUserCode("bdfg-hjkl")
+	if !ok || request.Token != deviceReqToken {
+		t.Error("Device request does not exist")
+	}
+
+	_, ok = GetGrantRequestByUserCode("doesNotExist")
+	if ok {
+		t.Error("Device request should not exist")
+	}
+}
+
+func TestIsDeviceCodeExpired(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	if IsDeviceCodeExpired(deviceReqDeviceCode) || IsDeviceCodeExpired("doesNotExist") {
+		t.Error("Device code should not be expired")
+	}
+
+	database.MustExec("UPDATE GrantRequests SET createdAt = 'yesterday' WHERE token = $1", deviceReqToken)
+	if _, ok := GetGrantRequestByDeviceCode(deviceReqDeviceCode); ok {
+		t.Error("Expired device request should not be returned")
+	}
+	if !IsDeviceCodeExpired(deviceReqDeviceCode) {
+		t.Error("Device code expected to be expired")
+	}
+}
+
+func TestGrantRequest_Poll(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	request, ok := GetGrantRequestByDeviceCode(deviceReqDeviceCode)
+	if !ok {
+		t.Fatal("Device request does not exist")
+	}
+	if !request.IsPending() {
+		t.Error("Device request expected to be pending")
+	}
+
+	ok, err := request.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("First poll expected to be accepted")
+	}
+
+	ok, err = request.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || request.PollInterval != 10 {
+		t.Error("Second poll expected to slow down the device")
+	}
+
+	approved, ok := GetGrantRequest(deviceReqApprovedToken)
+	if !ok {
+		t.Fatal("Device request does not exist")
+	}
+	if approved.IsPending() {
+		t.Error("Approved device request should not be pending")
+	}
+}
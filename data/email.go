@@ -10,29 +10,50 @@ package data
 
 import (
 	"database/sql"
-	"fmt"
-	"net/smtp"
-	"strconv"
+	"encoding/json"
 	"time"
 
 	"github.com/G-Node/gin-auth/conf"
 	"github.com/G-Node/gin-auth/util"
 )
 
-// Email data as stored in the database
+// Status of e-mails in the e-mail queue
+const (
+	EmailQueued = "queued"
+	EmailFailed = "failed"
+)
+
+// Email data as stored in the database. E-mails which could not be sent are retried
+// at NextAttempt and are marked as failed after too many attempts.
 type Email struct {
-	Id        int
-	Mode      sql.NullString
-	Sender    string
-	Recipient util.StringSet
-	Content   []byte
-	CreatedAt time.Time
+	Id          int
+	Mode        sql.NullString
+	Sender      string
+	Recipient   util.StringSet
+	Content     []byte
+	CreatedAt   time.Time
+	Status      string
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	UpdatedAt   time.Time
 }
 
 // GetQueuedEmails selects all unsent e-mails from the email queue
 // database table and returns the result as a slice of Emails.
+// E-mails marked as failed are not included.
 func GetQueuedEmails() ([]Email, error) {
-	const q = `SELECT * FROM EmailQueue order by createdat`
+	const q = `SELECT * FROM EmailQueue WHERE status = 'queued' ORDER BY createdAt`
+
+	emails := make([]Email, 0)
+	err := database.Select(&emails, q)
+
+	return emails, err
+}
+
+// GetDueEmails selects all unsent e-mails which are due for their next attempt.
+func GetDueEmails() ([]Email, error) {
+	const q = `SELECT * FROM EmailQueue WHERE status = 'queued' AND nextAttempt <= now() ORDER BY createdAt`
 
 	emails := make([]Email, 0)
 	err := database.Select(&emails, q)
@@ -40,11 +61,39 @@ func GetQueuedEmails() ([]Email, error) {
 	return emails, err
 }
 
+// ListEmails returns all e-mails of the e-mail queue with the given status. If status
+// is empty, queued and failed e-mails are returned.
+func ListEmails(status string) []Email {
+	const q = `SELECT * FROM EmailQueue WHERE ($1 = '' OR status = $1) ORDER BY createdAt, id`
+
+	emails := make([]Email, 0)
+	err := database.Select(&emails, q, status)
+	if err != nil {
+		panic(err)
+	}
+
+	return emails
+}
+
+// GetEmail returns an e-mail from the e-mail queue with the given id.
+// Returns false if no such e-mail exists.
+func GetEmail(id int) (*Email, bool) {
+	const q = `SELECT * FROM EmailQueue WHERE id = $1`
+
+	email := &Email{}
+	err := database.Get(email, q, id)
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return email, err == nil
+}
+
 // Create adds a new entry to table EmailQueue
 func (e *Email) Create(to util.StringSet, content []byte) error {
 
-	const q = `INSERT INTO EmailQueue(mode, sender, recipient, content, createdat)
-	           VALUES ($1, $2, $3, $4, now())
+	const q = `INSERT INTO EmailQueue(mode, sender, recipient, content, createdat, updatedAt)
+	           VALUES ($1, $2, $3, $4, now(), now())
 	           RETURNING *`
 
 	config := conf.GetSmtpCredentials()
@@ -62,29 +111,79 @@ func (e *Email) Delete() error {
 	return err
 }
 
-// Send checks the smtp Mode setting and if appropriate
-// sets up authentication for e-mail dispatch via smtp and sends the e-mail.
-func (e *Email) Send() error {
-	switch e.Mode.String {
-	case "skip":
-		fmt.Printf("Skip sending e-mail to '%s'\n", e.Recipient.Strings()[0])
-	case "print":
-		fmt.Printf("%s\n", string(e.Content))
-	default:
-		config := conf.GetSmtpCredentials()
-
-		var auth smtp.Auth
-		if config.Username == "" && config.Password == "" {
-			auth = &conf.NoAuth{}
-		} else {
-			auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
-		}
-
-		addr := config.Host + ":" + strconv.Itoa(config.Port)
-		err := smtp.SendMail(addr, auth, e.Sender, e.Recipient.Strings(), e.Content)
-		if err != nil {
-			return err
-		}
+// retryDelay returns the delay before the next attempt to send an e-mail after the
+// given number of failed attempts. The delay doubles with every attempt.
+func retryDelay(attempts int) time.Duration {
+	config := conf.GetSmtpCredentials()
+	delay := config.RetryDelay
+	for i := 1; i < attempts && delay < config.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > config.MaxRetryDelay {
+		delay = config.MaxRetryDelay
+	}
+	return delay
+}
+
+// Fail records a failed attempt to send the e-mail together with the error. The next attempt
+// is scheduled with exponential backoff. After the maximum number of attempts the e-mail is
+// marked as failed and will not be sent again unless it is retried explicitly.
+func (e *Email) Fail(cause error) error {
+	const q = `UPDATE EmailQueue SET (status, attempts, nextAttempt, lastError, updatedAt) =
+	           ($1, $2, $3, $4, now())
+	           WHERE id=$5
+	           RETURNING *`
+
+	attempts := e.Attempts + 1
+	status := EmailQueued
+	if attempts >= conf.GetSmtpCredentials().MaxAttempts {
+		status = EmailFailed
 	}
-	return nil
+	msg := cause.Error()
+	if len(msg) > 1024 {
+		msg = msg[:1024]
+	}
+
+	return database.Get(e, q, status, attempts, time.Now().Add(retryDelay(attempts)), msg, e.Id)
+}
+
+// Retry moves the e-mail back to the queue and resets its attempts, such that it is sent
+// with the next dispatch. The last error is kept until the next attempt.
+func (e *Email) Retry() error {
+	const q = `UPDATE EmailQueue SET (status, attempts, nextAttempt, updatedAt) = ('queued', 0, now(), now())
+	           WHERE id=$1
+	           RETURNING *`
+
+	return database.Get(e, q, e.Id)
+}
+
+// MarshalJSON implements Marshaler for Email. The content of the e-mail is omitted
+// since it may contain activation or password reset codes.
+func (e *Email) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		ID          int       `json:"id"`
+		Status      string    `json:"status"`
+		Sender      string    `json:"sender"`
+		Recipient   []string  `json:"recipient"`
+		Attempts    int       `json:"attempts"`
+		NextAttempt time.Time `json:"next_attempt"`
+		LastError   string    `json:"last_error"`
+		CreatedAt   time.Time `json:"created_at"`
+		UpdatedAt   time.Time `json:"updated_at"`
+	}{
+		ID:          e.Id,
+		Status:      e.Status,
+		Sender:      e.Sender,
+		Recipient:   e.Recipient.Strings(),
+		Attempts:    e.Attempts,
+		NextAttempt: e.NextAttempt,
+		LastError:   e.LastError,
+		CreatedAt:   e.CreatedAt,
+		UpdatedAt:   e.UpdatedAt,
+	})
+}
+
+// Send delivers the e-mail using the transport of the e-mail's mode.
+func (e *Email) Send() error {
+	return util.NewEmailTransport(e.Mode.String).Send(e.Sender, e.Recipient.Strings(), e.Content)
 }
@@ -0,0 +1,217 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
+)
+
+// EmailChange is a pending change of the e-mail address of an account. The new address replaces
+// the current one only after it was confirmed with the code sent to the new address. The undo code
+// sent to the previous address reverts the change, before and after the confirmation, until the
+// change expires.
+type EmailChange struct {
+	Code          string
+	UndoCode      string
+	AccountUUID   string
+	Email         string
+	PreviousEmail string
+	IsConfirmed   bool
+	Expires       time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// GetEmailChange returns a change which was neither confirmed nor is expired by its confirmation code.
+// Returns false if no such change exists or the account is not active.
+func GetEmailChange(code string) (*EmailChange, bool) {
+	const q = `SELECT e.* FROM EmailChanges e JOIN ActiveAccounts a ON e.accountUUID = a.uuid
+	           WHERE e.code=$1 AND NOT e.isConfirmed AND e.expires > now()`
+
+	change := &EmailChange{}
+	err := database.Get(change, q, hashToken(code))
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return change, err == nil
+}
+
+// GetEmailChangeByUndoCode returns a change which is not expired by its undo code, regardless
+// of whether it was confirmed. Returns false if no such change exists or the account is disabled.
+func GetEmailChangeByUndoCode(code string) (*EmailChange, bool) {
+	const q = `SELECT e.* FROM EmailChanges e JOIN Accounts a ON e.accountUUID = a.uuid
+	           WHERE e.undoCode=$1 AND e.expires > now() AND NOT a.isDisabled`
+
+	change := &EmailChange{}
+	err := database.Get(change, q, hashToken(code))
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return change, err == nil
+}
+
+// CreateEmailChange checks the validity of a new e-mail address and stores it as pending change of
+// the account, which expires after the configured life time. A previous unconfirmed change of the
+// account is replaced. As long as a confirmed change can still be undone, no new change is accepted,
+// since this would invalidate the undo code sent to the previous address. Only the hashes of the codes
+// are stored, but the plain codes are accessible via Code and UndoCode of the returned change.
+func (acc *Account) CreateEmailChange(email string) (*EmailChange, error) {
+	const (
+		qCheck  = `SELECT COUNT(*) FROM EmailChanges WHERE accountUUID=$1 AND isConfirmed AND expires > now()`
+		qDelete = `DELETE FROM EmailChanges WHERE accountUUID=$1`
+		qCreate = `INSERT INTO EmailChanges (code, undoCode, accountUUID, email, previousEmail, expires, createdAt, updatedAt)
+		           VALUES ($1, $2, $3, $4, $5, $6, now(), now())
+		           RETURNING *`
+	)
+
+	err := checkEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &EmailChange{}
+	code := util.RandomToken()
+	undoCode := util.RandomToken()
+	expires := time.Now().Add(conf.GetServerConfig().EmailChangeLifeTime)
+
+	tx := database.MustBegin()
+	var confirmed int
+	err = tx.Get(&confirmed, qCheck, acc.UUID)
+	if err == nil && confirmed > 0 {
+		err = &util.ValidationError{
+			Message: "A recent change of the e-mail address can still be undone",
+			FieldErrors: map[string]string{
+				"email": "Please wait until the recent change of the e-mail address can no longer be undone"}}
+	}
+	if err == nil {
+		_, err = tx.Exec(qDelete, acc.UUID)
+	}
+	if err == nil {
+		err = tx.Get(change, qCreate, hashToken(code), hashToken(undoCode), acc.UUID, email, acc.Email, expires)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	change.Code = code
+	change.UndoCode = undoCode
+
+	return change, nil
+}
+
+// Confirm replaces the e-mail address of the account by the new address. The change is kept,
+// such that it can still be undone from the previous address until it expires.
+func (change *EmailChange) Confirm() error {
+	const (
+		qConfirm = `UPDATE EmailChanges SET (isConfirmed, expires, updatedAt) = (TRUE, $1, now())
+		              WHERE code=$2 AND NOT isConfirmed AND expires > now()`
+		qAccount = `UPDATE Accounts SET (email, updatedAt) = ($1, now()) WHERE uuid=$2`
+	)
+
+	err := checkEmail(change.Email)
+	if err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(conf.GetServerConfig().EmailChangeLifeTime)
+
+	tx := database.MustBegin()
+	res, err := tx.Exec(qConfirm, expires, storedToken(change.Code))
+	if err == nil {
+		var n int64
+		n, err = res.RowsAffected()
+		if err == nil && n != 1 {
+			err = errors.New("Invalid or expired e-mail confirmation code")
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec(qAccount, change.Email, change.AccountUUID)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	change.IsConfirmed = true
+	change.Expires = expires
+
+	return nil
+}
+
+// Undo removes the change and restores the previous e-mail address if the change was already
+// confirmed. Pending password resets of the account are removed as well, since they may have
+// been sent to the new address.
+func (change *EmailChange) Undo() error {
+	const (
+		qDelete  = `DELETE FROM EmailChanges WHERE undoCode=$1 AND expires > now()`
+		qAccount = `UPDATE Accounts SET (email, updatedAt) = ($1, now()) WHERE uuid=$2 AND email=$3`
+		qResets  = `DELETE FROM PasswordResets WHERE accountUUID=$1`
+	)
+
+	tx := database.MustBegin()
+	res, err := tx.Exec(qDelete, storedToken(change.UndoCode))
+	if err == nil {
+		var n int64
+		n, err = res.RowsAffected()
+		if err == nil && n != 1 {
+			err = errors.New("Invalid or expired e-mail undo code")
+		}
+	}
+	if err == nil && change.IsConfirmed {
+		_, err = tx.Exec(qAccount, change.PreviousEmail, change.AccountUUID, change.Email)
+	}
+	if err == nil {
+		_, err = tx.Exec(qResets, change.AccountUUID)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Account returns the account of the change.
+func (change *EmailChange) Account() *Account {
+	const q = `SELECT * FROM Accounts WHERE uuid=$1`
+
+	account := &Account{}
+	err := database.Get(account, q, change.AccountUUID)
+	if err != nil {
+		panic(err)
+	}
+
+	return account
+}
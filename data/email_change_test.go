@@ -0,0 +1,180 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"testing"
+
+	"github.com/G-Node/gin-auth/util"
+)
+
+func TestGetEmailChange(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	change, ok := GetEmailChange("ec_a")
+	if !ok {
+		t.Fatal("Change does not exist")
+	}
+	if change.AccountUUID != uuidBob || change.Email != "bob@example.com" || change.PreviousEmail != "bob@foo.com" {
+		t.Errorf("Unexpected change '%v'", change)
+	}
+
+	// confirmed, expired and unknown codes
+	for _, code := range []string{"ec_b", "ec_x", "eu_a", "", "iDoNotExist"} {
+		if _, ok := GetEmailChange(code); ok {
+			t.Errorf("Change should not exist for code '%s'", code)
+		}
+	}
+}
+
+func TestGetEmailChangeByUndoCode(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	for _, code := range []string{"eu_a", "eu_b"} {
+		if _, ok := GetEmailChangeByUndoCode(code); !ok {
+			t.Errorf("Change should exist for undo code '%s'", code)
+		}
+	}
+
+	for _, code := range []string{"eu_x", "ec_a", "", "iDoNotExist"} {
+		if _, ok := GetEmailChangeByUndoCode(code); ok {
+			t.Errorf("Change should not exist for undo code '%s'", code)
+		}
+	}
+}
+
+func TestAccount_CreateEmailChange(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	acc, ok := GetAccount(uuidBob)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+
+	// invalid and existing addresses
+	for _, email := range []string{"a", "aaaa", "aclic@foo.com"} {
+		_, err := acc.CreateEmailChange(email)
+		if _, ok := err.(*util.ValidationError); !ok {
+			t.Errorf("Validation error expected for '%s' but was '%v'", email, err)
+		}
+	}
+
+	change, err := acc.CreateEmailChange("bob@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Code == "" || change.UndoCode == "" || change.IsConfirmed {
+		t.Errorf("Unconfirmed change with codes expected but was '%v'", change)
+	}
+	if change.PreviousEmail != "bob@foo.com" {
+		t.Errorf("Previous e-mail expected to be 'bob@foo.com' but was '%s'", change.PreviousEmail)
+	}
+
+	// the address is not changed yet and the previous change is replaced
+	if acc, _ = GetAccount(uuidBob); acc.Email != "bob@foo.com" {
+		t.Errorf("E-mail address should not be changed but was '%s'", acc.Email)
+	}
+	if _, ok := GetEmailChange("ec_a"); ok {
+		t.Error("Previous change should be removed")
+	}
+	if _, ok := GetEmailChange(change.Code); !ok {
+		t.Error("Change should exist")
+	}
+
+	// a confirmed change which can still be undone is not replaced
+	acc, ok = GetAccount("test0002-1234-6789-1234-678901234567")
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+	_, err = acc.CreateEmailChange("other@example.org")
+	if _, ok := err.(*util.ValidationError); !ok {
+		t.Errorf("Validation error expected but was '%v'", err)
+	}
+	if _, ok := GetEmailChangeByUndoCode("eu_b"); !ok {
+		t.Error("Confirmed change should still be valid for undo")
+	}
+}
+
+func TestEmailChange_Confirm(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	change, ok := GetEmailChange("ec_a")
+	if !ok {
+		t.Fatal("Change does not exist")
+	}
+
+	err := change.Confirm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc, _ := GetAccount(uuidBob); acc.Email != "bob@example.com" {
+		t.Errorf("E-mail address expected to be 'bob@example.com' but was '%s'", acc.Email)
+	}
+
+	// a change can only be confirmed once, but can still be undone
+	if _, ok := GetEmailChange("ec_a"); ok {
+		t.Error("Confirmed change should not be returned")
+	}
+	err = change.Confirm()
+	if err == nil {
+		t.Error("Error expected for a confirmed change")
+	}
+	if _, ok := GetEmailChangeByUndoCode("eu_a"); !ok {
+		t.Error("Confirmed change should still be valid for undo")
+	}
+}
+
+func TestEmailChange_Undo(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	const uuidConfirmed = "test0002-1234-6789-1234-678901234567"
+
+	// unconfirmed change
+	change, ok := GetEmailChangeByUndoCode("eu_a")
+	if !ok {
+		t.Fatal("Change does not exist")
+	}
+	err := change.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := GetEmailChange("ec_a"); ok {
+		t.Error("Change should be removed")
+	}
+	if acc, _ := GetAccount(uuidBob); acc.Email != "bob@foo.com" {
+		t.Errorf("E-mail address expected to be 'bob@foo.com' but was '%s'", acc.Email)
+	}
+
+	// confirmed change restores the previous address and removes password resets
+	change, ok = GetEmailChangeByUndoCode("eu_b")
+	if !ok {
+		t.Fatal("Change does not exist")
+	}
+	err = change.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc, _ := GetAccount(uuidConfirmed); acc.Email != "email2@foo.com" {
+		t.Errorf("E-mail address expected to be 'email2@foo.com' but was '%s'", acc.Email)
+	}
+	if _, ok := GetAccountByResetCode("rc_a"); ok {
+		t.Error("Password reset should be removed")
+	}
+
+	// a change can only be undone once
+	err = change.Undo()
+	if err == nil {
+		t.Error("Error expected for a removed change")
+	}
+}
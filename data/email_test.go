@@ -9,9 +9,11 @@
 package data
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/G-Node/gin-auth/conf"
 	"github.com/G-Node/gin-auth/util"
@@ -28,6 +30,134 @@ func TestGetQueuedEmails(t *testing.T) {
 	}
 }
 
+func TestListEmails(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	emails := ListEmails("")
+	if len(emails) != 3 {
+		t.Errorf("Exactly 3 e-mails expected but was %d", len(emails))
+	}
+	emails = ListEmails(EmailQueued)
+	if len(emails) != 2 {
+		t.Errorf("Exactly 2 queued e-mails expected but was %d", len(emails))
+	}
+	emails = ListEmails(EmailFailed)
+	if len(emails) != 1 {
+		t.Fatalf("Exactly 1 failed e-mail expected but was %d", len(emails))
+	}
+	if emails[0].LastError != "connection refused" {
+		t.Errorf("Unexpected last error '%s'", emails[0].LastError)
+	}
+}
+
+func TestGetEmail(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	failed := ListEmails(EmailFailed)[0]
+	email, ok := GetEmail(failed.Id)
+	if !ok {
+		t.Fatal("E-mail expected to exist")
+	}
+	if email.Status != EmailFailed || email.Attempts != 10 {
+		t.Errorf("Unexpected e-mail status '%s' with %d attempts", email.Status, email.Attempts)
+	}
+
+	_, ok = GetEmail(-1)
+	if ok {
+		t.Error("E-mail should not exist")
+	}
+}
+
+func TestGetDueEmails(t *testing.T) {
+	InitTestDb(t)
+
+	emails, err := GetDueEmails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 2 {
+		t.Errorf("Exactly 2 due e-mails expected but was %d", len(emails))
+	}
+
+	err = emails[0].Fail(errors.New("temporary failure"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails, err = GetDueEmails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 1 {
+		t.Errorf("Exactly 1 due e-mail expected but was %d", len(emails))
+	}
+}
+
+func TestEmail_Fail(t *testing.T) {
+	InitTestDb(t)
+
+	config := conf.GetSmtpCredentials()
+	email := &ListEmails(EmailQueued)[0]
+
+	// the delay doubles with every attempt
+	err := email.Fail(errors.New("first failure"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := email.NextAttempt.Sub(email.UpdatedAt)
+	if email.Status != EmailQueued || email.Attempts != 1 || email.LastError != "first failure" {
+		t.Errorf("Unexpected e-mail status '%s' with %d attempts and error '%s'",
+			email.Status, email.Attempts, email.LastError)
+	}
+	if first < config.RetryDelay-time.Second || first > config.RetryDelay+time.Second {
+		t.Errorf("Next attempt expected after '%s' but was after '%s'", config.RetryDelay, first)
+	}
+
+	err = email.Fail(errors.New("second failure"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := email.NextAttempt.Sub(email.UpdatedAt)
+	if second < 2*config.RetryDelay-time.Second || second > 2*config.RetryDelay+time.Second {
+		t.Errorf("Next attempt expected after '%s' but was after '%s'", 2*config.RetryDelay, second)
+	}
+
+	// the e-mail is marked as failed after the maximum number of attempts
+	email.Attempts = config.MaxAttempts - 1
+	err = email.Fail(errors.New("last failure"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Status != EmailFailed {
+		t.Errorf("E-mail status expected to be '%s' but was '%s'", EmailFailed, email.Status)
+	}
+	if delay := retryDelay(100); delay != config.MaxRetryDelay {
+		t.Errorf("Delay expected to be limited to '%s' but was '%s'", config.MaxRetryDelay, delay)
+	}
+}
+
+func TestEmail_Retry(t *testing.T) {
+	InitTestDb(t)
+
+	email := &ListEmails(EmailFailed)[0]
+	err := email.Retry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Status != EmailQueued || email.Attempts != 0 {
+		t.Errorf("Unexpected e-mail status '%s' with %d attempts", email.Status, email.Attempts)
+	}
+
+	emails, err := GetDueEmails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 3 {
+		t.Errorf("Exactly 3 due e-mails expected but was %d", len(emails))
+	}
+}
+
 func TestEmail_Create(t *testing.T) {
 	InitTestDb(t)
 
@@ -9,8 +9,12 @@
 package data
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/base64"
 	"errors"
+	"regexp"
 	"time"
 
 	"fmt"
@@ -18,18 +22,61 @@ import (
 	"github.com/G-Node/gin-auth/util"
 )
 
+// pkceRegex matches valid PKCE code verifiers and code challenges as defined by RFC 7636.
+var pkceRegex = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// Error codes of authorization and token requests as defined by RFC 6749 sections 4.1.2.1 and 5.2
+// and by RFC 8628 section 3.5 for device authorization requests
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+	OAuthAuthorizationPending    = "authorization_pending"
+	OAuthSlowDown                = "slow_down"
+	OAuthExpiredToken            = "expired_token"
+)
+
+// OAuthError is returned if an authorization or token request is invalid.
+// Code is one of the error codes defined by RFC 6749.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+// Error implements Go error
+func (err *OAuthError) Error() string {
+	return err.Description
+}
+
 // GrantRequest contains data about an ongoing authorization grant request.
+// PendingAccountUUID refers to an account whose password was verified during login,
+// but which still has to provide a second factor. DeviceCode, UserCode, PollInterval,
+// PolledAt and IsDenied are only used by device authorization requests (RFC 8628).
 type GrantRequest struct {
-	Token          string
-	GrantType      string
-	State          string
-	Code           sql.NullString
-	ScopeRequested util.StringSet
-	RedirectURI    string
-	ClientUUID     string
-	AccountUUID    sql.NullString
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	Token               string
+	GrantType           string
+	State               string
+	Code                sql.NullString
+	ScopeRequested      util.StringSet
+	RedirectURI         string
+	ClientUUID          string
+	AccountUUID         sql.NullString
+	CodeChallenge       sql.NullString
+	CodeChallengeMethod sql.NullString
+	Nonce               sql.NullString
+	PendingAccountUUID  sql.NullString
+	DeviceCode          sql.NullString
+	UserCode            sql.NullString
+	PollInterval        int
+	PolledAt            time.Time
+	IsDenied            bool
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
 }
 
 // ListGrantRequests returns all current grant requests ordered by creation time.
@@ -46,10 +93,10 @@ func ListGrantRequests() []GrantRequest {
 	return grantRequests
 }
 
-// GetGrantRequest returns a grant request with a given token.
+// GetGrantRequest returns a grant request with a given token, which was not denied.
 // Returns false if no request with a matching token exists.
 func GetGrantRequest(token string) (*GrantRequest, bool) {
-	const q = `SELECT * FROM GrantRequests WHERE token=$1 AND createdAt > $2`
+	const q = `SELECT * FROM GrantRequests WHERE token=$1 AND NOT isDenied AND createdAt > $2`
 
 	grantRequest := &GrantRequest{}
 	err := database.Get(grantRequest, q, token,
@@ -67,7 +114,7 @@ func GetGrantRequestByCode(code string) (*GrantRequest, bool) {
 	const q = `SELECT * FROM GrantRequests WHERE code=$1 AND code IS NOT NULL AND createdAt > $2`
 
 	grantRequest := &GrantRequest{}
-	err := database.Get(grantRequest, q, code,
+	err := database.Get(grantRequest, q, hashToken(code),
 		time.Now().Add(-1*conf.GetServerConfig().GrantReqLifeTime))
 	if err != nil && err != sql.ErrNoRows {
 		panic(err)
@@ -76,16 +123,19 @@ func GetGrantRequestByCode(code string) (*GrantRequest, bool) {
 	return grantRequest, err == nil
 }
 
-// ExchangeCodeForTokens creates an access token and a refresh token.
+// ExchangeCodeForTokens creates an access token and a refresh token and returns the encoded
+// access token (see AccessToken.Encode) and the refresh token.
 // Finally the grant request will be deleted from the database, even if the token creation fails!
 func (req *GrantRequest) ExchangeCodeForTokens() (string, string, error) {
 	defer req.Delete()
 
-	const qCreateRefresh = `INSERT INTO RefreshTokens (token, scope, clientUUID, accountUUID, createdAt, updatedAt)
-	                        VALUES ($1, $2, $3, $4, now(), now())
+	const qCreateRefresh = `INSERT INTO RefreshTokens (token, scope, clientUUID, accountUUID, family, rotated, expires,
+	                                                  createdAt, updatedAt)
+	                        VALUES ($1, $2, $3, $4, $1, FALSE, $5, now(), now())
 	                        RETURNING *`
-	const qCreateAccess = `INSERT INTO AccessTokens (token, scope, expires, clientUUID, accountUUID, createdAt, updatedAt)
-	                        VALUES ($1, $2, $3, $4, $5, now(), now())
+	const qCreateAccess = `INSERT INTO AccessTokens (token, scope, expires, clientUUID, accountUUID, refreshToken,
+	                                                 createdAt, updatedAt)
+	                        VALUES ($1, $2, $3, $4, $5, $6, now(), now())
 	                        RETURNING *`
 
 	if !req.AccountUUID.Valid || !req.IsApproved() {
@@ -96,16 +146,20 @@ func (req *GrantRequest) ExchangeCodeForTokens() (string, string, error) {
 		Token:       util.RandomToken(),
 		Scope:       req.ScopeRequested,
 		ClientUUID:  req.ClientUUID,
-		AccountUUID: req.AccountUUID.String}
+		AccountUUID: req.AccountUUID.String,
+		Expires:     time.Now().Add(conf.GetServerConfig().RefreshTokenLifeTime)}
 	access := &AccessToken{
-		Token:       util.RandomToken(),
-		Scope:       req.ScopeRequested,
-		Expires:     time.Now().Add(conf.GetServerConfig().GrantReqLifeTime),
-		ClientUUID:  req.ClientUUID,
-		AccountUUID: req.AccountUUID}
+		Token:        util.RandomToken(),
+		Scope:        req.ScopeRequested,
+		Expires:      time.Now().Add(conf.GetServerConfig().GrantReqLifeTime),
+		ClientUUID:   req.ClientUUID,
+		AccountUUID:  req.AccountUUID,
+		RefreshToken: sql.NullString{String: storedToken(refresh.Token), Valid: true}}
+	refreshToken, accessToken := refresh.Token, access.Token
 
 	tx := database.MustBegin()
-	err := tx.Get(refresh, qCreateRefresh, refresh.Token, refresh.Scope, refresh.ClientUUID, refresh.AccountUUID)
+	err := tx.Get(refresh, qCreateRefresh, storedToken(refresh.Token), refresh.Scope, refresh.ClientUUID,
+		refresh.AccountUUID, refresh.Expires)
 	if err != nil {
 		errTx := tx.Rollback()
 		if errTx != nil {
@@ -113,7 +167,8 @@ func (req *GrantRequest) ExchangeCodeForTokens() (string, string, error) {
 		}
 		return "", "", err
 	}
-	err = tx.Get(access, qCreateAccess, access.Token, access.Scope, access.Expires, access.ClientUUID, access.AccountUUID)
+	err = tx.Get(access, qCreateAccess, storedToken(access.Token), access.Scope, access.Expires, access.ClientUUID,
+		access.AccountUUID, access.RefreshToken)
 	if err != nil {
 		errTx := tx.Rollback()
 		if errTx != nil {
@@ -122,35 +177,58 @@ func (req *GrantRequest) ExchangeCodeForTokens() (string, string, error) {
 		return "", "", err
 	}
 	err = tx.Commit()
+	if err != nil {
+		return "", "", err
+	}
 
-	return access.Token, refresh.Token, err
+	refresh.Token, access.Token = refreshToken, accessToken
+	value, err := access.Encode()
+
+	return value, refresh.Token, err
 }
 
 // Create stores a new grant request.
+// Only the hashes of the code and device code are stored, but the plain codes remain
+// accessible via Code and DeviceCode.
 func (req *GrantRequest) Create() error {
 	const q = `INSERT INTO GrantRequests (token, grantType, state, code, scopeRequested, redirectUri,
-	                                      clientUUID, accountUUID, createdAt, updatedAt)
-	           VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now(), now())
+	                                      clientUUID, accountUUID, codeChallenge, codeChallengeMethod, nonce,
+	                                      pendingAccountUUID, deviceCode, userCode, pollInterval, polledAt,
+	                                      createdAt, updatedAt)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, now(), now(), now())
 	           RETURNING *`
 
 	if req.Token == "" {
 		req.Token = util.RandomToken()
 	}
 
-	return database.Get(req, q, req.Token, req.GrantType, req.State, req.Code, req.ScopeRequested,
-		req.RedirectURI, req.ClientUUID, req.AccountUUID)
+	code, deviceCode := req.Code, req.DeviceCode
+	err := database.Get(req, q, req.Token, req.GrantType, req.State, storedNullToken(req.Code), req.ScopeRequested,
+		req.RedirectURI, req.ClientUUID, req.AccountUUID, req.CodeChallenge, req.CodeChallengeMethod, req.Nonce,
+		req.PendingAccountUUID, storedNullToken(req.DeviceCode), req.UserCode, req.PollInterval)
+	req.Code, req.DeviceCode = code, deviceCode
+
+	return err
 }
 
 // Update an existing grant request.
+// Like for Create, only the hashes of the code and device code are stored.
 func (req *GrantRequest) Update() error {
 	const q = `UPDATE GrantRequests gr
-	           SET (grantType, state, code, scopeRequested, redirectUri, clientUUID, accountUUID, updatedAt) =
-	               ($1, $2, $3, $4, $5, $6, $7, now())
-	           WHERE token=$8
+	           SET (grantType, state, code, scopeRequested, redirectUri, clientUUID, accountUUID,
+	                codeChallenge, codeChallengeMethod, nonce, pendingAccountUUID, deviceCode, userCode,
+	                pollInterval, updatedAt) =
+	               ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, now())
+	           WHERE token=$15
 	           RETURNING *`
 
-	return database.Get(req, q, req.GrantType, req.State, req.Code, req.ScopeRequested, req.RedirectURI,
-		req.ClientUUID, req.AccountUUID, req.Token)
+	code, deviceCode := req.Code, req.DeviceCode
+	err := database.Get(req, q, req.GrantType, req.State, storedNullToken(req.Code), req.ScopeRequested,
+		req.RedirectURI, req.ClientUUID, req.AccountUUID, req.CodeChallenge, req.CodeChallengeMethod, req.Nonce,
+		req.PendingAccountUUID, storedNullToken(req.DeviceCode), req.UserCode, req.PollInterval, req.Token)
+	req.Code, req.DeviceCode = code, deviceCode
+
+	return err
 }
 
 // Delete removes an existing request from the database.
@@ -180,7 +258,7 @@ func (req *GrantRequest) IsApproved() bool {
 	}
 
 	client := req.Client()
-	if req.ScopeRequested.Intersect(client.ScopeBlacklist).Len() > 0 {
+	if req.ScopeRequested.Intersect(client.ScopeBlacklist).Len() > 0 || !client.AllowsScope(req.ScopeRequested) {
 		return false
 	}
 	if client.ScopeWhitelist.IsSuperset(req.ScopeRequested) {
@@ -195,3 +273,40 @@ func (req *GrantRequest) IsApproved() bool {
 
 	return scope.Union(client.ScopeWhitelist).IsSuperset(req.ScopeRequested)
 }
+
+// NarrowScope reduces the requested scope to the scope the user has approved, such that tokens
+// issued for the request only carry the approved scope. Scopes whitelisted for the client are kept.
+// Returns an error if no requested scope remains.
+func (req *GrantRequest) NarrowScope(approved util.StringSet) error {
+	scope := req.ScopeRequested.Intersect(approved.Union(req.Client().ScopeWhitelist))
+	if scope.Len() == 0 {
+		return errors.New("No scope was approved")
+	}
+
+	req.ScopeRequested = scope
+	return req.Update()
+}
+
+// VerifyCodeChallenge checks a PKCE code verifier (RFC 7636) against the code challenge
+// of the grant request. If the request has no code challenge, only an empty verifier is accepted.
+func (req *GrantRequest) VerifyCodeChallenge(verifier string) bool {
+	if !req.CodeChallenge.Valid {
+		return verifier == ""
+	}
+	if !pkceRegex.MatchString(verifier) {
+		return false
+	}
+
+	var computed string
+	switch req.CodeChallengeMethod.String {
+	case "S256":
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	case "plain":
+		computed = verifier
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(req.CodeChallenge.String)) == 1
+}
@@ -29,8 +29,8 @@ func TestListGrantRequests(t *testing.T) {
 	InitTestDb(t)
 
 	requests := ListGrantRequests()
-	if len(requests) != 4 {
-		t.Errorf("Exactly 4 grant requests expected in list but was %d", len(requests))
+	if len(requests) != 6 {
+		t.Errorf("Exactly 6 grant requests expected in list but was %d", len(requests))
 	}
 }
 
@@ -143,7 +143,7 @@ func TestGrantRequest_Create(t *testing.T) {
 	if check.State != state {
 		t.Error("State does not match")
 	}
-	if check.Code.Valid && check.Code.String != code {
+	if check.Code.Valid && check.Code.String != hashToken(code) {
 		t.Error("Code does not match")
 	}
 	if !check.ScopeRequested.Contains("foo-read") {
@@ -189,7 +189,7 @@ func TestGrantRequest_Update(t *testing.T) {
 	if !ok {
 		t.Error("Grant request does not exist")
 	}
-	if check.Code.Valid && check.Code.String != newCode {
+	if check.Code.Valid && check.Code.String != hashToken(newCode) {
 		t.Error("Code does not match")
 	}
 	if check.State != newState {
@@ -228,6 +228,33 @@ func TestGrantRequest_IsApproved(t *testing.T) {
 	}
 }
 
+func TestGrantRequest_NarrowScope(t *testing.T) {
+	InitTestDb(t)
+
+	request, ok := GetGrantRequest(grantReqTokenBob)
+	if !ok {
+		t.Fatal("Grant request does not exist")
+	}
+
+	// scopes which were not requested are ignored
+	err := request.NarrowScope(util.NewStringSet("account-read"))
+	if err == nil {
+		t.Error("Error expected")
+	}
+
+	err = request.NarrowScope(util.NewStringSet("repo-read", "account-read"))
+	if err != nil {
+		t.Error(err)
+	}
+	check, ok := GetGrantRequest(grantReqTokenBob)
+	if !ok {
+		t.Fatal("Grant request does not exist")
+	}
+	if check.ScopeRequested.Len() != 1 || !check.ScopeRequested.Contains("repo-read") {
+		t.Errorf("Scope 'repo-read' expected but was '%v'", check.ScopeRequested.Strings())
+	}
+}
+
 func TestGrantRequest_Delete(t *testing.T) {
 	InitTestDb(t)
 
@@ -246,3 +273,46 @@ func TestGrantRequest_Delete(t *testing.T) {
 		t.Error("Grant request should not exist")
 	}
 }
+
+func TestGrantRequest_VerifyCodeChallenge(t *testing.T) {
+	const verifier = "dBjftJeZ4CVP-mJ92K9RbE2GkXB7X4cUTlnE8mYVbtrk"
+	const challengeS256 = "cfJ6pHaJqoo2OhoajaK2YC2F4X8CRi6_h-ECLXsDzhg"
+
+	// request without code challenge
+	req := &GrantRequest{}
+	if !req.VerifyCodeChallenge("") {
+		t.Error("Empty verifier should be accepted without challenge")
+	}
+	if req.VerifyCodeChallenge(verifier) {
+		t.Error("Verifier should not be accepted without challenge")
+	}
+
+	// method S256
+	req.CodeChallenge = sql.NullString{String: challengeS256, Valid: true}
+	req.CodeChallengeMethod = sql.NullString{String: "S256", Valid: true}
+	if !req.VerifyCodeChallenge(verifier) {
+		t.Error("Verifier should match the S256 challenge")
+	}
+	if req.VerifyCodeChallenge("") {
+		t.Error("Empty verifier should not be accepted")
+	}
+	if req.VerifyCodeChallenge(challengeS256) {
+		t.Error("Challenge should not be accepted as verifier")
+	}
+
+	// method plain
+	req.CodeChallenge = sql.NullString{String: verifier, Valid: true}
+	req.CodeChallengeMethod = sql.NullString{String: "plain", Valid: true}
+	if !req.VerifyCodeChallenge(verifier) {
+		t.Error("Verifier should match the plain challenge")
+	}
+	if req.VerifyCodeChallenge(verifier + "x") {
+		t.Error("Wrong verifier should not be accepted")
+	}
+
+	// invalid verifier characters
+	req.CodeChallenge = sql.NullString{String: verifier + "!", Valid: true}
+	if req.VerifyCodeChallenge(verifier + "!") {
+		t.Error("Verifier with invalid characters should not be accepted")
+	}
+}
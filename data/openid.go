@@ -0,0 +1,112 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
+)
+
+// IDTokenClaims are the claims of an OpenID Connect id token.
+type IDTokenClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+	Nonce     string `json:"nonce,omitempty"`
+}
+
+// CreateIDToken creates a signed OpenID Connect id token for the account and client
+// of an approved grant request. The nonce of the request is passed on to the token.
+func (req *GrantRequest) CreateIDToken() (string, error) {
+	if !req.AccountUUID.Valid {
+		return "", errors.New("Grant request is not associated with an account")
+	}
+
+	client := req.Client()
+	now := time.Now()
+	claims := &IDTokenClaims{
+		Issuer:    conf.GetServerConfig().BaseURL,
+		Subject:   req.AccountUUID.String,
+		Audience:  client.Name,
+		ExpiresAt: now.Add(conf.GetServerConfig().IDTokenLifeTime).Unix(),
+		IssuedAt:  now.Unix(),
+		Nonce:     req.Nonce.String,
+	}
+
+	key := conf.GetSigningKey()
+	return util.SignJWT(claims, key.Algorithm, key.KeyID, key.Key)
+}
+
+// UserInfoAddress is the address claim of the OpenID Connect user info.
+type UserInfoAddress struct {
+	Locality string `json:"locality"`
+	Country  string `json:"country"`
+}
+
+// UserInfo contains the standard claims about an account returned by the
+// OpenID Connect user info endpoint. Institute and department are additional
+// claims specific to gin-auth.
+type UserInfo struct {
+	Subject           string           `json:"sub"`
+	PreferredUsername string           `json:"preferred_username"`
+	Name              string           `json:"name"`
+	GivenName         string           `json:"given_name"`
+	MiddleName        string           `json:"middle_name,omitempty"`
+	FamilyName        string           `json:"family_name"`
+	Profile           string           `json:"profile"`
+	Email             string           `json:"email,omitempty"`
+	EmailVerified     *bool            `json:"email_verified,omitempty"`
+	Address           *UserInfoAddress `json:"address,omitempty"`
+	Institute         string           `json:"institute,omitempty"`
+	Department        string           `json:"department,omitempty"`
+	UpdatedAt         int64            `json:"updated_at"`
+}
+
+// UserInfo maps the account data to OpenID Connect standard claims. Like for the
+// JSON representation, e-mail and affiliation are only present if WithMail or
+// WithAffiliation are set.
+func (am *AccountMarshaler) UserInfo() *UserInfo {
+	acc := am.Account
+
+	names := []string{acc.FirstName}
+	if acc.MiddleName.Valid && acc.MiddleName.String != "" {
+		names = append(names, acc.MiddleName.String)
+	}
+	names = append(names, acc.LastName)
+
+	info := &UserInfo{
+		Subject:           acc.UUID,
+		PreferredUsername: acc.Login,
+		Name:              strings.Join(names, " "),
+		GivenName:         acc.FirstName,
+		MiddleName:        acc.MiddleName.String,
+		FamilyName:        acc.LastName,
+		Profile:           conf.MakeUrl("/api/accounts/%s", acc.Login),
+		UpdatedAt:         acc.UpdatedAt.Unix(),
+	}
+	if am.WithMail {
+		// e-mail addresses are verified during account activation
+		verified := !acc.ActivationCode.Valid
+		info.Email = acc.Email
+		info.EmailVerified = &verified
+	}
+	if am.WithAffiliation {
+		info.Address = &UserInfoAddress{Locality: acc.City, Country: acc.Country}
+		info.Institute = acc.Institute
+		info.Department = acc.Department
+	}
+
+	return info
+}
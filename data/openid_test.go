@@ -0,0 +1,106 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
+)
+
+func TestGrantRequest_CreateIDToken(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	req, ok := GetGrantRequest(grantReqTokenAlice)
+	if !ok {
+		t.Fatal("Grant request does not exist")
+	}
+	req.Nonce = sql.NullString{String: "n-0S6_WzA2Mj", Valid: true}
+
+	token, err := req.CreateIDToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &IDTokenClaims{}
+	key := conf.GetSigningKey()
+	err = util.VerifyJWT(token, key.Algorithm, key.Key.Public(), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != uuidAlice {
+		t.Errorf("Subject '%s' expected but was '%s'", uuidAlice, claims.Subject)
+	}
+	if claims.Audience != "gin" {
+		t.Errorf("Audience 'gin' expected but was '%s'", claims.Audience)
+	}
+	if claims.Nonce != "n-0S6_WzA2Mj" {
+		t.Errorf("Nonce 'n-0S6_WzA2Mj' expected but was '%s'", claims.Nonce)
+	}
+	if claims.Issuer != conf.GetServerConfig().BaseURL {
+		t.Errorf("Unexpected issuer '%s'", claims.Issuer)
+	}
+	if claims.ExpiresAt <= claims.IssuedAt {
+		t.Error("Expiration time must be after issue time")
+	}
+
+	// request without account
+	req.AccountUUID = sql.NullString{}
+	_, err = req.CreateIDToken()
+	if err == nil {
+		t.Error("Creating an id token without account should fail")
+	}
+}
+
+func TestAccountMarshaler_UserInfo(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	account, ok := GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+
+	marshal := &AccountMarshaler{Account: account}
+	info := marshal.UserInfo()
+	if info.Subject != uuidAlice {
+		t.Errorf("Subject '%s' expected but was '%s'", uuidAlice, info.Subject)
+	}
+	if info.PreferredUsername != "alice" {
+		t.Errorf("Preferred username 'alice' expected but was '%s'", info.PreferredUsername)
+	}
+	if info.Name != "Alice Goodchild" {
+		t.Errorf("Name 'Alice Goodchild' expected but was '%s'", info.Name)
+	}
+	if info.Email != "" || info.EmailVerified != nil {
+		t.Error("Email not expected to be present")
+	}
+	if info.Address != nil || info.Institute != "" {
+		t.Error("Affiliation not expected to be present")
+	}
+
+	marshal.WithMail = true
+	marshal.WithAffiliation = true
+	info = marshal.UserInfo()
+	if info.Email != account.Email {
+		t.Errorf("Email '%s' expected but was '%s'", account.Email, info.Email)
+	}
+	if info.EmailVerified == nil || !*info.EmailVerified {
+		t.Error("Email of an active account is expected to be verified")
+	}
+	if info.Address == nil || info.Address.Locality != account.City || info.Address.Country != account.Country {
+		t.Error("Address does not match the affiliation")
+	}
+	if info.Institute != account.Institute || info.Department != account.Department {
+		t.Error("Institute and department do not match the affiliation")
+	}
+}
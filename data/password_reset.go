@@ -0,0 +1,146 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordReset is a single use code which allows to set a new password for an account.
+// Requesting a reset does not affect the account, it stays usable until the reset is completed.
+type PasswordReset struct {
+	Code        string
+	AccountUUID string
+	Expires     time.Time
+	CreatedAt   time.Time
+}
+
+// GetAccountByResetCode returns the account of a password reset code which is not expired.
+// Returns false if the code is invalid or the account is disabled.
+func GetAccountByResetCode(code string) (*Account, bool) {
+	const q = `SELECT a.* FROM Accounts a JOIN PasswordResets p ON p.accountUUID = a.uuid
+	           WHERE p.code=$1 AND p.expires > now() AND NOT a.isDisabled`
+
+	account := &Account{}
+	err := database.Get(account, q, hashToken(code))
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return account, err == nil
+}
+
+// SetPasswordReset creates a new password reset code, if an account can be found, that is
+// non disabled and has either email or login of a provided credential.
+// Returns false, if no non-disabled account with the credential as email or login can be found.
+func SetPasswordReset(credential string) (*Account, *PasswordReset, bool) {
+	const q = `SELECT * FROM Accounts WHERE NOT isDisabled AND (login=$1 OR email=$1)`
+
+	account := &Account{}
+	err := database.Get(account, q, credential)
+	if err == sql.ErrNoRows {
+		return nil, nil, false
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	reset, err := account.CreatePasswordReset()
+	if err != nil {
+		panic(err)
+	}
+
+	return account, reset, true
+}
+
+// CreatePasswordReset creates a new password reset code for the account, which expires after the
+// configured life time. All previous codes of the account are invalidated. Only the hash of the code
+// is stored, but the plain code is accessible via Code of the returned reset.
+func (acc *Account) CreatePasswordReset() (*PasswordReset, error) {
+	const (
+		qDelete = `DELETE FROM PasswordResets WHERE accountUUID=$1`
+		qCreate = `INSERT INTO PasswordResets (code, accountUUID, expires, createdAt)
+		           VALUES ($1, $2, $3, now())
+		           RETURNING *`
+	)
+
+	reset := &PasswordReset{}
+	code := util.RandomToken()
+	expires := time.Now().Add(conf.GetServerConfig().ResetCodeLifeTime)
+
+	tx := database.MustBegin()
+	_, err := tx.Exec(qDelete, acc.UUID)
+	if err == nil {
+		err = tx.Get(reset, qCreate, hashToken(code), acc.UUID, expires)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	reset.Code = code
+
+	return reset, nil
+}
+
+// ResetPassword sets a new password for the account using a password reset code. The code can only
+// be used once, all other codes of the account are invalidated as well. A pending activation code is
+// removed, since the code proves that the user has access to the e-mail address of the account.
+func (acc *Account) ResetPassword(code, plain string) error {
+	const (
+		qUse      = `DELETE FROM PasswordResets WHERE code=$1 AND accountUUID=$2 AND expires > now()`
+		qDelete   = `DELETE FROM PasswordResets WHERE accountUUID=$1`
+		qPassword = `UPDATE Accounts SET (pwHash, activationCode, updatedAt) = ($1, NULL, now())
+		               WHERE uuid=$2 RETURNING *`
+	)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	tx := database.MustBegin()
+	res, err := tx.Exec(qUse, hashToken(code), acc.UUID)
+	if err == nil {
+		var n int64
+		n, err = res.RowsAffected()
+		if err == nil && n != 1 {
+			err = errors.New("Invalid or expired password reset code")
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec(qDelete, acc.UUID)
+	}
+	if err == nil {
+		err = tx.Get(acc, qPassword, string(hash), acc.UUID)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"testing"
+
+	"github.com/G-Node/gin-auth/util"
+)
+
+func TestGetAccountByResetCode(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	const enabledUUID = "test0002-1234-6789-1234-678901234567"
+	const enabledCode = "rc_a"
+	const disabledCode = "rc_c"
+	const expiredCode = "rc_x"
+
+	acc, ok := GetAccountByResetCode(enabledCode)
+	if !ok {
+		t.Error("Account does not exist")
+	}
+	if acc.UUID != enabledUUID {
+		t.Errorf("UUID was expected to be '%s'", enabledUUID)
+	}
+
+	_, ok = GetAccountByResetCode(disabledCode)
+	if ok {
+		t.Error("Account should not exist")
+	}
+
+	_, ok = GetAccountByResetCode(expiredCode)
+	if ok {
+		t.Error("Expired code should not be valid")
+	}
+
+	_, ok = GetAccountByResetCode("")
+	if ok {
+		t.Error("Account should not exist")
+	}
+
+	_, ok = GetAccountByResetCode("iDoNotExist")
+	if ok {
+		t.Error("Account should not exist")
+	}
+}
+
+func TestSetPasswordReset(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	const disabledLogin = "inact_log4"
+	const disabledEmail = "email4@example.com"
+	const enabledLogin = "alice"
+	const enabledEmail = "aclic@foo.com"
+
+	// Test empty and non existing credential
+	_, _, ok := SetPasswordReset("")
+	if ok {
+		t.Error("Reset should not be created using an empty credential")
+	}
+	_, _, ok = SetPasswordReset("iDoNotExist")
+	if ok {
+		t.Error("Reset should not be created using non existing credential")
+	}
+
+	// Test login and email of disabled account
+	_, _, ok = SetPasswordReset(disabledLogin)
+	if ok {
+		t.Error("Reset should not be created using disabled account login")
+	}
+	_, _, ok = SetPasswordReset(disabledEmail)
+	if ok {
+		t.Error("Reset should not be created using disabled account email")
+	}
+
+	// Test valid reset using login, the account remains active
+	account, reset, ok := SetPasswordReset(enabledLogin)
+	if !ok {
+		t.Fatalf("Reset should be created using valid account login '%s'", enabledLogin)
+	}
+	if account.UUID != uuidAlice || reset.Code == "" {
+		t.Errorf("Reset code expected for alice but was '%v'", reset)
+	}
+	if _, ok := GetAccountByLogin(enabledLogin); !ok {
+		t.Error("Account should remain active")
+	}
+
+	// Test valid reset using email, the old code is invalidated
+	old := reset.Code
+	_, reset, ok = SetPasswordReset(enabledEmail)
+	if !ok {
+		t.Fatalf("Reset should be created using valid account email '%s'", enabledEmail)
+	}
+	if reset.Code == old {
+		t.Error("New reset code expected")
+	}
+	if _, ok := GetAccountByResetCode(old); ok {
+		t.Error("Old reset code should be invalid")
+	}
+	if _, ok := GetAccountByResetCode(reset.Code); !ok {
+		t.Error("New reset code should be valid")
+	}
+}
+
+func TestAccount_ResetPassword(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	const uuidInactive = "test0003-1234-6789-1234-678901234567"
+
+	acc, ok := GetAccountByResetCode("rc_b")
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+
+	// code of another account
+	err := acc.ResetPassword("rc_a", "newpassword")
+	if err == nil {
+		t.Error("Error expected for the code of another account")
+	}
+
+	err = acc.ResetPassword("rc_b", "newpassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acc.VerifyPassword("newpassword") {
+		t.Error("Password was not updated")
+	}
+	if _, ok := GetAccount(uuidInactive); !ok {
+		t.Error("Account should be activated by the reset")
+	}
+
+	// codes can only be used once
+	err = acc.ResetPassword("rc_b", "otherpassword")
+	if err == nil {
+		t.Error("Error expected for a used code")
+	}
+
+	// expired code
+	acc, ok = GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+	err = acc.ResetPassword("rc_x", "newpassword")
+	if err == nil {
+		t.Error("Error expected for an expired code")
+	}
+}
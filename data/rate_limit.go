@@ -0,0 +1,246 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+)
+
+// Actions protected by the rate limiter
+const (
+	RateLimitLogin  = "login"
+	RateLimitReset  = "reset"
+	RateLimitDevice = "device"
+)
+
+// AccountLockout records the temporary lockout of an account after too many failed logins.
+// A lockout ends at LockedUntil; if an admin removes a lockout, LockedUntil is set to the time
+// of the unlock and UnlockedBy contains the login of the admin.
+type AccountLockout struct {
+	ID          int64
+	AccountUUID string
+	IP          string
+	Failures    int
+	LockedUntil time.Time
+	UnlockedBy  sql.NullString
+	CreatedAt   time.Time
+}
+
+// rateLimitSubject returns the subject of rate limit events for an action.
+// Logins are limited per account UUID, reset requests per submitted login or e-mail.
+func rateLimitSubject(action, subject string) string {
+	if action == RateLimitReset {
+		return strings.ToLower(strings.TrimSpace(subject))
+	}
+	return subject
+}
+
+// rateLimitEvents returns the times of all events of an action within the rate limit window
+// in ascending order. If subject is empty the events are selected by IP address.
+func rateLimitEvents(action, ip, subject string) []time.Time {
+	const qIP = `SELECT createdAt FROM RateLimitEvents WHERE action=$1 AND ip=$2 AND createdAt > $3
+	             ORDER BY createdAt`
+	const qSubject = `SELECT createdAt FROM RateLimitEvents WHERE action=$1 AND subject=$2 AND createdAt > $3
+	                  ORDER BY createdAt`
+
+	since := time.Now().Add(-1 * conf.GetRateLimitConfig().Window)
+	events := make([]time.Time, 0)
+	var err error
+	if subject == "" {
+		err = database.Select(&events, qIP, action, ip, since)
+	} else {
+		err = database.Select(&events, qSubject, action, subject, since)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	return events
+}
+
+// windowExceeded returns the time until the number of events drops below max, or zero if
+// the limit is not exceeded.
+func windowExceeded(events []time.Time, max int) time.Duration {
+	if len(events) < max {
+		return 0
+	}
+	return time.Until(events[len(events)-max].Add(conf.GetRateLimitConfig().Window))
+}
+
+// progressiveDelay returns the remaining time a client has to wait after the last of the failed
+// logins of an account. The delay doubles with every failure after DelayAfterFailures.
+func progressiveDelay(events []time.Time) time.Duration {
+	config := conf.GetRateLimitConfig()
+	n := len(events) - config.DelayAfterFailures
+	if n < 0 {
+		return 0
+	}
+
+	delay := config.MaxDelay
+	if n < 30 && time.Second<<uint(n) < delay {
+		delay = time.Second << uint(n)
+	}
+
+	return time.Until(events[len(events)-1].Add(delay))
+}
+
+// CheckRateLimit checks whether a client may attempt an action. For logins the subject is the UUID
+// of the account (empty if the login does not belong to an account), for password reset requests
+// the submitted login or e-mail address. Invalid user codes of device authorization requests are
+// only limited per IP address and have no subject. Returns false together with the time the client has to
+// wait, if the account is locked or one of the limits is exceeded.
+func CheckRateLimit(action, ip, subject string) (time.Duration, bool) {
+	config := conf.GetRateLimitConfig()
+	subject = rateLimitSubject(action, subject)
+
+	var wait time.Duration
+	if action == RateLimitLogin && subject != "" {
+		if lockout, ok := GetActiveLockout(subject); ok {
+			wait = time.Until(lockout.LockedUntil)
+		}
+	}
+
+	if w := windowExceeded(rateLimitEvents(action, ip, ""), config.MaxAttemptsPerIP); w > wait {
+		wait = w
+	}
+
+	if subject != "" {
+		events := rateLimitEvents(action, ip, subject)
+		var w time.Duration
+		if action == RateLimitLogin {
+			w = progressiveDelay(events)
+		} else {
+			w = windowExceeded(events, config.MaxResetsPerAccount)
+		}
+		if w > wait {
+			wait = w
+		}
+	}
+
+	return wait, wait <= 0
+}
+
+// RecordRateLimitEvent records a failed login or a password reset request. If the number of failed
+// logins of an account reaches MaxFailuresPerAccount, the account is locked and its failures are reset.
+func RecordRateLimitEvent(action, ip, subject string) {
+	const qEvent = `INSERT INTO RateLimitEvents (action, ip, subject, createdAt) VALUES ($1, $2, $3, now())`
+	const qLock = `INSERT INTO AccountLockouts (accountUUID, ip, failures, lockedUntil, createdAt)
+	               VALUES ($1, $2, $3, $4, now())`
+	const qClear = `DELETE FROM RateLimitEvents WHERE action=$1 AND subject=$2`
+
+	config := conf.GetRateLimitConfig()
+	subject = rateLimitSubject(action, subject)
+	database.MustExec(qEvent, action, ip, sql.NullString{String: subject, Valid: subject != ""})
+
+	if action != RateLimitLogin || subject == "" {
+		return
+	}
+
+	failures := len(rateLimitEvents(action, ip, subject))
+	if failures < config.MaxFailuresPerAccount {
+		return
+	}
+
+	tx := database.MustBegin()
+	_, err := tx.Exec(qLock, subject, ip, failures, time.Now().Add(config.LockoutTime))
+	if err == nil {
+		_, err = tx.Exec(qClear, RateLimitLogin, subject)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		panic(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ClearLoginFailures removes all failed logins of an account, e.g. after a successful login.
+func ClearLoginFailures(accountUUID string) {
+	const q = `DELETE FROM RateLimitEvents WHERE action=$1 AND subject=$2`
+	database.MustExec(q, RateLimitLogin, accountUUID)
+}
+
+// GetActiveLockout returns the current lockout of an account.
+// Returns false if the account is not locked.
+func GetActiveLockout(accountUUID string) (*AccountLockout, bool) {
+	const q = `SELECT * FROM AccountLockouts WHERE accountUUID=$1 AND lockedUntil > now()
+	           ORDER BY lockedUntil DESC LIMIT 1`
+
+	lockout := &AccountLockout{}
+	err := database.Get(lockout, q, accountUUID)
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return lockout, err == nil
+}
+
+// ListAccountLockouts returns all recorded lockouts of an account, latest first.
+func ListAccountLockouts(accountUUID string) []AccountLockout {
+	const q = `SELECT * FROM AccountLockouts WHERE accountUUID=$1 ORDER BY createdAt DESC, id DESC`
+
+	lockouts := make([]AccountLockout, 0)
+	err := database.Select(&lockouts, q, accountUUID)
+	if err != nil {
+		panic(err)
+	}
+
+	return lockouts
+}
+
+// Unlock ends all active lockouts of the account and removes its failed logins.
+// The login of the admin is recorded with the lockouts.
+func (acc *Account) Unlock(admin string) error {
+	const qUnlock = `UPDATE AccountLockouts SET (lockedUntil, unlockedBy) = (now(), $2)
+	                 WHERE accountUUID=$1 AND lockedUntil > now()`
+	const qClear = `DELETE FROM RateLimitEvents WHERE action=$1 AND subject=$2`
+
+	tx := database.MustBegin()
+	_, err := tx.Exec(qUnlock, acc.UUID, admin)
+	if err == nil {
+		_, err = tx.Exec(qClear, RateLimitLogin, acc.UUID)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarshalJSON implements Marshaler for AccountLockout.
+func (lockout *AccountLockout) MarshalJSON() ([]byte, error) {
+	var unlockedBy *string
+	if lockout.UnlockedBy.Valid {
+		unlockedBy = &lockout.UnlockedBy.String
+	}
+	return json.Marshal(&struct {
+		IP          string    `json:"ip"`
+		Failures    int       `json:"failures"`
+		Active      bool      `json:"active"`
+		LockedUntil time.Time `json:"locked_until"`
+		UnlockedBy  *string   `json:"unlocked_by"`
+		CreatedAt   time.Time `json:"created_at"`
+	}{lockout.IP, lockout.Failures, lockout.LockedUntil.After(time.Now()), lockout.LockedUntil, unlockedBy, lockout.CreatedAt})
+}
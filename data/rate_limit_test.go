@@ -0,0 +1,147 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
+)
+
+const testIP = "192.0.2.1"
+
+// setRateLimitConfig replaces the rate limit configuration and returns a function that restores it.
+func setRateLimitConfig(config conf.RateLimitConfig) func() {
+	current := conf.GetRateLimitConfig()
+	previous := *current
+	*current = config
+	return func() { *current = previous }
+}
+
+func TestCheckRateLimitDelay(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+	defer setRateLimitConfig(conf.RateLimitConfig{
+		Window:                time.Minute,
+		MaxAttemptsPerIP:      100,
+		MaxFailuresPerAccount: 100,
+		DelayAfterFailures:    2,
+		MaxDelay:              time.Minute,
+		LockoutTime:           time.Minute,
+		MaxResetsPerAccount:   2,
+	})()
+
+	for i := 0; i < 2; i++ {
+		if _, ok := CheckRateLimit(RateLimitLogin, testIP, uuidAlice); !ok {
+			t.Fatalf("Attempt %d should not be throttled", i+1)
+		}
+		RecordRateLimitEvent(RateLimitLogin, testIP, uuidAlice)
+	}
+
+	wait, ok := CheckRateLimit(RateLimitLogin, testIP, uuidAlice)
+	if ok || wait <= 0 || wait > time.Second {
+		t.Errorf("Delay of up to one second expected but was '%s'", wait)
+	}
+	if _, ok := CheckRateLimit(RateLimitLogin, testIP, uuidBob); !ok {
+		t.Error("Other accounts should not be throttled")
+	}
+
+	ClearLoginFailures(uuidAlice)
+	if _, ok := CheckRateLimit(RateLimitLogin, testIP, uuidAlice); !ok {
+		t.Error("No delay expected after clearing the failures")
+	}
+
+	// reset requests
+	RecordRateLimitEvent(RateLimitReset, testIP, "Alice")
+	RecordRateLimitEvent(RateLimitReset, testIP, "alice ")
+	wait, ok = CheckRateLimit(RateLimitReset, testIP, "alice")
+	if ok || wait <= 0 || wait > time.Minute {
+		t.Errorf("Wait of up to one minute expected but was '%s'", wait)
+	}
+	if _, ok := CheckRateLimit(RateLimitReset, testIP, "bob"); !ok {
+		t.Error("Reset requests for other accounts should not be throttled")
+	}
+}
+
+func TestCheckRateLimitIP(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+	defer setRateLimitConfig(conf.RateLimitConfig{
+		Window:                time.Minute,
+		MaxAttemptsPerIP:      3,
+		MaxFailuresPerAccount: 100,
+		DelayAfterFailures:    100,
+		MaxDelay:              time.Minute,
+		LockoutTime:           time.Minute,
+		MaxResetsPerAccount:   100,
+	})()
+
+	RecordRateLimitEvent(RateLimitLogin, testIP, "")
+	RecordRateLimitEvent(RateLimitLogin, testIP, uuidAlice)
+	RecordRateLimitEvent(RateLimitLogin, testIP, uuidBob)
+
+	if _, ok := CheckRateLimit(RateLimitLogin, testIP, ""); ok {
+		t.Error("IP address expected to be throttled")
+	}
+	if _, ok := CheckRateLimit(RateLimitLogin, "192.0.2.2", ""); !ok {
+		t.Error("Other IP addresses should not be throttled")
+	}
+	if _, ok := CheckRateLimit(RateLimitReset, testIP, "alice"); !ok {
+		t.Error("Reset requests should be limited independently")
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+	defer setRateLimitConfig(conf.RateLimitConfig{
+		Window:                time.Minute,
+		MaxAttemptsPerIP:      100,
+		MaxFailuresPerAccount: 3,
+		DelayAfterFailures:    100,
+		MaxDelay:              time.Minute,
+		LockoutTime:           time.Hour,
+		MaxResetsPerAccount:   100,
+	})()
+
+	for i := 0; i < 3; i++ {
+		RecordRateLimitEvent(RateLimitLogin, testIP, uuidAlice)
+	}
+
+	lockout, ok := GetActiveLockout(uuidAlice)
+	if !ok {
+		t.Fatal("Account expected to be locked")
+	}
+	if lockout.Failures != 3 || lockout.IP != testIP {
+		t.Errorf("Unexpected lockout: %v", lockout)
+	}
+	wait, ok := CheckRateLimit(RateLimitLogin, "192.0.2.2", uuidAlice)
+	if ok || wait < 59*time.Minute {
+		t.Errorf("Wait of one hour expected but was '%s'", wait)
+	}
+
+	alice, _ := GetAccount(uuidAlice)
+	err := alice.Unlock("bob")
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := CheckRateLimit(RateLimitLogin, testIP, uuidAlice); !ok {
+		t.Error("Account expected to be unlocked")
+	}
+
+	lockouts := ListAccountLockouts(uuidAlice)
+	if len(lockouts) != 1 {
+		t.Fatalf("One lockout expected but got %d", len(lockouts))
+	}
+	if lockouts[0].UnlockedBy.String != "bob" {
+		t.Errorf("Lockout expected to be removed by 'bob' but was '%s'", lockouts[0].UnlockedBy.String)
+	}
+}
@@ -10,27 +10,40 @@ package data
 
 import (
 	"database/sql"
-	"github.com/G-Node/gin-auth/util"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
 )
 
 // RefreshToken represents an OAuth refresh token issued
 // in a `code` grant request.
+// If refresh token rotation is enabled, each use of a refresh token replaces it by a new
+// token of the same family. Replaced tokens are marked as rotated and kept until they
+// expire, such that a reuse can be detected.
+// Token and Family are stored as keyed hashes.
 type RefreshToken struct {
 	Token       string
 	Scope       util.StringSet
 	ClientUUID  string
 	AccountUUID string
+	Family      string
+	Rotated     bool
+	Expires     time.Time
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
-// ListRefreshTokens returns all refresh tokens sorted by creation time.
+// ListRefreshTokens returns all valid refresh tokens sorted by creation time.
 func ListRefreshTokens() []RefreshToken {
-	const q = `SELECT * FROM RefreshTokens ORDER BY createdAt`
+	const q = `SELECT * FROM RefreshTokens
+	           WHERE NOT rotated AND expires > now() AND updatedAt > $1
+	           ORDER BY createdAt`
 
 	refreshTokens := make([]RefreshToken, 0)
-	err := database.Select(&refreshTokens, q)
+	err := database.Select(&refreshTokens, q, refreshTokenIdleLimit())
 	if err != nil {
 		panic(err)
 	}
@@ -39,12 +52,28 @@ func ListRefreshTokens() []RefreshToken {
 }
 
 // GetRefreshToken returns a refresh token with a given token value.
-// Returns false if no such refresh token exists.
+// Returns false if no such refresh token exists or if the token was rotated or has expired.
 func GetRefreshToken(token string) (*RefreshToken, bool) {
-	const q = `SELECT * FROM RefreshTokens WHERE token=$1`
+	const q = `SELECT * FROM RefreshTokens
+	           WHERE token=$1 AND NOT rotated AND expires > now() AND updatedAt > $2`
+
+	refreshToken := &RefreshToken{}
+	err := database.Get(refreshToken, q, hashToken(token), refreshTokenIdleLimit())
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return refreshToken, err == nil
+}
+
+// GetRotatedRefreshToken returns a refresh token that was already replaced by a new token
+// of the same family. Presenting such a token indicates that the token was stolen.
+// Returns false if no such rotated refresh token exists.
+func GetRotatedRefreshToken(token string) (*RefreshToken, bool) {
+	const q = `SELECT * FROM RefreshTokens WHERE token=$1 AND rotated AND expires > now()`
 
 	refreshToken := &RefreshToken{}
-	err := database.Get(refreshToken, q, token)
+	err := database.Get(refreshToken, q, hashToken(token))
 	if err != nil && err != sql.ErrNoRows {
 		panic(err)
 	}
@@ -52,24 +81,127 @@ func GetRefreshToken(token string) (*RefreshToken, bool) {
 	return refreshToken, err == nil
 }
 
+// refreshTokenIdleLimit returns the time before which refresh tokens that were not used
+// are considered expired.
+func refreshTokenIdleLimit() time.Time {
+	return time.Now().Add(-1 * conf.GetServerConfig().RefreshTokenIdleTime)
+}
+
+// ExpiresAt returns the time at which the refresh token expires, which is either the end of its
+// absolute life time or the end of the idle time after its last use, whichever comes first.
+func (tok *RefreshToken) ExpiresAt() time.Time {
+	idle := tok.UpdatedAt.Add(conf.GetServerConfig().RefreshTokenIdleTime)
+	if idle.Before(tok.Expires) {
+		return idle
+	}
+	return tok.Expires
+}
+
 // Create stores a new refresh token in the database.
-// If the token is empty a random token will be generated.
+// If the token is empty a random token will be generated. A new token starts
+// its own family and expires after the configured refresh token life time.
+// Only the hash of the token is stored, but the plain token remains accessible via Token.
 func (tok *RefreshToken) Create() error {
-	const q = `INSERT INTO RefreshTokens (token, scope, clientUUID, accountUUID, createdAt, updatedAt)
-	           VALUES ($1, $2, $3, $4, now(), now())
+	const q = `INSERT INTO RefreshTokens (token, scope, clientUUID, accountUUID, family, rotated, expires,
+	                                      createdAt, updatedAt)
+	           VALUES ($1, $2, $3, $4, $5, FALSE, $6, now(), now())
 	           RETURNING *`
 
 	if tok.Token == "" {
 		tok.Token = util.RandomToken()
 	}
+	if tok.Family == "" {
+		tok.Family = storedToken(tok.Token)
+	}
+	if tok.Expires.IsZero() {
+		tok.Expires = time.Now().Add(conf.GetServerConfig().RefreshTokenLifeTime)
+	}
+
+	token := tok.Token
+	err := database.Get(tok, q, storedToken(tok.Token), tok.Scope, tok.ClientUUID, tok.AccountUUID,
+		storedToken(tok.Family), tok.Expires)
+	tok.Token = token
 
-	return database.Get(tok, q, tok.Token, tok.Scope, tok.ClientUUID, tok.AccountUUID)
+	return err
+}
+
+// Touch marks the refresh token as used, which resets its idle time.
+func (tok *RefreshToken) Touch() error {
+	const q = `UPDATE RefreshTokens SET updatedAt = now() WHERE token=$1 RETURNING *`
+
+	token := tok.Token
+	err := database.Get(tok, q, storedToken(tok.Token))
+	tok.Token = token
+
+	return err
+}
+
+// Rotate marks the refresh token as rotated and returns a new refresh token of the same family.
+// The new token has the same scope and keeps the absolute expiration time of the family.
+func (tok *RefreshToken) Rotate() (*RefreshToken, error) {
+	const qRotate = `UPDATE RefreshTokens SET (rotated, updatedAt) = (TRUE, now())
+	                 WHERE token=$1 AND NOT rotated`
+	const qCreate = `INSERT INTO RefreshTokens (token, scope, clientUUID, accountUUID, family, rotated, expires,
+	                                            createdAt, updatedAt)
+	                 VALUES ($1, $2, $3, $4, $5, FALSE, $6, now(), now())
+	                 RETURNING *`
+
+	fresh := &RefreshToken{
+		Token:       util.RandomToken(),
+		Scope:       tok.Scope,
+		ClientUUID:  tok.ClientUUID,
+		AccountUUID: tok.AccountUUID,
+		Family:      tok.Family,
+		Expires:     tok.Expires,
+	}
+
+	tx := database.MustBegin()
+	res, err := tx.Exec(qRotate, storedToken(tok.Token))
+	if err == nil {
+		var n int64
+		n, err = res.RowsAffected()
+		if err == nil && n != 1 {
+			err = errors.New("Refresh token was already rotated")
+		}
+	}
+	token := fresh.Token
+	if err == nil {
+		err = tx.Get(fresh, qCreate, storedToken(fresh.Token), fresh.Scope, fresh.ClientUUID, fresh.AccountUUID,
+			storedToken(fresh.Family), fresh.Expires)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	tok.Rotated = true
+	fresh.Token = token
+
+	return fresh, nil
 }
 
 // Delete removes an refresh token from the database.
+// All access tokens issued in exchange for the refresh token are removed as well.
 func (tok *RefreshToken) Delete() error {
 	const q = `DELETE FROM RefreshTokens WHERE token=$1`
 
-	_, err := database.Exec(q, tok.Token)
+	_, err := database.Exec(q, storedToken(tok.Token))
+	return err
+}
+
+// DeleteFamily removes the refresh token and all other tokens of the same family,
+// including rotated tokens, from the database. All access tokens issued in exchange
+// for these refresh tokens are removed as well.
+func (tok *RefreshToken) DeleteFamily() error {
+	const q = `DELETE FROM RefreshTokens WHERE family=$1`
+
+	_, err := database.Exec(q, storedToken(tok.Family))
 	return err
 }
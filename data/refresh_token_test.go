@@ -9,8 +9,12 @@
 package data
 
 import (
-	"github.com/G-Node/gin-auth/util"
+	"database/sql"
 	"testing"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
 )
 
 const (
@@ -90,3 +94,146 @@ func TestRefreshTokenDelete(t *testing.T) {
 		t.Error("Refresh token should not exist")
 	}
 }
+
+func TestRefreshTokenDeleteCascade(t *testing.T) {
+	InitTestDb(t)
+
+	refresh, ok := GetRefreshToken(refreshTokenAlice)
+	if !ok {
+		t.Error("Refresh token does not exist")
+	}
+
+	access := &AccessToken{
+		Token:        "TNKD4ZVE",
+		Scope:        refresh.Scope,
+		ClientUUID:   refresh.ClientUUID,
+		AccountUUID:  sql.NullString{String: refresh.AccountUUID, Valid: true},
+		RefreshToken: sql.NullString{String: refresh.Token, Valid: true},
+	}
+	err := access.Create()
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = refresh.Delete()
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, ok = GetAccessToken("TNKD4ZVE")
+	if ok {
+		t.Error("Access token should not exist")
+	}
+}
+
+func TestRefreshTokenRotate(t *testing.T) {
+	InitTestDb(t)
+
+	tok, ok := GetRefreshToken(refreshTokenAlice)
+	if !ok {
+		t.Fatal("Refresh token does not exist")
+	}
+
+	fresh, err := tok.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Token == tok.Token {
+		t.Error("Rotated token should differ from the original token")
+	}
+	if fresh.Family != tok.Family {
+		t.Errorf("Family '%s' expected but was '%s'", tok.Family, fresh.Family)
+	}
+	if !fresh.Expires.Equal(tok.Expires) {
+		t.Error("Rotated token should keep the expiration time of the family")
+	}
+
+	_, ok = GetRefreshToken(refreshTokenAlice)
+	if ok {
+		t.Error("Rotated token should not be valid any more")
+	}
+	_, ok = GetRotatedRefreshToken(refreshTokenAlice)
+	if !ok {
+		t.Error("Rotated token should be found as rotated token")
+	}
+	_, ok = GetRefreshToken(fresh.Token)
+	if !ok {
+		t.Error("New token should be valid")
+	}
+
+	_, err = tok.Rotate()
+	if err == nil {
+		t.Error("Rotating a token twice should fail")
+	}
+}
+
+func TestRefreshTokenDeleteFamily(t *testing.T) {
+	InitTestDb(t)
+
+	tok, ok := GetRefreshToken(refreshTokenAlice)
+	if !ok {
+		t.Fatal("Refresh token does not exist")
+	}
+	fresh, err := tok.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tok.DeleteFamily()
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, ok = GetRotatedRefreshToken(refreshTokenAlice)
+	if ok {
+		t.Error("Rotated token should not exist")
+	}
+	_, ok = GetRefreshToken(fresh.Token)
+	if ok {
+		t.Error("New token of the family should not exist")
+	}
+	if len(ListRefreshTokens()) != 1 {
+		t.Error("Tokens of other families should not be deleted")
+	}
+}
+
+func TestRefreshTokenIdleTime(t *testing.T) {
+	InitTestDb(t)
+
+	idle := time.Now().Add(-1*conf.GetServerConfig().RefreshTokenIdleTime - time.Hour)
+	database.MustExec("UPDATE RefreshTokens SET updatedAt = $1 WHERE token = $2", idle, hashToken(refreshTokenAlice))
+
+	_, ok := GetRefreshToken(refreshTokenAlice)
+	if ok {
+		t.Error("Idle refresh token should not be valid")
+	}
+
+	RemoveExpired()
+	if len(ListRefreshTokens()) != 1 {
+		t.Error("Idle refresh token should be removed by the cleaner")
+	}
+	_, ok = GetRotatedRefreshToken(refreshTokenAlice)
+	if ok {
+		t.Error("Idle refresh token should not exist")
+	}
+}
+
+func TestRefreshTokenExpiresAt(t *testing.T) {
+	InitTestDb(t)
+
+	tok, ok := GetRefreshToken(refreshTokenAlice)
+	if !ok {
+		t.Fatal("Refresh token does not exist")
+	}
+
+	idle := tok.UpdatedAt.Add(conf.GetServerConfig().RefreshTokenIdleTime)
+	tok.Expires = idle.Add(time.Hour)
+	if !tok.ExpiresAt().Equal(idle) {
+		t.Errorf("Expiration at the end of the idle time '%v' expected but was '%v'", idle, tok.ExpiresAt())
+	}
+
+	tok.Expires = idle.Add(-1 * time.Hour)
+	if !tok.ExpiresAt().Equal(tok.Expires) {
+		t.Errorf("Absolute expiration '%v' expected but was '%v'", tok.Expires, tok.ExpiresAt())
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/G-Node/gin-auth/conf"
+)
+
+// hashPrefix marks values that are stored as keyed hash in the database.
+const hashPrefix = "hmac:"
+
+// hashedColumns lists all columns which contain tokens, codes or secrets that are only
+// stored as keyed hashes. Refresh tokens have to be converted before their families,
+// since the family of a token refers to the value of the first token.
+var hashedColumns = []struct {
+	table  string
+	column string
+}{
+	{"AccessTokens", "token"},
+	{"RefreshTokens", "token"},
+	{"RefreshTokens", "family"},
+	{"Sessions", "token"},
+	{"GrantRequests", "code"},
+	{"GrantRequests", "deviceCode"},
+	{"Accounts", "activationCode"},
+	{"PasswordResets", "code"},
+	{"EmailChanges", "code"},
+	{"EmailChanges", "undoCode"},
+	{"Clients", "secret"},
+	{"Clients", "registrationToken"},
+}
+
+// hashToken computes the keyed hash (HMAC-SHA256) of a token, code or secret using the
+// configured pepper. Values presented by clients are always looked up by this hash.
+func hashToken(value string) string {
+	mac := hmac.New(sha256.New, conf.GetSecurityConfig().TokenPepper)
+	mac.Write([]byte(value))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// storedToken returns a value in the form it is stored in the database. In contrast
+// to hashToken, values that are already hashed are returned unchanged and empty
+// values remain empty. Never use this function for values presented by a client.
+func storedToken(value string) string {
+	if value == "" || strings.HasPrefix(value, hashPrefix) {
+		return value
+	}
+	return hashToken(value)
+}
+
+// storedNullToken is like storedToken for nullable values.
+func storedNullToken(value sql.NullString) sql.NullString {
+	if !value.Valid {
+		return value
+	}
+	return sql.NullString{String: storedToken(value.String), Valid: true}
+}
+
+// compareToken checks in constant time whether a plain value matches a stored hash.
+func compareToken(plain, stored string) bool {
+	return hmac.Equal([]byte(hashToken(plain)), []byte(stored))
+}
+
+// HashStoredValues replaces all tokens, codes and secrets which are still stored in
+// plain text by their keyed hash. Since clients present the same values as before, all
+// issued tokens and codes remain valid. Values that are already hashed are not changed.
+func HashStoredValues() {
+	const qSelect = `SELECT DISTINCT %[2]s FROM %[1]s
+	                 WHERE %[2]s IS NOT NULL AND %[2]s <> '' AND %[2]s NOT LIKE 'hmac:%%'`
+	const qUpdate = `UPDATE %[1]s SET %[2]s=$2 WHERE %[2]s=$1`
+
+	tx := database.MustBegin()
+	for _, c := range hashedColumns {
+		values := make([]string, 0)
+		err := tx.Select(&values, fmt.Sprintf(qSelect, c.table, c.column))
+		if err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+
+		for _, v := range values {
+			_, err = tx.Exec(fmt.Sprintf(qUpdate, c.table, c.column), v, hashToken(v))
+			if err != nil {
+				tx.Rollback()
+				panic(err)
+			}
+		}
+	}
+
+	err := tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/util"
+)
+
+func TestHashToken(t *testing.T) {
+	hash := hashToken(accessTokenAlice)
+	if !strings.HasPrefix(hash, hashPrefix) || len(hash) != len(hashPrefix)+64 {
+		t.Errorf("Unexpected hash '%s'", hash)
+	}
+	if hashToken(accessTokenAlice) != hash {
+		t.Error("Hash of the same value expected to be equal")
+	}
+	if hashToken(hash) == hash {
+		t.Error("Presented values should always be hashed")
+	}
+
+	if storedToken(accessTokenAlice) != hash {
+		t.Error("Plain value expected to be hashed")
+	}
+	if storedToken(hash) != hash {
+		t.Error("Hashed value expected to remain unchanged")
+	}
+	if storedToken("") != "" {
+		t.Error("Empty value expected to remain empty")
+	}
+	if storedNullToken(sql.NullString{}).Valid {
+		t.Error("Null value expected to remain null")
+	}
+
+	if !compareToken(accessTokenAlice, hash) {
+		t.Error("Plain value expected to match its hash")
+	}
+	if compareToken(hash, hash) {
+		t.Error("Hash should not match itself")
+	}
+	if compareToken("iDoNotExist", hash) {
+		t.Error("Wrong value should not match")
+	}
+}
+
+func TestHashStoredValues(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	// fixtures are hashed by InitTestDb
+	var plain int
+	err := database.Get(&plain, `SELECT count(*) FROM AccessTokens WHERE token NOT LIKE 'hmac:%'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain != 0 {
+		t.Errorf("No plain access tokens expected but found %d", plain)
+	}
+
+	// plain text values left by a previous version
+	database.MustExec(`UPDATE Sessions SET token = $1 WHERE token = $2`, "PLAINSES", hashToken(sessionTokenAlice))
+	database.MustExec(`INSERT INTO RefreshTokens (token, scope, clientUUID, accountUUID, family, rotated, expires,
+	                                              createdAt, updatedAt)
+	                   VALUES ('PLAINREF', '{"account-read"}', $1, $2, 'PLAINREF', FALSE, now() + INTERVAL '1 day',
+	                           now(), now())`, uuidClientGin, uuidAlice)
+	database.MustExec(`INSERT INTO AccessTokens (token, scope, expires, clientUUID, accountUUID, refreshToken,
+	                                             createdAt, updatedAt)
+	                   VALUES ('PLAINACC', '{"account-read"}', now() + INTERVAL '1 day', $1, $2, 'PLAINREF',
+	                           now(), now())`, uuidClientGin, uuidAlice)
+
+	HashStoredValues()
+	HashStoredValues() // a second run must not change anything
+
+	if _, ok := GetSession("PLAINSES"); !ok {
+		t.Error("Session expected to be valid after hashing")
+	}
+	refresh, ok := GetRefreshToken("PLAINREF")
+	if !ok {
+		t.Fatal("Refresh token expected to be valid after hashing")
+	}
+	if refresh.Family != hashToken("PLAINREF") {
+		t.Errorf("Family '%s' expected but was '%s'", hashToken("PLAINREF"), refresh.Family)
+	}
+	access, ok := GetAccessToken("PLAINACC")
+	if !ok {
+		t.Fatal("Access token expected to be valid after hashing")
+	}
+	if access.RefreshToken.String != refresh.Token {
+		t.Errorf("Reference to refresh token '%s' expected but was '%s'", refresh.Token, access.RefreshToken.String)
+	}
+}
@@ -10,18 +10,26 @@ package data
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/G-Node/gin-auth/conf"
 	"github.com/G-Node/gin-auth/util"
+	"github.com/pborman/uuid"
 )
 
 // Session contains data about session tokens used to identify
-// logged in accounts.
+// logged in accounts. The token is stored as keyed hash, therefore
+// sessions are addressed by their UUID outside of the login.
 type Session struct {
 	Token       string
+	UUID        string
 	Expires     time.Time
 	AccountUUID string
+	UserAgent   string
+	IP          string
+	LastSeen    time.Time
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
@@ -39,13 +47,41 @@ func ListSessions() []Session {
 	return sessions
 }
 
+// ListSessionsForAccount returns all active sessions of an account, the most recently
+// used session first.
+func ListSessionsForAccount(accountUUID string) []Session {
+	const q = `SELECT * FROM Sessions WHERE accountUUID=$1 AND expires > now() ORDER BY lastSeen DESC`
+
+	sessions := make([]Session, 0)
+	err := database.Select(&sessions, q, accountUUID)
+	if err != nil {
+		panic(err)
+	}
+
+	return sessions
+}
+
+// GetSessionByUUID returns an active session with a given UUID.
+// Returns false if no such session exists.
+func GetSessionByUUID(uuid string) (*Session, bool) {
+	const q = `SELECT * FROM Sessions WHERE uuid=$1 AND expires > now()`
+
+	session := &Session{}
+	err := database.Get(session, q, uuid)
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return session, err == nil
+}
+
 // GetSession returns a session with a given token.
 // Returns false if no such session exists.
 func GetSession(token string) (*Session, bool) {
 	const q = `SELECT * FROM Sessions WHERE token=$1 AND expires > now()`
 
 	session := &Session{}
-	err := database.Get(session, q, token)
+	err := database.Get(session, q, hashToken(token))
 	if err != nil && err != sql.ErrNoRows {
 		panic(err)
 	}
@@ -54,34 +90,120 @@ func GetSession(token string) (*Session, bool) {
 }
 
 // Create stores a new session.
-// If the token is empty a random token will be generated.
+// If the token is empty a random token will be generated. Only the hash of the token
+// is stored, but the plain token remains accessible via Token. If the UUID is empty a
+// new random UUID will be created.
 func (sess *Session) Create() error {
-	const q = `INSERT INTO Sessions (token, expires, accountUUID, createdAt, updatedAt)
-	           VALUES ($1, $2, $3, now(), now())
+	const q = `INSERT INTO Sessions (token, uuid, expires, accountUUID, userAgent, ip, lastSeen, createdAt, updatedAt)
+	           VALUES ($1, $2, $3, $4, $5, $6, now(), now(), now())
 	           RETURNING *`
 
 	sess.Expires = time.Now().Add(conf.GetServerConfig().SessionLifeTime)
 	if sess.Token == "" {
 		sess.Token = util.RandomToken()
 	}
+	if sess.UUID == "" {
+		sess.UUID = uuid.NewRandom().String()
+	}
+	if len(sess.UserAgent) > 512 {
+		sess.UserAgent = sess.UserAgent[:512]
+	}
+
+	token := sess.Token
+	err := database.Get(sess, q, storedToken(sess.Token), sess.UUID, sess.Expires, sess.AccountUUID,
+		sess.UserAgent, sess.IP)
+	sess.Token = token
 
-	return database.Get(sess, q, sess.Token, sess.Expires, sess.AccountUUID)
+	return err
 }
 
-// UpdateExpirationTime updates the expiration time and stores
-// the new time in the database.
+// UpdateExpirationTime updates the expiration time and the time the session
+// was last seen and stores the new times in the database.
 func (sess *Session) UpdateExpirationTime() error {
-	const q = `UPDATE Sessions SET (expires, updatedAt) = ($1, now())
+	const q = `UPDATE Sessions SET (expires, lastSeen, updatedAt) = ($1, now(), now())
 	           WHERE token=$2
 	           RETURNING *`
 
-	return database.Get(sess, q, time.Now().Add(conf.GetServerConfig().SessionLifeTime), sess.Token)
+	token := sess.Token
+	err := database.Get(sess, q, time.Now().Add(conf.GetServerConfig().SessionLifeTime), storedToken(sess.Token))
+	sess.Token = token
+
+	return err
 }
 
 // Delete removes a session from the database.
 func (sess *Session) Delete() error {
 	const q = `DELETE FROM Sessions WHERE token=$1`
 
-	_, err := database.Exec(q, sess.Token)
+	_, err := database.Exec(q, storedToken(sess.Token))
 	return err
 }
+
+// DeleteSessionsForAccount removes all sessions of an account except the session with the
+// given token. Pass an empty token to remove all sessions.
+func DeleteSessionsForAccount(accountUUID, except string) error {
+	const q = `DELETE FROM Sessions WHERE accountUUID=$1 AND token<>$2`
+
+	_, err := database.Exec(q, accountUUID, hashToken(except))
+	return err
+}
+
+// Logout signs an account out everywhere by removing all its sessions together with
+// all access tokens and refresh tokens issued for the account.
+func (acc *Account) Logout() error {
+	const (
+		qSessions = `DELETE FROM Sessions WHERE accountUUID=$1`
+		qAccess   = `DELETE FROM AccessTokens WHERE accountUUID=$1`
+		qRefresh  = `DELETE FROM RefreshTokens WHERE accountUUID=$1`
+	)
+
+	tx := database.MustBegin()
+	_, err := tx.Exec(qSessions, acc.UUID)
+	if err == nil {
+		_, err = tx.Exec(qAccess, acc.UUID)
+	}
+	if err == nil {
+		_, err = tx.Exec(qRefresh, acc.UUID)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SessionMarshaler wraps a Session together with an Account to provide all
+// information needed to marshal a Session. Current marks the session the
+// request was made with.
+type SessionMarshaler struct {
+	Session *Session
+	Account *Account
+	Current bool
+}
+
+// MarshalJSON implements Marshaler for SessionMarshaler
+func (sm *SessionMarshaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		URL       string    `json:"url"`
+		UUID      string    `json:"uuid"`
+		UserAgent string    `json:"user_agent"`
+		IP        string    `json:"ip"`
+		Current   bool      `json:"current"`
+		LastSeen  time.Time `json:"last_seen"`
+		Expires   time.Time `json:"expires"`
+		CreatedAt time.Time `json:"created_at"`
+	}{
+		URL:       conf.MakeUrl("/api/accounts/%s/sessions/%s", sm.Account.Login, sm.Session.UUID),
+		UUID:      sm.Session.UUID,
+		UserAgent: sm.Session.UserAgent,
+		IP:        sm.Session.IP,
+		Current:   sm.Current,
+		LastSeen:  sm.Session.LastSeen,
+		Expires:   sm.Session.Expires,
+		CreatedAt: sm.Session.CreatedAt,
+	})
+}
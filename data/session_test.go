@@ -17,6 +17,7 @@ import (
 
 const (
 	sessionTokenAlice = "DNM5RS3C"
+	sessionUUIDAlice  = "5c1a2b2e-3b8f-4f5e-9d0a-6c7e8f9a0b1c"
 	sessionTokenBob   = "2MFZZUKI" // is expired
 )
 
@@ -25,8 +26,42 @@ func TestListSessions(t *testing.T) {
 	InitTestDb(t)
 
 	sessions := ListSessions()
+	if len(sessions) != 3 {
+		t.Error("Exactly three sessions expected in slice.")
+	}
+}
+
+func TestListSessionsForAccount(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	sessions := ListSessionsForAccount(uuidAlice)
 	if len(sessions) != 2 {
-		t.Error("Exactly two sessions expected in slice.")
+		t.Fatalf("Two sessions expected but was %d", len(sessions))
+	}
+	if sessions[0].UUID != sessionUUIDAlice {
+		t.Error("The most recently used session expected first")
+	}
+	if sessions[0].UserAgent != "Mozilla/5.0" || sessions[0].IP != "192.0.2.1" {
+		t.Errorf("Unexpected user agent or IP: '%s' '%s'", sessions[0].UserAgent, sessions[0].IP)
+	}
+}
+
+func TestGetSessionByUUID(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	sess, ok := GetSessionByUUID(sessionUUIDAlice)
+	if !ok {
+		t.Error("Session does not exist")
+	}
+	if sess.AccountUUID != uuidAlice {
+		t.Errorf("AccountUUID was expectd to be '%s'", uuidAlice)
+	}
+
+	_, ok = GetSessionByUUID("doesNotExist")
+	if ok {
+		t.Error("Session should not exist")
 	}
 }
 
@@ -60,7 +95,9 @@ func TestCreateSession(t *testing.T) {
 	fresh := Session{
 		Token:       token,
 		Expires:     time.Now().Add(time.Hour * 12),
-		AccountUUID: uuidAlice}
+		AccountUUID: uuidAlice,
+		UserAgent:   "Mozilla/5.0",
+		IP:          "192.0.2.3"}
 
 	err := fresh.Create()
 	if err != nil {
@@ -74,6 +111,12 @@ func TestCreateSession(t *testing.T) {
 	if check.AccountUUID != uuidAlice {
 		t.Errorf("AccountUUID is supposed to be '%s'", uuidAlice)
 	}
+	if check.UUID == "" || check.UUID != fresh.UUID {
+		t.Error("UUID expected")
+	}
+	if check.UserAgent != "Mozilla/5.0" || check.IP != "192.0.2.3" {
+		t.Errorf("Unexpected user agent or IP: '%s' '%s'", check.UserAgent, check.IP)
+	}
 }
 
 func TestSessionUpdateExpirationTime(t *testing.T) {
@@ -123,3 +166,50 @@ func TestSessionDelete(t *testing.T) {
 		t.Error("Session should not exist")
 	}
 }
+
+func TestDeleteSessionsForAccount(t *testing.T) {
+	InitTestDb(t)
+
+	err := DeleteSessionsForAccount(uuidAlice, sessionTokenAlice)
+	if err != nil {
+		t.Error(err)
+	}
+	sessions := ListSessionsForAccount(uuidAlice)
+	if len(sessions) != 1 || sessions[0].UUID != sessionUUIDAlice {
+		t.Error("Only the current session should remain")
+	}
+
+	err = DeleteSessionsForAccount(uuidAlice, "")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(ListSessionsForAccount(uuidAlice)) != 0 {
+		t.Error("No session should remain")
+	}
+}
+
+func TestAccountLogout(t *testing.T) {
+	InitTestDb(t)
+
+	account, ok := GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+
+	err := account.Logout()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(ListSessionsForAccount(uuidAlice)) != 0 {
+		t.Error("No session should remain")
+	}
+	if _, ok = GetAccessToken(accessTokenAlice); ok {
+		t.Error("Access token should not exist")
+	}
+	if _, ok = GetRefreshToken(refreshTokenAlice); ok {
+		t.Error("Refresh token should not exist")
+	}
+	if _, ok = GetSession("4KDNO8T0"); !ok {
+		t.Error("Session of bob should still exist")
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
+)
+
+// Number and length of the recovery codes created when two-factor authentication is enabled
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+// TOTPSecret is the shared secret used by an account to generate time-based one-time
+// passwords (RFC 6238). The secret is only used for login after the enrolment was confirmed
+// with a valid code. LastCounter is the time step of the last accepted code, which prevents
+// codes from being used twice.
+type TOTPSecret struct {
+	AccountUUID string
+	Secret      string
+	Confirmed   bool
+	LastCounter int64
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// GetTOTPSecret returns the TOTP secret of an account.
+// Returns false if the account has no secret.
+func GetTOTPSecret(accountUUID string) (*TOTPSecret, bool) {
+	const q = `SELECT * FROM TOTPSecrets WHERE accountUUID=$1`
+
+	secret := &TOTPSecret{}
+	err := database.Get(secret, q, accountUUID)
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return secret, err == nil
+}
+
+// RequiresTwoFactor returns true if the scope contains one of the scopes that may only
+// be granted to accounts using two-factor authentication.
+func RequiresTwoFactor(scope util.StringSet) bool {
+	restricted := util.NewStringSet(conf.GetSecurityConfig().TwoFactorScopes...)
+	return scope.Intersect(restricted).Len() > 0
+}
+
+// HasTwoFactor returns true if two-factor authentication is enabled for the account.
+func (acc *Account) HasTwoFactor() bool {
+	secret, ok := GetTOTPSecret(acc.UUID)
+	return ok && secret.Confirmed
+}
+
+// EnrollTOTP creates a new unconfirmed TOTP secret for the account. A previous unconfirmed
+// secret is replaced. Returns an error if two-factor authentication is already enabled.
+func (acc *Account) EnrollTOTP() (*TOTPSecret, error) {
+	const qDelete = `DELETE FROM TOTPSecrets WHERE accountUUID=$1 AND NOT confirmed`
+	const qCreate = `INSERT INTO TOTPSecrets (accountUUID, secret, confirmed, lastCounter, createdAt, updatedAt)
+	                 VALUES ($1, $2, FALSE, 0, now(), now())
+	                 RETURNING *`
+
+	if acc.HasTwoFactor() {
+		return nil, errors.New("Two-factor authentication is already enabled")
+	}
+
+	_, err := database.Exec(qDelete, acc.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &TOTPSecret{}
+	err = database.Get(secret, qCreate, acc.UUID, util.RandomTOTPSecret())
+	if err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// VerifySecondFactor checks a one-time password or, if this fails, a recovery code of an
+// account with enabled two-factor authentication. A matching recovery code is removed.
+func (acc *Account) VerifySecondFactor(code string) bool {
+	secret, ok := GetTOTPSecret(acc.UUID)
+	if !ok || !secret.Confirmed {
+		return false
+	}
+
+	code = strings.TrimSpace(code)
+	return secret.Verify(code) || acc.useRecoveryCode(code)
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of the account.
+func (acc *Account) CountRecoveryCodes() int {
+	const q = `SELECT count(*) FROM RecoveryCodes WHERE accountUUID=$1`
+
+	var count int
+	err := database.Get(&count, q, acc.UUID)
+	if err != nil {
+		panic(err)
+	}
+
+	return count
+}
+
+// DisableTwoFactor removes the TOTP secret and all recovery codes of the account.
+func (acc *Account) DisableTwoFactor() error {
+	const qCodes = `DELETE FROM RecoveryCodes WHERE accountUUID=$1`
+	const qSecret = `DELETE FROM TOTPSecrets WHERE accountUUID=$1`
+
+	tx := database.MustBegin()
+	_, err := tx.Exec(qCodes, acc.UUID)
+	if err == nil {
+		_, err = tx.Exec(qSecret, acc.UUID)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// useRecoveryCode removes a matching recovery code of the account.
+// Returns false if the code does not match any unused recovery code.
+func (acc *Account) useRecoveryCode(code string) bool {
+	const q = `DELETE FROM RecoveryCodes WHERE accountUUID=$1 AND code=$2`
+
+	res, err := database.Exec(q, acc.UUID, hashToken(strings.ToUpper(code)))
+	if err != nil {
+		panic(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+
+	return n == 1
+}
+
+// Verify checks a one-time password against the secret. Since each code must only be used once,
+// codes of time steps up to the last accepted time step are rejected.
+func (sec *TOTPSecret) Verify(code string) bool {
+	const q = `UPDATE TOTPSecrets SET (lastCounter, updatedAt) = ($2, now())
+	           WHERE accountUUID=$1 AND lastCounter < $2
+	           RETURNING *`
+
+	counter, ok := util.VerifyTOTP(sec.Secret, code, time.Now())
+	if !ok {
+		return false
+	}
+
+	err := database.Get(sec, q, sec.AccountUUID, counter)
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return err == nil
+}
+
+// URI returns the otpauth URI of the secret, which can be used to add the secret
+// to an authenticator app.
+func (sec *TOTPSecret) URI(login string) string {
+	return util.TOTPURI(conf.GetSecurityConfig().TwoFactorIssuer, login, sec.Secret)
+}
+
+// Confirm enables two-factor authentication for the account if the one-time password is valid.
+// Returns new recovery codes; only the hashes of the codes are stored, therefore the plain codes
+// can only be shown once. Returns false if the code is invalid or the secret was already confirmed.
+func (sec *TOTPSecret) Confirm(code string) ([]string, bool) {
+	const qConfirm = `UPDATE TOTPSecrets SET (confirmed, updatedAt) = (TRUE, now())
+	                  WHERE accountUUID=$1
+	                  RETURNING *`
+	const qDelete = `DELETE FROM RecoveryCodes WHERE accountUUID=$1`
+	const qCode = `INSERT INTO RecoveryCodes (code, accountUUID, createdAt) VALUES ($1, $2, now())`
+
+	if sec.Confirmed || !sec.Verify(strings.TrimSpace(code)) {
+		return nil, false
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i] = util.RandomToken()[:recoveryCodeLength]
+	}
+
+	tx := database.MustBegin()
+	err := tx.Get(sec, qConfirm, sec.AccountUUID)
+	if err == nil {
+		_, err = tx.Exec(qDelete, sec.AccountUUID)
+	}
+	for i := 0; err == nil && i < len(codes); i++ {
+		_, err = tx.Exec(qCode, hashToken(codes[i]), sec.AccountUUID)
+	}
+	if err != nil {
+		errTx := tx.Rollback()
+		if errTx != nil {
+			err = fmt.Errorf("After initial error '%v'\nrollback failed: '%v'\n", err, errTx)
+		}
+		panic(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+
+	return codes, true
+}
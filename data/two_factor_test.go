@@ -0,0 +1,118 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
+)
+
+func totpCode(t *testing.T, secret string, counter int64) string {
+	code, err := util.TOTPCode(secret, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTwoFactor(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	acc, ok := GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+
+	secret, err := acc.EnrollTOTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.HasTwoFactor() {
+		t.Error("Unconfirmed secret should not enable two-factor authentication")
+	}
+	if !strings.HasPrefix(secret.URI(acc.Login), "otpauth://totp/") {
+		t.Errorf("Unexpected URI '%s'", secret.URI(acc.Login))
+	}
+
+	// a new enrolment replaces the unconfirmed secret
+	secret, err = acc.EnrollTOTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := secret.Confirm("000000x"); ok {
+		t.Error("Invalid code should not confirm the secret")
+	}
+	now := util.TOTPCounter(time.Now())
+	codes, ok := secret.Confirm(totpCode(t, secret.Secret, now))
+	if !ok {
+		t.Fatal("Valid code should confirm the secret")
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("%d recovery codes expected but got %d", recoveryCodeCount, len(codes))
+	}
+	if !acc.HasTwoFactor() {
+		t.Error("Two-factor authentication expected to be enabled")
+	}
+	if _, err := acc.EnrollTOTP(); err == nil {
+		t.Error("Enrolment should fail if two-factor authentication is enabled")
+	}
+
+	// codes can only be used once
+	if acc.VerifySecondFactor(totpCode(t, secret.Secret, now)) {
+		t.Error("Code already used for confirmation should be rejected")
+	}
+	if !acc.VerifySecondFactor(totpCode(t, secret.Secret, now+1)) {
+		t.Error("Code of the next time step expected to be valid")
+	}
+	if !acc.VerifySecondFactor(strings.ToLower(codes[0])) {
+		t.Error("Recovery code expected to be valid")
+	}
+	if acc.VerifySecondFactor(codes[0]) {
+		t.Error("Recovery code should only be valid once")
+	}
+	if n := acc.CountRecoveryCodes(); n != recoveryCodeCount-1 {
+		t.Errorf("%d recovery codes expected but got %d", recoveryCodeCount-1, n)
+	}
+
+	err = acc.DisableTwoFactor()
+	if err != nil {
+		t.Error(err)
+	}
+	if acc.HasTwoFactor() || acc.CountRecoveryCodes() != 0 {
+		t.Error("Two-factor authentication expected to be disabled")
+	}
+	if acc.VerifySecondFactor(codes[1]) {
+		t.Error("Recovery codes should be removed")
+	}
+}
+
+func TestRequiresTwoFactor(t *testing.T) {
+	config := conf.GetSecurityConfig()
+	scopes := config.TwoFactorScopes
+	defer func() { config.TwoFactorScopes = scopes }()
+
+	config.TwoFactorScopes = []string{"account-admin", "repo-write"}
+	if !RequiresTwoFactor(util.NewStringSet("repo-read", "repo-write")) {
+		t.Error("Scope 'repo-write' expected to require two-factor authentication")
+	}
+	if RequiresTwoFactor(util.NewStringSet("repo-read", "account-read")) {
+		t.Error("Scope should not require two-factor authentication")
+	}
+
+	config.TwoFactorScopes = nil
+	if RequiresTwoFactor(util.NewStringSet("account-admin")) {
+		t.Error("No scope should require two-factor authentication")
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/util"
+)
+
+// Types of WebAuthn ceremonies as used in the client data
+const (
+	WebAuthnCreate = "webauthn.create"
+	WebAuthnGet    = "webauthn.get"
+)
+
+// WebAuthnCredential is a public key credential of a security key or platform authenticator
+// registered for an account. The ID is the base64url encoded credential ID.
+type WebAuthnCredential struct {
+	ID          string
+	AccountUUID string
+	PublicKey   []byte
+	SignCount   int64
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// WebAuthnChallenge is a single-use challenge issued for a registration or login ceremony.
+// Challenges for passwordless logins are not bound to an account.
+type WebAuthnChallenge struct {
+	Challenge   string
+	Ceremony    string
+	AccountUUID sql.NullString
+	CreatedAt   time.Time
+}
+
+// WebAuthnRPID returns the relying party ID, which is the host name of the server base URL.
+func WebAuthnRPID() string {
+	base, err := url.Parse(conf.GetServerConfig().BaseURL)
+	if err != nil {
+		panic(err)
+	}
+	return base.Hostname()
+}
+
+// WebAuthnOrigin returns the origin expected in the client data of WebAuthn ceremonies.
+func WebAuthnOrigin() string {
+	base, err := url.Parse(conf.GetServerConfig().BaseURL)
+	if err != nil {
+		panic(err)
+	}
+	return base.Scheme + "://" + base.Host
+}
+
+// NewWebAuthnChallenge creates and stores a new random challenge for a ceremony.
+func NewWebAuthnChallenge(ceremony string, accountUUID sql.NullString) (*WebAuthnChallenge, error) {
+	const q = `INSERT INTO WebAuthnChallenges (challenge, ceremony, accountUUID, createdAt)
+	           VALUES ($1, $2, $3, now())
+	           RETURNING *`
+
+	rnd := make([]byte, 32)
+	_, err := rand.Read(rnd)
+	if err != nil {
+		panic(err)
+	}
+
+	challenge := &WebAuthnChallenge{}
+	err = database.Get(challenge, q, base64.RawURLEncoding.EncodeToString(rnd), ceremony, accountUUID)
+	return challenge, err
+}
+
+// useWebAuthnChallenge removes a challenge of a ceremony issued within the life time of grant
+// requests. Returns false if no such challenge exists.
+func useWebAuthnChallenge(challenge, ceremony string) (*WebAuthnChallenge, bool) {
+	const q = `DELETE FROM WebAuthnChallenges WHERE challenge=$1 AND ceremony=$2 AND createdAt > $3
+	           RETURNING *`
+
+	ch := &WebAuthnChallenge{}
+	err := database.Get(ch, q, challenge, ceremony, time.Now().Add(-1*conf.GetServerConfig().GrantReqLifeTime))
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return ch, err == nil
+}
+
+// ListWebAuthnCredentials returns all credentials registered for an account.
+func ListWebAuthnCredentials(accountUUID string) []WebAuthnCredential {
+	const q = `SELECT * FROM WebAuthnCredentials WHERE accountUUID=$1 ORDER BY createdAt, id`
+
+	credentials := make([]WebAuthnCredential, 0)
+	err := database.Select(&credentials, q, accountUUID)
+	if err != nil {
+		panic(err)
+	}
+
+	return credentials
+}
+
+// GetWebAuthnCredential returns a credential by its base64url encoded ID.
+// Returns false if no such credential exists.
+func GetWebAuthnCredential(id string) (*WebAuthnCredential, bool) {
+	const q = `SELECT * FROM WebAuthnCredentials WHERE id=$1`
+
+	credential := &WebAuthnCredential{}
+	err := database.Get(credential, q, id)
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+
+	return credential, err == nil
+}
+
+// HasWebAuthn returns true if at least one WebAuthn credential is registered for the account.
+func (acc *Account) HasWebAuthn() bool {
+	const q = `SELECT count(*) FROM WebAuthnCredentials WHERE accountUUID=$1`
+
+	var count int
+	err := database.Get(&count, q, acc.UUID)
+	if err != nil {
+		panic(err)
+	}
+
+	return count > 0
+}
+
+// UsesSecondFactor returns true if the account has to provide a second factor after the
+// password, either a one-time password or a WebAuthn assertion.
+func (acc *Account) UsesSecondFactor() bool {
+	return acc.HasTwoFactor() || acc.HasWebAuthn()
+}
+
+// RegisterWebAuthnCredential completes a registration ceremony started with a challenge for the
+// account. The client data and attestation object are the values returned by the authenticator.
+// Returns an error if the response is invalid or the credential is already registered.
+func (acc *Account) RegisterWebAuthnCredential(description string, clientDataJSON, attestationObject []byte) (*WebAuthnCredential, error) {
+	const q = `INSERT INTO WebAuthnCredentials (id, accountUUID, publicKey, signCount, description, createdAt, updatedAt)
+	           VALUES ($1, $2, $3, $4, $5, now(), now())
+	           RETURNING *`
+
+	challenge, err := util.ParseWebAuthnClientData(clientDataJSON, WebAuthnCreate, WebAuthnOrigin())
+	if err != nil {
+		return nil, err
+	}
+	ch, ok := useWebAuthnChallenge(challenge, WebAuthnCreate)
+	if !ok || ch.AccountUUID.String != acc.UUID {
+		return nil, errors.New("Invalid or expired challenge")
+	}
+
+	raw, err := util.ParseWebAuthnAttestation(attestationObject)
+	if err != nil {
+		return nil, err
+	}
+	authData, err := util.ParseWebAuthnAuthData(raw, WebAuthnRPID())
+	if err != nil {
+		return nil, err
+	}
+	if authData.Flags&util.WebAuthnUserPresent == 0 {
+		return nil, errors.New("User presence is required")
+	}
+	if len(authData.CredentialID) == 0 {
+		return nil, errors.New("Attested credential data is missing")
+	}
+	_, _, err = util.ParseCOSEKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(authData.CredentialID)
+	if _, ok := GetWebAuthnCredential(id); ok {
+		return nil, errors.New("This credential is already registered")
+	}
+	if description == "" {
+		description = "Security key"
+	}
+
+	credential := &WebAuthnCredential{}
+	err = database.Get(credential, q, id, acc.UUID, authData.PublicKey, authData.SignCount, description)
+	if err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+// VerifyWebAuthnAssertion completes a login ceremony and returns the credential used.
+// The challenge must have been issued for the given account; if accountUUID is not valid
+// the login is passwordless and the authenticator must have verified the user (e.g. by PIN or
+// biometrics). The sign counter of the credential is updated in order to detect cloned
+// authenticators.
+func VerifyWebAuthnAssertion(accountUUID sql.NullString, credentialID string, clientDataJSON, authenticatorData, signature []byte) (*WebAuthnCredential, error) {
+	const q = `UPDATE WebAuthnCredentials SET (signCount, updatedAt) = ($2, now())
+	           WHERE id=$1
+	           RETURNING *`
+
+	challenge, err := util.ParseWebAuthnClientData(clientDataJSON, WebAuthnGet, WebAuthnOrigin())
+	if err != nil {
+		return nil, err
+	}
+	ch, ok := useWebAuthnChallenge(challenge, WebAuthnGet)
+	if !ok || ch.AccountUUID != accountUUID {
+		return nil, errors.New("Invalid or expired challenge")
+	}
+
+	credential, ok := GetWebAuthnCredential(credentialID)
+	if !ok || (accountUUID.Valid && credential.AccountUUID != accountUUID.String) {
+		return nil, errors.New("Unknown credential")
+	}
+
+	authData, err := util.ParseWebAuthnAuthData(authenticatorData, WebAuthnRPID())
+	if err != nil {
+		return nil, err
+	}
+	if authData.Flags&util.WebAuthnUserPresent == 0 {
+		return nil, errors.New("User presence is required")
+	}
+	if !accountUUID.Valid && authData.Flags&util.WebAuthnUserVerified == 0 {
+		return nil, errors.New("User verification is required for passwordless login")
+	}
+
+	err = util.VerifyWebAuthnSignature(credential.PublicKey, authenticatorData, clientDataJSON, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// authenticators without counter always report zero
+	count := int64(authData.SignCount)
+	if (count != 0 || credential.SignCount != 0) && count <= credential.SignCount {
+		return nil, errors.New("Sign counter did not increase, the authenticator might be cloned")
+	}
+
+	err = database.Get(credential, q, credential.ID, count)
+	if err != nil {
+		panic(err)
+	}
+
+	return credential, nil
+}
+
+// Delete removes a credential from the database.
+func (cred *WebAuthnCredential) Delete() error {
+	const q = `DELETE FROM WebAuthnCredentials WHERE id=$1`
+
+	_, err := database.Exec(q, cred.ID)
+	return err
+}
+
+// MarshalJSON implements Marshaler for WebAuthnCredential.
+// The public key is not included.
+func (cred *WebAuthnCredential) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		ID          string    `json:"id"`
+		Description string    `json:"description"`
+		SignCount   int64     `json:"sign_count"`
+		CreatedAt   time.Time `json:"created_at"`
+		UpdatedAt   time.Time `json:"updated_at"`
+	}{cred.ID, cred.Description, cred.SignCount, cred.CreatedAt, cred.UpdatedAt})
+}
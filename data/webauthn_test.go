@@ -0,0 +1,143 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package data
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"testing"
+
+	"github.com/G-Node/gin-auth/util"
+)
+
+// registerSoftAuthenticator registers a new software authenticator for an account.
+func registerSoftAuthenticator(t *testing.T, acc *Account) (*util.SoftAuthenticator, *WebAuthnCredential) {
+	auth := util.NewSoftAuthenticator()
+	challenge, err := NewWebAuthnChallenge(WebAuthnCreate, sql.NullString{String: acc.UUID, Valid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientData, attestation := auth.Create(WebAuthnRPID(), WebAuthnOrigin(), challenge.Challenge)
+	credential, err := acc.RegisterWebAuthnCredential("My key", clientData, attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth, credential
+}
+
+func TestRegisterWebAuthnCredential(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	alice, _ := GetAccount(uuidAlice)
+	bob, _ := GetAccount(uuidBob)
+	if alice.HasWebAuthn() || alice.UsesSecondFactor() {
+		t.Error("Alice should not have WebAuthn credentials")
+	}
+
+	auth, credential := registerSoftAuthenticator(t, alice)
+	if credential.ID != base64.RawURLEncoding.EncodeToString(auth.CredentialID) {
+		t.Errorf("Unexpected credential ID '%s'", credential.ID)
+	}
+	if !alice.HasWebAuthn() || !alice.UsesSecondFactor() {
+		t.Error("Alice expected to have WebAuthn credentials")
+	}
+	if len(ListWebAuthnCredentials(uuidAlice)) != 1 {
+		t.Error("One credential expected")
+	}
+
+	// challenge of another account
+	challenge, _ := NewWebAuthnChallenge(WebAuthnCreate, sql.NullString{String: uuidBob, Valid: true})
+	clientData, attestation := util.NewSoftAuthenticator().Create(WebAuthnRPID(), WebAuthnOrigin(), challenge.Challenge)
+	if _, err := alice.RegisterWebAuthnCredential("", clientData, attestation); err == nil {
+		t.Error("Challenge of bob should not be accepted for alice")
+	}
+
+	// challenge was used
+	if _, err := bob.RegisterWebAuthnCredential("", clientData, attestation); err == nil {
+		t.Error("Challenge should only be valid once")
+	}
+
+	// credential already registered
+	challenge, _ = NewWebAuthnChallenge(WebAuthnCreate, sql.NullString{String: uuidBob, Valid: true})
+	clientData, attestation = auth.Create(WebAuthnRPID(), WebAuthnOrigin(), challenge.Challenge)
+	if _, err := bob.RegisterWebAuthnCredential("", clientData, attestation); err == nil {
+		t.Error("Credential should only be registered once")
+	}
+
+	err := credential.Delete()
+	if err != nil {
+		t.Error(err)
+	}
+	if alice.HasWebAuthn() {
+		t.Error("Credential expected to be deleted")
+	}
+}
+
+func TestVerifyWebAuthnAssertion(t *testing.T) {
+	defer util.FailOnPanic(t)
+	InitTestDb(t)
+
+	alice, _ := GetAccount(uuidAlice)
+	auth, credential := registerSoftAuthenticator(t, alice)
+	accountAlice := sql.NullString{String: uuidAlice, Valid: true}
+
+	assert := func(account sql.NullString) error {
+		challenge, err := NewWebAuthnChallenge(WebAuthnGet, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientData, authData, sig := auth.Get(WebAuthnRPID(), WebAuthnOrigin(), challenge.Challenge)
+		_, err = VerifyWebAuthnAssertion(account, credential.ID, clientData, authData, sig)
+		return err
+	}
+
+	// second factor
+	if err := assert(accountAlice); err != nil {
+		t.Error(err)
+	}
+	credential, _ = GetWebAuthnCredential(credential.ID)
+	if credential.SignCount != int64(auth.SignCount) {
+		t.Errorf("Sign count %d expected but was %d", auth.SignCount, credential.SignCount)
+	}
+
+	// passwordless
+	if err := assert(sql.NullString{}); err != nil {
+		t.Error(err)
+	}
+	auth.UserVerified = false
+	if err := assert(sql.NullString{}); err == nil {
+		t.Error("User verification should be required for passwordless login")
+	}
+	if err := assert(accountAlice); err != nil {
+		t.Error(err)
+	}
+
+	// wrong account
+	if err := assert(sql.NullString{String: uuidBob, Valid: true}); err == nil {
+		t.Error("Credential of alice should not be accepted for bob")
+	}
+
+	// cloned authenticator
+	auth.SignCount = 0
+	if err := assert(accountAlice); err == nil {
+		t.Error("Sign counter that did not increase should be rejected")
+	}
+
+	// replayed challenge
+	auth.SignCount = 100
+	challenge, _ := NewWebAuthnChallenge(WebAuthnGet, accountAlice)
+	clientData, authData, sig := auth.Get(WebAuthnRPID(), WebAuthnOrigin(), challenge.Challenge)
+	if _, err := VerifyWebAuthnAssertion(accountAlice, credential.ID, clientData, authData, sig); err != nil {
+		t.Error(err)
+	}
+	if _, err := VerifyWebAuthnAssertion(accountAlice, credential.ID, clientData, authData, sig); err == nil {
+		t.Error("Challenge should only be valid once")
+	}
+}
@@ -62,7 +62,11 @@ func main() {
 	defer logEnv.Close()
 
 	srvConf := conf.GetServerConfig()
-	err := conf.SmtpCheck()
+	err := util.CheckEmailTransport()
+	if err != nil {
+		panic(err.Error())
+	}
+	err = conf.CheckSecurityConfig()
 	if err != nil {
 		panic(err.Error())
 	}
@@ -70,6 +74,7 @@ func main() {
 	dbConf := conf.GetDbConfig()
 	data.InitDb(dbConf)
 	data.InitClients(conf.GetClientsConfigFile())
+	data.HashStoredValues()
 
 	// Initialize externals
 	conf.GetExternals()
@@ -0,0 +1,43 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- failed logins and password reset requests within the rate limit window; the subject
+-- is the account UUID for logins and the submitted login or e-mail for reset requests
+CREATE TABLE RateLimitEvents (
+  id                BIGSERIAL PRIMARY KEY ,
+  action            VARCHAR(20) NOT NULL ,          -- login or reset
+  ip                VARCHAR(64) NOT NULL ,
+  subject           VARCHAR(1024) NULL ,
+  createdAt         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX ON RateLimitEvents (action, ip, createdAt);
+CREATE INDEX ON RateLimitEvents (action, subject, createdAt);
+
+-- temporary lockouts of accounts after too many failed logins
+CREATE TABLE AccountLockouts (
+  id                BIGSERIAL PRIMARY KEY ,
+  accountUUID       VARCHAR(36) NOT NULL REFERENCES Accounts(uuid) ON DELETE CASCADE ,
+  ip                VARCHAR(64) NOT NULL ,          -- address of the last failed login
+  failures          INTEGER NOT NULL ,
+  lockedUntil       TIMESTAMP WITH TIME ZONE NOT NULL ,
+  unlockedBy        VARCHAR(1024) NULL ,            -- login of the admin who removed the lockout
+  createdAt         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX ON AccountLockouts (accountUUID, lockedUntil);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS AccountLockouts CASCADE;
+DROP TABLE IF EXISTS RateLimitEvents CASCADE;
@@ -0,0 +1,22 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- clients defined in clients.yml are managed by the file and synced at startup,
+-- clients created via the client API are never removed by the sync
+ALTER TABLE Clients
+  ADD COLUMN managedBy VARCHAR(10) NOT NULL DEFAULT 'file' CHECK (managedBy IN ('file', 'api'));
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE Clients
+  DROP COLUMN IF EXISTS managedBy;
@@ -0,0 +1,33 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- dynamically registered clients manage their registration with a registration
+-- access token, which is stored as keyed hash, and keep the client name and the
+-- scope of their registration; other clients are not restricted by a registered scope
+ALTER TABLE Clients
+  DROP CONSTRAINT IF EXISTS clients_managedby_check ,
+  ADD CONSTRAINT clients_managedby_check CHECK (managedBy IN ('file', 'api', 'registration')) ,
+  ADD COLUMN registrationToken VARCHAR(512) NULL UNIQUE ,
+  ADD COLUMN displayName VARCHAR(512) NOT NULL DEFAULT '' ,
+  ADD COLUMN scopeRegistered VARCHAR[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DELETE FROM Clients WHERE managedBy = 'registration';
+
+ALTER TABLE Clients
+  DROP COLUMN IF EXISTS registrationToken ,
+  DROP COLUMN IF EXISTS displayName ,
+  DROP COLUMN IF EXISTS scopeRegistered ,
+  DROP CONSTRAINT IF EXISTS clients_managedby_check ,
+  ADD CONSTRAINT clients_managedby_check CHECK (managedBy IN ('file', 'api'));
@@ -0,0 +1,22 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- existing clients keep all grant types
+ALTER TABLE Clients
+  ADD COLUMN grantTypes VARCHAR[] NOT NULL
+    DEFAULT '{"authorization_code","implicit","refresh_token","password","client_credentials"}';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE Clients
+  DROP COLUMN IF EXISTS grantTypes;
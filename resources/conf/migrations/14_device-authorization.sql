@@ -0,0 +1,38 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- device authorization requests (RFC 8628) are grant requests of the type 'device'; the device
+-- code is stored as keyed hash, the user code is removed once the user approved the request
+ALTER TABLE GrantRequests
+  ADD COLUMN deviceCode   VARCHAR(512) NULL UNIQUE ,
+  ADD COLUMN userCode     VARCHAR(16) NULL UNIQUE ,
+  ADD COLUMN pollInterval INTEGER NOT NULL DEFAULT 5 ,      -- seconds
+  ADD COLUMN polledAt     TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+ALTER TABLE Clients
+  ALTER COLUMN grantTypes SET DEFAULT '{"authorization_code","implicit","refresh_token","password","client_credentials","urn:ietf:params:oauth:grant-type:device_code"}';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DELETE FROM GrantRequests WHERE grantType = 'device';
+
+UPDATE Clients SET grantTypes = array_remove(grantTypes, 'urn:ietf:params:oauth:grant-type:device_code');
+
+ALTER TABLE Clients
+  ALTER COLUMN grantTypes SET DEFAULT '{"authorization_code","implicit","refresh_token","password","client_credentials"}';
+
+ALTER TABLE GrantRequests
+  DROP COLUMN IF EXISTS polledAt ,
+  DROP COLUMN IF EXISTS pollInterval ,
+  DROP COLUMN IF EXISTS userCode ,
+  DROP COLUMN IF EXISTS deviceCode;
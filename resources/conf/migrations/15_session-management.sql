@@ -0,0 +1,36 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- sessions are addressed by a public uuid, since the token is stored as keyed hash
+ALTER TABLE Sessions
+  ADD COLUMN uuid       VARCHAR(36) NULL UNIQUE ,
+  ADD COLUMN userAgent  VARCHAR(512) NOT NULL DEFAULT '' ,
+  ADD COLUMN ip         VARCHAR(64) NOT NULL DEFAULT '' ,
+  ADD COLUMN lastSeen   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+UPDATE Sessions SET uuid = uuid_in(md5(random()::TEXT || token)::CSTRING)::TEXT, lastSeen = updatedAt;
+
+ALTER TABLE Sessions
+  ALTER COLUMN uuid SET NOT NULL;
+
+CREATE INDEX ON Sessions (accountUUID);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS sessions_accountuuid_idx;
+
+ALTER TABLE Sessions
+  DROP COLUMN IF EXISTS lastSeen ,
+  DROP COLUMN IF EXISTS ip ,
+  DROP COLUMN IF EXISTS userAgent ,
+  DROP COLUMN IF EXISTS uuid;
@@ -0,0 +1,33 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- security relevant events; accounts and clients are not referenced by foreign keys,
+-- such that events remain after an account or client was removed
+CREATE TABLE AuditEvents (
+  id                BIGSERIAL PRIMARY KEY ,
+  type              VARCHAR(32) NOT NULL ,
+  actorUUID         VARCHAR(36) NULL ,              -- account which caused the event
+  targetUUID        VARCHAR(36) NULL ,              -- account affected by the event
+  clientUUID        VARCHAR(36) NULL ,
+  ip                VARCHAR(64) NOT NULL ,
+  detail            VARCHAR(1024) NOT NULL DEFAULT '' ,
+  createdAt         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX ON AuditEvents (createdAt);
+CREATE INDEX ON AuditEvents (actorUUID, createdAt);
+CREATE INDEX ON AuditEvents (targetUUID, createdAt);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS AuditEvents CASCADE;
@@ -0,0 +1,52 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- password reset codes are kept apart from the account, such that a requested reset
+-- does not deactivate the account; codes are stored as keyed hash
+CREATE TABLE PasswordResets (
+  code              VARCHAR(512) PRIMARY KEY ,
+  accountUUID       VARCHAR(36) NOT NULL REFERENCES Accounts(uuid) ON DELETE CASCADE ,
+  expires           TIMESTAMP WITH TIME ZONE NOT NULL ,
+  createdAt         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX ON PasswordResets (accountUUID);
+
+-- pending resets remain valid for one hour
+INSERT INTO PasswordResets (code, accountUUID, expires, createdAt)
+  SELECT resetPWCode, uuid, now() + INTERVAL '1 hour', now() FROM Accounts WHERE resetPWCode IS NOT NULL;
+
+DROP VIEW IF EXISTS ActiveAccounts;
+
+ALTER TABLE Accounts
+  DROP COLUMN IF EXISTS resetPWCode;
+
+CREATE VIEW ActiveAccounts AS
+  SELECT * from Accounts
+  WHERE NOT isDisabled AND activationCode IS NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP VIEW IF EXISTS ActiveAccounts;
+
+ALTER TABLE Accounts
+  ADD COLUMN resetPWCode VARCHAR(512) NULL UNIQUE;
+
+UPDATE Accounts a SET resetPWCode = (
+  SELECT code FROM PasswordResets p WHERE p.accountUUID = a.uuid ORDER BY createdAt DESC LIMIT 1);
+
+CREATE VIEW ActiveAccounts AS
+  SELECT * from Accounts
+  WHERE NOT isDisabled AND activationCode IS NULL AND resetPWCode IS NULL;
+
+DROP TABLE IF EXISTS PasswordResets CASCADE;
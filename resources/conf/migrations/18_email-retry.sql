@@ -0,0 +1,32 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- e-mails which could not be sent are retried with exponential backoff and moved
+-- to the status 'failed' after too many attempts
+ALTER TABLE EmailQueue
+  ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'failed')) ,
+  ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0 ,
+  ADD COLUMN nextAttempt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now() ,
+  ADD COLUMN lastError VARCHAR(1024) NOT NULL DEFAULT '' ,
+  ADD COLUMN updatedAt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+CREATE INDEX ON EmailQueue (status, nextAttempt);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE EmailQueue
+  DROP COLUMN IF EXISTS updatedAt ,
+  DROP COLUMN IF EXISTS lastError ,
+  DROP COLUMN IF EXISTS nextAttempt ,
+  DROP COLUMN IF EXISTS attempts ,
+  DROP COLUMN IF EXISTS status;
@@ -0,0 +1,41 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- preferred language of e-mails sent to an account; the view has to be recreated
+-- such that it contains the new column
+DROP VIEW IF EXISTS ActiveAccounts;
+
+ALTER TABLE Accounts
+  ADD COLUMN language VARCHAR(16) NOT NULL DEFAULT 'en';
+
+CREATE VIEW ActiveAccounts AS
+  SELECT * from Accounts
+  WHERE NOT isDisabled AND activationCode IS NULL;
+
+-- multipart e-mails with html and plain text parts exceed the former limit
+ALTER TABLE EmailQueue
+  ALTER COLUMN content TYPE TEXT;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE EmailQueue
+  ALTER COLUMN content TYPE VARCHAR(4096);
+
+DROP VIEW IF EXISTS ActiveAccounts;
+
+ALTER TABLE Accounts
+  DROP COLUMN IF EXISTS language;
+
+CREATE VIEW ActiveAccounts AS
+  SELECT * from Accounts
+  WHERE NOT isDisabled AND activationCode IS NULL;
@@ -0,0 +1,30 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- a new e-mail address is only stored in Accounts once it was confirmed; the undo code
+-- sent to the previous address stays valid until the change expires; codes are stored as keyed hash
+CREATE TABLE EmailChanges (
+  code              VARCHAR(512) PRIMARY KEY ,
+  undoCode          VARCHAR(512) NOT NULL UNIQUE ,
+  accountUUID       VARCHAR(36) NOT NULL UNIQUE REFERENCES Accounts(uuid) ON DELETE CASCADE ,
+  email             VARCHAR(512) NOT NULL ,
+  previousEmail     VARCHAR(512) NOT NULL ,
+  isConfirmed       BOOLEAN NOT NULL DEFAULT FALSE ,
+  expires           TIMESTAMP WITH TIME ZONE NOT NULL ,
+  createdAt         TIMESTAMP WITH TIME ZONE NOT NULL ,
+  updatedAt         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS EmailChanges CASCADE;
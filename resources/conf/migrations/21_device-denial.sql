@@ -0,0 +1,24 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- device authorization requests denied by the user are kept until the device polls again,
+-- such that the device can be informed about the denial
+ALTER TABLE GrantRequests
+  ADD COLUMN isDenied BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DELETE FROM GrantRequests WHERE isDenied;
+
+ALTER TABLE GrantRequests
+  DROP COLUMN IF EXISTS isDenied;
@@ -0,0 +1,28 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE Clients
+  ADD COLUMN requirePKCE BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE GrantRequests
+  ADD COLUMN codeChallenge       VARCHAR(128) ,
+  ADD COLUMN codeChallengeMethod VARCHAR(10) CHECK (codeChallengeMethod IN ('S256', 'plain'));
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE GrantRequests
+  DROP COLUMN IF EXISTS codeChallengeMethod ,
+  DROP COLUMN IF EXISTS codeChallenge;
+
+ALTER TABLE Clients
+  DROP COLUMN IF EXISTS requirePKCE;
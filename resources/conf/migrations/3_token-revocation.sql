@@ -0,0 +1,22 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- access tokens issued together with or in exchange for a refresh token
+-- are revoked when the refresh token gets revoked
+ALTER TABLE AccessTokens
+  ADD COLUMN refreshToken VARCHAR(512) NULL REFERENCES RefreshTokens(token) ON DELETE CASCADE;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE AccessTokens
+  DROP COLUMN IF EXISTS refreshToken;
@@ -0,0 +1,20 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE Clients
+  ADD COLUMN tokenFormat VARCHAR(10) NOT NULL DEFAULT 'opaque' CHECK (tokenFormat IN ('opaque', 'jwt'));
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE Clients
+  DROP COLUMN IF EXISTS tokenFormat;
@@ -0,0 +1,35 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- refresh tokens of the same family replace each other when rotation is enabled,
+-- rotated tokens are kept until they expire in order to detect a reuse
+ALTER TABLE RefreshTokens
+  ADD COLUMN family  VARCHAR(512) ,
+  ADD COLUMN rotated BOOLEAN NOT NULL DEFAULT FALSE ,
+  ADD COLUMN expires TIMESTAMP WITH TIME ZONE;
+
+UPDATE RefreshTokens SET family = token, expires = createdAt + INTERVAL '365 days';
+
+ALTER TABLE RefreshTokens
+  ALTER COLUMN family SET NOT NULL ,
+  ALTER COLUMN expires SET NOT NULL;
+
+CREATE INDEX ON RefreshTokens (family);
+CREATE INDEX ON RefreshTokens (expires);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE RefreshTokens
+  DROP COLUMN IF EXISTS expires ,
+  DROP COLUMN IF EXISTS rotated ,
+  DROP COLUMN IF EXISTS family;
@@ -0,0 +1,33 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- tokens, codes and client secrets are stored as keyed hashes; values still stored in
+-- plain text are hashed by gin-auth on startup, which requires references to refresh
+-- tokens to follow the new value
+ALTER TABLE AccessTokens
+  DROP CONSTRAINT IF EXISTS accesstokens_refreshtoken_fkey ,
+  ADD CONSTRAINT accesstokens_refreshtoken_fkey FOREIGN KEY (refreshToken)
+    REFERENCES RefreshTokens(token) ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- the hash of an access token must not be handed out, JWT access tokens therefore refer
+-- to the stored token by a separate non-secret id
+ALTER TABLE AccessTokens
+  ADD COLUMN jti VARCHAR(32) NOT NULL UNIQUE DEFAULT md5(random()::text || clock_timestamp()::text);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE AccessTokens
+  DROP COLUMN IF EXISTS jti ,
+  DROP CONSTRAINT IF EXISTS accesstokens_refreshtoken_fkey ,
+  ADD CONSTRAINT accesstokens_refreshtoken_fkey FOREIGN KEY (refreshToken)
+    REFERENCES RefreshTokens(token) ON DELETE CASCADE;
@@ -0,0 +1,44 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- TOTP secrets (RFC 6238) of accounts using two-factor authentication; a secret is only
+-- used for login after the enrolment was confirmed with a valid code
+CREATE TABLE TOTPSecrets (
+  accountUUID       VARCHAR(36) PRIMARY KEY REFERENCES Accounts(uuid) ON DELETE CASCADE ,
+  secret            VARCHAR(512) NOT NULL ,
+  confirmed         BOOLEAN NOT NULL DEFAULT FALSE ,
+  lastCounter       BIGINT NOT NULL DEFAULT 0 ,     -- time step of the last accepted code
+  createdAt         TIMESTAMP WITH TIME ZONE NOT NULL ,
+  updatedAt         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- single-use recovery codes, stored as keyed hashes
+CREATE TABLE RecoveryCodes (
+  code              VARCHAR(512) PRIMARY KEY ,
+  accountUUID       VARCHAR(36) NOT NULL REFERENCES Accounts(uuid) ON DELETE CASCADE ,
+  createdAt         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX ON RecoveryCodes (accountUUID);
+
+-- account whose password was verified, but who still has to provide the second factor
+ALTER TABLE GrantRequests
+  ADD COLUMN pendingAccountUUID VARCHAR(36) NULL REFERENCES Accounts(uuid) ON DELETE CASCADE;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE GrantRequests
+  DROP COLUMN IF EXISTS pendingAccountUUID;
+
+DROP TABLE IF EXISTS RecoveryCodes CASCADE;
+DROP TABLE IF EXISTS TOTPSecrets CASCADE;
@@ -0,0 +1,39 @@
+-- Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+--
+-- All rights reserved.
+--
+-- Redistribution and use in source and binary forms, with or without
+-- modification, are permitted under the terms of the BSD License. See
+-- LICENSE file in the root of the Project.
+
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- WebAuthn credentials (security keys or platform authenticators) registered for an account
+CREATE TABLE WebAuthnCredentials (
+  id                VARCHAR(1024) PRIMARY KEY ,     -- base64url encoded credential ID
+  accountUUID       VARCHAR(36) NOT NULL REFERENCES Accounts(uuid) ON DELETE CASCADE ,
+  publicKey         BYTEA NOT NULL ,                -- COSE encoded public key
+  signCount         BIGINT NOT NULL DEFAULT 0 ,
+  description       VARCHAR(1024) NOT NULL ,
+  createdAt         TIMESTAMP WITH TIME ZONE NOT NULL ,
+  updatedAt         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX ON WebAuthnCredentials (accountUUID);
+
+-- single-use challenges of pending registration and login ceremonies; challenges for
+-- passwordless logins are not bound to an account
+CREATE TABLE WebAuthnChallenges (
+  challenge         VARCHAR(512) PRIMARY KEY ,
+  ceremony          VARCHAR(20) NOT NULL ,          -- webauthn.create or webauthn.get
+  accountUUID       VARCHAR(36) NULL REFERENCES Accounts(uuid) ON DELETE CASCADE ,
+  createdAt         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS WebAuthnChallenges CASCADE;
+DROP TABLE IF EXISTS WebAuthnCredentials CASCADE;
@@ -1,5 +1,7 @@
 -- Test fixtures to be used in tests
 DELETE FROM EmailQueue;
+DELETE FROM AuditEvents;
+DELETE FROM RateLimitEvents;
 DELETE FROM RefreshTokens;
 DELETE FROM AccessTokens;
 DELETE FROM Sessions;
@@ -8,6 +10,8 @@ DELETE FROM ClientApprovals;
 DELETE FROM ClientScopeProvided;
 DELETE FROM Clients;
 DELETE FROM SSHKeys;
+DELETE FROM PasswordResets;
+DELETE FROM EmailChanges;
 DELETE FROM Accounts;
 
 INSERT INTO Accounts (uuid, login, pwHash, email, isEmailPublic, title, firstName, lastName, institute, department, city, country, isAffiliationPublic, activationCode, createdAt, updatedAt) VALUES
@@ -18,13 +22,26 @@ INSERT INTO Accounts (uuid, login, pwHash, email, isEmailPublic, title, firstNam
 UPDATE Accounts SET pwHash = '$2a$10$kYB77ZPuIxon00ZPpk6APeAqi5J7aOPpqaPwS6riF40/RrfQ.EMlW';
 
 -- add account active and disabled testaccounts
-INSERT INTO Accounts (uuid, login, pwhash, email, firstname, lastname, institute, department, city, country, activationcode, resetpwcode, isdisabled, createdat, updatedat) VALUES
-  ('test0001-1234-6789-1234-678901234567', 'inact_log1', '', 'email1@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', 'ac_a', NULL, FALSE, now(), now()),
-  ('test0002-1234-6789-1234-678901234567', 'inact_log2', '', 'email2@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', NULL, 'rc_a', FALSE, now(), now()),
-  ('test0003-1234-6789-1234-678901234567', 'inact_log3', '', 'email3@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', 'ac_c', 'rc_b', FALSE, now(), now()),
-  ('test0004-1234-6789-1234-678901234567', 'inact_log4', '', 'email4@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', NULL, NULL, TRUE, now(), now()),
-  ('test0005-1234-6789-1234-678901234567', 'inact_log5', '', 'email5@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', 'ac_b', NULL, TRUE, now(), now()),
-  ('test0006-1234-6789-1234-678901234567', 'inact_log6', '', 'email6@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', 'ac_d', 'rc_c', TRUE, now(), now());
+INSERT INTO Accounts (uuid, login, pwhash, email, firstname, lastname, institute, department, city, country, activationcode, isdisabled, createdat, updatedat) VALUES
+  ('test0001-1234-6789-1234-678901234567', 'inact_log1', '', 'email1@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', 'ac_a', FALSE, now(), now()),
+  ('test0002-1234-6789-1234-678901234567', 'inact_log2', '', 'email2@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', NULL, FALSE, now(), now()),
+  ('test0003-1234-6789-1234-678901234567', 'inact_log3', '', 'email3@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', 'ac_c', FALSE, now(), now()),
+  ('test0004-1234-6789-1234-678901234567', 'inact_log4', '', 'email4@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', NULL, TRUE, now(), now()),
+  ('test0005-1234-6789-1234-678901234567', 'inact_log5', '', 'email5@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', 'ac_b', TRUE, now(), now()),
+  ('test0006-1234-6789-1234-678901234567', 'inact_log6', '', 'email6@example.com', 'fname', 'lname', 'inst', 'dep', 'cty', 'ctry', 'ac_d', TRUE, now(), now());
+
+-- accounts with pending password resets remain active
+INSERT INTO PasswordResets (code, accountUUID, expires, createdAt) VALUES
+  ('rc_a', 'test0002-1234-6789-1234-678901234567', now() + INTERVAL '1 hour', now()),
+  ('rc_b', 'test0003-1234-6789-1234-678901234567', now() + INTERVAL '1 hour', now()),
+  ('rc_c', 'test0006-1234-6789-1234-678901234567', now() + INTERVAL '1 hour', now()),
+  ('rc_x', 'bf431618-f696-4dca-a95d-882618ce4ef9', 'yesterday', 'yesterday');
+
+-- a pending, a confirmed and an expired e-mail address change
+INSERT INTO EmailChanges (code, undoCode, accountUUID, email, previousEmail, isConfirmed, expires, createdAt, updatedAt) VALUES
+  ('ec_a', 'eu_a', '51f5ac36-d332-4889-8023-6e033fcd8e17', 'bob@example.com', 'bob@foo.com', FALSE, now() + INTERVAL '1 day', now(), now()),
+  ('ec_b', 'eu_b', 'test0002-1234-6789-1234-678901234567', 'email2@example.com', 'email2@foo.com', TRUE, now() + INTERVAL '1 day', now(), now()),
+  ('ec_x', 'eu_x', '03dcd573-1cce-4eb1-8b33-73860575da65', 'jj@foo.com', 'jj@example.com', FALSE, 'yesterday', 'yesterday', 'yesterday');
 
 INSERT INTO SSHKeys (fingerprint, accountUUID, description, temporary, key, createdAt, updatedAt) VALUES
   ('A3tkBXFQWkjU6rzhkofY55G7tPR/Lmna4B+WEGVFXOQ', 'bf431618-f696-4dca-a95d-882618ce4ef9', 'Key from alice', false, 'ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDLtRNg1UHUf0k0ZlkfoYod9NoDPpOgx2AStEaEk/0bIKBqWJUNAZUfc6CHooKXTP3YakgqI7/BxV2pVgJIFBI4K9yGeLu76mwTpIZUTjEw/VoOaNP/vfV0LmXvQXstXMOZkmWt1rFaLsBpL9REP7XxteZYc2tjyVqy32GsVZHh6pPNes2q1Cf+awhkV/kXjup5AXwROLzqRvYBRs8oMPFDRZEGGax/Pp+r2GTB44M8YC0p7JAL3tLDDWsLVyygFA0OGhUffHmOGGf69uhh5JHhOjp49GEGftABdjnJznrVAI/71ySt0xWHJIOgMScsUGLYJtOZE/9KVrOQgZ1UAQML bar@foo', now(), now()),
@@ -34,15 +51,17 @@ INSERT INTO SSHKeys (fingerprint, accountUUID, description, temporary, key, crea
   ('LTPF+bl45+47oT1X+Yxy0oNH4P6xufQhNxGMjRvxP2A', '51f5ac36-d332-4889-8023-6e033fcd8e17', 'Bobs old temporary key', true, 'ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDFvuAQeIhvyrf61heV+XeW4OBTmQpde1G29RSeuzG1UhGbLq/+ihiOYbH4ICL6LD8s5gSPSl50XBOSXZPObn0ZG6TjCwArGSpzEUtTh8nqmp583dDHdeBayfigqwGzZN7+GK8YGTqcwLXg/HpaFXthnS3eHAud9UqKZVtyTVcS5bRqs6BlHnSSxzcH8wZFgG2TtmQ3xJhUcSA7+XzA5CVrmgdD+Jr28kAkGFDmNz/7Smzk3O4wsEouwxyhxcAWxTBscVPUSAHvcFC8rHrFv25mWe/9KeIfhxzsq2rLQ/JXFF1XY3VKjSGC7kbi9oKE4/IBXnmh3VUgwCOxo6z7OkgN bar@foo', (now() - INTERVAL '1 day'), now()),
   ('dgU2JX3eCYur5xbKhFQ+jEACSurCwtRaG+Qn6SYq7lE', '51f5ac36-d332-4889-8023-6e033fcd8e17', 'Bobs new temporary key', true, 'ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDKHfQ67plrnKU5ua2JP6zTYZWiN23H26paJ4M/7r1/m9Ct8a3Oy5qK0LGmwj+nSInOX5U5AmQSnAfqnVcXG1QWP/GEvz7fxm+99ZU00P+Pti1AenmiK69qxvP7dMC3KJbwe6haEgVHNbDy3Uj1lW+cIH+FUkpuoLr5B6tCrXAUD+ZJrSAR3VlYMbAQ5W4ElU3Oh1gruacINCy3B83D3PVSumdgnPopYQdcFSVFv22fHGal4iw1T/M0Xfe7iQevLaEa/F+BwX8IAqNJb3mA+1JQbF0Vkfo+qxMtK3OUK0hZIYheH9H1OIl53RZ18jck0IWBgyo8chegSMoNtL3gzA6p bar@foo', now(), now());
 
-INSERT INTO Clients (uuid, name, secret, scopeWhitelist, scopeBlacklist, redirectURIs, createdAt, updatedAt) VALUES
-  ('8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'gin', 'secret', '{"account-create"}','{"account-admin"}','{"https://localhost:8081/login","http://localhost:8080/notice"}', now(), now()),
-  ('177c56a4-57b4-4baf-a1a7-04f3d8e5b276', 'wb', 'secret', '{"account-read","repo-read"}','{"account-admin"}','{"https://localhost:8081/login"}', now(), now());
+INSERT INTO Clients (uuid, name, secret, scopeWhitelist, scopeBlacklist, redirectURIs, tokenFormat, createdAt, updatedAt) VALUES
+  ('8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'gin', 'secret', '{"account-create"}','{"account-admin"}','{"https://localhost:8081/login","http://localhost:8080/notice"}', 'opaque', now(), now()),
+  ('177c56a4-57b4-4baf-a1a7-04f3d8e5b276', 'wb', 'secret', '{"account-read","repo-read"}','{"account-admin"}','{"https://localhost:8081/login"}', 'jwt', now(), now());
 
 INSERT INTO ClientScopeProvided (clientuuid, name, description) VALUES
+  ('8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'openid', 'Sign in with your account'),
   ('8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'account-create', 'Create an account'),
   ('8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'account-read', 'Read access to your account data'),
   ('8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'account-write', 'Write access to your account data'),
   ('8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'account-admin', 'Admin access to all account data'),
+  ('8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'client-admin', 'Admin access to all clients'),
   ('8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'repo-read', 'Read access to your repositories and repositories shared with you'),
   ('8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'repo-write', 'Write access to your repositories and repositories you have write access to');
 
@@ -57,20 +76,34 @@ INSERT INTO GrantRequests (token, grantType, state, code, scopeRequested, redire
   ('AGTBAI3D', 'code', 'GBNAM23L', 'KWANG2G4','{"account-read"}', 'https://localhost:8081/login', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '51f5ac36-d332-4889-8023-6e033fcd8e17', 'yesterday', 'yesterday'),
   ('QPJ64HK0', 'client', 'AHZ6DK8F', '0LA7T4EO','{"account-create"}', 'http://localhost:8080/notice', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', NULL, now(), now());
 
-INSERT INTO Sessions (token, expires, accountUUID, createdAt, updatedAt) VALUES
-  ('DNM5RS3C', 'tomorrow', 'bf431618-f696-4dca-a95d-882618ce4ef9', now(), now()),
-  ('4KDNO8T0', 'tomorrow', '51f5ac36-d332-4889-8023-6e033fcd8e17', now(), now()),
-  ('2MFZZUKI', 'yesterday', '51f5ac36-d332-4889-8023-6e033fcd8e17', 'yesterday', 'yesterday');
+INSERT INTO GrantRequests (token, grantType, state, scopeRequested, redirectUri, clientUUID, accountUUID, deviceCode, userCode, polledAt, createdAt, updatedAt) VALUES
+  ('DV3PQXWA', 'device', '', '{"repo-read","repo-write"}', '', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', NULL, 'DVC7ZLQN', 'BDFGHJKL', 'yesterday', now(), now()),
+  ('DV8MRTYE', 'device', '', '{"repo-read","repo-write"}', '', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'bf431618-f696-4dca-a95d-882618ce4ef9', 'DVC4KWPB', NULL, 'yesterday', now(), now());
+
+INSERT INTO Sessions (token, uuid, expires, accountUUID, userAgent, ip, lastSeen, createdAt, updatedAt) VALUES
+  ('DNM5RS3C', '5c1a2b2e-3b8f-4f5e-9d0a-6c7e8f9a0b1c', 'tomorrow', 'bf431618-f696-4dca-a95d-882618ce4ef9', 'Mozilla/5.0', '192.0.2.1', now(), now(), now()),
+  ('Q7WZ3MHB', 'a3e4f5d6-7b8c-4d9e-8f0a-1b2c3d4e5f60', 'tomorrow', 'bf431618-f696-4dca-a95d-882618ce4ef9', 'curl/7.50', '192.0.2.2', 'yesterday', 'yesterday', 'yesterday'),
+  ('4KDNO8T0', '9f8e7d6c-5b4a-4392-8817-263544536271', 'tomorrow', '51f5ac36-d332-4889-8023-6e033fcd8e17', '', '', now(), now(), now()),
+  ('2MFZZUKI', '0e1d2c3b-4a59-4687-9766-85a4b3c2d1e0', 'yesterday', '51f5ac36-d332-4889-8023-6e033fcd8e17', '', '', 'yesterday', 'yesterday', 'yesterday');
 
-INSERT INTO AccessTokens (token, expires, scope, clientUUID, accountUUID, createdAt, updatedAt) VALUES
-  ('3N7MP7M7', 'tomorrow', '{"account-read","account-write","repo-read","repo-write"}', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'bf431618-f696-4dca-a95d-882618ce4ef9', now(), now()),
-  ('LJ3W7ZFK', 'yesterday', '{"account-read","account-write","repo-read","repo-write"}', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '51f5ac36-d332-4889-8023-6e033fcd8e17', 'yesterday', 'yesterday'),
-  ('KDEW57D4', 'tomorrow', '{"account-admin","repo-admin"}', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '51f5ac36-d332-4889-8023-6e033fcd8e17', now(), now());
+INSERT INTO AccessTokens (token, jti, expires, scope, clientUUID, accountUUID, createdAt, updatedAt) VALUES
+  ('3N7MP7M7', 'JT3N7MP7', 'tomorrow', '{"account-read","account-write","repo-read","repo-write"}', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'bf431618-f696-4dca-a95d-882618ce4ef9', now(), now()),
+  ('LJ3W7ZFK', 'JTLJ3W7Z', 'yesterday', '{"account-read","account-write","repo-read","repo-write"}', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '51f5ac36-d332-4889-8023-6e033fcd8e17', 'yesterday', 'yesterday'),
+  ('KDEW57D4', 'JTKDEW57', 'tomorrow', '{"account-admin","repo-admin","client-admin"}', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '51f5ac36-d332-4889-8023-6e033fcd8e17', now(), now());
 
-INSERT INTO RefreshTokens (token, scope, clientUUID, accountUUID, createdAt, updatedAt) VALUES
-  ('YYPTDSVZ', '{"repo-read","repo-write"}', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'bf431618-f696-4dca-a95d-882618ce4ef9', now(), now()),
-  ('4FKJVX3K', '{"repo-read","repo-write"}', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '51f5ac36-d332-4889-8023-6e033fcd8e17', 'yesterday', 'yesterday');
+INSERT INTO RefreshTokens (token, scope, clientUUID, accountUUID, family, rotated, expires, createdAt, updatedAt) VALUES
+  ('YYPTDSVZ', '{"repo-read","repo-write"}', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', 'bf431618-f696-4dca-a95d-882618ce4ef9', 'YYPTDSVZ', FALSE, now() + INTERVAL '365 days', now(), now()),
+  ('4FKJVX3K', '{"repo-read","repo-write"}', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '51f5ac36-d332-4889-8023-6e033fcd8e17', '4FKJVX3K', FALSE, now() + INTERVAL '365 days', 'yesterday', 'yesterday');
 
 INSERT INTO EmailQueue (mode, sender, recipient, content, createdat) VALUES
   ('print', 'no-reply@g-node.org', '{"a@example.com"}', 'content2', now()),
   ('skip', 'no-reply@g-node.org', '{"b@example.com"}', 'content3', now());
+
+INSERT INTO EmailQueue (mode, sender, recipient, content, createdat, status, attempts, nextAttempt, lastError, updatedAt) VALUES
+  ('', 'no-reply@g-node.org', '{"c@example.com"}', 'content4', 'yesterday', 'failed', 10, 'yesterday', 'connection refused', 'yesterday');
+
+INSERT INTO AuditEvents (type, actorUUID, targetUUID, clientUUID, ip, detail, createdAt) VALUES
+  ('login_failure', NULL, 'bf431618-f696-4dca-a95d-882618ce4ef9', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '192.0.2.7', 'invalid credentials', 'yesterday'),
+  ('login', 'bf431618-f696-4dca-a95d-882618ce4ef9', 'bf431618-f696-4dca-a95d-882618ce4ef9', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '192.0.2.1', '', 'yesterday'),
+  ('admin', '51f5ac36-d332-4889-8023-6e033fcd8e17', 'bf431618-f696-4dca-a95d-882618ce4ef9', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '192.0.2.2', 'unlock account', now()),
+  ('login', '51f5ac36-d332-4889-8023-6e033fcd8e17', '51f5ac36-d332-4889-8023-6e033fcd8e17', '8b14d6bb-cae7-4163-bbd1-f3be46e43e31', '192.0.2.2', '', now());
@@ -0,0 +1,220 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CBOR major types as defined by RFC 7049 section 2.1
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborSimple   = 7
+)
+
+// cborMaxDepth limits the nesting of decoded data items.
+const cborMaxDepth = 16
+
+// DecodeCBOR decodes the first CBOR data item (RFC 7049) from data and returns it together
+// with the remaining bytes. Only the subset of CBOR used by WebAuthn is supported: integers
+// are decoded as int64, byte strings as []byte, text strings as string, arrays as []interface{},
+// maps as map[interface{}]interface{} and the simple values true, false and null.
+func DecodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBOR(data, 0)
+}
+
+func decodeCBOR(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("CBOR data is nested too deeply")
+	}
+	if len(data) < 1 {
+		return nil, nil, errors.New("Unexpected end of CBOR data")
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22:
+			return nil, data, nil
+		}
+		return nil, nil, fmt.Errorf("Unsupported CBOR simple value %d", info)
+	}
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24 && len(data) >= 1:
+		arg, data = uint64(data[0]), data[1:]
+	case info == 25 && len(data) >= 2:
+		arg, data = uint64(binary.BigEndian.Uint16(data)), data[2:]
+	case info == 26 && len(data) >= 4:
+		arg, data = uint64(binary.BigEndian.Uint32(data)), data[4:]
+	case info == 27 && len(data) >= 8:
+		arg, data = binary.BigEndian.Uint64(data), data[8:]
+	default:
+		return nil, nil, errors.New("Invalid or unsupported CBOR argument")
+	}
+
+	switch major {
+	case cborUnsigned, cborNegative:
+		if arg > 1<<63-1 {
+			return nil, nil, errors.New("CBOR integer out of range")
+		}
+		if major == cborNegative {
+			return -1 - int64(arg), data, nil
+		}
+		return int64(arg), data, nil
+	case cborBytes, cborText:
+		if arg > uint64(len(data)) {
+			return nil, nil, errors.New("Unexpected end of CBOR data")
+		}
+		if major == cborText {
+			return string(data[:arg]), data[arg:], nil
+		}
+		return append([]byte{}, data[:arg]...), data[arg:], nil
+	case cborArray:
+		if arg > uint64(len(data)) {
+			return nil, nil, errors.New("Unexpected end of CBOR data")
+		}
+		items := make([]interface{}, arg)
+		for i := range items {
+			var err error
+			items[i], data, err = decodeCBOR(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return items, data, nil
+	case cborMap:
+		if arg > uint64(len(data)) {
+			return nil, nil, errors.New("Unexpected end of CBOR data")
+		}
+		items := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, rest, err := decodeCBOR(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.New("Unsupported CBOR map key")
+			}
+			items[key], data, err = decodeCBOR(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return items, data, nil
+	}
+
+	return nil, nil, fmt.Errorf("Unsupported CBOR major type %d", major)
+}
+
+// EncodeCBOR encodes a value using the same subset of CBOR supported by DecodeCBOR.
+// Integers may be passed as int or int64, maps may have int, int64 or string keys.
+// Map keys are sorted such that the encoding is deterministic.
+func EncodeCBOR(value interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := encodeCBOR(buf, value)
+	return buf.Bytes(), err
+}
+
+func encodeCBOR(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(cborSimple<<5 | 22)
+	case bool:
+		if v {
+			buf.WriteByte(cborSimple<<5 | 21)
+		} else {
+			buf.WriteByte(cborSimple<<5 | 20)
+		}
+	case int:
+		return encodeCBOR(buf, int64(v))
+	case int64:
+		if v < 0 {
+			writeCBORHead(buf, cborNegative, uint64(-1-v))
+		} else {
+			writeCBORHead(buf, cborUnsigned, uint64(v))
+		}
+	case []byte:
+		writeCBORHead(buf, cborBytes, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case []interface{}:
+		writeCBORHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := encodeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		keys := make([][]byte, 0, len(v))
+		values := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			encoded, err := EncodeCBOR(key)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, encoded)
+			values[string(encoded)] = item
+		}
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+		writeCBORHead(buf, cborMap, uint64(len(v)))
+		for _, key := range keys {
+			buf.Write(key)
+			if err := encodeCBOR(buf, values[string(key)]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("Unsupported type %T for CBOR encoding", value)
+	}
+	return nil
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major<<5 | byte(arg))
+	case arg <= 0xff:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= 0xffff:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= 0xffffffff:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package util
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// examples from RFC 7049 appendix A
+	vectors := []struct {
+		hex   string
+		value interface{}
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3903e7", int64(-1000)},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"83010203", []interface{}{int64(1), int64(2), int64(3)}},
+		{"a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+	}
+
+	for _, v := range vectors {
+		raw, _ := hex.DecodeString(v.hex)
+		value, rest, err := DecodeCBOR(raw)
+		if err != nil {
+			t.Errorf("Unable to decode '%s': %v", v.hex, err)
+			continue
+		}
+		if len(rest) > 0 {
+			t.Errorf("No remaining bytes expected after '%s'", v.hex)
+		}
+		if !reflect.DeepEqual(value, v.value) {
+			t.Errorf("Value '%v' expected for '%s' but was '%v'", v.value, v.hex, value)
+		}
+
+		encoded, err := EncodeCBOR(v.value)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(encoded, raw) {
+			t.Errorf("Encoding '%s' expected but was '%x'", v.hex, encoded)
+		}
+	}
+
+	invalid := []string{"", "18", "4401", "830102", "a1f401", "f7", "9f", "c0"}
+	for _, v := range invalid {
+		raw, _ := hex.DecodeString(v)
+		if _, _, err := DecodeCBOR(raw); err == nil {
+			t.Errorf("Error expected for '%s'", v)
+		}
+	}
+}
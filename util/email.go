@@ -11,78 +11,199 @@ package util
 import (
 	"bytes"
 	"fmt"
-	"net"
-	"net/smtp"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/G-Node/gin-auth/conf"
 )
 
-// EmailDispatcher defines an interface for e-mail dispatch.
-type EmailDispatcher interface {
-	Send(recipient []string, message []byte) error
+// DefaultLanguage is the language of e-mails if no template in the preferred language exists.
+const DefaultLanguage = "en"
+
+var languageRegex = regexp.MustCompile(`^[a-z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// ValidLanguage checks whether lang is a language tag like "en" or "de-AT".
+func ValidLanguage(lang string) bool {
+	return len(lang) <= 16 && languageRegex.MatchString(lang)
 }
 
-type emailDispatcher struct {
-	conf *conf.SmtpCredentials
-	send func(string, smtp.Auth, string, []string, []byte) error
+// emailLanguages returns the languages which are tried in order to find a template for lang:
+// the language itself, the language without region and finally the default language.
+func emailLanguages(lang string) []string {
+	lang = strings.ToLower(lang)
+	if !ValidLanguage(lang) {
+		return []string{DefaultLanguage}
+	}
+	languages := []string{lang}
+	if i := strings.Index(lang, "-"); i > 0 {
+		languages = append(languages, lang[:i])
+	}
+	return append(languages, DefaultLanguage)
 }
 
-// Send sets up authentication for e-mail dispatch via smtp and invokes the objects send function.
-func (e *emailDispatcher) Send(recipient []string, content []byte) error {
-	addr := e.conf.Host + ":" + strconv.Itoa(e.conf.Port)
-	auth := smtp.PlainAuth("", e.conf.Username, e.conf.Password, e.conf.Host)
-	if e.conf.Mode != "print" && e.conf.Mode != "skip" {
-		netCon, err := net.DialTimeout("tcp", addr, time.Second*10)
-		if err != nil {
-			return err
-		}
-		if err = netCon.Close(); err != nil {
-			return err
+// emailTemplateDirs returns the directories of e-mail templates for a language. Templates in
+// the configuration directory take precedence over the templates of the resources directory,
+// such that deployments can override single templates.
+func emailTemplateDirs(lang string) []string {
+	return []string{
+		conf.GetConfigFile("templates", "email", lang),
+		conf.GetResourceFile("templates", "email", lang),
+	}
+}
+
+// emailTemplateFile returns the path of an e-mail template file in the given language or,
+// if no such file exists, in the next best language.
+func emailTemplateFile(lang, fileName string) string {
+	for _, l := range emailLanguages(lang) {
+		for _, dir := range emailTemplateDirs(l) {
+			file := filepath.Join(dir, fileName)
+			if _, err := os.Stat(file); err == nil {
+				return file
+			}
 		}
 	}
-	return e.send(addr, auth, e.conf.From, recipient, content)
+	panic("E-mail template not found: " + fileName)
 }
 
-// NewEmailDispatcher returns an instance of emailDispatcher.
-// Dependent on the value of config.smtp.Mode the send method will
-// print the e-mail content to the commandline (value "print"), do nothing (value "skip")
-// or by default send an e-mail via smtp.SendMail.
-func NewEmailDispatcher() EmailDispatcher {
-	config := conf.GetSmtpCredentials()
-	send := smtp.SendMail
-	if config.Mode == "print" {
-		send = func(addr string, auth smtp.Auth, from string, recipient []string, cont []byte) error {
-			fmt.Printf("E-Mail content:\n---\n%s---\n", string(cont))
-			return nil
+// EmailLanguage returns the best language for e-mails according to the value of an
+// Accept-Language header. Only languages with e-mail templates are considered.
+func EmailLanguage(acceptLanguage string) string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	accepted := make([]weighted, 0)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		entry := weighted{lang: strings.ToLower(strings.TrimSpace(fields[0])), q: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					entry.q = q
+				}
+			}
 		}
-	} else if config.Mode == "skip" {
-		send = func(addr string, auth smtp.Auth, from string, recipient []string, cont []byte) error {
-			return nil
+		if entry.q > 0 && ValidLanguage(entry.lang) {
+			accepted = append(accepted, entry)
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+
+	for _, entry := range accepted {
+		// the default language is the last candidate and only considered if no accepted language matches
+		candidates := emailLanguages(entry.lang)
+		for _, l := range candidates[:len(candidates)-1] {
+			for _, dir := range emailTemplateDirs(l) {
+				if info, err := os.Stat(dir); err == nil && info.IsDir() {
+					return l
+				}
+			}
 		}
 	}
-	return &emailDispatcher{config, send}
+	return DefaultLanguage
+}
+
+// formatAddress formats an e-mail address for a message header. Display names
+// are encoded according to RFC 2047.
+func formatAddress(address string) string {
+	addr, err := mail.ParseAddress(address)
+	if err != nil || addr.Name == "" {
+		return address
+	}
+	return addr.String()
 }
 
-// MakeEmailTemplate parses a given template into the main email layout template,
-// applies the parsed template to the specified content object and returns
-// the result as a bytes.Buffer.
-func MakeEmailTemplate(fileName string, content interface{}) *bytes.Buffer {
-	var doc bytes.Buffer
+// headerValue removes line breaks and surrounding white space from the value of a header.
+func headerValue(value string) string {
+	return strings.TrimSpace(strings.NewReplacer("\r", " ", "\n", " ").Replace(value))
+}
 
-	mainFile := conf.GetResourceFile("templates", "emaillayout.txt")
-	contentFile := conf.GetResourceFile("templates", fileName)
-	tmpl, err := template.ParseFiles(mainFile, contentFile)
+// MakeEmail renders the e-mail template with the given name in the language lang and returns a
+// MIME multipart/alternative message with a plain text and an HTML part. The template set consists
+// of the files <name>.txt, which defines the blocks "subject" and "content", and <name>.html, which
+// defines the block "content". Both are rendered into the layouts layout.txt and layout.html.
+// Templates are looked up in templates/email/<lang> of the configuration and the resources directory.
+func MakeEmail(lang, name string, to []string, content interface{}) []byte {
+	textTmpl, err := template.ParseFiles(emailTemplateFile(lang, "layout.txt"), emailTemplateFile(lang, name+".txt"))
+	if err != nil {
+		panic("Error parsing e-mail template: " + err.Error())
+	}
+	htmlTmpl, err := htmltemplate.ParseFiles(emailTemplateFile(lang, "layout.html"), emailTemplateFile(lang, name+".html"))
 	if err != nil {
 		panic("Error parsing e-mail template: " + err.Error())
 	}
 
-	err = tmpl.Execute(&doc, content)
+	var subject, text, html bytes.Buffer
+	err = textTmpl.ExecuteTemplate(&subject, "subject", content)
+	if err == nil {
+		err = textTmpl.ExecuteTemplate(&text, "layout", content)
+	}
+	if err == nil {
+		err = htmlTmpl.ExecuteTemplate(&html, "layout", content)
+	}
 	if err != nil {
 		panic("Error executing e-mail template: " + err.Error())
 	}
 
-	return &doc
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{{"text/plain; charset=utf-8", text.Bytes()}, {"text/html; charset=utf-8", html.Bytes()}} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		w, err := parts.CreatePart(header)
+		if err != nil {
+			panic(err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err = qp.Write(part.content); err != nil {
+			panic(err)
+		}
+		if err = qp.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if err = parts.Close(); err != nil {
+		panic(err)
+	}
+
+	from := conf.GetSmtpCredentials().From
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = strings.Trim(from[i+1:], "<> ")
+	}
+	recipients := make([]string, 0, len(to))
+	for _, address := range to {
+		recipients = append(recipients, formatAddress(address))
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", formatAddress(from))
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(subject.String())))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", RandomToken(), domain)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=\"%s\"\r\n\r\n", parts.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes()
 }
@@ -9,183 +9,235 @@
 package util
 
 import (
-	"fmt"
-	"github.com/G-Node/gin-auth/conf"
-	"net/smtp"
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
-)
-
-func TestMakeEmailTemplate_Plain(t *testing.T) {
-	const template = "emailplain.txt"
-	const from = "sender@example.com"
-	const subject = "This is a test message from your conscience!"
-	const message = "Give up your evil ways!"
-	recipient := []string{"recipient1@example.com", "recipient2@example.com"}
 
-	fields := &struct {
-		From    string
-		To      string
-		Subject string
-		Body    string
-	}{from, strings.Join(recipient, ", "), subject, message}
-
-	content := MakeEmailTemplate(template, fields).String()
-	if strings.Contains(content, "<no value>") {
-		t.Errorf("Part of the template was not properly parsed:\n\n%s", content)
-	}
+	"github.com/G-Node/gin-auth/conf"
+)
 
-	if !strings.Contains(content, "From: "+from) {
-		t.Errorf("Sender line is malformed or missing:\n\n%s", content)
+// readEmail parses a multipart e-mail and returns the decoded subject together with
+// the decoded plain text and HTML parts.
+func readEmail(t *testing.T, content []byte) (*mail.Message, string, string, string) {
+	msg, err := mail.ReadMessage(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(content, "To: "+recipient[0]+", "+recipient[1]) {
-		t.Errorf("Recipient line is malformed or missing:\n\n%s", content)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(content, "Subject: "+subject) {
-		t.Errorf("Subject is malformed or missing:\n\n%s", content)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content type multipart/alternative expected but was '%s'", mediaType)
 	}
-	if !strings.Contains(content, message) {
-		t.Errorf("Body is malformed or missing:\n\n%s", content)
+	parts := map[string]string{}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := ioutil.ReadAll(part)
+		parts[strings.Split(part.Header.Get("Content-Type"), ";")[0]] = string(body)
 	}
+
+	return msg, subject, parts["text/plain"], parts["text/html"]
 }
 
-func TestMakeEmailTemplate_Activate(t *testing.T) {
-	const template = "emailactivate.txt"
+func TestMakeEmail_Activate(t *testing.T) {
 	const code = "activation_code"
-	const from = "sender@example.com"
-	const subject = "This is another test message from your conscience!"
 	const url = "http://this.net/points/to/nowhere"
 	recipient := []string{"recipient@example.com"}
 
 	fields := &struct {
-		From    string
-		To      string
-		Subject string
-		Code    string
 		BaseUrl string
-	}{from, strings.Join(recipient, ", "), subject, code, url}
+		Code    string
+	}{url, code}
 
-	content := MakeEmailTemplate(template, fields).String()
-	if strings.Contains(content, "<no value>") {
+	content := MakeEmail("en", "activate", recipient, fields)
+	if bytes.Contains(content, []byte("<no value>")) {
 		t.Errorf("Part of the template was not properly parsed:\n\n%s", content)
 	}
 
-	if !strings.Contains(content, "From: "+from) {
+	msg, subject, text, html := readEmail(t, content)
+	if msg.Header.Get("From") != conf.GetSmtpCredentials().From {
 		t.Errorf("Sender line is malformed or missing:\n\n%s", content)
 	}
-	if !strings.Contains(content, "To: "+recipient[0]) {
+	if msg.Header.Get("To") != recipient[0] {
 		t.Errorf("Recipient line is malformed or missing:\n\n%s", content)
 	}
-	if !strings.Contains(content, "Subject: "+subject) {
+	if msg.Header.Get("MIME-Version") != "1.0" || msg.Header.Get("Message-ID") == "" || msg.Header.Get("Date") == "" {
+		t.Errorf("Headers are malformed or missing:\n\n%s", content)
+	}
+	if subject != "GIN account activation" {
 		t.Errorf("Subject is malformed or missing:\n\n%s", content)
 	}
-	if !strings.Contains(content, url) {
-		t.Errorf("BaseUrl is malformed or missing:\n\n%s", content)
+	if !strings.Contains(text, url+"/oauth/activation?activation_code="+code) {
+		t.Errorf("Activation link is malformed or missing:\n\n%s", text)
 	}
-	if !strings.Contains(content, "activation_code="+code) {
-		t.Errorf("ActivationCode is malformed or missing:\n\n%s", content)
+	if !strings.Contains(html, `href="`+url+"/oauth/activation?activation_code="+code+`"`) {
+		t.Errorf("Activation link is malformed or missing:\n\n%s", html)
 	}
 }
 
-func TestMakeEmailTemplate_Reset(t *testing.T) {
-	const template = "emailreset.txt"
+func TestMakeEmail_Reset(t *testing.T) {
 	const code = "reset_pw_code"
-	const from = "sender@example.com"
-	const subject = "This is another test message from your conscience!"
 	const url = "http://this.net/points/to/nowhere"
-	recipient := []string{"recipient@example.com"}
+	recipient := []string{"recipient1@example.com", "recipient2@example.com"}
 
 	fields := &struct {
-		From    string
-		To      string
-		Subject string
-		Code    string
-		BaseUrl string
-	}{from, strings.Join(recipient, ", "), subject, code, url}
-
-	content := MakeEmailTemplate(template, fields).String()
-	if strings.Contains(content, "<no value>") {
-		t.Errorf("Part of the template was not properly parsed:\n\n%s", content)
+		BaseUrl  string
+		Code     string
+		ValidFor int
+	}{url, code, 60}
+
+	content := MakeEmail("en", "reset", recipient, fields)
+	msg, _, text, html := readEmail(t, content)
+	if msg.Header.Get("To") != recipient[0]+", "+recipient[1] {
+		t.Errorf("Recipient line is malformed or missing:\n\n%s", content)
+	}
+	if !strings.Contains(text, "reset_page?reset_code="+code) || !strings.Contains(text, "60 minutes") {
+		t.Errorf("Reset code is malformed or missing:\n\n%s", text)
 	}
+	if !strings.Contains(html, "reset_page?reset_code="+code) {
+		t.Errorf("Reset code is malformed or missing:\n\n%s", html)
+	}
+}
 
-	if !strings.Contains(content, "From: "+from) {
-		t.Errorf("Sender line is malformed or missing:\n\n%s", content)
+func TestMakeEmail_Language(t *testing.T) {
+	fields := &struct {
+		BaseUrl  string
+		Code     string
+		ValidFor int
+	}{"http://this.net", "code", 60}
+
+	// german templates with encoded subject
+	content := MakeEmail("de", "reset", []string{"recipient@example.com"}, fields)
+	if bytes.Contains(content, []byte("Subject: Zurücksetzen")) {
+		t.Error("Subject is expected to be encoded")
 	}
-	if !strings.Contains(content, "To: "+recipient[0]) {
-		t.Errorf("Recipient line is malformed or missing:\n\n%s", content)
+	_, subject, text, _ := readEmail(t, content)
+	if subject != "Zurücksetzen Ihres GIN-Passworts" {
+		t.Errorf("German subject expected but was '%s'", subject)
 	}
-	if !strings.Contains(content, "Subject: "+subject) {
-		t.Errorf("Subject is malformed or missing:\n\n%s", content)
+	if !strings.Contains(text, "60 Minuten gültig") {
+		t.Errorf("German text expected:\n\n%s", text)
 	}
-	if !strings.Contains(content, url+"/oauth") {
-		t.Errorf("Url is malformed or missing:\n\n%s", content)
+
+	// region falls back to the language
+	_, subject, _, _ = readEmail(t, MakeEmail("de-AT", "reset", []string{"recipient@example.com"}, fields))
+	if subject != "Zurücksetzen Ihres GIN-Passworts" {
+		t.Errorf("German subject expected but was '%s'", subject)
 	}
-	if !strings.Contains(content, "reset_page?reset_code="+code) {
-		t.Errorf("Reset code is malformed or missing:\n\n%s", content)
+
+	// unknown and invalid languages fall back to the default language
+	for _, lang := range []string{"fr", "", "../en"} {
+		_, subject, _, _ = readEmail(t, MakeEmail(lang, "reset", []string{"recipient@example.com"}, fields))
+		if subject != "Your GIN Account Password Reset Request" {
+			t.Errorf("English subject expected for '%s' but was '%s'", lang, subject)
+		}
 	}
 }
 
-func TestEmailDispatcher_Send(t *testing.T) {
-	const template = "emailplain.txt"
-	const from = "sender@example.com"
-	const subject = "This is a test message from your conscience!"
-	const message = "Give up your evil ways!"
-	recipient := []string{"recipient1@example.com", "recipient2@example.com"}
-
+func TestMakeEmail_EmailChange(t *testing.T) {
 	fields := &struct {
-		From    string
-		To      string
-		Subject string
-		Body    string
-	}{from, strings.Join(recipient, ", "), subject, message}
-
-	content := MakeEmailTemplate(template, fields).Bytes()
-
-	f := func(addr string, auth smtp.Auth, from string, recipient []string, cont []byte) error {
-		var err error
-		content := string(cont)
-		if !strings.Contains(content, "\n"+message) {
-			err = fmt.Errorf("Body is malformed or missing:\n%s", content)
+		BaseUrl  string
+		Login    string
+		Email    string
+		Code     string
+		ValidFor int
+	}{"http://this.net", "alice", "new@example.com", "change_code", 1440}
+
+	for _, lang := range []string{"en", "de"} {
+		content := MakeEmail(lang, "emailconfirm", []string{fields.Email}, fields)
+		_, _, text, html := readEmail(t, content)
+		if !strings.Contains(text, "/oauth/email_confirm?code=change_code") || !strings.Contains(html, "/oauth/email_confirm?code=change_code") {
+			t.Errorf("Confirmation link is malformed or missing:\n\n%s", content)
+		}
+
+		content = MakeEmail(lang, "emailnotice", []string{"old@example.com"}, fields)
+		_, _, text, html = readEmail(t, content)
+		if !strings.Contains(text, "/oauth/email_undo_page?code=change_code") || !strings.Contains(html, "/oauth/email_undo_page?code=change_code") {
+			t.Errorf("Undo link is malformed or missing:\n\n%s", content)
+		}
+		if !strings.Contains(text, fields.Email) {
+			t.Errorf("New address is missing:\n\n%s", text)
 		}
-		return err
 	}
+}
 
-	config := conf.GetSmtpCredentials()
+func TestMakeEmail_Override(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gin-auth-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 
-	disp := &emailDispatcher{conf: config, send: f}
-	err := disp.Send(recipient, content)
+	override := filepath.Join(dir, "templates", "email", "en")
+	err = os.MkdirAll(override, 0700)
 	if err != nil {
-		t.Error(err.Error())
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(override, "activate.txt"),
+		[]byte(`{{ define "subject" }}Custom activation{{ end }}{{ define "content" }}Custom {{ .Code }}{{ end }}`), 0600)
+	if err != nil {
+		t.Fatal(err)
 	}
-}
 
-func TestNewEmailDispatcher(t *testing.T) {
-	const template = "emailplain.txt"
-	const from = "sender@example.com"
-	const subject = "This is a test message from your conscience!"
-	const message = "Give up your evil ways!"
-	recipient := []string{"recipient1@example.com", "recipient2@example.com"}
+	configPath := conf.GetConfigFile()
+	conf.SetConfigPath(dir)
+	defer conf.SetConfigPath(configPath)
 
 	fields := &struct {
-		From    string
-		To      string
-		Subject string
-		Body    string
-	}{from, strings.Join(recipient, ", "), subject, message}
+		BaseUrl string
+		Code    string
+	}{"http://this.net", "code"}
 
-	content := MakeEmailTemplate(template, fields).Bytes()
+	_, subject, text, html := readEmail(t, MakeEmail("en", "activate", []string{"recipient@example.com"}, fields))
+	if subject != "Custom activation" || !strings.Contains(text, "Custom code") {
+		t.Errorf("Overridden template expected but was '%s':\n\n%s", subject, text)
+	}
+	if !strings.Contains(html, "Activate your account") {
+		t.Errorf("HTML template of the resources expected:\n\n%s", html)
+	}
+}
 
-	conf.GetSmtpCredentials().Mode = "skip"
-	mail := NewEmailDispatcher()
-	err := mail.Send(recipient, content)
-	if err != nil {
-		t.Error(err.Error())
+func TestEmailLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":                          DefaultLanguage,
+		"de":                        "de",
+		"de-DE,de;q=0.9,en;q=0.8":   "de",
+		"fr-FR, en;q=0.5, de;q=0.7": "de",
+		"en;q=0.5, de;q=0":          "en",
+		"fr, it":                    DefaultLanguage,
+		"*":                         DefaultLanguage,
+		"../../conf, de;q=0.1":      "de",
+		"EN-us":                     "en",
+	}
+	for header, expected := range cases {
+		if lang := EmailLanguage(header); lang != expected {
+			t.Errorf("Language '%s' expected for '%s' but was '%s'", expected, header, lang)
+		}
 	}
+}
 
-	conf.GetSmtpCredentials().Mode = "print"
-	mail = NewEmailDispatcher()
-	err = mail.Send(recipient, content)
-	if err != nil {
-		t.Error(err.Error())
+func TestValidLanguage(t *testing.T) {
+	for _, lang := range []string{"en", "de-AT", "zh-Hant-TW"} {
+		if !ValidLanguage(lang) {
+			t.Errorf("Language '%s' expected to be valid", lang)
+		}
+	}
+	for _, lang := range []string{"", "e", "english-language-tag", "../en", "DE"} {
+		if ValidLanguage(lang) {
+			t.Errorf("Language '%s' expected to be invalid", lang)
+		}
 	}
 }
@@ -0,0 +1,355 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package util
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+)
+
+const smtpTimeout = 10 * time.Second
+
+// EmailTransport defines an interface for the delivery of e-mails.
+type EmailTransport interface {
+	// Send delivers an e-mail with the given content to all recipients.
+	Send(from string, recipient []string, content []byte) error
+	// Check tests whether the transport is able to deliver e-mails.
+	Check() error
+}
+
+// NewEmailTransport returns the e-mail transport for the given mode. Supported values of mode are
+// "sendmail", "file", "memory", "print" and "skip", for any other value e-mails are sent via smtp.
+// The transports are configured in the smtp section of the server configuration.
+func NewEmailTransport(mode string) EmailTransport {
+	config := conf.GetSmtpCredentials()
+	switch strings.ToLower(mode) {
+	case "skip":
+		return &skipTransport{}
+	case "print":
+		return &printTransport{}
+	case "memory":
+		return CapturedEmails
+	case "sendmail":
+		return &sendmailTransport{path: config.SendmailPath}
+	case "file":
+		return &fileTransport{dir: config.Directory}
+	default:
+		return &smtpTransport{conf: config}
+	}
+}
+
+// CheckEmailTransport tests whether e-mails can be delivered with the configured transport.
+func CheckEmailTransport() error {
+	return NewEmailTransport(conf.GetSmtpCredentials().Mode).Check()
+}
+
+// skipTransport skips over any e-mail sending process.
+type skipTransport struct{}
+
+// Send does not deliver the e-mail.
+func (t *skipTransport) Send(from string, recipient []string, content []byte) error {
+	fmt.Printf("Skip sending e-mail to '%s'\n", strings.Join(recipient, ", "))
+	return nil
+}
+
+// Check always succeeds.
+func (t *skipTransport) Check() error {
+	return nil
+}
+
+// printTransport writes the content of any e-mail to the commandline / log.
+type printTransport struct{}
+
+// Send prints the content of the e-mail.
+func (t *printTransport) Send(from string, recipient []string, content []byte) error {
+	fmt.Printf("%s\n", string(content))
+	return nil
+}
+
+// Check always succeeds.
+func (t *printTransport) Check() error {
+	return nil
+}
+
+// CapturedEmail is an e-mail kept by the memory transport.
+type CapturedEmail struct {
+	From      string
+	Recipient []string
+	Content   []byte
+}
+
+// MemoryTransport keeps all e-mails in memory instead of delivering them.
+// It is meant to be used in tests.
+type MemoryTransport struct {
+	lock   sync.Mutex
+	emails []CapturedEmail
+}
+
+// CapturedEmails is the memory transport used if the mode "memory" is configured.
+var CapturedEmails = &MemoryTransport{}
+
+// Send stores a copy of the e-mail.
+func (t *MemoryTransport) Send(from string, recipient []string, content []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	email := CapturedEmail{
+		From:      from,
+		Recipient: append([]string{}, recipient...),
+		Content:   append([]byte{}, content...),
+	}
+	t.emails = append(t.emails, email)
+	return nil
+}
+
+// Check always succeeds.
+func (t *MemoryTransport) Check() error {
+	return nil
+}
+
+// Emails returns all e-mails sent with the transport.
+func (t *MemoryTransport) Emails() []CapturedEmail {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return append([]CapturedEmail{}, t.emails...)
+}
+
+// Reset removes all e-mails from the transport.
+func (t *MemoryTransport) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.emails = nil
+}
+
+// sendmailTransport pipes e-mails to a local sendmail compatible binary.
+type sendmailTransport struct {
+	path string
+}
+
+// Send invokes the sendmail binary with the envelope sender and recipients and writes
+// the e-mail to its standard input.
+func (t *sendmailTransport) Send(from string, recipient []string, content []byte) error {
+	args := append([]string{"-i", "-f", from, "--"}, recipient...)
+	cmd := exec.Command(t.path, args...)
+	cmd.Stdin = bytes.NewReader(content)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Sendmail failed: %s: %s", err.Error(), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Check tests whether the sendmail binary exists and is executable.
+func (t *sendmailTransport) Check() error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return fmt.Errorf("Sendmail binary '%s' is not executable", t.path)
+	}
+	return nil
+}
+
+// fileTransport drops e-mails into a maildir, which is useful for staging environments.
+type fileTransport struct {
+	dir string
+}
+
+// Send writes the e-mail to the 'tmp' directory of the maildir and moves it to 'new'
+// afterwards, such that readers never see incomplete e-mails. The envelope sender and
+// recipients are prepended as Return-Path and Delivered-To headers.
+func (t *fileTransport) Send(from string, recipient []string, content []byte) error {
+	err := t.Check()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Return-Path: <%s>\r\n", from)
+	for _, r := range recipient {
+		fmt.Fprintf(&buf, "Delivered-To: %s\r\n", r)
+	}
+	buf.Write(content)
+
+	name := fmt.Sprintf("%d.%s.gin-auth", time.Now().UnixNano(), RandomToken())
+	tmp := filepath.Join(t.dir, "tmp", name)
+	err = ioutil.WriteFile(tmp, buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.dir, "new", name))
+}
+
+// Check creates the directories of the maildir if necessary.
+func (t *fileTransport) Check() error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(t.dir, sub), 0700)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// smtpTransport sends e-mails via smtp using STARTTLS, implicit TLS or an unencrypted connection.
+type smtpTransport struct {
+	conf *conf.SmtpCredentials
+}
+
+// Send delivers the e-mail to the configured smtp server.
+func (t *smtpTransport) Send(from string, recipient []string, content []byte) error {
+	c, err := t.connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	for _, r := range recipient {
+		if err = c.Rcpt(r); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(content); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// Check tests whether a connection to the smtp server can be established and
+// whether the authentication with the configured credentials succeeds.
+func (t *smtpTransport) Check() error {
+	c, err := t.connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return c.Quit()
+}
+
+// connect opens an authenticated connection to the smtp server.
+func (t *smtpTransport) connect() (*smtp.Client, error) {
+	addr := t.conf.Host + ":" + strconv.Itoa(t.conf.Port)
+	tlsConfig := &tls.Config{ServerName: t.conf.Host}
+
+	var conn net.Conn
+	var err error
+	if t.conf.TLS == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, smtpTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = conn.SetDeadline(time.Now().Add(6 * smtpTimeout))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c, err := smtp.NewClient(conn, t.conf.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// never fall back to plain text if STARTTLS was configured
+	if t.conf.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, errors.New("The smtp server does not support STARTTLS")
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	var auth smtp.Auth
+	switch t.conf.Auth {
+	case "none":
+	case "login":
+		auth = &loginAuth{username: t.conf.Username, password: t.conf.Password, host: t.conf.Host}
+	case "cram-md5":
+		auth = smtp.CRAMMD5Auth(t.conf.Username, t.conf.Password)
+	default:
+		auth = smtp.PlainAuth("", t.conf.Username, t.conf.Password, t.conf.Host)
+	}
+	if auth != nil {
+		if err = c.Auth(auth); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// loginAuth implements the smtp authentication mechanism LOGIN, which is not supported by net/smtp.
+// Like smtp.PlainAuth credentials are only sent over encrypted connections or to localhost.
+type loginAuth struct {
+	username, password, host string
+}
+
+// Start begins the authentication with the server.
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	local := server.Name == "localhost" || server.Name == "127.0.0.1" || server.Name == "::1"
+	if !server.TLS && !local {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next answers the username and password challenges of the server.
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("Unexpected server challenge: %s", fromServer)
+}
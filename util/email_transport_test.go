@@ -0,0 +1,275 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package util
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/conf"
+)
+
+const (
+	transportFrom    = "sender@example.com"
+	transportContent = "Subject: Test\r\n\r\nGive up your evil ways!\r\n"
+)
+
+var transportRecipient = []string{"recipient1@example.com", "recipient2@example.com"}
+
+func TestNewEmailTransport(t *testing.T) {
+	if _, ok := NewEmailTransport("skip").(*skipTransport); !ok {
+		t.Error("Skip transport expected")
+	}
+	if _, ok := NewEmailTransport("Print").(*printTransport); !ok {
+		t.Error("Print transport expected")
+	}
+	if NewEmailTransport("memory") != CapturedEmails {
+		t.Error("Memory transport expected")
+	}
+	if _, ok := NewEmailTransport("sendmail").(*sendmailTransport); !ok {
+		t.Error("Sendmail transport expected")
+	}
+	if _, ok := NewEmailTransport("file").(*fileTransport); !ok {
+		t.Error("File transport expected")
+	}
+	if _, ok := NewEmailTransport("").(*smtpTransport); !ok {
+		t.Error("Smtp transport expected")
+	}
+	if _, ok := NewEmailTransport("somethingElse").(*smtpTransport); !ok {
+		t.Error("Smtp transport expected")
+	}
+}
+
+func TestCheckEmailTransport(t *testing.T) {
+	creds := conf.GetSmtpCredentials()
+	mode, host := creds.Mode, creds.Host
+	defer func() { creds.Mode, creds.Host = mode, host }()
+
+	creds.Mode = "print"
+	err := CheckEmailTransport()
+	if err != nil {
+		t.Errorf("Transport check error on print: %s\n", err.Error())
+	}
+
+	creds.Mode = "skip"
+	err = CheckEmailTransport()
+	if err != nil {
+		t.Errorf("Transport check error on skip: %s\n", err.Error())
+	}
+
+	creds.Host = "nowhere"
+	creds.Mode = "somethingElse"
+	err = CheckEmailTransport()
+	if err == nil {
+		t.Error("Expected smtp connection error")
+	}
+
+	creds.Mode = ""
+	err = CheckEmailTransport()
+	if err == nil {
+		t.Error("Expected smtp connection error")
+	}
+}
+
+// serveSmtpWithoutTLS accepts a single connection and answers like an smtp server, which
+// does not support STARTTLS.
+func serveSmtpWithoutTLS(l net.Listener) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	_, _ = conn.Write([]byte("220 localhost ESMTP\r\n"))
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"):
+			_, _ = conn.Write([]byte("250-localhost\r\n250 8BITMIME\r\n"))
+		case cmd == "QUIT":
+			_, _ = conn.Write([]byte("221 Bye\r\n"))
+			return
+		default:
+			_, _ = conn.Write([]byte("502 Not implemented\r\n"))
+		}
+	}
+}
+
+func TestSmtpTransportStartTLS(t *testing.T) {
+	creds := conf.GetSmtpCredentials()
+	mode, host, port, tlsMode := creds.Mode, creds.Host, creds.Port, creds.TLS
+	defer func() { creds.Mode, creds.Host, creds.Port, creds.TLS = mode, host, port, tlsMode }()
+
+	creds.Mode = "smtp"
+	creds.Host = "127.0.0.1"
+
+	for _, tls := range []string{"starttls", "none"} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go serveSmtpWithoutTLS(l)
+
+		creds.Port = l.Addr().(*net.TCPAddr).Port
+		creds.TLS = tls
+		err = CheckEmailTransport()
+		if tls == "starttls" && (err == nil || !strings.Contains(err.Error(), "STARTTLS")) {
+			t.Errorf("Error expected for a server without STARTTLS but was '%v'", err)
+		}
+		if tls == "none" && err != nil {
+			t.Errorf("No error expected without TLS but was '%v'", err)
+		}
+		l.Close()
+	}
+}
+
+func TestMemoryTransport(t *testing.T) {
+	transport := &MemoryTransport{}
+
+	err := transport.Send(transportFrom, transportRecipient, []byte(transportContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails := transport.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Exactly one e-mail expected but was %d", len(emails))
+	}
+	if emails[0].From != transportFrom || len(emails[0].Recipient) != 2 || string(emails[0].Content) != transportContent {
+		t.Errorf("Unexpected e-mail: %v", emails[0])
+	}
+
+	transport.Reset()
+	if len(transport.Emails()) != 0 {
+		t.Error("No e-mails expected after reset")
+	}
+}
+
+func TestFileTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gin-auth-maildir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	transport := &fileTransport{dir: filepath.Join(dir, "maildir")}
+	err = transport.Send(transportFrom, transportRecipient, []byte(transportContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "maildir", "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Exactly one e-mail expected but was %d", len(files))
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "maildir", "new", files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "Return-Path: <"+transportFrom+">\r\n") {
+		t.Errorf("Return-Path header expected:\n%s", content)
+	}
+	if !strings.Contains(string(content), "Delivered-To: "+transportRecipient[1]+"\r\n") {
+		t.Errorf("Delivered-To header expected:\n%s", content)
+	}
+	if !strings.HasSuffix(string(content), transportContent) {
+		t.Errorf("Content expected:\n%s", content)
+	}
+	tmp, _ := ioutil.ReadDir(filepath.Join(dir, "maildir", "tmp"))
+	if len(tmp) != 0 {
+		t.Error("No e-mails expected in tmp")
+	}
+}
+
+func TestSendmailTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gin-auth-sendmail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// fake sendmail writing its arguments and input to files
+	out := filepath.Join(dir, "out")
+	script := "#!/bin/sh\necho \"$@\" > " + out + ".args\ncat > " + out + "\n"
+	path := filepath.Join(dir, "sendmail")
+	err = ioutil.WriteFile(path, []byte(script), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &sendmailTransport{path: path}
+	if err = transport.Check(); err != nil {
+		t.Fatal(err)
+	}
+	err = transport.Send(transportFrom, transportRecipient, []byte(transportContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, _ := ioutil.ReadFile(out + ".args")
+	expected := "-i -f " + transportFrom + " -- " + strings.Join(transportRecipient, " ")
+	if strings.TrimSpace(string(args)) != expected {
+		t.Errorf("Arguments '%s' expected but were '%s'", expected, args)
+	}
+	content, _ := ioutil.ReadFile(out)
+	if string(content) != transportContent {
+		t.Errorf("Content expected but was:\n%s", content)
+	}
+
+	// missing binary
+	transport = &sendmailTransport{path: filepath.Join(dir, "doesnotexist")}
+	if transport.Check() == nil {
+		t.Error("Error expected for missing binary")
+	}
+	if transport.Send(transportFrom, transportRecipient, []byte(transportContent)) == nil {
+		t.Error("Error expected for missing binary")
+	}
+}
+
+func TestLoginAuth(t *testing.T) {
+	auth := &loginAuth{username: "user", password: "secret", host: "mail.example.com"}
+
+	_, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com", TLS: false})
+	if err == nil {
+		t.Error("Error expected on unencrypted connection")
+	}
+	_, _, err = auth.Start(&smtp.ServerInfo{Name: "other.example.com", TLS: true})
+	if err == nil {
+		t.Error("Error expected on wrong host")
+	}
+	proto, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com", TLS: true})
+	if err != nil || proto != "LOGIN" {
+		t.Errorf("Mechanism LOGIN expected but was '%s' (%v)", proto, err)
+	}
+
+	resp, err := auth.Next([]byte("Username:"), true)
+	if err != nil || string(resp) != "user" {
+		t.Errorf("Username expected but was '%s' (%v)", resp, err)
+	}
+	resp, err = auth.Next([]byte("Password:"), true)
+	if err != nil || string(resp) != "secret" {
+		t.Errorf("Password expected but was '%s' (%v)", resp, err)
+	}
+	_, err = auth.Next([]byte("Something:"), true)
+	if err == nil {
+		t.Error("Error expected on unknown challenge")
+	}
+}
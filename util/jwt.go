@@ -0,0 +1,133 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// jwtHeader is the JOSE header of a signed JWT.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// SignJWT encodes the claims as JSON and creates a signed JWT in compact serialization
+// (RFC 7519 "JSON Web Token"). Supported algorithms are "RS256" with an *rsa.PrivateKey
+// and "ES256" with an *ecdsa.PrivateKey on the P-256 curve.
+func SignJWT(claims interface{}, alg, kid string, key crypto.Signer) (string, error) {
+	header, err := json.Marshal(&jwtHeader{Alg: alg, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if alg != "RS256" {
+			return "", fmt.Errorf("Algorithm %s can not be used with a RSA key", alg)
+		}
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+	case *ecdsa.PrivateKey:
+		if alg != "ES256" {
+			return "", fmt.Errorf("Algorithm %s can not be used with an ECDSA key", alg)
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return "", err
+		}
+		sig = make([]byte, 64)
+		copyPadded(sig[:32], r.Bytes())
+		copyPadded(sig[32:], s.Bytes())
+	default:
+		return "", errors.New("Unsupported signing key")
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyJWT checks the signature of a JWT in compact serialization and decodes its payload
+// into claims. The algorithm in the header of the token must match alg. Validation of the
+// claims themselves (e.g. the expiration time) is up to the caller.
+func VerifyJWT(token, alg string, key crypto.PublicKey, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("Malformed token")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return errors.New("Malformed token header")
+	}
+	header := &jwtHeader{}
+	err = json.Unmarshal(headerBytes, header)
+	if err != nil {
+		return errors.New("Malformed token header")
+	}
+	if header.Alg != alg {
+		return fmt.Errorf("Unexpected algorithm %s", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("Malformed token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+			return errors.New("Invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || len(sig) != 64 {
+			return errors.New("Invalid token signature")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return errors.New("Invalid token signature")
+		}
+	default:
+		return errors.New("Unsupported verification key")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return errors.New("Malformed token payload")
+	}
+	return json.Unmarshal(payload, claims)
+}
+
+// copyPadded copies src right aligned into dst, such that leading bytes of
+// dst are zero if src is shorter than dst.
+func copyPadded(dst, src []byte) {
+	copy(dst[len(dst)-len(src):], src)
+}
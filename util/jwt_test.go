@@ -0,0 +1,89 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+)
+
+type testClaims struct {
+	Sub string `json:"sub"`
+	Exp int64  `json:"exp"`
+}
+
+func TestSignAndVerifyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []struct {
+		alg     string
+		private crypto.Signer
+	}{
+		{"RS256", rsaKey},
+		{"ES256", ecKey},
+	}
+
+	for _, k := range keys {
+		token, err := SignJWT(&testClaims{Sub: "alice", Exp: 42}, k.alg, "key1", k.private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Count(token, ".") != 2 {
+			t.Errorf("Token '%s' is not in compact serialization", token)
+		}
+
+		claims := &testClaims{}
+		err = VerifyJWT(token, k.alg, k.private.Public(), claims)
+		if err != nil {
+			t.Error(err)
+		}
+		if claims.Sub != "alice" || claims.Exp != 42 {
+			t.Errorf("Unexpected claims: %v", claims)
+		}
+
+		// wrong algorithm
+		err = VerifyJWT(token, "HS256", k.private.Public(), &testClaims{})
+		if err == nil {
+			t.Error("Verification with wrong algorithm should fail")
+		}
+
+		// manipulated payload
+		parts := strings.Split(token, ".")
+		forged, _ := SignJWT(&testClaims{Sub: "bob", Exp: 42}, k.alg, "key1", k.private)
+		parts[1] = strings.Split(forged, ".")[1]
+		err = VerifyJWT(strings.Join(parts, "."), k.alg, k.private.Public(), &testClaims{})
+		if err == nil {
+			t.Error("Verification of manipulated token should fail")
+		}
+	}
+
+	// key does not match the algorithm
+	_, err = SignJWT(&testClaims{}, "ES256", "", rsaKey)
+	if err == nil {
+		t.Error("Signing with mismatching key should fail")
+	}
+
+	// malformed token
+	err = VerifyJWT("foo.bar", "RS256", rsaKey.Public(), &testClaims{})
+	if err == nil {
+		t.Error("Verification of malformed token should fail")
+	}
+}
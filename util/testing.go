@@ -9,6 +9,12 @@
 package util
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
 	"testing"
 )
 
@@ -19,3 +25,93 @@ func FailOnPanic(t *testing.T) {
 		t.Fatal(r)
 	}
 }
+
+// SoftAuthenticator is a software WebAuthn authenticator with an ES256 key, which can be
+// used in tests to perform registration and assertion ceremonies.
+type SoftAuthenticator struct {
+	CredentialID []byte
+	Key          *ecdsa.PrivateKey
+	SignCount    uint32
+	UserVerified bool
+}
+
+// NewSoftAuthenticator creates a software authenticator with a new key and credential ID.
+func NewSoftAuthenticator() *SoftAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		panic(err)
+	}
+	return &SoftAuthenticator{CredentialID: id, Key: key, UserVerified: true}
+}
+
+// Create performs a registration ceremony and returns the client data and the attestation object
+// (format "none") for the given challenge.
+func (auth *SoftAuthenticator) Create(rpID, origin, challenge string) ([]byte, []byte) {
+	coseKey, err := EncodeCBOR(map[interface{}]interface{}{
+		1:  2,
+		3:  COSEAlgES256,
+		-1: 1,
+		-2: auth.Key.X.FillBytes(make([]byte, 32)),
+		-3: auth.Key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	authData := auth.authData(rpID, webAuthnAttested)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = append(authData, byte(len(auth.CredentialID)>>8), byte(len(auth.CredentialID)))
+	authData = append(authData, auth.CredentialID...)
+	authData = append(authData, coseKey...)
+
+	attestation, err := EncodeCBOR(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return auth.clientData("webauthn.create", origin, challenge), attestation
+}
+
+// Get performs an assertion ceremony and returns the client data, the authenticator data
+// and the signature for the given challenge.
+func (auth *SoftAuthenticator) Get(rpID, origin, challenge string) ([]byte, []byte, []byte) {
+	auth.SignCount++
+	clientData := auth.clientData("webauthn.get", origin, challenge)
+	authData := auth.authData(rpID, 0)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, auth.Key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return clientData, authData, sig
+}
+
+func (auth *SoftAuthenticator) clientData(typ, origin, challenge string) []byte {
+	clientData, err := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": origin})
+	if err != nil {
+		panic(err)
+	}
+	return clientData
+}
+
+func (auth *SoftAuthenticator) authData(rpID string, flags byte) []byte {
+	flags |= WebAuthnUserPresent
+	if auth.UserVerified {
+		flags |= WebAuthnUserVerified
+	}
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, auth.SignCount)
+}
@@ -11,9 +11,14 @@ package util
 import (
 	"crypto/rand"
 	"encoding/base32"
+	"math/big"
 	"strings"
 )
 
+// userCodeChars contains the characters of user codes: upper case consonants without
+// easily confused characters as recommended by RFC 8628 section 6.1.
+const userCodeChars = "BCDFGHJKLMNPQRSTVWXZ"
+
 // RandomToken returns a cryptographically strong random token string.
 // The Token is generated from 512 random bits and encoded via base32.StdEncoding
 func RandomToken() string {
@@ -26,3 +31,19 @@ func RandomToken() string {
 
 	return strings.Trim(base32.StdEncoding.EncodeToString(rnd), "=")
 }
+
+// RandomUserCode returns a random code of the given length, which is short enough to be
+// typed in by a user. Codes only consist of the characters in userCodeChars.
+func RandomUserCode(length int) string {
+	max := big.NewInt(int64(len(userCodeChars)))
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		code[i] = userCodeChars[n.Int64()]
+	}
+
+	return string(code)
+}
@@ -9,6 +9,7 @@
 package util
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -18,3 +19,15 @@ func TestRandomToken(t *testing.T) {
 		t.Error("Token length is expected to be 103")
 	}
 }
+
+func TestRandomUserCode(t *testing.T) {
+	code := RandomUserCode(8)
+	if len(code) != 8 {
+		t.Error("Code length is expected to be 8")
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(userCodeChars, c) {
+			t.Errorf("Unexpected character '%c' in code", c)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parameters of the time-based one-time passwords (RFC 6238) used for two-factor authentication.
+// These are the defaults expected by most authenticator apps.
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30
+)
+
+// RandomTOTPSecret returns a new random TOTP secret of 160 bits encoded via base32.StdEncoding.
+func RandomTOTPSecret() string {
+	rnd := make([]byte, 20)
+
+	_, err := rand.Read(rnd)
+	if err != nil {
+		panic(err)
+	}
+
+	return base32.StdEncoding.EncodeToString(rnd)
+}
+
+// TOTPCounter returns the time step of a one-time password for the given point in time.
+func TOTPCounter(t time.Time) int64 {
+	return t.Unix() / TOTPPeriod
+}
+
+// TOTPCode computes the one-time password for a base32 encoded secret and a time step.
+func TOTPCode(secret string, counter int64) (string, error) {
+	key, err := base32.StdEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(counter), TOTPDigits), nil
+}
+
+// VerifyTOTP checks a one-time password against the codes of the current time step and the
+// adjacent steps in order to tolerate a small clock drift. Returns the matching time step and
+// true if the code is valid.
+func VerifyTOTP(secret, code string, t time.Time) (int64, bool) {
+	now := TOTPCounter(t)
+	for _, counter := range []int64{now, now - 1, now + 1} {
+		expected, err := TOTPCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPURI returns the otpauth URI for a secret which can be used to enroll the
+// secret in an authenticator app.
+func TOTPURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", strings.Trim(secret, "="))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprintf("%d", TOTPDigits))
+	query.Set("period", fmt.Sprintf("%d", TOTPPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+// hotp computes a HMAC-based one-time password as defined by RFC 4226.
+func hotp(key []byte, counter uint64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package util
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHOTP(t *testing.T) {
+	// test vectors from RFC 6238 appendix B (SHA1)
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		time int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		code := hotp(key, uint64(TOTPCounter(time.Unix(v.time, 0))), 8)
+		if code != v.code {
+			t.Errorf("Code '%s' expected at %d but was '%s'", v.code, v.time, code)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := RandomTOTPSecret()
+	if _, err := base32.StdEncoding.DecodeString(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, err := TOTPCode(secret, TOTPCounter(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != TOTPDigits {
+		t.Errorf("Code '%s' expected to have %d digits", code, TOTPDigits)
+	}
+
+	counter, ok := VerifyTOTP(secret, code, now)
+	if !ok || counter != TOTPCounter(now) {
+		t.Error("Current code expected to be valid")
+	}
+	if _, ok := VerifyTOTP(secret, code, now.Add(TOTPPeriod*time.Second)); !ok {
+		t.Error("Code of the previous time step expected to be valid")
+	}
+	if _, ok := VerifyTOTP(secret, code, now.Add(3*TOTPPeriod*time.Second)); ok {
+		t.Error("Code of an old time step expected to be invalid")
+	}
+	if _, ok := VerifyTOTP(secret, "", now); ok {
+		t.Error("Empty code expected to be invalid")
+	}
+	if _, ok := VerifyTOTP("not base32!", code, now); ok {
+		t.Error("Invalid secret should not verify any code")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("GIN", "alice", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/GIN:alice?") {
+		t.Errorf("Unexpected URI '%s'", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=GIN") {
+		t.Errorf("URI '%s' expected to contain secret and issuer", uri)
+	}
+}
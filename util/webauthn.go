@@ -0,0 +1,215 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Flags of the WebAuthn authenticator data
+const (
+	WebAuthnUserPresent  = 0x01
+	WebAuthnUserVerified = 0x04
+	webAuthnAttested     = 0x40
+	webAuthnExtensions   = 0x80
+)
+
+// COSE algorithm identifiers of the supported credential public keys
+const (
+	COSEAlgES256 = -7
+	COSEAlgRS256 = -257
+)
+
+// WebAuthnAuthData contains the parsed authenticator data of a WebAuthn registration or
+// assertion (W3C Web Authentication, section 6.1). CredentialID and PublicKey are only
+// present in authenticator data with attested credential data. PublicKey is the COSE_Key
+// encoded credential public key.
+type WebAuthnAuthData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// ParseWebAuthnClientData checks the collected client data of a WebAuthn ceremony and returns
+// the base64url encoded challenge, which has to be compared to the challenge issued by the server.
+// The type must be "webauthn.create" or "webauthn.get" and the origin must match exactly.
+func ParseWebAuthnClientData(clientDataJSON []byte, typ, origin string) (string, error) {
+	clientData := &struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}{}
+	err := json.Unmarshal(clientDataJSON, clientData)
+	if err != nil {
+		return "", errors.New("Unable to parse client data")
+	}
+
+	if clientData.Type != typ {
+		return "", fmt.Errorf("Client data of type '%s' expected", typ)
+	}
+	if clientData.Origin != origin {
+		return "", fmt.Errorf("Origin '%s' does not match", clientData.Origin)
+	}
+	if clientData.Challenge == "" {
+		return "", errors.New("Challenge is missing")
+	}
+
+	return clientData.Challenge, nil
+}
+
+// ParseWebAuthnAttestation decodes a CBOR attestation object and returns the contained
+// authenticator data. Attestation statements are not verified since the server does not
+// request attestation (conveyance preference "none"), therefore the format is ignored.
+func ParseWebAuthnAttestation(attestationObject []byte) ([]byte, error) {
+	decoded, _, err := DecodeCBOR(attestationObject)
+	if err != nil {
+		return nil, err
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("Attestation object is not a map")
+	}
+	if _, ok := attestation["fmt"].(string); !ok {
+		return nil, errors.New("Attestation format is missing")
+	}
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("Authenticator data is missing")
+	}
+
+	return authData, nil
+}
+
+// ParseWebAuthnAuthData parses the binary authenticator data. The RP ID hash is compared to the
+// SHA-256 hash of rpID.
+func ParseWebAuthnAuthData(raw []byte, rpID string) (*WebAuthnAuthData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("Authenticator data is too short")
+	}
+
+	authData := &WebAuthnAuthData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	if subtle.ConstantTimeCompare(authData.RPIDHash, rpIDHash[:]) != 1 {
+		return nil, errors.New("RP ID hash does not match")
+	}
+
+	rest := raw[37:]
+	if authData.Flags&webAuthnAttested != 0 {
+		if len(rest) < 18 {
+			return nil, errors.New("Attested credential data is too short")
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, errors.New("Attested credential data is too short")
+		}
+		authData.CredentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, keyRest, err := DecodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		authData.PublicKey = rest[:len(rest)-len(keyRest)]
+		rest = keyRest
+	}
+	if authData.Flags&webAuthnExtensions != 0 {
+		var err error
+		_, rest, err = DecodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("Unexpected trailing authenticator data")
+	}
+
+	return authData, nil
+}
+
+// ParseCOSEKey decodes a COSE_Key (RFC 8152) encoded public key and returns the key together
+// with its algorithm. Supported are ES256 keys on the P-256 curve and RS256 keys.
+func ParseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	decoded, _, err := DecodeCBOR(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errors.New("COSE key is not a map")
+	}
+
+	alg, _ := key[int64(3)].(int64)
+	switch alg {
+	case COSEAlgES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, okX := key[int64(-2)].([]byte)
+		y, okY := key[int64(-3)].([]byte)
+		if key[int64(1)] != int64(2) || crv != 1 || !okX || !okY {
+			return nil, 0, errors.New("Invalid ES256 key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, errors.New("Invalid ES256 key")
+		}
+		return pub, alg, nil
+	case COSEAlgRS256:
+		n, okN := key[int64(-1)].([]byte)
+		e, okE := key[int64(-2)].([]byte)
+		if key[int64(1)] != int64(3) || !okN || !okE || len(n) < 256 || len(e) > 4 {
+			return nil, 0, errors.New("Invalid RS256 key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, alg, nil
+	}
+
+	return nil, 0, fmt.Errorf("Unsupported COSE algorithm %d", alg)
+}
+
+// VerifyWebAuthnSignature verifies the signature of a WebAuthn assertion, which is computed over
+// the authenticator data and the SHA-256 hash of the client data. The public key is COSE encoded.
+func VerifyWebAuthnSignature(publicKey, authData, clientDataJSON, sig []byte) error {
+	key, alg, err := ParseCOSEKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	switch alg {
+	case COSEAlgES256:
+		if !ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], sig) {
+			return errors.New("Invalid signature")
+		}
+	case COSEAlgRS256:
+		err = rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], sig)
+		if err != nil {
+			return errors.New("Invalid signature")
+		}
+	}
+
+	return nil
+}
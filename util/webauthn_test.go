@@ -0,0 +1,99 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:8081"
+)
+
+func TestWebAuthnRegistration(t *testing.T) {
+	auth := NewSoftAuthenticator()
+	clientData, attestation := auth.Create(testRPID, testOrigin, "challenge")
+
+	challenge, err := ParseWebAuthnClientData(clientData, "webauthn.create", testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge != "challenge" {
+		t.Errorf("Challenge 'challenge' expected but was '%s'", challenge)
+	}
+	if _, err = ParseWebAuthnClientData(clientData, "webauthn.get", testOrigin); err == nil {
+		t.Error("Error expected for wrong type")
+	}
+	if _, err = ParseWebAuthnClientData(clientData, "webauthn.create", "https://example.com"); err == nil {
+		t.Error("Error expected for wrong origin")
+	}
+
+	raw, err := ParseWebAuthnAttestation(attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authData, err := ParseWebAuthnAuthData(raw, testRPID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(authData.CredentialID, auth.CredentialID) {
+		t.Error("Credential ID does not match")
+	}
+	if authData.Flags&WebAuthnUserPresent == 0 {
+		t.Error("User presence flag expected")
+	}
+	if _, alg, err := ParseCOSEKey(authData.PublicKey); err != nil || alg != COSEAlgES256 {
+		t.Errorf("ES256 key expected: %v", err)
+	}
+
+	if _, err = ParseWebAuthnAuthData(raw, "example.com"); err == nil {
+		t.Error("Error expected for wrong RP ID")
+	}
+	if _, err = ParseWebAuthnAuthData(raw[:len(raw)-1], testRPID); err == nil {
+		t.Error("Error expected for truncated data")
+	}
+}
+
+func TestVerifyWebAuthnSignature(t *testing.T) {
+	auth := NewSoftAuthenticator()
+	_, attestation := auth.Create(testRPID, testOrigin, "challenge")
+	raw, _ := ParseWebAuthnAttestation(attestation)
+	registered, _ := ParseWebAuthnAuthData(raw, testRPID)
+
+	clientData, rawAuthData, sig := auth.Get(testRPID, testOrigin, "other")
+	authData, err := ParseWebAuthnAuthData(rawAuthData, testRPID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authData.SignCount != 1 {
+		t.Errorf("Sign count 1 expected but was %d", authData.SignCount)
+	}
+
+	err = VerifyWebAuthnSignature(registered.PublicKey, rawAuthData, clientData, sig)
+	if err != nil {
+		t.Error(err)
+	}
+
+	other := NewSoftAuthenticator()
+	_, attestation = other.Create(testRPID, testOrigin, "challenge")
+	raw, _ = ParseWebAuthnAttestation(attestation)
+	otherKey, _ := ParseWebAuthnAuthData(raw, testRPID)
+	err = VerifyWebAuthnSignature(otherKey.PublicKey, rawAuthData, clientData, sig)
+	if err == nil {
+		t.Error("Signature should not match the key of another authenticator")
+	}
+
+	clientData[len(clientData)-2] ^= 1
+	err = VerifyWebAuthnSignature(registered.PublicKey, rawAuthData, clientData, sig)
+	if err == nil {
+		t.Error("Signature should not match modified client data")
+	}
+}
@@ -13,7 +13,6 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/G-Node/gin-auth/conf"
 	"github.com/G-Node/gin-auth/data"
 	"github.com/G-Node/gin-auth/util"
 	"github.com/gorilla/mux"
@@ -86,7 +85,8 @@ func GetAccount(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateAccount is a handler which updated all updatable fields of an account (Title, FirstName,
-// MiddleName and LastName) and returns the updated account as JSON
+// MiddleName and LastName) and returns the updated account as JSON. Accounts can be updated by
+// their owner with the scope 'account-write' or by admins with the scope 'account-admin'.
 func UpdateAccount(w http.ResponseWriter, r *http.Request) {
 	login := mux.Vars(r)["login"]
 	oauth, ok := OAuthToken(r)
@@ -100,7 +100,9 @@ func UpdateAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if oauth.Token.AccountUUID.String != account.UUID || !oauth.Match.Contains("account-write") && !oauth.Match.Contains("account-admin") {
+	isOwner := oauth.Token.AccountUUID.String == account.UUID && oauth.Match.Contains("account-write")
+	isAdmin := oauth.Match.Contains("account-admin")
+	if !isOwner && !isAdmin {
 		PrintErrorJSON(w, r, "Access to requested account forbidden", http.StatusUnauthorized)
 		return
 	}
@@ -119,6 +121,9 @@ func UpdateAccount(w http.ResponseWriter, r *http.Request) {
 		PrintErrorJSON(w, r, "Error while processing account", http.StatusBadRequest)
 		return
 	}
+	if !isOwner {
+		recordTokenAudit(r, data.AuditAdmin, account.UUID, "update account")
+	}
 
 	w.Header().Add("Cache-Control", "no-cache")
 	w.Header().Add("Content-Type", "application/json")
@@ -130,7 +135,8 @@ func UpdateAccount(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateAccountPassword is a handler which parses the old and new password from the request body and
-// updates the accounts password. Returns StatusOK and an empty body on success.
+// updates the accounts password. All other sessions of the account are terminated.
+// Returns StatusOK and an empty body on success.
 func UpdateAccountPassword(w http.ResponseWriter, r *http.Request) {
 	login := mux.Vars(r)["login"]
 	oauth, ok := OAuthToken(r)
@@ -186,10 +192,18 @@ func UpdateAccountPassword(w http.ResponseWriter, r *http.Request) {
 		PrintErrorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
+
+	err = data.DeleteSessionsForAccount(account.UUID, sessionToken(r))
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditPasswordChange, account.UUID, "")
 }
 
-// UpdateAccountEmail parses an e-mail address and the account password
-// from a JSON request body and updates the e-mail address of the authorized account.
+// UpdateAccountEmail parses an e-mail address and the account password from a JSON request body
+// and requests a change of the e-mail address of the authorized account. The address is only changed
+// once it was confirmed with the link sent to the new address, the previous address receives a notice
+// with a link to undo the change.
 func UpdateAccountEmail(w http.ResponseWriter, r *http.Request) {
 
 	login := mux.Vars(r)["login"]
@@ -225,26 +239,14 @@ func UpdateAccountEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := acc.UpdateEmail(cred.Email)
+	change, err := acc.CreateEmailChange(cred.Email)
 	if err != nil {
 		PrintErrorJSON(w, r, err, http.StatusBadRequest)
 		return
 	}
+	recordTokenAudit(r, data.AuditEmailChange, acc.UUID, "requested change to "+cred.Email)
 
-	tmplFields := &struct {
-		From    string
-		To      string
-		Subject string
-		Body    string
-	}{}
-	tmplFields.From = conf.GetSmtpCredentials().From
-	tmplFields.To = cred.Email
-	tmplFields.Subject = "GIN account confirmation"
-	tmplFields.Body = "The e-mail address of your GIN account has been successfully changed."
-
-	content := util.MakeEmailTemplate("emailplain.txt", tmplFields)
-	email := &data.Email{}
-	err = email.Create(util.NewStringSet(cred.Email), content.Bytes())
+	err = sendEmailChangeEmails(acc, change)
 	if err != nil {
 		msg := "An error occurred trying to create change e-mail address confirmation."
 		PrintErrorJSON(w, r, msg, http.StatusInternalServerError)
@@ -357,6 +359,7 @@ func CreateKey(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic(err)
 	}
+	recordTokenAudit(r, data.AuditKeyAdd, account.UUID, "SHA256:"+key.Fingerprint)
 
 	w.Header().Add("Cache-Control", "no-cache")
 	w.Header().Add("Content-Type", "application/json")
@@ -399,6 +402,7 @@ func DeleteKey(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic(err)
 	}
+	recordTokenAudit(r, data.AuditKeyDelete, key.AccountUUID, "SHA256:"+key.Fingerprint)
 
 	// account is only needed for the output (maybe this can be avoided)
 	account, _ := data.GetAccount(key.AccountUUID)
@@ -411,3 +415,27 @@ func DeleteKey(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 }
+
+// ownAccount returns the account addressed by the request, if the OAuth token of the
+// request belongs to this account and grants the requested scope. Otherwise an error is written
+// to the response.
+func ownAccount(w http.ResponseWriter, r *http.Request, scope string) (*data.Account, bool) {
+	login := mux.Vars(r)["login"]
+	oauth, ok := OAuthToken(r)
+	if !ok {
+		panic("Request was authorized but no OAuth token is available!") // this should never happen
+	}
+
+	account, ok := data.GetAccountByLogin(login)
+	if !ok {
+		PrintErrorJSON(w, r, "The requested account does not exist", http.StatusNotFound)
+		return nil, false
+	}
+
+	if oauth.Token.AccountUUID.String != account.UUID || !oauth.Match.Contains(scope) {
+		PrintErrorJSON(w, r, "Access to requested account forbidden", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return account, true
+}
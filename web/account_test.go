@@ -193,6 +193,16 @@ func TestUpdateAccount(t *testing.T) {
 		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
 	}
 
+	// admin of another account
+	request, _ = http.NewRequest("PUT", "/api/accounts/alice", mkBody())
+	request.Header.Set("Authorization", "Bearer "+accessTokenAliceAdmin)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+
 	// all ok (own account)
 	request, _ = http.NewRequest("PUT", "/api/accounts/alice", mkBody())
 	request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
@@ -217,6 +227,36 @@ func TestUpdateAccount(t *testing.T) {
 	if acc.Account.LastName != "Bonenfant" {
 		t.Error("Account FirstName expected to be 'Alix'")
 	}
+	if acc.Account.Language != "en" {
+		t.Errorf("Account Language expected to be 'en' but was '%s'", acc.Account.Language)
+	}
+
+	// language
+	mkLanguageBody := func(lang string) io.Reader {
+		acc := &data.Account{Login: "alice", FirstName: "Alix", LastName: "Bonenfant", Language: lang}
+		b, _ := json.Marshal(&data.AccountMarshaler{WithMail: true, Account: acc})
+		return bytes.NewReader(b)
+	}
+	request, _ = http.NewRequest("PUT", "/api/accounts/alice", mkLanguageBody("../de"))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	request, _ = http.NewRequest("PUT", "/api/accounts/alice", mkLanguageBody("de"))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if check, ok := data.GetAccount(uuidAlice); !ok || check.Language != "de" {
+		t.Error("Account Language expected to be 'de'")
+	}
 }
 
 func TestUpdateAccountPassword(t *testing.T) {
@@ -293,6 +333,7 @@ func TestUpdateAccountPassword(t *testing.T) {
 	// all ok
 	request, _ = http.NewRequest("PUT", "/api/accounts/alice/password", mkBody("testtest", "TestTest", "TestTest"))
 	request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+	request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
 	response = httptest.NewRecorder()
 	handler.ServeHTTP(response, request)
 
@@ -304,6 +345,14 @@ func TestUpdateAccountPassword(t *testing.T) {
 	if !acc.VerifyPassword("TestTest") {
 		t.Error("Unable to verify password")
 	}
+
+	// other sessions are terminated
+	if _, ok := data.GetSession("DNM5RS3C"); !ok {
+		t.Error("Current session should still exist")
+	}
+	if _, ok := data.GetSession("Q7WZ3MHB"); ok {
+		t.Error("Other sessions should be removed")
+	}
 }
 
 func TestUpdateAccountEmail(t *testing.T) {
@@ -401,8 +450,17 @@ func TestUpdateAccountEmail(t *testing.T) {
 		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
 	}
 	emails, _ = data.GetQueuedEmails()
-	if len(emails) <= num {
-		t.Errorf("Expected e-mail queue to contain '%d' entries but had '%d'", num, len(emails))
+	if len(emails) != num+2 {
+		t.Errorf("Expected e-mail queue to contain '%d' entries but had '%d'", num+2, len(emails))
+	}
+
+	// the address is only changed after the confirmation
+	acc, ok := data.GetAccountByLogin("alice")
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+	if acc.Email == "testemail@example.com" {
+		t.Error("E-mail address should not be changed before the confirmation")
 	}
 }
 
@@ -0,0 +1,168 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/G-Node/gin-auth/data"
+	"github.com/gorilla/mux"
+)
+
+// adminAccount returns the account with the login from the request path. In contrast to other
+// account handlers, admins may access disabled and not yet activated accounts.
+func adminAccount(w http.ResponseWriter, r *http.Request) (*data.Account, bool) {
+	account, ok := data.GetAnyAccountByLogin(mux.Vars(r)["login"])
+	if !ok {
+		PrintErrorJSON(w, r, "The requested account does not exist", http.StatusNotFound)
+		return nil, false
+	}
+	return account, true
+}
+
+// DisableAccount disables an account, terminates all its sessions and revokes all its tokens.
+// Requires the scope 'account-admin'. Returns StatusOK and an empty body on success.
+func DisableAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := adminAccount(w, r)
+	if !ok {
+		return
+	}
+
+	err := account.SetDisabled(true)
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditAdmin, account.UUID, "disable account")
+}
+
+// EnableAccount enables a disabled account. Requires the scope 'account-admin'.
+// Returns StatusOK and an empty body on success.
+func EnableAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := adminAccount(w, r)
+	if !ok {
+		return
+	}
+
+	err := account.SetDisabled(false)
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditAdmin, account.UUID, "enable account")
+}
+
+// ForcePasswordReset invalidates the password of an account and sends a password reset code to
+// the user by e-mail. Requires the scope 'account-admin'. Returns StatusOK and an empty body on success.
+func ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	account, ok := adminAccount(w, r)
+	if !ok {
+		return
+	}
+	if account.IsDisabled {
+		PrintErrorJSON(w, r, "The requested account is disabled", http.StatusConflict)
+		return
+	}
+
+	reset, err := account.ForcePasswordReset()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditAdmin, account.UUID, "force password reset")
+
+	err = sendResetEmail(account, reset)
+	if err != nil {
+		PrintErrorJSON(w, r, "An error occurred trying to send password reset e-mail", http.StatusInternalServerError)
+		return
+	}
+}
+
+// ResendActivation creates a new activation code for an account which was not yet activated
+// and sends it to the user by e-mail. Requires the scope 'account-admin'.
+// Returns StatusOK and an empty body on success.
+func ResendActivation(w http.ResponseWriter, r *http.Request) {
+	account, ok := adminAccount(w, r)
+	if !ok {
+		return
+	}
+	if account.IsDisabled {
+		PrintErrorJSON(w, r, "The requested account is disabled", http.StatusConflict)
+		return
+	}
+
+	err := account.RenewActivationCode()
+	if err != nil {
+		PrintErrorJSON(w, r, err, http.StatusConflict)
+		return
+	}
+	recordTokenAudit(r, data.AuditAdmin, account.UUID, "resend activation")
+
+	err = sendActivationEmail(account)
+	if err != nil {
+		PrintErrorJSON(w, r, "An error occurred trying to send activation e-mail", http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateAccountLogin parses a new login from a JSON request body and changes the login of
+// an account. Requires the scope 'account-admin'. Returns the updated account as JSON.
+func UpdateAccountLogin(w http.ResponseWriter, r *http.Request) {
+	account, ok := adminAccount(w, r)
+	if !ok {
+		return
+	}
+
+	body := &struct {
+		Login string `json:"login"`
+	}{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(body)
+	if err != nil {
+		PrintErrorJSON(w, r, "Error while processing request body", http.StatusBadRequest)
+		return
+	}
+
+	previous := account.Login
+	err = account.UpdateLogin(body.Login)
+	if err != nil {
+		PrintErrorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+	recordTokenAudit(r, data.AuditAdmin, account.UUID, "change login "+previous+" to "+account.Login)
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(&data.AccountMarshaler{WithMail: true, WithAffiliation: true, Account: account})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// DeleteAccount removes an account together with its keys, tokens, sessions and approvals.
+// Requires the scope 'account-admin'. Returns the deleted account as JSON.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := adminAccount(w, r)
+	if !ok {
+		return
+	}
+
+	err := account.Delete()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditAdmin, account.UUID, "delete account "+account.Login)
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(&data.AccountMarshaler{WithMail: true, WithAffiliation: true, Account: account})
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/data"
+)
+
+func TestAccountAdminAPI(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(method, uri, token, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, uri, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	// admin scope required
+	for _, uri := range []string{"/api/accounts/alice/disable", "/api/accounts/alice/enable",
+		"/api/accounts/alice/password_reset", "/api/accounts/alice/activation"} {
+		response := mkRequest("POST", uri, accessTokenAlice, "")
+		if response.Code != http.StatusUnauthorized {
+			t.Errorf("Response code '%d' expected for '%s' but was '%d'", http.StatusUnauthorized, uri, response.Code)
+		}
+	}
+
+	// unknown account
+	response := mkRequest("POST", "/api/accounts/doesnotexist/disable", accessTokenAliceAdmin, "")
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+
+	// disable and enable
+	response = mkRequest("POST", "/api/accounts/alice/disable", accessTokenAliceAdmin, "")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetAccountDisabled(uuidAlice); !ok {
+		t.Error("Account expected to be disabled")
+	}
+	if _, ok := data.GetAccessToken(accessTokenAlice); ok {
+		t.Error("Access tokens of a disabled account should be revoked")
+	}
+	response = mkRequest("POST", "/api/accounts/alice/enable", accessTokenAliceAdmin, "")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetAccount(uuidAlice); !ok {
+		t.Error("Account expected to be active")
+	}
+
+	// resend activation
+	response = mkRequest("POST", "/api/accounts/alice/activation", accessTokenAliceAdmin, "")
+	if response.Code != http.StatusConflict {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusConflict, response.Code)
+	}
+	response = mkRequest("POST", "/api/accounts/inact_log1/activation", accessTokenAliceAdmin, "")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetAccountByActivationCode("ac_a"); ok {
+		t.Error("Old activation code should be invalid")
+	}
+
+	// force password reset
+	response = mkRequest("POST", "/api/accounts/alice/password_reset", accessTokenAliceAdmin, "")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetAccountByLogin("alice"); ok {
+		t.Error("Account should be inactive until the password was reset")
+	}
+}
+
+func TestUpdateAccountLogin(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(token, login string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(&struct {
+			Login string `json:"login"`
+		}{login})
+		request, _ := http.NewRequest("PUT", "/api/accounts/alice/login", bytes.NewReader(b))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	response := mkRequest(accessTokenAlice, "alix")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	response = mkRequest(accessTokenAliceAdmin, "bob")
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// malformed body
+	request, _ := http.NewRequest("PUT", "/api/accounts/alice/login", strings.NewReader(`{"login": `))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAliceAdmin)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	response = mkRequest(accessTokenAliceAdmin, "alix")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	acc := &data.AccountMarshaler{}
+	_ = json.NewDecoder(response.Body).Decode(acc)
+	if acc.Account.Login != "alix" {
+		t.Errorf("Login 'alix' expected but was '%s'", acc.Account.Login)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	request, _ := http.NewRequest("DELETE", "/api/accounts/alice", strings.NewReader(""))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	request, _ = http.NewRequest("DELETE", "/api/accounts/alice", strings.NewReader(""))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAliceAdmin)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetAnyAccountByLogin("alice"); ok {
+		t.Error("Account should be removed")
+	}
+	if _, ok := data.GetAccessToken(accessTokenAlice); ok {
+		t.Error("Access tokens should be removed")
+	}
+}
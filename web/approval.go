@@ -0,0 +1,152 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+	"github.com/gorilla/mux"
+)
+
+// ListAccountApprovals returns all clients an account has approved together with the approved
+// scopes as JSON.
+func ListAccountApprovals(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-read")
+	if !ok {
+		return
+	}
+
+	approvals := data.ListClientApprovalsForAccount(account.UUID)
+	marshal := make([]data.ClientApprovalMarshaler, 0, len(approvals))
+	for i := 0; i < len(approvals); i++ {
+		client, ok := data.GetClient(approvals[i].ClientUUID)
+		if !ok {
+			continue
+		}
+		marshal = append(marshal, data.ClientApprovalMarshaler{Approval: &approvals[i], Client: client, Account: account})
+	}
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(marshal)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RevokeAccountApproval revokes the access of a client to an account. The approval is removed
+// together with all tokens the client holds for the account. Returns the removed approval as JSON.
+func RevokeAccountApproval(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-write")
+	if !ok {
+		return
+	}
+
+	approval, ok := data.GetClientApproval(mux.Vars(r)["uuid"])
+	if !ok || approval.AccountUUID != account.UUID {
+		PrintErrorJSON(w, r, "The requested approval does not exist", http.StatusNotFound)
+		return
+	}
+	client := approval.Client()
+
+	err := approval.Revoke()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditApprovalRevoke, account.UUID, "client "+client.Name)
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(&data.ClientApprovalMarshaler{Approval: approval, Client: client, Account: account})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// approvalPageData contains the values of one connected client shown on the approvals page.
+type approvalPageData struct {
+	UUID      string
+	Client    string
+	Scope     map[string]string
+	CreatedAt time.Time
+}
+
+// ApprovalsPage shows all clients connected to the account of the logged in user, such that
+// the user can revoke the access of a client.
+func ApprovalsPage(w http.ResponseWriter, r *http.Request) {
+	account, ok := sessionAccount(r)
+	if !ok {
+		PrintErrorHTML(w, r, "Please sign in to manage your connected applications", http.StatusUnauthorized)
+		return
+	}
+
+	approvals := data.ListClientApprovalsForAccount(account.UUID)
+	pageData := make([]approvalPageData, 0, len(approvals))
+	for _, approval := range approvals {
+		client, ok := data.GetClient(approval.ClientUUID)
+		if !ok {
+			continue
+		}
+		// scopes which are no longer provided by any client are shown by name
+		scope, _ := data.DescribeScope(approval.Scope)
+		for name := range approval.Scope {
+			if _, ok := scope[name]; !ok {
+				scope[name] = name + " (no longer available)"
+			}
+		}
+		pageData = append(pageData, approvalPageData{approval.UUID, client.Title(), scope, approval.CreatedAt})
+	}
+
+	tmpl := conf.MakeTemplate("approvals.html")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "text/html")
+	err := tmpl.ExecuteTemplate(w, "layout", &struct{ Approvals []approvalPageData }{pageData})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RevokeApproval revokes the access of a client to the account of the logged in user and
+// redirects back to the approvals page.
+func RevokeApproval(w http.ResponseWriter, r *http.Request) {
+	param := &struct{ UUID string }{}
+	err := util.ReadFormIntoStruct(r, param, false)
+	if err != nil {
+		PrintErrorHTML(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	account, ok := sessionAccount(r)
+	if !ok {
+		PrintErrorHTML(w, r, "Please sign in to manage your connected applications", http.StatusUnauthorized)
+		return
+	}
+
+	approval, ok := data.GetClientApproval(param.UUID)
+	if !ok || approval.AccountUUID != account.UUID {
+		PrintErrorHTML(w, r, "The requested approval does not exist", http.StatusNotFound)
+		return
+	}
+
+	err = approval.Revoke()
+	if err != nil {
+		panic(err)
+	}
+	recordAudit(r, data.AuditApprovalRevoke, account.UUID, account.UUID, approval.ClientUUID, "")
+
+	w.Header().Add("Cache-Control", "no-store")
+	http.Redirect(w, r, "/oauth/approvals_page", http.StatusFound)
+}
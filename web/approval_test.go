@@ -0,0 +1,149 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+)
+
+const (
+	approvalUUIDAliceGin = "31da7869-4593-4682-b9f2-5f47987aa5fc"
+	approvalUUIDAliceWB  = "ffde3769-cb45-43c1-8afd-4fb154ddf0b0"
+)
+
+func TestApprovalsAPI(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(method, uri string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, uri, strings.NewReader(""))
+		request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	// wrong account
+	response := mkRequest("GET", "/api/accounts/bob/approvals")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// list approvals
+	response = mkRequest("GET", "/api/accounts/alice/approvals")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	approvals := []map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&approvals)
+	if len(approvals) != 2 {
+		t.Fatalf("Two approvals expected but was %d", len(approvals))
+	}
+	if approvals[0]["client_id"] == "" || approvals[0]["scope"] == nil {
+		t.Errorf("Unexpected approval: %v", approvals[0])
+	}
+
+	// unknown approval
+	response = mkRequest("DELETE", "/api/accounts/alice/approvals/doesnotexist")
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+
+	// revoke access of wb
+	response = mkRequest("DELETE", "/api/accounts/alice/approvals/"+approvalUUIDAliceWB)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetClientApproval(approvalUUIDAliceWB); ok {
+		t.Error("Approval should be removed")
+	}
+	if _, ok := data.GetAccessToken(accessTokenAlice); !ok {
+		t.Error("Access token of another client should still exist")
+	}
+}
+
+func TestApprovalsPage(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	// no session
+	request, _ := http.NewRequest("GET", "/oauth/approvals_page", strings.NewReader(""))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// session of alice
+	request, _ = http.NewRequest("GET", "/oauth/approvals_page", strings.NewReader(""))
+	request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if !strings.Contains(response.Body.String(), approvalUUIDAliceGin) {
+		t.Error("Approval expected on the page")
+	}
+
+	// scope which is no longer provided
+	approval, ok := data.GetClientApproval(approvalUUIDAliceWB)
+	if !ok {
+		t.Fatal("Approval does not exist")
+	}
+	approval.Scope = approval.Scope.Union(util.NewStringSet("foo-read"))
+	err := approval.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, _ = http.NewRequest("GET", "/oauth/approvals_page", strings.NewReader(""))
+	request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if !strings.Contains(response.Body.String(), "foo-read (no longer available)") {
+		t.Error("Unknown scope expected to be labeled on the page")
+	}
+
+	// approval of another account
+	body := &url.Values{}
+	body.Add("uuid", approvalUUIDAliceGin)
+	request, _ = http.NewRequest("POST", "/oauth/approvals", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(&http.Cookie{Name: cookieName, Value: "4KDNO8T0"})
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+
+	// revoke access of gin
+	request, _ = http.NewRequest("POST", "/oauth/approvals", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	if _, ok := data.GetClientApproval(approvalUUIDAliceGin); ok {
+		t.Error("Approval should be removed")
+	}
+	if _, ok := data.GetAccessToken(accessTokenAlice); ok {
+		t.Error("Access token should be removed")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/G-Node/gin-auth/data"
+)
+
+// recordAudit records a security relevant event caused by a request.
+func recordAudit(r *http.Request, eventType, actorUUID, targetUUID, clientUUID, detail string) {
+	data.RecordAuditEvent(eventType, clientIP(r), actorUUID, targetUUID, clientUUID, detail)
+}
+
+// recordTokenAudit records an event caused by a request which was authorized with an OAuth token.
+// The account and client of the token are recorded as actor and client of the event.
+func recordTokenAudit(r *http.Request, eventType, targetUUID, detail string) {
+	oauth, ok := OAuthToken(r)
+	if !ok {
+		panic("Request was authorized but no OAuth token is available!") // this should never happen
+	}
+	recordAudit(r, eventType, oauth.Token.AccountUUID.String, targetUUID, oauth.Token.ClientUUID, detail)
+}
+
+// readAuditFilter reads the filter and pagination parameters of an audit event listing
+// from the query of a request.
+func readAuditFilter(r *http.Request) (*data.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := &data.AuditFilter{
+		Type:       query.Get("type"),
+		ActorUUID:  query.Get("actor_uuid"),
+		TargetUUID: query.Get("target_uuid"),
+		ClientUUID: query.Get("client_uuid"),
+	}
+
+	var err error
+	if s := query.Get("since"); s != "" {
+		filter.Since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("Parameter 'since' is not a valid RFC 3339 time")
+		}
+	}
+	if s := query.Get("until"); s != "" {
+		filter.Until, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("Parameter 'until' is not a valid RFC 3339 time")
+		}
+	}
+	if s := query.Get("limit"); s != "" {
+		filter.Limit, err = strconv.Atoi(s)
+		if err != nil || filter.Limit < 1 {
+			return nil, fmt.Errorf("Parameter 'limit' must be a positive number")
+		}
+	}
+	if s := query.Get("offset"); s != "" {
+		filter.Offset, err = strconv.Atoi(s)
+		if err != nil || filter.Offset < 0 {
+			return nil, fmt.Errorf("Parameter 'offset' must not be negative")
+		}
+	}
+
+	return filter, nil
+}
+
+// printAuditEvents writes a list of audit events as JSON.
+func printAuditEvents(w http.ResponseWriter, events []data.AuditEvent) {
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(events)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ListAuditEvents returns audit events of all accounts as JSON, latest first. The events
+// can be filtered and paginated using query parameters. Requires the scope 'account-admin'.
+func ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := readAuditFilter(r)
+	if err != nil {
+		PrintErrorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	printAuditEvents(w, data.ListAuditEvents(filter))
+}
+
+// ListAccountAuditEvents returns all audit events caused by or affecting an account as JSON,
+// latest first. Filters for actor and target are ignored.
+func ListAccountAuditEvents(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-read")
+	if !ok {
+		return
+	}
+
+	filter, err := readAuditFilter(r)
+	if err != nil {
+		PrintErrorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+	filter.ActorUUID = ""
+	filter.TargetUUID = ""
+	filter.Account = account.UUID
+
+	printAuditEvents(w, data.ListAuditEvents(filter))
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/data"
+)
+
+func TestAuditAPI(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(token, uri string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", uri, strings.NewReader(""))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	decode := func(response *httptest.ResponseRecorder) []map[string]interface{} {
+		events := []map[string]interface{}{}
+		_ = json.NewDecoder(response.Body).Decode(&events)
+		return events
+	}
+
+	// missing scope
+	response := mkRequest(accessTokenAlice, "/api/audit")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// all events
+	response = mkRequest(accessTokenAliceAdmin, "/api/audit")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if events := decode(response); len(events) != 4 {
+		t.Errorf("Exactly 4 events expected but was %d", len(events))
+	}
+
+	// filtered and paginated
+	response = mkRequest(accessTokenAliceAdmin, "/api/audit?type=login&target_uuid="+uuidAlice)
+	events := decode(response)
+	if len(events) != 1 || events[0]["type"] != data.AuditLogin {
+		t.Errorf("One login event expected but was %v", events)
+	}
+	response = mkRequest(accessTokenAliceAdmin, "/api/audit?limit=3&offset=3")
+	if events := decode(response); len(events) != 1 {
+		t.Errorf("Exactly one event expected on the second page but was %d", len(events))
+	}
+
+	// invalid parameters
+	response = mkRequest(accessTokenAliceAdmin, "/api/audit?since=yesterday")
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+	response = mkRequest(accessTokenAliceAdmin, "/api/audit?limit=-1")
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// events of another account
+	response = mkRequest(accessTokenAlice, "/api/accounts/bob/audit")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// own events, filters for other accounts are ignored
+	response = mkRequest(accessTokenAlice, "/api/accounts/alice/audit?actor_uuid=51f5ac36-d332-4889-8023-6e033fcd8e17")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if events := decode(response); len(events) != 3 {
+		t.Errorf("Exactly 3 events expected but was %d", len(events))
+	}
+}
+
+func TestAuditRecording(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	// unlocking an account is recorded as admin action
+	request, _ := http.NewRequest("DELETE", "/api/accounts/alice/lockouts", strings.NewReader(""))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAliceAdmin)
+	request.RemoteAddr = "192.0.2.9:1234"
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+
+	events := data.ListAuditEvents(&data.AuditFilter{Type: data.AuditAdmin, Limit: 1})
+	if len(events) != 1 {
+		t.Fatal("Admin event expected")
+	}
+	event := events[0]
+	if event.TargetUUID.String != uuidAlice || event.Detail != "unlock account" {
+		t.Errorf("Unexpected event '%v'", event)
+	}
+	if event.IP != "192.0.2.9" {
+		t.Errorf("IP '192.0.2.9' expected but was '%s'", event.IP)
+	}
+}
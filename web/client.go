@@ -0,0 +1,205 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+	"github.com/gorilla/mux"
+)
+
+// requestedClient returns the client addressed by the uuid in the request path. If manage is true
+// the client must be managed via the client API, since changes of clients defined in the clients
+// configuration file would be overwritten at the next start. Writes an error if this is not the case.
+func requestedClient(w http.ResponseWriter, r *http.Request, manage bool) (*data.Client, bool) {
+	client, ok := data.GetClient(mux.Vars(r)["uuid"])
+	if !ok {
+		PrintErrorJSON(w, r, "The requested client does not exist", http.StatusNotFound)
+		return nil, false
+	}
+
+	if manage && client.IsFileManaged() {
+		PrintErrorJSON(w, r, "The client is defined in the clients configuration file and can not be changed", http.StatusConflict)
+		return nil, false
+	}
+
+	return client, true
+}
+
+// writeClient writes a client as JSON. The secret is only included if it is not empty.
+func writeClient(w http.ResponseWriter, client *data.Client, secret string) {
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(&data.ClientMarshaler{Client: client, Secret: secret})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ListClients returns all registered clients as JSON.
+// Requires the scope 'client-admin'.
+func ListClients(w http.ResponseWriter, r *http.Request) {
+	clients := data.ListClients()
+
+	marshalers := make([]data.ClientMarshaler, 0, len(clients))
+	for i := range clients {
+		client, ok := data.GetClient(clients[i].UUID)
+		if ok {
+			marshalers = append(marshalers, data.ClientMarshaler{Client: client})
+		}
+	}
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(marshalers)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// GetClient returns a single client as JSON.
+// Requires the scope 'client-admin'.
+func GetClient(w http.ResponseWriter, r *http.Request) {
+	client, ok := requestedClient(w, r, false)
+	if !ok {
+		return
+	}
+
+	writeClient(w, client, "")
+}
+
+// CreateClient creates a new client managed via the client API from the JSON request body.
+// Unless the client is public, a random secret is created, which is only returned by this
+// request. Requires the scope 'client-admin'.
+func CreateClient(w http.ResponseWriter, r *http.Request) {
+	body := json.RawMessage{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(&body)
+	if err != nil {
+		PrintErrorJSON(w, r, "Error while processing client", http.StatusBadRequest)
+		return
+	}
+
+	client := &data.Client{}
+	public := &struct {
+		Public bool `json:"public"`
+	}{}
+	err = json.Unmarshal(body, client)
+	if err == nil {
+		err = json.Unmarshal(body, public)
+	}
+	if err != nil {
+		PrintErrorJSON(w, r, "Error while processing client", http.StatusBadRequest)
+		return
+	}
+
+	valErr := client.Validate()
+	if len(valErr.FieldErrors) > 0 {
+		PrintErrorJSON(w, r, valErr, http.StatusBadRequest)
+		return
+	}
+
+	var secret string
+	if !public.Public {
+		secret = util.RandomToken()
+		client.Secret = secret
+	}
+
+	err = client.Create()
+	if err != nil {
+		panic(err)
+	}
+
+	client, ok := data.GetClient(client.UUID)
+	if !ok {
+		panic("Client was created but does not exist!") // this should never happen
+	}
+	recordTokenAudit(r, data.AuditAdmin, "", "create client "+client.UUID)
+
+	writeClient(w, client, secret)
+}
+
+// UpdateClient replaces all updatable fields of a client managed via the client API with
+// the fields of the JSON request body. Requires the scope 'client-admin'.
+func UpdateClient(w http.ResponseWriter, r *http.Request) {
+	client, ok := requestedClient(w, r, true)
+	if !ok {
+		return
+	}
+
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(client)
+	if err != nil {
+		PrintErrorJSON(w, r, "Error while processing client", http.StatusBadRequest)
+		return
+	}
+
+	valErr := client.Validate()
+	if len(valErr.FieldErrors) > 0 {
+		PrintErrorJSON(w, r, valErr, http.StatusBadRequest)
+		return
+	}
+
+	err = client.Update()
+	if err != nil {
+		panic(err)
+	}
+
+	client, ok = data.GetClient(client.UUID)
+	if !ok {
+		panic("Client was updated but does not exist!") // this should never happen
+	}
+	recordTokenAudit(r, data.AuditAdmin, "", "update client "+client.UUID)
+
+	writeClient(w, client, "")
+}
+
+// RotateClientSecret replaces the secret of a confidential client managed via the client API
+// and returns the client together with the new secret. Requires the scope 'client-admin'.
+func RotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	client, ok := requestedClient(w, r, true)
+	if !ok {
+		return
+	}
+
+	if client.IsPublic() {
+		PrintErrorJSON(w, r, "Public clients have no secret", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := client.RotateSecret()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditAdmin, "", "rotate secret of client "+client.UUID)
+
+	writeClient(w, client, secret)
+}
+
+// DeleteClient removes a client managed via the client API together with all its approvals
+// and tokens. Returns the deleted client as JSON. Requires the scope 'client-admin'.
+func DeleteClient(w http.ResponseWriter, r *http.Request) {
+	client, ok := requestedClient(w, r, true)
+	if !ok {
+		return
+	}
+
+	err := client.Delete()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditAdmin, "", "delete client "+client.UUID)
+
+	writeClient(w, client, "")
+}
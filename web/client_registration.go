@@ -0,0 +1,211 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+	"github.com/gorilla/mux"
+)
+
+// registrationResponse contains the information about a registered client as defined by RFC 7591
+// and RFC 7592. The secret and registration access token are only present after registration.
+type registrationResponse struct {
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+	*data.ClientMetadata
+}
+
+// writeRegistration writes the registration of a client as JSON.
+func writeRegistration(w http.ResponseWriter, client *data.Client, meta *data.ClientMetadata, secret, token string, status int) {
+	response := &registrationResponse{
+		ClientID:                client.Name,
+		ClientSecret:            secret,
+		ClientIDIssuedAt:        client.CreatedAt.Unix(),
+		RegistrationAccessToken: token,
+		RegistrationClientURI:   conf.MakeUrl("/oauth/register/%s", client.Name),
+		ClientMetadata:          meta,
+	}
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	err := enc.Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// bearerToken returns the bearer token from the authorization header of a request.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// registrationAllowed checks whether a registration request presents a valid initial access token or
+// only uses redirect URIs on allowed hosts. Writes an error response if this is not the case.
+func registrationAllowed(w http.ResponseWriter, r *http.Request, meta *data.ClientMetadata) bool {
+	config := conf.GetRegistrationConfig()
+
+	if token, ok := bearerToken(r); ok {
+		for _, t := range config.InitialAccessTokens {
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				return true
+			}
+		}
+		printOAuthError(w, "invalid_token", "Invalid initial access token", http.StatusUnauthorized)
+		return false
+	}
+
+	hosts := util.NewStringSet(config.AllowedHosts...)
+	allowed := len(meta.RedirectURIs) > 0
+	for _, uri := range meta.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !hosts.Contains(u.Hostname()) {
+			allowed = false
+		}
+	}
+	if !allowed {
+		printOAuthError(w, "invalid_token", "An initial access token is required", http.StatusUnauthorized)
+	}
+	return allowed
+}
+
+// registeredClient returns the client addressed by the client id in the request path, if the
+// request presents its registration access token. Writes an error response otherwise.
+func registeredClient(w http.ResponseWriter, r *http.Request) (*data.Client, bool) {
+	if !conf.GetRegistrationConfig().Enabled {
+		PrintErrorJSON(w, r, "Client registration is disabled", http.StatusNotFound)
+		return nil, false
+	}
+
+	token, ok := bearerToken(r)
+	if !ok {
+		printOAuthError(w, "invalid_token", "A registration access token is required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	client, ok := data.GetRegisteredClient(mux.Vars(r)["client_id"], token)
+	if !ok {
+		printOAuthError(w, "invalid_token", "Invalid registration access token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return client, true
+}
+
+// RegisterClient registers a new client from the JSON metadata in the request body (RFC 7591).
+// If the client is not public the response contains the client secret. The registration access
+// token in the response allows the client to read, update or delete its registration.
+func RegisterClient(w http.ResponseWriter, r *http.Request) {
+	if !conf.GetRegistrationConfig().Enabled {
+		PrintErrorJSON(w, r, "Client registration is disabled", http.StatusNotFound)
+		return
+	}
+
+	meta := &data.ClientMetadata{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(meta)
+	if err != nil {
+		printOAuthError(w, data.RegistrationInvalidMetadata, "Unable to parse client metadata", http.StatusBadRequest)
+		return
+	}
+
+	if !registrationAllowed(w, r, meta) {
+		return
+	}
+
+	client, secret, token, err := data.RegisterClient(meta)
+	if err != nil {
+		if regErr, ok := err.(*data.RegistrationError); ok {
+			printOAuthError(w, regErr.Code, regErr.Description, http.StatusBadRequest)
+			return
+		}
+		panic(err)
+	}
+
+	writeRegistration(w, client, meta, secret, token, http.StatusCreated)
+}
+
+// GetClientRegistration returns the registered metadata of a client (RFC 7592).
+func GetClientRegistration(w http.ResponseWriter, r *http.Request) {
+	client, ok := registeredClient(w, r)
+	if !ok {
+		return
+	}
+
+	writeRegistration(w, client, client.Metadata(), "", "", http.StatusOK)
+}
+
+// UpdateClientRegistration replaces the registered metadata of a client with the JSON
+// metadata in the request body (RFC 7592).
+func UpdateClientRegistration(w http.ResponseWriter, r *http.Request) {
+	client, ok := registeredClient(w, r)
+	if !ok {
+		return
+	}
+
+	meta := &struct {
+		ClientID string `json:"client_id"`
+		*data.ClientMetadata
+	}{ClientMetadata: &data.ClientMetadata{}}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(meta)
+	if err != nil {
+		printOAuthError(w, data.RegistrationInvalidMetadata, "Unable to parse client metadata", http.StatusBadRequest)
+		return
+	}
+	if meta.ClientID != client.Name {
+		printOAuthError(w, data.RegistrationInvalidMetadata, "The client id does not match", http.StatusBadRequest)
+		return
+	}
+
+	err = client.UpdateRegistration(meta.ClientMetadata)
+	if err != nil {
+		if regErr, ok := err.(*data.RegistrationError); ok {
+			printOAuthError(w, regErr.Code, regErr.Description, http.StatusBadRequest)
+			return
+		}
+		panic(err)
+	}
+
+	writeRegistration(w, client, meta.ClientMetadata, "", "", http.StatusOK)
+}
+
+// DeleteClientRegistration removes a registered client together with all its tokens (RFC 7592).
+// Returns StatusNoContent on success.
+func DeleteClientRegistration(w http.ResponseWriter, r *http.Request) {
+	client, ok := registeredClient(w, r)
+	if !ok {
+		return
+	}
+
+	err := client.Delete()
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+)
+
+func TestClientRegistration(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	config := conf.GetRegistrationConfig()
+	previous := *config
+	defer func() { *config = previous }()
+
+	mkRequest := func(method, path, token, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	const metadata = `{
+		"client_name": "analysis tool",
+		"redirect_uris": ["https://tool.example.com/callback"],
+		"grant_types": ["authorization_code", "refresh_token"],
+		"scope": "repo-read"
+	}`
+
+	// disabled by default
+	response := mkRequest("POST", "/oauth/register", "", metadata)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+
+	config.Enabled = true
+	config.InitialAccessTokens = []string{"initial-token"}
+	config.AllowedHosts = []string{"localhost"}
+
+	response = mkRequest("POST", "/oauth/register", "", metadata)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+	response = mkRequest("POST", "/oauth/register", "wrong", metadata)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// invalid metadata
+	response = mkRequest("POST", "/oauth/register", "initial-token", `{"redirect_uris": ["nowhere"]}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+	regErr := map[string]string{}
+	_ = json.NewDecoder(response.Body).Decode(&regErr)
+	if regErr["error"] != data.RegistrationInvalidRedirectURI {
+		t.Errorf("Error '%s' expected but was '%s'", data.RegistrationInvalidRedirectURI, regErr["error"])
+	}
+
+	// register with initial access token
+	response = mkRequest("POST", "/oauth/register", "initial-token", metadata)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusCreated, response.Code)
+	}
+	registration := map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&registration)
+	clientID, _ := registration["client_id"].(string)
+	secret, _ := registration["client_secret"].(string)
+	token, _ := registration["registration_access_token"].(string)
+	uri, _ := registration["registration_client_uri"].(string)
+	if clientID == "" || secret == "" || token == "" || !strings.HasSuffix(uri, "/oauth/register/"+clientID) {
+		t.Fatalf("Incomplete registration response: %v", registration)
+	}
+	client, ok := data.GetClientByName(clientID)
+	if !ok || !client.VerifySecret(secret) {
+		t.Fatal("Client was not registered")
+	}
+
+	// read
+	path := "/oauth/register/" + clientID
+	response = mkRequest("GET", path, "wrong", "")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+	response = mkRequest("GET", path, token, "")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	registration = map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&registration)
+	if registration["scope"] != "repo-read" || registration["client_secret"] != nil {
+		t.Errorf("Unexpected registration: %v", registration)
+	}
+
+	// update
+	response = mkRequest("PUT", path, token, `{
+		"client_id": "`+clientID+`",
+		"redirect_uris": ["https://tool.example.com/other"],
+		"scope": "repo-read repo-write"
+	}`)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	client, _ = data.GetClientByName(clientID)
+	if !client.RedirectURIs.Contains("https://tool.example.com/other") {
+		t.Error("Registration was not updated")
+	}
+	response = mkRequest("PUT", path, token, `{"client_id": "other", "redirect_uris": ["https://tool.example.com"]}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// delete
+	response = mkRequest("DELETE", path, token, "")
+	if response.Code != http.StatusNoContent {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNoContent, response.Code)
+	}
+	if _, ok = data.GetClientByName(clientID); ok {
+		t.Error("Client was not deleted")
+	}
+
+	// register via allowed host without token
+	response = mkRequest("POST", "/oauth/register", "", `{
+		"redirect_uris": ["http://localhost:9000/callback"],
+		"token_endpoint_auth_method": "none"
+	}`)
+	if response.Code != http.StatusCreated {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusCreated, response.Code)
+	}
+	registration = map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&registration)
+	if _, ok := registration["client_secret"]; ok {
+		t.Error("Public clients expected to have no secret")
+	}
+}
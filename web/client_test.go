@@ -0,0 +1,167 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/data"
+)
+
+const uuidClientGin = "8b14d6bb-cae7-4163-bbd1-f3be46e43e31"
+
+func TestClientAPI(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(method, path, token, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	decode := func(response *httptest.ResponseRecorder) map[string]interface{} {
+		result := make(map[string]interface{})
+		err := json.NewDecoder(response.Body).Decode(&result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// admin scope required
+	response := mkRequest("GET", "/api/clients", accessTokenAlice, "")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	response = mkRequest("GET", "/api/clients", accessTokenAliceAdmin, "")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	clients := []map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&clients)
+	if len(clients) != 2 {
+		t.Errorf("Two clients expected but got %d", len(clients))
+	}
+	for _, c := range clients {
+		if _, ok := c["secret"]; ok {
+			t.Error("Secret should not be listed")
+		}
+	}
+
+	// invalid client
+	response = mkRequest("POST", "/api/clients", accessTokenAliceAdmin, `{"name": "gin", "redirect_uris": ["nowhere"]}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// create
+	response = mkRequest("POST", "/api/clients", accessTokenAliceAdmin, `{
+		"name": "new-service",
+		"scope_provided": {"service-read": "Read access to the new service"},
+		"scope_whitelist": ["service-read"],
+		"scope_blacklist": ["account-admin"],
+		"redirect_uris": ["https://service.example.com/login"]
+	}`)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	created := decode(response)
+	id, _ := created["uuid"].(string)
+	secret, _ := created["secret"].(string)
+	if secret == "" || created["public"] != false || created["managed_by"] != data.ClientManagedAPI {
+		t.Errorf("Confidential client with secret expected: %v", created)
+	}
+	client, ok := data.GetClientByName("new-service")
+	if !ok || client.UUID != id || !client.VerifySecret(secret) {
+		t.Fatal("Client was not created")
+	}
+
+	// get
+	response = mkRequest("GET", "/api/clients/"+id, accessTokenAliceAdmin, "")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := decode(response)["secret"]; ok {
+		t.Error("Secret should only be returned after creation")
+	}
+
+	// update
+	response = mkRequest("PUT", "/api/clients/"+id, accessTokenAliceAdmin, `{
+		"name": "new-service",
+		"scope_provided": {"service-read": "Read access to the new service"},
+		"redirect_uris": ["https://service.example.com/login", "https://service.example.com/other"],
+		"token_format": "jwt"
+	}`)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	client, _ = data.GetClient(id)
+	if client.RedirectURIs.Len() != 2 || client.ScopeWhitelist.Len() != 0 || !client.IssuesJWT() {
+		t.Error("Client was not updated")
+	}
+	if !client.VerifySecret(secret) {
+		t.Error("Secret expected to be unchanged by an update")
+	}
+
+	// rotate secret
+	response = mkRequest("POST", "/api/clients/"+id+"/secret", accessTokenAliceAdmin, "")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	rotated, _ := decode(response)["secret"].(string)
+	client, _ = data.GetClient(id)
+	if rotated == "" || client.VerifySecret(secret) || !client.VerifySecret(rotated) {
+		t.Error("Secret was not rotated")
+	}
+
+	// clients from the configuration file can not be changed
+	for _, method := range []string{"PUT", "DELETE"} {
+		response = mkRequest(method, "/api/clients/"+uuidClientGin, accessTokenAliceAdmin, `{"name": "gin"}`)
+		if response.Code != http.StatusConflict {
+			t.Errorf("Response code '%d' expected but was '%d'", http.StatusConflict, response.Code)
+		}
+	}
+
+	// delete
+	response = mkRequest("DELETE", "/api/clients/"+id, accessTokenAliceAdmin, "")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetClient(id); ok {
+		t.Error("Client was not deleted")
+	}
+	response = mkRequest("GET", "/api/clients/"+id, accessTokenAliceAdmin, "")
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+
+	// public clients have no secret
+	response = mkRequest("POST", "/api/clients", accessTokenAliceAdmin, `{
+		"name": "public-app",
+		"public": true,
+		"redirect_uris": ["https://app.example.com/callback"]
+	}`)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	created = decode(response)
+	if _, ok := created["secret"]; ok || created["public"] != true {
+		t.Errorf("Public client without secret expected: %v", created)
+	}
+	response = mkRequest("POST", "/api/clients/"+created["uuid"].(string)+"/secret", accessTokenAliceAdmin, "")
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+}
@@ -9,6 +9,7 @@
 package web
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -19,6 +20,8 @@ import (
 )
 
 // createGrantRequest creates a Grant Request for a client and redirects to a forwarding URI.
+// If the client or redirect URI are invalid an error page is shown, all other errors are
+// redirected to the client as described in RFC 6749 section 4.1.2.1.
 func createGrantRequest(w http.ResponseWriter, r *http.Request, forwardURI string) {
 	param := &struct {
 		ResponseType string
@@ -28,7 +31,8 @@ func createGrantRequest(w http.ResponseWriter, r *http.Request, forwardURI strin
 		Scope        string
 	}{}
 
-	err := util.ReadQueryIntoStruct(r, param, false)
+	// missing parameters are checked by CreateGrantRequest
+	err := util.ReadQueryIntoStruct(r, param, true)
 	if err != nil {
 		PrintErrorHTML(w, r, err, http.StatusBadRequest)
 		return
@@ -40,13 +44,32 @@ func createGrantRequest(w http.ResponseWriter, r *http.Request, forwardURI strin
 		return
 	}
 
+	// PKCE parameters are optional
+	challenge := r.URL.Query().Get("code_challenge")
+	challengeMethod := r.URL.Query().Get("code_challenge_method")
+
+	// errors are only redirected to the client after the redirect URI was validated
 	scope := util.NewStringSet(strings.Split(param.Scope, " ")...)
-	request, err := client.CreateGrantRequest(param.ResponseType, param.RedirectURI, param.State, scope)
+	request, err := client.CreateGrantRequest(param.ResponseType, param.RedirectURI, param.State, scope,
+		challenge, challengeMethod)
 	if err != nil {
+		if oauthErr, ok := err.(*data.OAuthError); ok {
+			redirectOAuthError(w, r, param.RedirectURI, param.State, param.ResponseType == "token", oauthErr)
+			return
+		}
 		PrintErrorHTML(w, r, err, http.StatusBadRequest)
 		return
 	}
 
+	// The nonce of OpenID Connect requests is passed on to the id token
+	if nonce := r.URL.Query().Get("nonce"); nonce != "" {
+		request.Nonce = sql.NullString{String: nonce, Valid: true}
+		err = request.Update()
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	queryVals := &url.Values{}
 	queryVals.Add("request_id", request.Token)
 	w.Header().Add("Cache-Control", "no-store")
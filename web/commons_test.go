@@ -48,8 +48,11 @@ func TestCreateGrantRequest(t *testing.T) {
 	request, _ := http.NewRequest("GET", "/root?"+queryVals.Encode(), strings.NewReader(""))
 	response := httptest.NewRecorder()
 	createGrantRequest(response, request, forwardURI)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Expected code %d but got %d\n", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusFound {
+		t.Errorf("Expected code %d but got %d\n", http.StatusFound, response.Code)
+	}
+	if location, _ := response.Result().Location(); location == nil || location.Query().Get("error") != "invalid_request" {
+		t.Errorf("Expected redirect with error %q but got %v\n", "invalid_request", location)
 	}
 
 	// Test missing client id
@@ -78,8 +81,11 @@ func TestCreateGrantRequest(t *testing.T) {
 	request, _ = http.NewRequest("GET", "/root?"+queryVals.Encode(), strings.NewReader(""))
 	response = httptest.NewRecorder()
 	createGrantRequest(response, request, forwardURI)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Expected code %d but got %d\n", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusFound {
+		t.Errorf("Expected code %d but got %d\n", http.StatusFound, response.Code)
+	}
+	if location, _ := response.Result().Location(); location == nil || location.Query().Get("error") != "invalid_request" {
+		t.Errorf("Expected redirect with error %q but got %v\n", "invalid_request", location)
 	}
 
 	// Test missing Scope
@@ -88,8 +94,11 @@ func TestCreateGrantRequest(t *testing.T) {
 	request, _ = http.NewRequest("GET", "/root?"+queryVals.Encode(), strings.NewReader(""))
 	response = httptest.NewRecorder()
 	createGrantRequest(response, request, forwardURI)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Expected code %d but got %d\n", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusFound {
+		t.Errorf("Expected code %d but got %d\n", http.StatusFound, response.Code)
+	}
+	if location, _ := response.Result().Location(); location == nil || location.Query().Get("error") != "invalid_scope" {
+		t.Errorf("Expected redirect with error %q but got %v\n", "invalid_scope", location)
 	}
 
 	// Test invalid client id
@@ -108,8 +117,11 @@ func TestCreateGrantRequest(t *testing.T) {
 	request, _ = http.NewRequest("GET", "/root?"+queryVals.Encode(), strings.NewReader(""))
 	response = httptest.NewRecorder()
 	createGrantRequest(response, request, forwardURI)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Expected code %d but got %d\n", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusFound {
+		t.Errorf("Expected code %d but got %d\n", http.StatusFound, response.Code)
+	}
+	if location, _ := response.Result().Location(); location == nil || location.Query().Get("error") != "invalid_scope" {
+		t.Errorf("Expected redirect with error %q but got %v\n", "invalid_scope", location)
 	}
 
 	// Test correct redirect and URI query after create
@@ -0,0 +1,176 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+)
+
+// deviceAuthorizationResponse is the response of the device authorization endpoint
+// as defined in RFC 8628 section 3.2.
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// formatUserCode splits a user code into two halves separated by a dash, which makes
+// the code easier to read and to type in.
+func formatUserCode(code string) string {
+	half := len(code) / 2
+	return code[:half] + "-" + code[half:]
+}
+
+// DeviceAuthorization starts a device authorization request as described in RFC 8628. The client
+// has to authenticate itself in the same way as for the token endpoint. The response contains the
+// device code, which the device uses to poll the token endpoint, and the user code, which the user
+// enters on the page at the verification URI. Errors are returned like by the token endpoint.
+func DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	body := &struct {
+		ClientId     string
+		ClientSecret string
+		Scope        string
+	}{}
+	err := util.ReadFormIntoStruct(r, body, true)
+	if err != nil {
+		printOAuthError(w, data.OAuthInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client, ok := authenticateClient(r, body.ClientId, body.ClientSecret)
+	if !ok {
+		printOAuthError(w, data.OAuthInvalidClient, "Wrong client id or client secret", http.StatusUnauthorized)
+		return
+	}
+
+	scope := util.NewStringSet(strings.Fields(body.Scope)...)
+	request, err := client.CreateDeviceRequest(scope)
+	if err != nil {
+		if oauthErr, ok := err.(*data.OAuthError); ok {
+			printOAuthError(w, oauthErr.Code, oauthErr.Description, http.StatusBadRequest)
+			return
+		}
+		panic(err)
+	}
+
+	userCode := formatUserCode(request.UserCode.String)
+	response := &deviceAuthorizationResponse{
+		DeviceCode:              request.DeviceCode.String,
+		UserCode:                userCode,
+		VerificationURI:         conf.MakeUrl("/oauth/device"),
+		VerificationURIComplete: conf.MakeUrl("/oauth/device?user_code=%s", url.QueryEscape(userCode)),
+		ExpiresIn:               int64(conf.GetServerConfig().GrantReqLifeTime.Seconds()),
+		Interval:                request.PollInterval,
+	}
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// devicePageData contains the values shown on the page where the user enters a user code.
+type devicePageData struct {
+	UserCode string
+	*util.ValidationError
+}
+
+// printDevicePage shows the page where the user enters the user code of a device.
+func printDevicePage(w http.ResponseWriter, pageData *devicePageData, status int) {
+	tmpl := conf.MakeTemplate("device.html")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+	err := tmpl.ExecuteTemplate(w, "layout", pageData)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// DevicePage shows a page where the user can enter the user code displayed by a device. The code
+// is pre-filled if the page was opened with the complete verification URI.
+func DevicePage(w http.ResponseWriter, r *http.Request) {
+	pageData := &devicePageData{
+		UserCode:        r.URL.Query().Get("user_code"),
+		ValidationError: &util.ValidationError{},
+	}
+	printDevicePage(w, pageData, http.StatusOK)
+}
+
+// DeviceVerify looks up the device authorization request of a user code and redirects to the
+// login page of the request. After signing in the user has to approve the request on the approve
+// page. Invalid user codes are limited per IP address like failed logins.
+func DeviceVerify(w http.ResponseWriter, r *http.Request) {
+	param := &struct {
+		UserCode string
+	}{}
+	err := util.ReadFormIntoStruct(r, param, true)
+	if err != nil {
+		PrintErrorHTML(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if !throttleHTML(w, r, data.RateLimitDevice, "") {
+		return
+	}
+
+	request, ok := data.GetGrantRequestByUserCode(param.UserCode)
+	if !ok {
+		data.RecordRateLimitEvent(data.RateLimitDevice, clientIP(r), "")
+		pageData := &devicePageData{
+			UserCode: param.UserCode,
+			ValidationError: &util.ValidationError{
+				Message:     "Invalid or expired code",
+				FieldErrors: map[string]string{"user_code": "The code is invalid or expired"},
+			},
+		}
+		printDevicePage(w, pageData, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Add("Cache-Control", "no-store")
+	http.Redirect(w, r, "/oauth/login_page?request_id="+request.Token, http.StatusFound)
+}
+
+// finishDeviceRequest removes the user code of an approved device authorization request, such
+// that the device receives its tokens with the next poll, and shows a success page.
+func finishDeviceRequest(w http.ResponseWriter, r *http.Request, request *data.GrantRequest) {
+	request.UserCode = sql.NullString{}
+	err := request.Update()
+	if err != nil {
+		panic(err)
+	}
+
+	pageData := struct {
+		Header  string
+		Message string
+	}{"Your device was signed in", "You can now close this page and return to your device."}
+
+	tmpl := conf.MakeTemplate("success.html")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "text/html")
+	err = tmpl.ExecuteTemplate(w, "layout", pageData)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/data"
+)
+
+func TestDeviceAuthorization(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(method, path string, body *url.Values) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body.Encode()))
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
+		request.SetBasicAuth("gin", "secret")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	poll := func(deviceCode string) map[string]interface{} {
+		body := &url.Values{}
+		body.Add("grant_type", data.DeviceCodeGrantType)
+		body.Add("device_code", deviceCode)
+		result := make(map[string]interface{})
+		_ = json.NewDecoder(mkRequest("POST", "/oauth/token", body).Body).Decode(&result)
+		return result
+	}
+
+	// invalid scope
+	response := mkRequest("POST", "/oauth/device_authorization", &url.Values{"scope": {"foo-read"}})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// all OK
+	response = mkRequest("POST", "/oauth/device_authorization", &url.Values{"scope": {"repo-read repo-write"}})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	device := &deviceAuthorizationResponse{}
+	err := json.NewDecoder(response.Body).Decode(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.DeviceCode == "" || len(device.UserCode) != 9 || device.Interval != 5 {
+		t.Errorf("Unexpected device authorization response: %v", device)
+	}
+	if !strings.HasSuffix(device.VerificationURIComplete, "/oauth/device?user_code="+device.UserCode) {
+		t.Errorf("Unexpected verification URI: %s", device.VerificationURIComplete)
+	}
+
+	// the device polls before the user approved the request
+	if result := poll(device.DeviceCode); result["error"] != "slow_down" {
+		t.Errorf("Error 'slow_down' expected but was '%v'", result["error"])
+	}
+	if result := poll("doesnotexist"); result["error"] != "invalid_grant" {
+		t.Errorf("Error 'invalid_grant' expected but was '%v'", result["error"])
+	}
+
+	// invalid user code
+	response = mkRequest("POST", "/oauth/device", &url.Values{"user_code": {"BBBB-BBBB"}})
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+
+	// valid user code leads to the login and always to the approve page
+	response = mkRequest("POST", "/oauth/device", &url.Values{"user_code": {strings.ToLower(device.UserCode)}})
+	if response.Code != http.StatusFound {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	request, ok := data.GetGrantRequestByUserCode(device.UserCode)
+	if !ok || !strings.HasSuffix(response.Header().Get("Location"), "request_id="+request.Token) {
+		t.Fatal("Redirect to the login page of the device request expected")
+	}
+	response = mkRequest("GET", "/oauth/login?request_id="+request.Token, &url.Values{})
+	if response.Code != http.StatusFound || !strings.HasPrefix(response.Header().Get("Location"), "/oauth/approve_page") {
+		t.Fatal("Redirect to the approve page expected")
+	}
+
+	body := &url.Values{"request_id": {request.Token}, "scope": {"repo-read", "repo-write"}}
+	response = mkRequest("POST", "/oauth/approve", body)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetGrantRequestByUserCode(device.UserCode); ok {
+		t.Error("User code expected to be removed after approval")
+	}
+}
+
+func TestTokenDeviceCode(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(client, deviceCode string) *httptest.ResponseRecorder {
+		body := &url.Values{}
+		body.Add("grant_type", data.DeviceCodeGrantType)
+		body.Add("device_code", deviceCode)
+		request, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth(client, "secret")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	decode := func(response *httptest.ResponseRecorder) map[string]interface{} {
+		result := make(map[string]interface{})
+		err := json.NewDecoder(response.Body).Decode(&result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// wrong client
+	response := mkRequest("wb", "DVC7ZLQN")
+	if result := decode(response); response.Code != http.StatusBadRequest || result["error"] != "invalid_grant" {
+		t.Errorf("Error 'invalid_grant' expected but was '%v'", result["error"])
+	}
+
+	// pending
+	response = mkRequest("gin", "DVC7ZLQN")
+	if result := decode(response); response.Code != http.StatusBadRequest || result["error"] != "authorization_pending" {
+		t.Errorf("Error 'authorization_pending' expected but was '%v'", result["error"])
+	}
+
+	// polling too fast
+	response = mkRequest("gin", "DVC7ZLQN")
+	if result := decode(response); response.Code != http.StatusBadRequest || result["error"] != "slow_down" {
+		t.Errorf("Error 'slow_down' expected but was '%v'", result["error"])
+	}
+
+	// approved
+	response = mkRequest("gin", "DVC4KWPB")
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	result := decode(response)
+	if result["access_token"] == nil || result["refresh_token"] == nil || result["scope"] != "repo-read repo-write" {
+		t.Errorf("Access and refresh token expected: %v", result)
+	}
+
+	// device codes can only be used once
+	response = mkRequest("gin", "DVC4KWPB")
+	if result := decode(response); result["error"] != "invalid_grant" {
+		t.Errorf("Error 'invalid_grant' expected but was '%v'", result["error"])
+	}
+}
+
+func TestDeviceDenied(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(method, path string, body *url.Values) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body.Encode()))
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
+		request.SetBasicAuth("gin", "secret")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	poll := func() map[string]interface{} {
+		body := &url.Values{}
+		body.Add("grant_type", data.DeviceCodeGrantType)
+		body.Add("device_code", "DVC7ZLQN")
+		result := make(map[string]interface{})
+		_ = json.NewDecoder(mkRequest("POST", "/oauth/token", body).Body).Decode(&result)
+		return result
+	}
+
+	response := mkRequest("GET", "/oauth/login?request_id=DV3PQXWA", &url.Values{})
+	if response.Code != http.StatusFound || !strings.HasPrefix(response.Header().Get("Location"), "/oauth/approve_page") {
+		t.Fatal("Redirect to the approve page expected")
+	}
+
+	body := &url.Values{"request_id": {"DV3PQXWA"}, "deny": {"true"}}
+	response = mkRequest("POST", "/oauth/approve", body)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusForbidden, response.Code)
+	}
+	if _, ok := data.GetGrantRequestByUserCode("BDFGHJKL"); ok {
+		t.Error("User code expected to be removed after denial")
+	}
+
+	// a denied request can not be approved any more
+	body = &url.Values{"request_id": {"DV3PQXWA"}, "scope": {"repo-read", "repo-write"}}
+	response = mkRequest("POST", "/oauth/approve", body)
+	if response.Code == http.StatusOK {
+		t.Error("Denied request should not be approved")
+	}
+
+	// the device is informed once about the denial
+	if result := poll(); result["error"] != "access_denied" {
+		t.Errorf("Error 'access_denied' expected but was '%v'", result["error"])
+	}
+	if result := poll(); result["error"] != "invalid_grant" {
+		t.Errorf("Error 'invalid_grant' expected but was '%v'", result["error"])
+	}
+}
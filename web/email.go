@@ -0,0 +1,115 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/G-Node/gin-auth/data"
+	"github.com/gorilla/mux"
+)
+
+// queuedEmail returns the e-mail with the id from the request path.
+func queuedEmail(w http.ResponseWriter, r *http.Request) (*data.Email, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		PrintErrorJSON(w, r, "The requested e-mail does not exist", http.StatusNotFound)
+		return nil, false
+	}
+	email, ok := data.GetEmail(id)
+	if !ok {
+		PrintErrorJSON(w, r, "The requested e-mail does not exist", http.StatusNotFound)
+		return nil, false
+	}
+	return email, true
+}
+
+// printEmail writes a single e-mail as JSON.
+func printEmail(w http.ResponseWriter, email *data.Email) {
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(email)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ListEmails returns all queued and failed e-mails as JSON. The parameter 'status' can be used to
+// list only queued or failed e-mails. Requires the scope 'account-admin'.
+func ListEmails(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != data.EmailQueued && status != data.EmailFailed {
+		PrintErrorJSON(w, r, fmt.Errorf("Parameter 'status' must be '%s' or '%s'", data.EmailQueued, data.EmailFailed),
+			http.StatusBadRequest)
+		return
+	}
+
+	emails := data.ListEmails(status)
+	marshal := make([]*data.Email, 0, len(emails))
+	for i := 0; i < len(emails); i++ {
+		marshal = append(marshal, &emails[i])
+	}
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(marshal)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// GetEmail returns a single queued or failed e-mail including the number of attempts and the
+// last error as JSON. Requires the scope 'account-admin'.
+func GetEmail(w http.ResponseWriter, r *http.Request) {
+	email, ok := queuedEmail(w, r)
+	if !ok {
+		return
+	}
+
+	printEmail(w, email)
+}
+
+// RetryEmail moves a queued or failed e-mail back to the queue, such that it is sent with the
+// next dispatch. Requires the scope 'account-admin'. Returns the e-mail as JSON.
+func RetryEmail(w http.ResponseWriter, r *http.Request) {
+	email, ok := queuedEmail(w, r)
+	if !ok {
+		return
+	}
+
+	err := email.Retry()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditAdmin, "", fmt.Sprintf("retry e-mail %d", email.Id))
+
+	printEmail(w, email)
+}
+
+// DeleteEmail discards a queued or failed e-mail without sending it. Requires the scope
+// 'account-admin'. Returns the removed e-mail as JSON.
+func DeleteEmail(w http.ResponseWriter, r *http.Request) {
+	email, ok := queuedEmail(w, r)
+	if !ok {
+		return
+	}
+
+	err := email.Delete()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditAdmin, "", fmt.Sprintf("discard e-mail %d", email.Id))
+
+	printEmail(w, email)
+}
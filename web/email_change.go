@@ -0,0 +1,200 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+)
+
+// ConfirmEmailChange checks whether an e-mail confirmation code submitted by request URI query belongs
+// to a pending change and replaces the e-mail address of the account by the confirmed address.
+func ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		PrintErrorHTML(w, r, "Request was malformed", http.StatusBadRequest)
+		return
+	}
+
+	code := r.Form.Get("code")
+	if code == "" {
+		PrintErrorHTML(w, r, "Request was malformed", http.StatusBadRequest)
+		return
+	}
+
+	change, ok := data.GetEmailChange(code)
+	if !ok {
+		PrintErrorHTML(w, r, "Your request is invalid or outdated. Please request the change again.",
+			http.StatusNotFound)
+		return
+	}
+
+	err = change.Confirm()
+	if _, ok := err.(*util.ValidationError); ok {
+		PrintErrorHTML(w, r, "The e-mail address is already used by another account.", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		PrintErrorHTML(w, r, "Your request is invalid or outdated. Please request the change again.",
+			http.StatusNotFound)
+		return
+	}
+	recordAudit(r, data.AuditEmailChange, change.AccountUUID, change.AccountUUID, "",
+		"previous address "+change.PreviousEmail)
+
+	head := "Success!"
+	message := fmt.Sprintf("Your e-mail address has been changed to %s.<br/><br/>", template.HTMLEscapeString(change.Email))
+	message += fmt.Sprintf("You can use <a href=\"%s\">this link</a> to return to the gin main page.",
+		conf.GetExternals().GinUiURL)
+
+	info := struct {
+		Header  string
+		Message template.HTML
+	}{head, template.HTML(message)}
+
+	tmpl := conf.MakeTemplate("success.html")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "text/html")
+	err = tmpl.ExecuteTemplate(w, "layout", info)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// UndoEmailChangePage checks whether an undo code submitted by request URI query belongs to a
+// change of an e-mail address and asks the user to confirm that the change should be undone.
+func UndoEmailChangePage(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		PrintErrorHTML(w, r, "Request was malformed", http.StatusBadRequest)
+		return
+	}
+
+	code := r.Form.Get("code")
+	if code == "" {
+		PrintErrorHTML(w, r, "Request was malformed", http.StatusBadRequest)
+		return
+	}
+
+	change, ok := data.GetEmailChangeByUndoCode(code)
+	if !ok {
+		PrintErrorHTML(w, r, "Your request is invalid or outdated.", http.StatusNotFound)
+		return
+	}
+
+	pageData := &struct {
+		Login         string
+		Email         string
+		PreviousEmail string
+		Code          string
+	}{change.Account().Login, change.Email, change.PreviousEmail, code}
+
+	tmpl := conf.MakeTemplate("emailundo.html")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "text/html")
+	err = tmpl.ExecuteTemplate(w, "layout", pageData)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// UndoEmailChange reverts a change of an e-mail address using the undo code sent to the previous
+// address and locks the account: the previous address is restored, all sessions and tokens are
+// revoked and the password is invalidated. A password reset code is sent to the previous address.
+func UndoEmailChange(w http.ResponseWriter, r *http.Request) {
+	param := &struct{ Code string }{}
+	err := util.ReadFormIntoStruct(r, param, false)
+	if err != nil {
+		PrintErrorHTML(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	change, ok := data.GetEmailChangeByUndoCode(param.Code)
+	if !ok {
+		PrintErrorHTML(w, r, "Your request is invalid or outdated.", http.StatusNotFound)
+		return
+	}
+
+	err = change.Undo()
+	if err != nil {
+		PrintErrorHTML(w, r, "Your request is invalid or outdated.", http.StatusNotFound)
+		return
+	}
+
+	account := change.Account()
+	reset, err := account.ForcePasswordReset()
+	if err != nil {
+		panic(err)
+	}
+	recordAudit(r, data.AuditEmailChange, account.UUID, account.UUID, "",
+		"undo change to "+change.Email+", account locked")
+
+	err = sendResetEmail(account, reset)
+	if err != nil {
+		msg := "An error occurred trying to send password reset e-mail. Please try again later."
+		PrintErrorHTML(w, r, msg, http.StatusInternalServerError)
+		return
+	}
+
+	head := "Your account has been locked"
+	message := fmt.Sprintf("The e-mail address of your account remains %s and all sessions and tokens "+
+		"of the account have been revoked.<br/><br/>", template.HTMLEscapeString(account.Email))
+	message += "An e-mail with a password reset link has been sent to this address. "
+	message += "Please follow the enclosed link to set a new password and unlock your account.<br/><br/>"
+	message += fmt.Sprintf("You can use <a href=\"%s\">this link</a> to return to the gin main page.",
+		conf.GetExternals().GinUiURL)
+
+	info := struct {
+		Header  string
+		Message template.HTML
+	}{head, template.HTML(message)}
+
+	tmpl := conf.MakeTemplate("success.html")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "text/html")
+	err = tmpl.ExecuteTemplate(w, "layout", info)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// sendEmailChangeEmails queues an e-mail with the confirmation link to the new address of a
+// change and a notice with the undo link to the previous address. The plain codes have to be
+// available via Code and UndoCode of the change.
+func sendEmailChangeEmails(account *data.Account, change *data.EmailChange) error {
+	tmplFields := &struct {
+		BaseUrl  string
+		Login    string
+		Email    string
+		Code     string
+		ValidFor int
+	}{}
+	tmplFields.BaseUrl = conf.GetServerConfig().BaseURL
+	tmplFields.Login = account.Login
+	tmplFields.Email = change.Email
+	tmplFields.Code = change.Code
+	tmplFields.ValidFor = int(conf.GetServerConfig().EmailChangeLifeTime.Minutes())
+
+	content := util.MakeEmail(account.Language, "emailconfirm", []string{change.Email}, tmplFields)
+	email := &data.Email{}
+	err := email.Create(util.NewStringSet(change.Email), content)
+	if err != nil {
+		return err
+	}
+
+	tmplFields.Code = change.UndoCode
+	content = util.MakeEmail(account.Language, "emailnotice", []string{change.PreviousEmail}, tmplFields)
+	email = &data.Email{}
+	return email.Create(util.NewStringSet(change.PreviousEmail), content)
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/data"
+)
+
+func TestConfirmEmailChange(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+	const confirmURL = "/oauth/email_confirm"
+
+	// missing, invalid and expired codes
+	for code, status := range map[string]int{"": http.StatusBadRequest, "iDoNotExist": http.StatusNotFound, "ec_x": http.StatusNotFound} {
+		request, _ := http.NewRequest("GET", confirmURL+"?code="+code, strings.NewReader(""))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != status {
+			t.Errorf("Response code '%d' expected for code '%s' but was '%d'", status, code, response.Code)
+		}
+	}
+
+	// valid code
+	request, _ := http.NewRequest("GET", confirmURL+"?code=ec_a", strings.NewReader(""))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	acc, ok := data.GetAccountByLogin("bob")
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+	if acc.Email != "bob@example.com" {
+		t.Errorf("E-mail address expected to be 'bob@example.com' but was '%s'", acc.Email)
+	}
+
+	// codes can only be used once
+	request, _ = http.NewRequest("GET", confirmURL+"?code=ec_a", strings.NewReader(""))
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+}
+
+func TestUndoEmailChangePage(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+	const undoURL = "/oauth/email_undo_page"
+
+	for code, status := range map[string]int{"": http.StatusBadRequest, "ec_a": http.StatusNotFound, "eu_x": http.StatusNotFound} {
+		request, _ := http.NewRequest("GET", undoURL+"?code="+code, strings.NewReader(""))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != status {
+			t.Errorf("Response code '%d' expected for code '%s' but was '%d'", status, code, response.Code)
+		}
+	}
+
+	request, _ := http.NewRequest("GET", undoURL+"?code=eu_a", strings.NewReader(""))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if !strings.Contains(response.Body.String(), "bob@example.com") {
+		t.Errorf("Page expected to contain the new address:\n%s", response.Body.String())
+	}
+}
+
+func TestUndoEmailChange(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+	const undoURL = "/oauth/email_undo"
+	const uuidConfirmed = "test0002-1234-6789-1234-678901234567"
+
+	mkBody := func(code string) *strings.Reader {
+		body := &url.Values{}
+		body.Add("code", code)
+		return strings.NewReader(body.Encode())
+	}
+
+	// invalid and expired codes
+	for _, code := range []string{"iDoNotExist", "eu_x"} {
+		request, _ := http.NewRequest("POST", undoURL, mkBody(code))
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != http.StatusNotFound {
+			t.Errorf("Response code '%d' expected for code '%s' but was '%d'", http.StatusNotFound, code, response.Code)
+		}
+	}
+
+	// a confirmed change is reverted and the account is locked
+	emails, _ := data.GetQueuedEmails()
+	num := len(emails)
+
+	request, _ := http.NewRequest("POST", undoURL, mkBody("eu_b"))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	acc, ok := data.GetAccount(uuidConfirmed)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+	if acc.Email != "email2@foo.com" {
+		t.Errorf("E-mail address expected to be 'email2@foo.com' but was '%s'", acc.Email)
+	}
+	if acc.PWHash != "" {
+		t.Error("Password expected to be invalidated")
+	}
+	emails, _ = data.GetQueuedEmails()
+	if len(emails) != num+1 || !emails[len(emails)-1].Recipient.Contains("email2@foo.com") {
+		t.Error("Password reset e-mail to the previous address expected")
+	}
+
+	// codes can only be used once
+	request, _ = http.NewRequest("POST", undoURL, mkBody("eu_b"))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/data"
+)
+
+func TestEmailsAPI(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(method, token, uri string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, uri, strings.NewReader(""))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	// missing scope
+	response := mkRequest("GET", accessTokenAlice, "/api/emails")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// all e-mails
+	response = mkRequest("GET", accessTokenAliceAdmin, "/api/emails")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	emails := []map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&emails)
+	if len(emails) != 3 {
+		t.Errorf("Exactly 3 e-mails expected but was %d", len(emails))
+	}
+
+	// failed e-mails
+	response = mkRequest("GET", accessTokenAliceAdmin, "/api/emails?status=failed")
+	emails = []map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&emails)
+	if len(emails) != 1 || emails[0]["last_error"] != "connection refused" {
+		t.Fatalf("One failed e-mail expected but was %v", emails)
+	}
+	if _, ok := emails[0]["content"]; ok {
+		t.Error("Content of e-mails should not be exposed")
+	}
+	uri := fmt.Sprintf("/api/emails/%v", emails[0]["id"])
+
+	// invalid status
+	response = mkRequest("GET", accessTokenAliceAdmin, "/api/emails?status=sent")
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// single e-mail
+	response = mkRequest("GET", accessTokenAliceAdmin, uri)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	response = mkRequest("GET", accessTokenAliceAdmin, "/api/emails/doesnotexist")
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+
+	// retry
+	response = mkRequest("POST", accessTokenAliceAdmin, uri+"/retry")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	email := map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&email)
+	if email["status"] != data.EmailQueued || email["attempts"] != 0.0 {
+		t.Errorf("Queued e-mail expected but was %v", email)
+	}
+
+	// discard
+	response = mkRequest("DELETE", accessTokenAliceAdmin, uri)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if len(data.ListEmails("")) != 2 {
+		t.Error("E-mail should be removed")
+	}
+	response = mkRequest("DELETE", accessTokenAliceAdmin, uri)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+}
@@ -12,8 +12,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
 	"github.com/G-Node/gin-auth/util"
 )
 
@@ -86,3 +88,62 @@ func PrintErrorJSON(w http.ResponseWriter, r *http.Request, err interface{}, cod
 		panic(err)
 	}
 }
+
+// printOAuthError writes an error response with an error code and description as defined
+// by RFC 6749 section 5.2 and the specifications extending it. Failed client authentication
+// is answered with a basic authentication challenge, other unauthorized requests with a
+// bearer token challenge.
+func printOAuthError(w http.ResponseWriter, code, description string, status int) {
+	if status == http.StatusUnauthorized {
+		if code == data.OAuthInvalidClient {
+			w.Header().Add("WWW-Authenticate", `Basic realm="gin-auth"`)
+		} else {
+			w.Header().Add("WWW-Authenticate", `Bearer error="`+code+`"`)
+		}
+	}
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	err := enc.Encode(&struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}{code, description})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// redirectOAuthError redirects the error of an authorization request to the redirect URI of the
+// client as described in RFC 6749 section 4.1.2.1. The error parameters are added to the query
+// of the redirect URI, or to its fragment for implicit requests (section 4.2.2.1). The redirect
+// URI must already be validated.
+func redirectOAuthError(w http.ResponseWriter, r *http.Request, redirectURI, state string, implicit bool, err *data.OAuthError) {
+	u, parseErr := url.Parse(redirectURI)
+	if parseErr != nil {
+		PrintErrorHTML(w, r, err.Description, http.StatusBadRequest)
+		return
+	}
+
+	query := url.Values{}
+	if !implicit {
+		query = u.Query()
+	}
+	query.Set("error", err.Code)
+	query.Set("error_description", err.Description)
+	if state != "" {
+		query.Set("state", state)
+	}
+
+	var location string
+	if implicit {
+		u.Fragment = ""
+		location = u.String() + "#" + query.Encode()
+	} else {
+		u.RawQuery = query.Encode()
+		location = u.String()
+	}
+
+	w.Header().Add("Cache-Control", "no-store")
+	http.Redirect(w, r, location, http.StatusFound)
+}
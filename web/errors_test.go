@@ -0,0 +1,50 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/G-Node/gin-auth/data"
+)
+
+func TestRedirectOAuthError(t *testing.T) {
+	oauthErr := &data.OAuthError{Code: data.OAuthInvalidScope, Description: "Invalid scope"}
+
+	// the error is merged into an existing query
+	request, _ := http.NewRequest("GET", "/oauth/authorize", nil)
+	response := httptest.NewRecorder()
+	redirectOAuthError(response, request, "https://example.com/callback?tenant=foo", "abc", false, oauthErr)
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	redirect, _ := url.Parse(response.Header().Get("Location"))
+	if redirect.Path != "/callback" || redirect.Query().Get("tenant") != "foo" {
+		t.Errorf("Existing query expected to be kept but was '%s'", redirect)
+	}
+	if redirect.Query().Get("error") != "invalid_scope" || redirect.Query().Get("state") != "abc" {
+		t.Errorf("Error and state expected in query but was '%s'", redirect)
+	}
+
+	// implicit requests get the error in the fragment
+	response = httptest.NewRecorder()
+	redirectOAuthError(response, request, "https://example.com/callback?tenant=foo", "abc", true, oauthErr)
+	redirect, _ = url.Parse(response.Header().Get("Location"))
+	if redirect.Query().Get("tenant") != "foo" || redirect.Query().Get("error") != "" {
+		t.Errorf("Query expected to be unchanged but was '%s'", redirect)
+	}
+	fragment, _ := url.ParseQuery(redirect.Fragment)
+	if fragment.Get("error") != "invalid_scope" || fragment.Get("error_description") != "Invalid scope" ||
+		fragment.Get("state") != "abc" {
+		t.Errorf("Error and state expected in fragment but was '%s'", redirect)
+	}
+}
@@ -84,7 +84,7 @@ func (o oauth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if tokenStr := r.Header.Get("Authorization"); tokenStr != "" && strings.HasPrefix(tokenStr, "Bearer ") {
 		tokenStr = strings.Trim(tokenStr[6:], " ")
 
-		if token, ok := data.GetAccessToken(tokenStr); ok {
+		if token, ok := data.FindAccessToken(tokenStr); ok {
 			match := token.Scope
 
 			if !o.Permissive {
@@ -156,7 +156,7 @@ func LoginPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// show login page
-	tmpl := conf.MakeTemplate("login.html")
+	tmpl := conf.MakeTemplate("login.html", "webauthn.html")
 	w.Header().Add("Cache-Control", "no-store")
 	w.Header().Add("Content-Type", "text/html")
 	err = tmpl.ExecuteTemplate(w, "layout", &loginData{RequestID: token})
@@ -181,31 +181,63 @@ func LoginWithCredentials(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// verify login data
+	// verify login data, failed attempts are limited per IP and account
 	account, ok := data.GetAccountByCredential(param.Login)
 	if !ok {
+		if !throttleHTML(w, r, data.RateLimitLogin, "") {
+			return
+		}
+		data.RecordRateLimitEvent(data.RateLimitLogin, clientIP(r), "")
+		recordAudit(r, data.AuditLoginFailure, "", "", request.ClientUUID, "unknown account")
 		w.Header().Add("Cache-Control", "no-store")
 		http.Redirect(w, r, "/oauth/login_page?request_id="+request.Token, http.StatusFound)
 		return
 	}
+	if !throttleHTML(w, r, data.RateLimitLogin, account.UUID) {
+		return
+	}
 
 	ok = account.VerifyPassword(param.Password)
 	if !ok {
+		data.RecordRateLimitEvent(data.RateLimitLogin, clientIP(r), account.UUID)
+		recordAudit(r, data.AuditLoginFailure, "", account.UUID, request.ClientUUID, "wrong password")
 		w.Header().Add("Cache-Control", "no-store")
 		http.Redirect(w, r, "/oauth/login_page?request_id="+request.Token, http.StatusFound)
 		return
 	}
 
-	// associate grant request with account
-	request.AccountUUID = sql.NullString{String: account.UUID, Valid: true}
-	err = request.Update()
-	if err != nil {
-		panic(err)
+	// accounts using two-factor authentication or security keys have to provide a second
+	// factor before the login is completed
+	if account.UsesSecondFactor() {
+		request.PendingAccountUUID = sql.NullString{String: account.UUID, Valid: true}
+		err = request.Update()
+		if err != nil {
+			panic(err)
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+		http.Redirect(w, r, "/oauth/login_2fa_page?request_id="+request.Token, http.StatusFound)
+		return
 	}
+	// accounts which have to use two-factor authentication for the requested scope are
+	// signed in and have to enrol before the login can be continued
+	if data.RequiresTwoFactor(request.ScopeRequested) {
+		data.ClearLoginFailures(account.UUID)
+		recordAudit(r, data.AuditLogin, account.UUID, account.UUID, request.ClientUUID, "two-factor enrolment required")
+		createSession(w, r, account)
 
-	// create session
-	session := &data.Session{AccountUUID: account.UUID}
-	err = session.Create()
+		w.Header().Add("Cache-Control", "no-store")
+		http.Redirect(w, r, twoFactorPageURL(request.Token), http.StatusFound)
+		return
+	}
+
+	finishLogin(w, r, request, account)
+}
+
+// createSession creates a new session for an authenticated account and sets the session cookie.
+func createSession(w http.ResponseWriter, r *http.Request, account *data.Account) {
+	session := &data.Session{AccountUUID: account.UUID, UserAgent: r.UserAgent(), IP: clientIP(r)}
+	err := session.Create()
 	if err != nil {
 		panic(err)
 	}
@@ -217,14 +249,27 @@ func LoginWithCredentials(w http.ResponseWriter, r *http.Request) {
 		Expires: session.Expires,
 	}
 	http.SetCookie(w, cookie)
+}
+
+// finishLogin associates the grant request with an authenticated account and creates a new
+// session. If the request was already approved it is finished, otherwise the user is redirected
+// to the approve page. Previous failed logins of the account are reset.
+func finishLogin(w http.ResponseWriter, r *http.Request, request *data.GrantRequest, account *data.Account) {
+	data.ClearLoginFailures(account.UUID)
+	recordAudit(r, data.AuditLogin, account.UUID, account.UUID, request.ClientUUID, "")
+
+	// associate grant request with account
+	request.AccountUUID = sql.NullString{String: account.UUID, Valid: true}
+	err := request.Update()
+	if err != nil {
+		panic(err)
+	}
+
+	createSession(w, r, account)
 
 	// if approved finish the grant request, otherwise redirect to approve page
-	if request.IsApproved() {
-		if request.GrantType == "code" {
-			finishCodeRequest(w, r, request)
-		} else {
-			finishImplicitRequest(w, r, request)
-		}
+	if request.IsApproved() && request.GrantType != "device" {
+		finishGrantRequest(w, r, request)
 	} else {
 		w.Header().Add("Cache-Control", "no-store")
 		http.Redirect(w, r, "/oauth/approve_page?request_id="+request.Token, http.StatusFound)
@@ -268,6 +313,11 @@ func LoginWithSession(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		panic("Session has not account")
 	}
+	if data.RequiresTwoFactor(request.ScopeRequested) && !account.UsesSecondFactor() {
+		w.Header().Add("Cache-Control", "no-store")
+		http.Redirect(w, r, twoFactorPageURL(request.Token), http.StatusFound)
+		return
+	}
 
 	// associate grant request with account
 	request.AccountUUID = sql.NullString{String: account.UUID, Valid: true}
@@ -278,25 +328,35 @@ func LoginWithSession(w http.ResponseWriter, r *http.Request) {
 
 	cookie = &http.Cookie{
 		Name:    cookieName,
-		Value:   session.Token,
+		Value:   cookie.Value,
 		Path:    cookiePath,
 		Expires: session.Expires,
 	}
 	http.SetCookie(w, cookie)
 
 	// if approved finish the grant request, otherwise redirect to approve page
-	if request.IsApproved() {
-		if request.GrantType == "code" {
-			finishCodeRequest(w, r, request)
-		} else {
-			finishImplicitRequest(w, r, request)
-		}
+	if request.IsApproved() && request.GrantType != "device" {
+		finishGrantRequest(w, r, request)
 	} else {
 		w.Header().Add("Cache-Control", "no-store")
 		http.Redirect(w, r, "/oauth/approve_page?request_id="+request.Token, http.StatusFound)
 	}
 }
 
+// finishGrantRequest finishes an approved grant request depending on its grant type. Device
+// authorization requests are never finished without showing the approve page, since the user
+// might have been tricked into entering the user code of a device controlled by somebody else.
+func finishGrantRequest(w http.ResponseWriter, r *http.Request, request *data.GrantRequest) {
+	switch request.GrantType {
+	case "code":
+		finishCodeRequest(w, r, request)
+	case "device":
+		finishDeviceRequest(w, r, request)
+	default:
+		finishImplicitRequest(w, r, request)
+	}
+}
+
 func finishCodeRequest(w http.ResponseWriter, r *http.Request, request *data.GrantRequest) {
 	request.Code = sql.NullString{String: util.RandomToken(), Valid: true}
 	err := request.Update()
@@ -330,9 +390,15 @@ func finishImplicitRequest(w http.ResponseWriter, r *http.Request, request *data
 		panic(err)
 	}
 
+	value, err := token.Encode()
+	if err != nil {
+		panic(err)
+	}
+	recordAudit(r, data.AuditTokenIssued, token.AccountUUID.String, token.AccountUUID.String, token.ClientUUID, "implicit")
+
 	scope := url.QueryEscape(strings.Join(token.Scope.Strings(), " "))
 	state := url.QueryEscape(request.State)
-	url := fmt.Sprintf("%s?token_type=bearer&scope=%s&state=%s&access_token=%s", request.RedirectURI, scope, state, token.Token)
+	url := fmt.Sprintf("%s?token_type=bearer&scope=%s&state=%s&access_token=%s", request.RedirectURI, scope, state, value)
 
 	w.Header().Add("Cache-Control", "no-store")
 	http.Redirect(w, r, url, http.StatusFound)
@@ -341,10 +407,12 @@ func finishImplicitRequest(w http.ResponseWriter, r *http.Request, request *data
 // Logout remove a valid token (and if present the session cookie too) so it can't be used any more.
 func Logout(w http.ResponseWriter, r *http.Request) {
 	tokenStr := mux.Vars(r)["token"]
-	if token, ok := data.GetAccessToken(tokenStr); ok {
+	if token, ok := data.FindAccessToken(tokenStr); ok {
 		if err := token.Delete(); err != nil {
 			panic(err)
 		}
+		recordAudit(r, data.AuditTokenRevoked, token.AccountUUID.String, token.AccountUUID.String, token.ClientUUID,
+			"logout")
 	} else {
 		PrintErrorHTML(w, r, "Access token does not exist", http.StatusNotFound)
 		return
@@ -428,7 +496,7 @@ func ApprovePage(w http.ResponseWriter, r *http.Request) {
 		AddScope      map[string]string
 		ExistingScope map[string]string
 		RequestID     string
-	}{client.Name, addScope, existScope, request.Token}
+	}{client.Title(), addScope, existScope, request.Token}
 
 	tmpl := conf.MakeTemplate("approve.html")
 	w.Header().Add("Cache-Control", "no-store")
@@ -439,12 +507,15 @@ func ApprovePage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Approve evaluates an access approval given to a certain client.
+// Approve evaluates an access approval given to a certain client. The user may deny the request,
+// which is then redirected to the client with the error access_denied, or approve only some of the
+// requested scopes, which narrows the scope of the issued tokens.
 func Approve(w http.ResponseWriter, r *http.Request) {
 	param := &struct {
 		Client    string
 		RequestID string
 		Scope     []string
+		Deny      bool
 	}{}
 	err := util.ReadFormIntoStruct(r, param, true)
 	if err != nil {
@@ -463,13 +534,23 @@ func Approve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if param.Deny {
+		rejectGrantRequest(w, r, request, &data.OAuthError{Code: data.OAuthAccessDenied,
+			Description: "The user denied the request"})
+		return
+	}
+
 	client := request.Client()
 
 	scopeApproved := util.NewStringSet(param.Scope...)
 	scopeRequired := request.ScopeRequested.Difference(client.ScopeWhitelist)
 	if !scopeApproved.IsSuperset(scopeRequired) {
-		PrintErrorHTML(w, r, "Requested scope was not approved", http.StatusUnauthorized)
-		return
+		err = request.NarrowScope(scopeApproved)
+		if err != nil {
+			rejectGrantRequest(w, r, request, &data.OAuthError{Code: data.OAuthAccessDenied,
+				Description: "Requested scope was not approved"})
+			return
+		}
 	}
 
 	// create approval
@@ -477,24 +558,65 @@ func Approve(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic(err)
 	}
+	recordAudit(r, data.AuditApproval, request.AccountUUID.String, request.AccountUUID.String, client.UUID,
+		strings.Join(request.ScopeRequested.Strings(), " "))
 
 	// if approved finish the grant request
 	if !request.IsApproved() {
 		panic("Requested scope should be approved but was not")
 	}
 
-	if request.GrantType == "code" {
-		finishCodeRequest(w, r, request)
-	} else {
-		finishImplicitRequest(w, r, request)
+	finishGrantRequest(w, r, request)
+}
+
+// rejectGrantRequest removes a grant request and redirects the error to the client. Since device
+// authorization requests have no redirect URI, they are only marked as denied until the device
+// polls again and an error page is shown instead.
+func rejectGrantRequest(w http.ResponseWriter, r *http.Request, request *data.GrantRequest, oauthErr *data.OAuthError) {
+	if request.GrantType == "device" {
+		err := request.Deny()
+		if err != nil {
+			panic(err)
+		}
+		PrintErrorHTML(w, r, oauthErr.Description, http.StatusForbidden)
+		return
 	}
+
+	err := request.Delete()
+	if err != nil {
+		panic(err)
+	}
+	redirectOAuthError(w, r, request.RedirectURI, request.State, request.GrantType == "token", oauthErr)
 }
 
-// Token exchanges a grant code for an access and refresh token
-func Token(w http.ResponseWriter, r *http.Request) {
-	// Read authorization header
+// authenticateClient checks the client credentials of a request to the token or revocation endpoint.
+// The client id and secret are taken from the basic authorization header or, if the header is
+// not present, from the request body.
+func authenticateClient(r *http.Request, bodyClientId, bodyClientSecret string) (*data.Client, bool) {
 	clientId, clientSecret, authorizeOk := r.BasicAuth()
+	if !authorizeOk {
+		clientId = bodyClientId
+		clientSecret = bodyClientSecret
+	}
 
+	client, ok := data.GetClientByName(clientId)
+	if !ok || !client.VerifySecret(clientSecret) {
+		return nil, false
+	}
+	return client, true
+}
+
+// tokenResponse extends the token response by the id token of OpenID Connect requests.
+type tokenResponse struct {
+	*gin.TokenResponse
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// Token exchanges a grant code for an access and refresh token.
+// If the scope of an authorization code request contains 'openid' an id token is
+// returned as well. Devices polling with a device code are answered with the error
+// codes defined by RFC 8628 until the user approved the request.
+func Token(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	body := &struct {
 		GrantType    string
@@ -502,45 +624,56 @@ func Token(w http.ResponseWriter, r *http.Request) {
 		ClientSecret string
 		Scope        string
 		Code         string
+		CodeVerifier string
 		RefreshToken string
 		Username     string
 		Password     string
+		DeviceCode   string
 	}{}
 	err := util.ReadFormIntoStruct(r, body, true)
 	if err != nil {
-		PrintErrorJSON(w, r, err, http.StatusBadRequest)
+		printOAuthError(w, data.OAuthInvalidRequest, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Take clientId and clientSecret from body if they are not in the header
-	if !authorizeOk {
-		clientId = body.ClientId
-		clientSecret = body.ClientSecret
-	}
-
 	// Check client
-	client, ok := data.GetClientByName(clientId)
+	client, ok := authenticateClient(r, body.ClientId, body.ClientSecret)
 	if !ok {
-		PrintErrorJSON(w, r, "Wrong client id or client secret", http.StatusUnauthorized)
+		printOAuthError(w, data.OAuthInvalidClient, "Wrong client id or client secret", http.StatusUnauthorized)
 		return
 	}
-	if clientSecret != client.Secret {
-		PrintErrorJSON(w, r, "Wrong client id or client secret", http.StatusUnauthorized)
+
+	if body.GrantType == "" {
+		printOAuthError(w, data.OAuthInvalidRequest, "Missing grant type", http.StatusBadRequest)
+		return
+	}
+	if data.GrantTypes.Contains(body.GrantType) && !client.AllowsGrantType(body.GrantType) {
+		printOAuthError(w, data.OAuthUnauthorizedClient,
+			fmt.Sprintf("Grant type %s is not allowed for this client", body.GrantType), http.StatusBadRequest)
 		return
 	}
 
 	// Prepare a response depending on the grant type
 	var response *gin.TokenResponse
+	var idToken, accountUUID string
 	switch body.GrantType {
 
 	case "authorization_code":
 		request, ok := data.GetGrantRequestByCode(body.Code)
 		if !ok {
-			PrintErrorJSON(w, r, "Invalid grant code", http.StatusUnauthorized)
+			printOAuthError(w, data.OAuthInvalidGrant, "Invalid grant code", http.StatusBadRequest)
 			return
 		}
 		if request.ClientUUID != client.UUID {
-			PrintErrorJSON(w, r, "Invalid grant code", http.StatusUnauthorized)
+			printOAuthError(w, data.OAuthInvalidGrant, "Invalid grant code", http.StatusBadRequest)
+			err = request.Delete()
+			if err != nil {
+				panic(err)
+			}
+			return
+		}
+		if !request.VerifyCodeChallenge(body.CodeVerifier) {
+			printOAuthError(w, data.OAuthInvalidGrant, "Invalid code verifier", http.StatusBadRequest)
 			err = request.Delete()
 			if err != nil {
 				panic(err)
@@ -550,10 +683,19 @@ func Token(w http.ResponseWriter, r *http.Request) {
 
 		access, refresh, err := request.ExchangeCodeForTokens()
 		if err != nil {
-			PrintErrorJSON(w, r, "Invalid grant code", http.StatusUnauthorized)
+			printOAuthError(w, data.OAuthInvalidGrant, "Invalid grant code", http.StatusBadRequest)
 			return
 		}
 
+		if request.ScopeRequested.Contains("openid") {
+			idToken, err = request.CreateIDToken()
+			if err != nil {
+				PrintErrorJSON(w, r, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		accountUUID = request.AccountUUID.String
 		response = &gin.TokenResponse{
 			TokenType:    "Bearer",
 			Scope:        strings.Join(request.ScopeRequested.Strings(), " "),
@@ -564,11 +706,16 @@ func Token(w http.ResponseWriter, r *http.Request) {
 	case "refresh_token":
 		refresh, ok := data.GetRefreshToken(body.RefreshToken)
 		if !ok {
-			PrintErrorJSON(w, r, "Invalid refresh token", http.StatusUnauthorized)
+			// A reused rotated token indicates that the token was stolen, therefore the
+			// whole token family is revoked.
+			if rotated, ok := data.GetRotatedRefreshToken(body.RefreshToken); ok {
+				revokeReusedRefreshToken(r, rotated)
+			}
+			printOAuthError(w, data.OAuthInvalidGrant, "Invalid refresh token", http.StatusBadRequest)
 			return
 		}
 		if refresh.ClientUUID != client.UUID {
-			PrintErrorJSON(w, r, "Invalid refresh token", http.StatusUnauthorized)
+			printOAuthError(w, data.OAuthInvalidGrant, "Invalid refresh token", http.StatusBadRequest)
 			err = refresh.Delete()
 			if err != nil {
 				panic(err)
@@ -576,38 +723,82 @@ func Token(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		var rotated *string
+		if conf.GetServerConfig().RefreshTokenRotation {
+			refresh, err = refresh.Rotate()
+			if err != nil {
+				// the token was rotated by a concurrent request, which is treated like a reuse
+				if rotated, ok := data.GetRotatedRefreshToken(body.RefreshToken); ok {
+					revokeReusedRefreshToken(r, rotated)
+				}
+				printOAuthError(w, data.OAuthInvalidGrant, "Invalid refresh token", http.StatusBadRequest)
+				return
+			}
+			rotated = &refresh.Token
+		} else {
+			err = refresh.Touch()
+			if err != nil {
+				panic(err)
+			}
+		}
+
 		access := data.AccessToken{
-			Token:       util.RandomToken(),
-			AccountUUID: sql.NullString{String: refresh.AccountUUID, Valid: true},
-			ClientUUID:  refresh.ClientUUID,
-			Scope:       refresh.Scope,
+			Token:        util.RandomToken(),
+			AccountUUID:  sql.NullString{String: refresh.AccountUUID, Valid: true},
+			ClientUUID:   refresh.ClientUUID,
+			Scope:        refresh.Scope,
+			RefreshToken: sql.NullString{String: refresh.Token, Valid: true},
 		}
 		err := access.Create()
 		if err != nil {
 			PrintErrorJSON(w, r, err, http.StatusInternalServerError)
 			return
 		}
+		value, err := access.Encode()
+		if err != nil {
+			PrintErrorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
 
+		accountUUID = refresh.AccountUUID
 		response = &gin.TokenResponse{
-			TokenType:   "Bearer",
-			Scope:       strings.Join(refresh.Scope.Strings(), " "),
-			AccessToken: access.Token,
+			TokenType:    "Bearer",
+			Scope:        strings.Join(refresh.Scope.Strings(), " "),
+			AccessToken:  value,
+			RefreshToken: rotated,
 		}
 
 	case "password":
 		account, ok := data.GetAccountByLogin(body.Username)
 		if !ok {
-			PrintErrorJSON(w, r, "Wrong username or password", http.StatusUnauthorized)
+			if !throttleOAuth(w, r, data.RateLimitLogin, "") {
+				return
+			}
+			data.RecordRateLimitEvent(data.RateLimitLogin, clientIP(r), "")
+			recordAudit(r, data.AuditLoginFailure, "", "", client.UUID, "unknown account")
+			printOAuthError(w, data.OAuthInvalidGrant, "Wrong username or password", http.StatusBadRequest)
+			return
+		}
+		if !throttleOAuth(w, r, data.RateLimitLogin, account.UUID) {
 			return
 		}
 		if !account.VerifyPassword(body.Password) {
-			PrintErrorJSON(w, r, "Wrong username or password", http.StatusUnauthorized)
+			data.RecordRateLimitEvent(data.RateLimitLogin, clientIP(r), account.UUID)
+			recordAudit(r, data.AuditLoginFailure, "", account.UUID, client.UUID, "wrong password")
+			printOAuthError(w, data.OAuthInvalidGrant, "Wrong username or password", http.StatusBadRequest)
 			return
 		}
+		data.ClearLoginFailures(account.UUID)
 
 		scope := util.NewStringSet(strings.Split(body.Scope, " ")...)
 		if scope.Len() == 0 || !client.ScopeWhitelist.IsSuperset(scope) {
-			PrintErrorJSON(w, r, "Invalid scope", http.StatusUnauthorized)
+			printOAuthError(w, data.OAuthInvalidScope, "Invalid scope", http.StatusBadRequest)
+			return
+		}
+
+		// the password grant offers no way to provide a second factor
+		if account.UsesSecondFactor() || data.RequiresTwoFactor(scope) {
+			printOAuthError(w, data.OAuthInvalidGrant, twoFactorRequired, http.StatusBadRequest)
 			return
 		}
 
@@ -622,17 +813,28 @@ func Token(w http.ResponseWriter, r *http.Request) {
 			PrintErrorJSON(w, r, err, http.StatusInternalServerError)
 			return
 		}
+		value, err := access.Encode()
+		if err != nil {
+			PrintErrorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
 
+		accountUUID = account.UUID
 		response = &gin.TokenResponse{
 			TokenType:   "Bearer",
 			Scope:       strings.Join(scope.Strings(), " "),
-			AccessToken: access.Token,
+			AccessToken: value,
 		}
 
 	case "client_credentials":
+		if client.IsPublic() {
+			printOAuthError(w, data.OAuthUnauthorizedClient, "Public clients can not use client credentials", http.StatusBadRequest)
+			return
+		}
+
 		scope := util.NewStringSet(strings.Split(body.Scope, " ")...)
 		if scope.Len() == 0 || !client.ScopeWhitelist.IsSuperset(scope) {
-			PrintErrorJSON(w, r, "Invalid scope", http.StatusUnauthorized)
+			printOAuthError(w, data.OAuthInvalidScope, "Invalid scope", http.StatusBadRequest)
 			return
 		}
 
@@ -646,42 +848,204 @@ func Token(w http.ResponseWriter, r *http.Request) {
 			PrintErrorJSON(w, r, err, http.StatusInternalServerError)
 			return
 		}
+		value, err := access.Encode()
+		if err != nil {
+			PrintErrorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
 
 		response = &gin.TokenResponse{
 			TokenType:   "Bearer",
 			Scope:       strings.Join(scope.Strings(), " "),
-			AccessToken: access.Token,
+			AccessToken: value,
+		}
+
+	case data.DeviceCodeGrantType:
+		request, ok := data.GetGrantRequestByDeviceCode(body.DeviceCode)
+		if !ok {
+			if data.IsDeviceCodeExpired(body.DeviceCode) {
+				printOAuthError(w, data.OAuthExpiredToken, "The device code is expired", http.StatusBadRequest)
+			} else {
+				printOAuthError(w, data.OAuthInvalidGrant, "Invalid device code", http.StatusBadRequest)
+			}
+			return
+		}
+		if request.ClientUUID != client.UUID {
+			printOAuthError(w, data.OAuthInvalidGrant, "The device code was issued to another client", http.StatusBadRequest)
+			return
+		}
+		if request.IsDenied {
+			err = request.Delete()
+			if err != nil {
+				panic(err)
+			}
+			printOAuthError(w, data.OAuthAccessDenied, "The user denied the request", http.StatusBadRequest)
+			return
+		}
+
+		ok, err = request.Poll()
+		if err != nil {
+			panic(err)
+		}
+		if !ok {
+			printOAuthError(w, data.OAuthSlowDown, "The device polls too frequently", http.StatusBadRequest)
+			return
+		}
+		if request.IsPending() {
+			printOAuthError(w, data.OAuthAuthorizationPending, "The user has not yet approved the request", http.StatusBadRequest)
+			return
+		}
+
+		access, refresh, err := request.ExchangeCodeForTokens()
+		if err != nil {
+			printOAuthError(w, data.OAuthInvalidGrant, "The device code is invalid", http.StatusBadRequest)
+			return
+		}
+
+		if request.ScopeRequested.Contains("openid") {
+			idToken, err = request.CreateIDToken()
+			if err != nil {
+				PrintErrorJSON(w, r, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		accountUUID = request.AccountUUID.String
+		response = &gin.TokenResponse{
+			TokenType:    "Bearer",
+			Scope:        strings.Join(request.ScopeRequested.Strings(), " "),
+			AccessToken:  access,
+			RefreshToken: &refresh,
 		}
 
 	default:
-		PrintErrorJSON(w, r, fmt.Sprintf("Unsupported grant type %s", body.GrantType), http.StatusBadRequest)
+		printOAuthError(w, data.OAuthUnsupportedGrantType, fmt.Sprintf("Unsupported grant type %s", body.GrantType), http.StatusBadRequest)
 		return
 	}
+	recordAudit(r, data.AuditTokenIssued, accountUUID, accountUUID, client.UUID, body.GrantType)
 
 	w.Header().Add("Cache-Control", "no-cache")
 	w.Header().Add("Content-Type", "application/json")
 	enc := json.NewEncoder(w)
-	err = enc.Encode(response)
+	err = enc.Encode(&tokenResponse{TokenResponse: response, IDToken: idToken})
 	if err != nil {
 		panic(err)
 	}
 }
 
+// tokenLookupOrder returns the order in which token types are searched for a given
+// token type hint. The hint only determines the order, both types are always searched.
+// Returns false if the hint is not supported.
+func tokenLookupOrder(hint string) ([]string, bool) {
+	switch hint {
+	case "", "access_token":
+		return []string{"access_token", "refresh_token"}, true
+	case "refresh_token":
+		return []string{"refresh_token", "access_token"}, true
+	default:
+		return nil, false
+	}
+}
+
+// revokeReusedRefreshToken revokes the whole family of a rotated refresh token which was used again.
+// Such a reuse indicates that the token was stolen.
+func revokeReusedRefreshToken(r *http.Request, rotated *data.RefreshToken) {
+	conf.GetLogEnv().Err.Warnf("Reuse of rotated refresh token detected (client %s, account %s): "+
+		"revoking token family\n", rotated.ClientUUID, rotated.AccountUUID)
+	recordAudit(r, data.AuditTokenReuse, "", rotated.AccountUUID, rotated.ClientUUID, "refresh_token")
+
+	err := rotated.DeleteFamily()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Revoke revokes an access or refresh token as described in RFC 7009 "OAuth 2.0 Token Revocation".
+// The client has to authenticate itself in the same way as for the token endpoint. Revoking a refresh
+// token also revokes all access tokens that were issued in exchange for it.
+func Revoke(w http.ResponseWriter, r *http.Request) {
+	body := &struct {
+		Token         string
+		TokenTypeHint string
+		ClientId      string
+		ClientSecret  string
+	}{}
+	err := util.ReadFormIntoStruct(r, body, true)
+	if err != nil {
+		PrintErrorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	client, ok := authenticateClient(r, body.ClientId, body.ClientSecret)
+	if !ok {
+		PrintErrorJSON(w, r, "Wrong client id or client secret", http.StatusUnauthorized)
+		return
+	}
+
+	if body.Token == "" {
+		PrintErrorJSON(w, r, "Missing token", http.StatusBadRequest)
+		return
+	}
+
+	lookup, ok := tokenLookupOrder(body.TokenTypeHint)
+	if !ok {
+		PrintErrorJSON(w, r, fmt.Sprintf("Unsupported token type %s", body.TokenTypeHint), http.StatusBadRequest)
+		return
+	}
+
+	for _, tokenType := range lookup {
+		if tokenType == "access_token" {
+			if access, ok := data.FindAccessToken(body.Token); ok {
+				if access.ClientUUID != client.UUID {
+					PrintErrorJSON(w, r, "Token was issued to another client", http.StatusUnauthorized)
+					return
+				}
+				err = access.Delete()
+				if err != nil {
+					panic(err)
+				}
+				recordAudit(r, data.AuditTokenRevoked, access.AccountUUID.String, access.AccountUUID.String,
+					client.UUID, "access_token")
+				break
+			}
+		} else {
+			if refresh, ok := data.GetRefreshToken(body.Token); ok {
+				if refresh.ClientUUID != client.UUID {
+					PrintErrorJSON(w, r, "Token was issued to another client", http.StatusUnauthorized)
+					return
+				}
+				// rotated tokens of the same family and their access tokens are revoked as well
+				err = refresh.DeleteFamily()
+				if err != nil {
+					panic(err)
+				}
+				recordAudit(r, data.AuditTokenRevoked, refresh.AccountUUID, refresh.AccountUUID, client.UUID,
+					"refresh_token")
+				break
+			}
+		}
+	}
+
+	// Invalid or unknown tokens do not cause an error response (RFC 7009 section 2.2)
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
 // Validate validates a token and returns information about it as JSON
 func Validate(w http.ResponseWriter, r *http.Request) {
 	tokenStr := mux.Vars(r)["token"]
-	token, ok := data.GetAccessToken(tokenStr)
+	token, ok := data.FindAccessToken(tokenStr)
 	if !ok {
 		PrintErrorJSON(w, r, "The requested token does not exist", http.StatusNotFound)
 		return
 	}
 
-	var login, accountUrl *string
+	// Tokens issued with the client credentials grant are not associated with an account
+	var login, accountUrl string
 	if token.AccountUUID.Valid {
 		if account, ok := data.GetAccount(token.AccountUUID.String); ok {
-			login = &account.Login
-			accountUrl = new(string)
-			(*accountUrl) = conf.MakeUrl("/api/accounts/%s", account.Login)
+			login = account.Login
+			accountUrl = conf.MakeUrl("/api/accounts/%s", account.Login)
 		} else {
 			PrintErrorJSON(w, r, "Unable to find account associated with the request", http.StatusInternalServerError)
 			return
@@ -690,12 +1054,12 @@ func Validate(w http.ResponseWriter, r *http.Request) {
 
 	scope := strings.Join(token.Scope.Strings(), " ")
 	response := &gin.TokenInfo{
-		URL:        conf.MakeUrl("/oauth/validate/%s", token.Token),
-		JTI:        token.Token,
+		URL:        conf.MakeUrl("/oauth/validate/%s", tokenStr),
+		JTI:        token.JTI,
 		EXP:        token.Expires,
 		ISS:        "gin-auth",
-		Login:      *login,
-		AccountURL: *accountUrl,
+		Login:      login,
+		AccountURL: accountUrl,
 		Scope:      scope,
 	}
 
@@ -707,3 +1071,130 @@ func Validate(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 }
+
+// introspectionResponse is the response body of the token introspection endpoint
+// as defined in RFC 7662 section 2.2.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+}
+
+// Introspect returns information about an access or refresh token as described in RFC 7662
+// "OAuth 2.0 Token Introspection". The endpoint is intended for resource servers which have to
+// authenticate themselves with their client credentials. For unknown or expired tokens only
+// the parameter active is returned.
+func Introspect(w http.ResponseWriter, r *http.Request) {
+	body := &struct {
+		Token         string
+		TokenTypeHint string
+		ClientId      string
+		ClientSecret  string
+	}{}
+	err := util.ReadFormIntoStruct(r, body, true)
+	if err != nil {
+		PrintErrorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	// introspection is only available to confidential clients like resource servers
+	client, ok := authenticateClient(r, body.ClientId, body.ClientSecret)
+	if !ok || client.IsPublic() {
+		PrintErrorJSON(w, r, "Wrong client id or client secret", http.StatusUnauthorized)
+		return
+	}
+
+	if body.Token == "" {
+		PrintErrorJSON(w, r, "Missing token", http.StatusBadRequest)
+		return
+	}
+
+	lookup, ok := tokenLookupOrder(body.TokenTypeHint)
+	if !ok {
+		PrintErrorJSON(w, r, fmt.Sprintf("Unsupported token type %s", body.TokenTypeHint), http.StatusBadRequest)
+		return
+	}
+
+	var scope util.StringSet
+	var clientUUID, accountUUID string
+	response := &introspectionResponse{}
+	for _, tokenType := range lookup {
+		if tokenType == "access_token" {
+			if access, ok := data.FindAccessToken(body.Token); ok {
+				scope = access.Scope
+				clientUUID = access.ClientUUID
+				accountUUID = access.AccountUUID.String
+				response.Active = true
+				response.Exp = access.Expires.Unix()
+				response.Iat = access.CreatedAt.Unix()
+				response.TokenType = "Bearer"
+				break
+			}
+		} else {
+			// refresh tokens expire after their absolute life time or when they were not used within the idle time
+			if refresh, ok := data.GetRefreshToken(body.Token); ok && refresh.ExpiresAt().After(time.Now()) {
+				scope = refresh.Scope
+				clientUUID = refresh.ClientUUID
+				accountUUID = refresh.AccountUUID
+				response.Active = true
+				response.Exp = refresh.ExpiresAt().Unix()
+				response.Iat = refresh.CreatedAt.Unix()
+				response.TokenType = "refresh_token"
+				break
+			}
+		}
+	}
+
+	if response.Active {
+		response.Scope = strings.Join(scope.Strings(), " ")
+
+		client, ok := data.GetClient(clientUUID)
+		if !ok {
+			PrintErrorJSON(w, r, "Unable to find client associated with the token", http.StatusInternalServerError)
+			return
+		}
+		response.ClientId = client.Name
+
+		// Tokens issued with the client credentials grant are not associated with an account
+		if accountUUID != "" {
+			account, ok := data.GetAccount(accountUUID)
+			if !ok {
+				PrintErrorJSON(w, r, "Unable to find account associated with the token", http.StatusInternalServerError)
+				return
+			}
+			response.Username = account.Login
+			response.Sub = account.UUID
+		}
+	}
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// JWKS publishes the public key used to sign JWT access tokens as JSON Web Key Set (RFC 7517),
+// such that resource servers are able to verify access tokens without contacting gin-auth.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	response := &struct {
+		Keys []map[string]string `json:"keys"`
+	}{
+		Keys: []map[string]string{conf.GetSigningKey().PublicJWK()},
+	}
+
+	w.Header().Add("Cache-Control", "max-age=3600")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
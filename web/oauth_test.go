@@ -9,14 +9,18 @@
 package web
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/G-Node/gin-auth/conf"
 	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
 	"github.com/G-Node/gin-core/gin"
 	"github.com/gorilla/mux"
 )
@@ -126,8 +130,15 @@ func TestAuthorize(t *testing.T) {
 	request.URL.RawQuery = query.Encode()
 	response = httptest.NewRecorder()
 	handler.ServeHTTP(response, request)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	redirect, _ := url.Parse(response.Header().Get("Location"))
+	if redirect.Host != "localhost:8081" || redirect.Query().Get("error") != "unsupported_response_type" {
+		t.Errorf("Redirect with error 'unsupported_response_type' expected but was '%s'", redirect)
+	}
+	if redirect.Query().Get("state") != "testcode" {
+		t.Error("State expected")
 	}
 
 	// wrong scope
@@ -137,8 +148,12 @@ func TestAuthorize(t *testing.T) {
 	request.URL.RawQuery = query.Encode()
 	response = httptest.NewRecorder()
 	handler.ServeHTTP(response, request)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	redirect, _ = url.Parse(response.Header().Get("Location"))
+	if redirect.Query().Get("error") != "invalid_scope" {
+		t.Errorf("Redirect with error 'invalid_scope' expected but was '%s'", redirect)
 	}
 
 	// wrong client id
@@ -515,6 +530,67 @@ func TestApprove(t *testing.T) {
 	}
 }
 
+func TestApprovePartial(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	body := &url.Values{}
+	body.Add("request_id", "B4LIMIMB")
+	body.Add("scope", "repo-read")
+	request, _ := http.NewRequest("POST", "/oauth/approve", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	redirect, _ := url.Parse(response.Header().Get("Location"))
+	if redirect.Query().Get("code") == "" {
+		t.Error("Code not found")
+	}
+	if redirect.Query().Get("scope") != "repo-read" {
+		t.Errorf("Scope 'repo-read' expected but was '%s'", redirect.Query().Get("scope"))
+	}
+
+	grantRequest, ok := data.GetGrantRequest("B4LIMIMB")
+	if !ok {
+		t.Fatal("Grant request does not exist")
+	}
+	if grantRequest.ScopeRequested.Contains("repo-write") {
+		t.Error("Scope 'repo-write' should be removed from the request")
+	}
+}
+
+func TestApproveDeny(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	body := &url.Values{}
+	body.Add("request_id", "B4LIMIMB")
+	body.Add("scope", "repo-read")
+	body.Add("scope", "repo-write")
+	body.Add("deny", "true")
+	request, _ := http.NewRequest("POST", "/oauth/approve", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	redirect, _ := url.Parse(response.Header().Get("Location"))
+	if redirect.Query().Get("error") != "access_denied" {
+		t.Errorf("Error 'access_denied' expected but was '%s'", redirect.Query().Get("error"))
+	}
+	if redirect.Query().Get("state") != "6Y4UTL24" {
+		t.Errorf("State '6Y4UTL24' expected but was '%s'", redirect.Query().Get("state"))
+	}
+	if redirect.Query().Get("code") != "" {
+		t.Error("Code should not be present")
+	}
+
+	if _, ok := data.GetGrantRequest("B4LIMIMB"); ok {
+		t.Error("Grant request should be removed")
+	}
+}
+
 func TestTokenAuthorizationCode(t *testing.T) {
 	const codeAlice = "HGZQP6WE"
 
@@ -556,8 +632,8 @@ func TestTokenAuthorizationCode(t *testing.T) {
 	request.SetBasicAuth("gin", "secret")
 	response = httptest.NewRecorder()
 	handler.ServeHTTP(response, request)
-	if response.Code != http.StatusUnauthorized {
-		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
 	}
 
 	// all OK (with authorization header)
@@ -594,8 +670,8 @@ func TestTokenAuthorizationCode(t *testing.T) {
 	request.SetBasicAuth("gin", "secret")
 	response = httptest.NewRecorder()
 	handler.ServeHTTP(response, request)
-	if response.Code != http.StatusUnauthorized {
-		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
 	}
 
 	// all OK (with client credentials in body)
@@ -628,6 +704,110 @@ func TestTokenAuthorizationCode(t *testing.T) {
 	}
 }
 
+func TestTokenAuthorizationCodePKCE(t *testing.T) {
+	const verifier = "dBjftJeZ4CVP-mJ92K9RbE2GkXB7X4cUTlnE8mYVbtrk"
+	const challenge = "cfJ6pHaJqoo2OhoajaK2YC2F4X8CRi6_h-ECLXsDzhg"
+
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func() string {
+		code := util.RandomToken()
+		request := &data.GrantRequest{
+			GrantType:           "code",
+			State:               util.RandomToken(),
+			Code:                sql.NullString{String: code, Valid: true},
+			ScopeRequested:      util.NewStringSet("repo-read"),
+			RedirectURI:         "https://localhost:8081/login",
+			ClientUUID:          "8b14d6bb-cae7-4163-bbd1-f3be46e43e31",
+			AccountUUID:         sql.NullString{String: "bf431618-f696-4dca-a95d-882618ce4ef9", Valid: true},
+			CodeChallenge:       sql.NullString{String: challenge, Valid: true},
+			CodeChallengeMethod: sql.NullString{String: "S256", Valid: true},
+		}
+		err := request.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	mkBody := func(code, verifier string) *url.Values {
+		body := &url.Values{}
+		body.Add("code", code)
+		body.Add("grant_type", "authorization_code")
+		if verifier != "" {
+			body.Add("code_verifier", verifier)
+		}
+		return body
+	}
+
+	// missing code verifier
+	code := mkRequest()
+	body := mkBody(code, "")
+	request, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// code must not be usable after a failed verification
+	body = mkBody(code, verifier)
+	request, _ = http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// wrong code verifier
+	code = mkRequest()
+	body = mkBody(code, strings.Replace(verifier, "d", "e", 1))
+	request, _ = http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// all OK
+	code = mkRequest()
+	body = mkBody(code, verifier)
+	request, _ = http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+
+	responseBody := &gin.TokenResponse{}
+	err := json.Unmarshal(response.Body.Bytes(), responseBody)
+	if err != nil {
+		t.Errorf("Error unmarshaling response: %v\n", err)
+	}
+	if responseBody.AccessToken == "" {
+		t.Error("No access token received")
+	}
+
+	// code verifier for a request without code challenge
+	body = mkBody("HGZQP6WE", verifier)
+	request, _ = http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+}
+
 func TestTokenRefreshToken(t *testing.T) {
 	const refreshTokenAlice = "YYPTDSVZ"
 
@@ -669,8 +849,8 @@ func TestTokenRefreshToken(t *testing.T) {
 	request.SetBasicAuth("gin", "secret")
 	response = httptest.NewRecorder()
 	handler.ServeHTTP(response, request)
-	if response.Code != http.StatusUnauthorized {
-		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
 	}
 
 	// all OK (with authorization header)
@@ -721,6 +901,73 @@ func TestTokenRefreshToken(t *testing.T) {
 	}
 }
 
+func TestTokenRefreshTokenRotation(t *testing.T) {
+	conf.GetServerConfig().RefreshTokenRotation = true
+	defer func() { conf.GetServerConfig().RefreshTokenRotation = false }()
+
+	refresh := func(handler http.Handler, refreshToken string) (*httptest.ResponseRecorder, *gin.TokenResponse) {
+		body := &url.Values{}
+		body.Add("refresh_token", refreshToken)
+		body.Add("grant_type", "refresh_token")
+		request, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth("gin", "secret")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		responseBody := &gin.TokenResponse{}
+		if response.Code == http.StatusOK {
+			err := json.Unmarshal(response.Body.Bytes(), responseBody)
+			if err != nil {
+				t.Errorf("Error unmarshaling response: %v\n", err)
+			}
+		}
+		return response, responseBody
+	}
+
+	handler := InitTestHttpHandler(t)
+
+	// use refresh token
+	response, responseBody := refresh(handler, "YYPTDSVZ")
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if responseBody.RefreshToken == nil || *responseBody.RefreshToken == "YYPTDSVZ" {
+		t.Fatal("New refresh token expected")
+	}
+	rotated := *responseBody.RefreshToken
+
+	// use new refresh token
+	response, responseBody = refresh(handler, rotated)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	current := *responseBody.RefreshToken
+	access := responseBody.AccessToken
+
+	// reuse of an old refresh token revokes the family
+	response, _ = refresh(handler, "YYPTDSVZ")
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+	if _, ok := data.GetRefreshToken(current); ok {
+		t.Error("Current refresh token of the family should be revoked")
+	}
+	if _, ok := data.GetAccessToken(access); ok {
+		t.Error("Access tokens of the family should be revoked")
+	}
+	events := data.ListAuditEvents(&data.AuditFilter{Type: data.AuditTokenReuse, TargetUUID: uuidAlice})
+	if len(events) != 1 {
+		t.Errorf("One '%s' event expected but was %d", data.AuditTokenReuse, len(events))
+	}
+
+	// other families are not affected
+	response, _ = refresh(handler, "4FKJVX3K")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+}
+
 func TestTokenPassword(t *testing.T) {
 	mkBody := func(username, password, scope string) *url.Values {
 		body := &url.Values{}
@@ -762,8 +1009,8 @@ func TestTokenPassword(t *testing.T) {
 	request.SetBasicAuth("wb", "secret")
 	response = httptest.NewRecorder()
 	handler.ServeHTTP(response, request)
-	if response.Code != http.StatusUnauthorized {
-		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
 	}
 
 	// wrong password
@@ -773,8 +1020,8 @@ func TestTokenPassword(t *testing.T) {
 	request.SetBasicAuth("wb", "secret")
 	response = httptest.NewRecorder()
 	handler.ServeHTTP(response, request)
-	if response.Code != http.StatusUnauthorized {
-		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
 	}
 
 	// wrong scope
@@ -784,8 +1031,8 @@ func TestTokenPassword(t *testing.T) {
 	request.SetBasicAuth("wb", "secret")
 	response = httptest.NewRecorder()
 	handler.ServeHTTP(response, request)
-	if response.Code != http.StatusUnauthorized {
-		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
 	}
 
 	// all OK (with authorization header)
@@ -873,8 +1120,8 @@ func TestTokenClientCredentials(t *testing.T) {
 	request.SetBasicAuth("wb", "secret")
 	response = httptest.NewRecorder()
 	handler.ServeHTTP(response, request)
-	if response.Code != http.StatusUnauthorized {
-		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
 	}
 
 	// all OK (with authorization header)
@@ -923,6 +1170,386 @@ func TestTokenClientCredentials(t *testing.T) {
 	}
 }
 
+func TestRevoke(t *testing.T) {
+	mkBody := func(token, hint string) *url.Values {
+		body := &url.Values{}
+		body.Add("token", token)
+		if hint != "" {
+			body.Add("token_type_hint", hint)
+		}
+		return body
+	}
+
+	handler := InitTestHttpHandler(t)
+
+	// wrong client secret
+	body := mkBody("3N7MP7M7", "")
+	request, _ := http.NewRequest("POST", "/oauth/revoke", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "wrongsecret")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// missing token
+	body = mkBody("", "")
+	request, _ = http.NewRequest("POST", "/oauth/revoke", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// unsupported token type hint
+	body = mkBody("3N7MP7M7", "id_token")
+	request, _ = http.NewRequest("POST", "/oauth/revoke", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// token issued to another client
+	body = mkBody("3N7MP7M7", "")
+	request, _ = http.NewRequest("POST", "/oauth/revoke", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("wb", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+	if _, ok := data.GetAccessToken("3N7MP7M7"); !ok {
+		t.Error("Access token should still exist")
+	}
+
+	// unknown token
+	body = mkBody("doesnotexist", "")
+	request, _ = http.NewRequest("POST", "/oauth/revoke", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+
+	// revoke access token (with client credentials in body)
+	body = mkBody("3N7MP7M7", "access_token")
+	body.Add("client_id", "gin")
+	body.Add("client_secret", "secret")
+	request, _ = http.NewRequest("POST", "/oauth/revoke", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetAccessToken("3N7MP7M7"); ok {
+		t.Error("Access token should not exist")
+	}
+
+	// revoke refresh token with wrong hint
+	body = mkBody("YYPTDSVZ", "access_token")
+	request, _ = http.NewRequest("POST", "/oauth/revoke", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetRefreshToken("YYPTDSVZ"); ok {
+		t.Error("Refresh token should not exist")
+	}
+
+	// revoke rotated refresh token, access tokens of the whole family are revoked
+	refresh, ok := data.GetRefreshToken("4FKJVX3K")
+	if !ok {
+		t.Fatal("Refresh token does not exist")
+	}
+	access := &data.AccessToken{
+		Token:        "TNKD4ZVE",
+		Scope:        refresh.Scope,
+		ClientUUID:   refresh.ClientUUID,
+		AccountUUID:  sql.NullString{String: refresh.AccountUUID, Valid: true},
+		RefreshToken: sql.NullString{String: refresh.Token, Valid: true},
+	}
+	err := access.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := refresh.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body = mkBody(fresh.Token, "refresh_token")
+	request, _ = http.NewRequest("POST", "/oauth/revoke", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetRotatedRefreshToken("4FKJVX3K"); ok {
+		t.Error("Rotated refresh token should not exist")
+	}
+	if _, ok := data.GetAccessToken("TNKD4ZVE"); ok {
+		t.Error("Access token of the rotated refresh token should not exist")
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	mkBody := func(token, hint string) *url.Values {
+		body := &url.Values{}
+		body.Add("token", token)
+		if hint != "" {
+			body.Add("token_type_hint", hint)
+		}
+		return body
+	}
+
+	introspect := func(handler http.Handler, body *url.Values) (*httptest.ResponseRecorder, map[string]interface{}) {
+		request, _ := http.NewRequest("POST", "/oauth/introspect", strings.NewReader(body.Encode()))
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth("wb", "secret")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		result := make(map[string]interface{})
+		if response.Code == http.StatusOK {
+			err := json.Unmarshal(response.Body.Bytes(), &result)
+			if err != nil {
+				t.Errorf("Error unmarshaling response: %v\n", err)
+			}
+		}
+		return response, result
+	}
+
+	handler := InitTestHttpHandler(t)
+
+	// wrong client secret
+	body := mkBody("3N7MP7M7", "")
+	request, _ := http.NewRequest("POST", "/oauth/introspect", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("wb", "wrongsecret")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// public client
+	public := &data.Client{Name: "public-app", RedirectURIs: util.NewStringSet("http://localhost:9000/callback")}
+	err := public.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Add("client_id", "public-app")
+	request, _ = http.NewRequest("POST", "/oauth/introspect", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected for a public client but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// missing token
+	response, _ = introspect(handler, mkBody("", ""))
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// unsupported token type hint
+	response, _ = introspect(handler, mkBody("3N7MP7M7", "id_token"))
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	// expired token
+	response, result := introspect(handler, mkBody("LJ3W7ZFK", ""))
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if result["active"] != false {
+		t.Error("Expired token should not be active")
+	}
+	if _, ok := result["scope"]; ok {
+		t.Error("Inactive token should not have a scope")
+	}
+
+	// valid access token
+	response, result = introspect(handler, mkBody("3N7MP7M7", ""))
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if result["active"] != true {
+		t.Error("Token should be active")
+	}
+	if result["client_id"] != "gin" {
+		t.Errorf("Client id 'gin' expected but was '%v'", result["client_id"])
+	}
+	if result["username"] != "alice" {
+		t.Errorf("Username 'alice' expected but was '%v'", result["username"])
+	}
+	if result["sub"] != "bf431618-f696-4dca-a95d-882618ce4ef9" {
+		t.Errorf("Unexpected sub '%v'", result["sub"])
+	}
+	if result["token_type"] != "Bearer" {
+		t.Errorf("Token type 'Bearer' expected but was '%v'", result["token_type"])
+	}
+	if _, ok := result["exp"]; !ok {
+		t.Error("Access token should have an expiration time")
+	}
+
+	// valid refresh token
+	response, result = introspect(handler, mkBody("YYPTDSVZ", "refresh_token"))
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if result["active"] != true {
+		t.Error("Token should be active")
+	}
+	if result["token_type"] != "refresh_token" {
+		t.Errorf("Token type 'refresh_token' expected but was '%v'", result["token_type"])
+	}
+	if result["scope"] != "repo-read repo-write" {
+		t.Errorf("Unexpected scope '%v'", result["scope"])
+	}
+	if exp, ok := result["exp"].(float64); !ok || int64(exp) <= time.Now().Unix() {
+		t.Errorf("Refresh token should have an expiration time but was '%v'", result["exp"])
+	}
+
+	// client only token
+	client, _ := data.GetClientByName("gin")
+	access := &data.AccessToken{
+		Token:      "W2JXXDQF",
+		Scope:      util.NewStringSet("repo-read"),
+		ClientUUID: client.UUID,
+	}
+	err = access.Create()
+	if err != nil {
+		t.Error(err)
+	}
+
+	response, result = introspect(handler, mkBody("W2JXXDQF", ""))
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if result["active"] != true {
+		t.Error("Token should be active")
+	}
+	if _, ok := result["username"]; ok {
+		t.Error("Client only token should not have a username")
+	}
+	if _, ok := result["sub"]; ok {
+		t.Error("Client only token should not have a sub")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	request, _ := http.NewRequest("GET", "/.well-known/jwks.json", strings.NewReader(""))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+
+	result := &struct {
+		Keys []map[string]string
+	}{}
+	err := json.Unmarshal(response.Body.Bytes(), result)
+	if err != nil {
+		t.Errorf("Error unmarshaling response: %v\n", err)
+	}
+	if len(result.Keys) != 1 {
+		t.Fatalf("Exactly one key expected but was %d", len(result.Keys))
+	}
+	if result.Keys[0]["kid"] != conf.GetSigningKey().KeyID {
+		t.Error("Key ID does not match the signing key")
+	}
+	if _, ok := result.Keys[0]["d"]; ok {
+		t.Error("Private key parameters must not be published")
+	}
+}
+
+func TestJWTAccessToken(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	// client wb issues JWT access tokens
+	body := &url.Values{}
+	body.Add("grant_type", "password")
+	body.Add("username", "alice")
+	body.Add("password", "testtest")
+	body.Add("scope", "account-read")
+	request, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("wb", "secret")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+
+	token := &gin.TokenResponse{}
+	err := json.Unmarshal(response.Body.Bytes(), token)
+	if err != nil {
+		t.Errorf("Error unmarshaling response: %v\n", err)
+	}
+
+	claims := &data.AccessTokenClaims{}
+	key := conf.GetSigningKey()
+	err = util.VerifyJWT(token.AccessToken, key.Algorithm, key.Key.Public(), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "bf431618-f696-4dca-a95d-882618ce4ef9" {
+		t.Errorf("Unexpected subject '%s'", claims.Subject)
+	}
+	if claims.ClientID != "wb" {
+		t.Errorf("Client id 'wb' expected but was '%s'", claims.ClientID)
+	}
+	if claims.Scope != "account-read" {
+		t.Errorf("Scope 'account-read' expected but was '%s'", claims.Scope)
+	}
+
+	// the JWT is accepted as bearer token
+	request, _ = http.NewRequest("GET", "/api/accounts/alice/keys", strings.NewReader(""))
+	request.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+
+	// a revoked JWT is not accepted
+	access, ok := data.FindAccessToken(token.AccessToken)
+	if !ok {
+		t.Fatal("Access token does not exist")
+	}
+	err = access.Delete()
+	if err != nil {
+		t.Error(err)
+	}
+	request, _ = http.NewRequest("GET", "/api/accounts/alice/keys", strings.NewReader(""))
+	request.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+}
+
 func TestValidate(t *testing.T) {
 	handler := InitTestHttpHandler(t)
 
@@ -955,8 +1582,8 @@ func TestValidate(t *testing.T) {
 	if err != nil {
 		t.Errorf("Error unmarshaling response: %v\n", err)
 	}
-	if result.JTI != "3N7MP7M7" {
-		t.Errorf("JTI expected to be '3N7MP7M7' but was '%s'", result.JTI)
+	if result.JTI != "JT3N7MP7" {
+		t.Errorf("JTI expected to be 'JT3N7MP7' but was '%s'", result.JTI)
 	}
 	if result.ISS != "gin-auth" {
 		t.Errorf("ISS expected to be 'gin-auth' but was '%s'", result.ISS)
@@ -965,3 +1592,53 @@ func TestValidate(t *testing.T) {
 		t.Errorf("Login expected to be 'alice' but was '%s'", result.Login)
 	}
 }
+
+func TestTokenGrantTypeNotAllowed(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	client, ok := data.GetClientByName("wb")
+	if !ok {
+		t.Fatal("Client does not exist")
+	}
+	client.GrantTypes = util.NewStringSet("authorization_code", "refresh_token")
+	err := client.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, grantType := range []string{"password", "client_credentials"} {
+		body := &url.Values{}
+		body.Add("grant_type", grantType)
+		body.Add("scope", "account-read")
+		body.Add("username", "alice")
+		body.Add("password", "testtest")
+		request, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth("wb", "secret")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+		}
+	}
+
+	// interactive flows are rejected as well
+	client.GrantTypes = util.NewStringSet("client_credentials")
+	err = client.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := &url.Values{}
+	query.Add("response_type", "code")
+	query.Add("client_id", "wb")
+	query.Add("redirect_uri", "https://localhost:8081/login")
+	query.Add("state", "OCQYDRYW")
+	query.Add("scope", "repo-read")
+	query.Add("code_challenge", "cfJ6pHaJqoo2OhoajaK2YC2F4X8CRi6_h-ECLXsDzhg")
+	request, _ := http.NewRequest("GET", "/oauth/authorize?"+query.Encode(), nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+)
+
+// UserInfo returns the standard OpenID Connect claims about the account associated with
+// the access token. E-mail and affiliation are only present if they are public or if the
+// token grants read access to the account data.
+func UserInfo(w http.ResponseWriter, r *http.Request) {
+	oauth, ok := OAuthToken(r)
+	if !ok {
+		panic("Request was authorized but no OAuth token is available!") // this should never happen
+	}
+
+	if !oauth.Token.AccountUUID.Valid {
+		PrintErrorJSON(w, r, "The token is not associated with an account", http.StatusUnauthorized)
+		return
+	}
+
+	account, ok := data.GetAccount(oauth.Token.AccountUUID.String)
+	if !ok {
+		PrintErrorJSON(w, r, "Unable to find account associated with the request", http.StatusInternalServerError)
+		return
+	}
+
+	canRead := oauth.Token.Scope.Contains("account-read")
+	marshal := &data.AccountMarshaler{
+		WithMail:        account.IsEmailPublic || canRead,
+		WithAffiliation: account.IsAffiliationPublic || canRead,
+		Account:         account,
+	}
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(marshal.UserInfo())
+	if err != nil {
+		panic(err)
+	}
+}
+
+// OpenIDConfiguration returns the OpenID Connect discovery document, which describes
+// the endpoints and capabilities of gin-auth as OpenID provider.
+func OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	response := &struct {
+		Issuer                            string   `json:"issuer"`
+		AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+		TokenEndpoint                     string   `json:"token_endpoint"`
+		UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+		JwksURI                           string   `json:"jwks_uri"`
+		RevocationEndpoint                string   `json:"revocation_endpoint"`
+		IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+		DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+		ScopesSupported                   []string `json:"scopes_supported"`
+		ResponseTypesSupported            []string `json:"response_types_supported"`
+		GrantTypesSupported               []string `json:"grant_types_supported"`
+		SubjectTypesSupported             []string `json:"subject_types_supported"`
+		IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+		TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+		CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+		ClaimsSupported                   []string `json:"claims_supported"`
+	}{
+		Issuer:                            conf.GetServerConfig().BaseURL,
+		AuthorizationEndpoint:             conf.MakeUrl("/oauth/authorize"),
+		TokenEndpoint:                     conf.MakeUrl("/oauth/token"),
+		UserInfoEndpoint:                  conf.MakeUrl("/oauth/userinfo"),
+		JwksURI:                           conf.MakeUrl("/.well-known/jwks.json"),
+		RevocationEndpoint:                conf.MakeUrl("/oauth/revoke"),
+		IntrospectionEndpoint:             conf.MakeUrl("/oauth/introspect"),
+		DeviceAuthorizationEndpoint:       conf.MakeUrl("/oauth/device_authorization"),
+		ScopesSupported:                   []string{"openid"},
+		ResponseTypesSupported:            []string{"code", "token"},
+		GrantTypesSupported:               data.GrantTypes.Strings(),
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{conf.GetSigningKey().Algorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256", "plain"},
+		ClaimsSupported: []string{"sub", "iss", "aud", "exp", "iat", "nonce", "preferred_username", "name",
+			"given_name", "middle_name", "family_name", "profile", "email", "email_verified", "address", "updated_at"},
+	}
+
+	w.Header().Add("Cache-Control", "max-age=3600")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+)
+
+const uuidAlice = "bf431618-f696-4dca-a95d-882618ce4ef9"
+
+func TestTokenAuthorizationCodeOpenID(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	client, _ := data.GetClientByName("gin")
+	err := client.Approve(uuidAlice, util.NewStringSet("openid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := util.RandomToken()
+	grant := &data.GrantRequest{
+		GrantType:      "code",
+		State:          util.RandomToken(),
+		Code:           sql.NullString{String: code, Valid: true},
+		ScopeRequested: util.NewStringSet("openid", "repo-read"),
+		RedirectURI:    "https://localhost:8081/login",
+		ClientUUID:     client.UUID,
+		AccountUUID:    sql.NullString{String: uuidAlice, Valid: true},
+		Nonce:          sql.NullString{String: "n-0S6_WzA2Mj", Valid: true},
+	}
+	err = grant.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := &url.Values{}
+	body.Add("code", code)
+	body.Add("grant_type", "authorization_code")
+	request, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+
+	result := &struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}{}
+	err = json.Unmarshal(response.Body.Bytes(), result)
+	if err != nil {
+		t.Errorf("Error unmarshaling response: %v\n", err)
+	}
+	if result.AccessToken == "" {
+		t.Error("No access token received")
+	}
+
+	claims := &data.IDTokenClaims{}
+	key := conf.GetSigningKey()
+	err = util.VerifyJWT(result.IDToken, key.Algorithm, key.Key.Public(), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != uuidAlice || claims.Audience != "gin" || claims.Nonce != "n-0S6_WzA2Mj" {
+		t.Errorf("Unexpected id token claims: %v", claims)
+	}
+
+	// no id token without openid scope
+	body = &url.Values{}
+	body.Add("code", "HGZQP6WE")
+	body.Add("grant_type", "authorization_code")
+	request, _ = http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("gin", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if strings.Contains(response.Body.String(), "id_token") {
+		t.Error("Id token not expected without scope 'openid'")
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkToken := func(scope ...string) string {
+		token := &data.AccessToken{
+			Scope:       util.NewStringSet(scope...),
+			ClientUUID:  "8b14d6bb-cae7-4163-bbd1-f3be46e43e31",
+			AccountUUID: sql.NullString{String: uuidAlice, Valid: true},
+		}
+		err := token.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token.Token
+	}
+
+	userInfo := func(token string) (*httptest.ResponseRecorder, *data.UserInfo) {
+		request, _ := http.NewRequest("GET", "/oauth/userinfo", strings.NewReader(""))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		info := &data.UserInfo{}
+		if response.Code == http.StatusOK {
+			err := json.Unmarshal(response.Body.Bytes(), info)
+			if err != nil {
+				t.Errorf("Error unmarshaling response: %v\n", err)
+			}
+		}
+		return response, info
+	}
+
+	// token without scope openid
+	response, _ := userInfo(accessTokenAlice)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// e-mail and affiliation of alice are not public
+	response, info := userInfo(mkToken("openid"))
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if info.Subject != uuidAlice || info.PreferredUsername != "alice" {
+		t.Errorf("Unexpected user info: %v", info)
+	}
+	if info.Email != "" || info.Address != nil {
+		t.Error("Email and affiliation not expected to be present")
+	}
+
+	// read access to account data
+	response, info = userInfo(mkToken("openid", "account-read"))
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if info.Email != "aclic@foo.com" {
+		t.Errorf("Email 'aclic@foo.com' expected but was '%s'", info.Email)
+	}
+	if info.Address == nil || info.Address.Locality != "Munich" {
+		t.Error("Affiliation expected to be present")
+	}
+}
+
+func TestOpenIDConfiguration(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	request, _ := http.NewRequest("GET", "/.well-known/openid-configuration", strings.NewReader(""))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+
+	result := make(map[string]interface{})
+	err := json.Unmarshal(response.Body.Bytes(), &result)
+	if err != nil {
+		t.Errorf("Error unmarshaling response: %v\n", err)
+	}
+	if result["issuer"] != conf.GetServerConfig().BaseURL {
+		t.Errorf("Unexpected issuer '%v'", result["issuer"])
+	}
+	if result["userinfo_endpoint"] != conf.MakeUrl("/oauth/userinfo") {
+		t.Errorf("Unexpected userinfo endpoint '%v'", result["userinfo_endpoint"])
+	}
+	if result["jwks_uri"] != conf.MakeUrl("/.well-known/jwks.json") {
+		t.Errorf("Unexpected jwks uri '%v'", result["jwks_uri"])
+	}
+	methods, _ := result["token_endpoint_auth_methods_supported"].([]interface{})
+	if len(methods) != 3 || methods[2] != "none" {
+		t.Errorf("Unexpected token endpoint auth methods '%v'", methods)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/G-Node/gin-auth/data"
+	"github.com/gorilla/mux"
+)
+
+const tooManyAttempts = "Too many attempts, please try again later"
+
+// clientIP returns the IP address of the client that sent the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// setRetryAfter sets the Retry-After header of a throttled response in whole seconds.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	seconds := int64((wait + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+// throttleHTML checks the rate limit of an action and shows an error page with status
+// 429 / Too Many Requests if the limit is exceeded. Returns false in this case.
+func throttleHTML(w http.ResponseWriter, r *http.Request, action, subject string) bool {
+	wait, ok := data.CheckRateLimit(action, clientIP(r), subject)
+	if !ok {
+		setRetryAfter(w, wait)
+		PrintErrorHTML(w, r, tooManyAttempts, http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// throttleJSON checks the rate limit of an action and writes a JSON error with status
+// 429 / Too Many Requests if the limit is exceeded. Returns false in this case.
+func throttleJSON(w http.ResponseWriter, r *http.Request, action, subject string) bool {
+	wait, ok := data.CheckRateLimit(action, clientIP(r), subject)
+	if !ok {
+		setRetryAfter(w, wait)
+		PrintErrorJSON(w, r, tooManyAttempts, http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// throttleOAuth checks the rate limit of an action at the token endpoint and writes an OAuth
+// error response with status 429 / Too Many Requests if the limit is exceeded. Returns false in this case.
+func throttleOAuth(w http.ResponseWriter, r *http.Request, action, subject string) bool {
+	wait, ok := data.CheckRateLimit(action, clientIP(r), subject)
+	if !ok {
+		setRetryAfter(w, wait)
+		printOAuthError(w, data.OAuthInvalidGrant, tooManyAttempts, http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// ListAccountLockouts returns all recorded lockouts of an account as JSON.
+// Requires the scope 'account-admin'.
+func ListAccountLockouts(w http.ResponseWriter, r *http.Request) {
+	account, ok := data.GetAccountByLogin(mux.Vars(r)["login"])
+	if !ok {
+		PrintErrorJSON(w, r, "The requested account does not exist", http.StatusNotFound)
+		return
+	}
+
+	lockouts := data.ListAccountLockouts(account.UUID)
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(lockouts)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// UnlockAccount removes an active lockout of an account and resets its failed logins.
+// Requires the scope 'account-admin'. Returns StatusOK and an empty body on success.
+func UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	oauth, ok := OAuthToken(r)
+	if !ok {
+		panic("Request was authorized but no OAuth token is available!") // this should never happen
+	}
+
+	account, ok := data.GetAccountByLogin(mux.Vars(r)["login"])
+	if !ok {
+		PrintErrorJSON(w, r, "The requested account does not exist", http.StatusNotFound)
+		return
+	}
+
+	admin, ok := data.GetAccount(oauth.Token.AccountUUID.String)
+	if !ok {
+		PrintErrorJSON(w, r, "Access to requested account forbidden", http.StatusUnauthorized)
+		return
+	}
+
+	err := account.Unlock(admin.Login)
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditAdmin, account.UUID, "unlock account")
+}
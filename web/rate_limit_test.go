@@ -0,0 +1,133 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+)
+
+func TestLoginRateLimit(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	config := conf.GetRateLimitConfig()
+	previous := *config
+	defer func() { *config = previous }()
+	config.DelayAfterFailures = 2
+	config.MaxDelay = time.Minute
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body := &url.Values{}
+		body.Add("request_id", "B4LIMIMB")
+		body.Add("login", "bob")
+		body.Add("password", password)
+		request, _ := http.NewRequest("POST", "/oauth/login", strings.NewReader(body.Encode()))
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	for i := 0; i < 2; i++ {
+		response := login("wrong")
+		if response.Code != http.StatusFound {
+			t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+		}
+	}
+
+	// even the correct password is throttled
+	response := login("testtest")
+	if response.Code != http.StatusTooManyRequests {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusTooManyRequests, response.Code)
+	}
+	if seconds, err := strconv.Atoi(response.Header().Get("Retry-After")); err != nil || seconds < 1 {
+		t.Errorf("Invalid Retry-After header '%s'", response.Header().Get("Retry-After"))
+	}
+
+	// password grant
+	body := &url.Values{}
+	body.Add("grant_type", "password")
+	body.Add("username", "bob")
+	body.Add("password", "testtest")
+	body.Add("scope", "account-read")
+	request, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("wb", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusTooManyRequests {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusTooManyRequests, response.Code)
+	}
+	if response.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header expected")
+	}
+	oauthErr := map[string]string{}
+	_ = json.NewDecoder(response.Body).Decode(&oauthErr)
+	if oauthErr["error"] != data.OAuthInvalidGrant {
+		t.Errorf("OAuth error '%s' expected but was '%s'", data.OAuthInvalidGrant, oauthErr["error"])
+	}
+}
+
+func TestAccountLockoutAPI(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	config := conf.GetRateLimitConfig()
+	previous := *config
+	defer func() { *config = previous }()
+	config.MaxFailuresPerAccount = 2
+	config.DelayAfterFailures = 100
+
+	for i := 0; i < 2; i++ {
+		data.RecordRateLimitEvent(data.RateLimitLogin, "192.0.2.1", uuidAlice)
+	}
+	if _, ok := data.GetActiveLockout(uuidAlice); !ok {
+		t.Fatal("Account expected to be locked")
+	}
+
+	mkRequest := func(method, token string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "/api/accounts/alice/lockouts", strings.NewReader(""))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	// admin scope required
+	response := mkRequest("DELETE", accessTokenAlice)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	response = mkRequest("GET", accessTokenAliceAdmin)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	lockouts := []map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&lockouts)
+	if len(lockouts) != 1 || lockouts[0]["active"] != true {
+		t.Errorf("One active lockout expected: %v", lockouts)
+	}
+
+	response = mkRequest("DELETE", accessTokenAliceAdmin)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetActiveLockout(uuidAlice); ok {
+		t.Error("Account expected to be unlocked")
+	}
+}
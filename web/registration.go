@@ -183,6 +183,9 @@ func (rh *registration) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	valAccount.Account.ActivationCode = sql.NullString{String: util.RandomToken(), Valid: true}
+	if valAccount.Account.Language == "" {
+		valAccount.Account.Language = util.EmailLanguage(r.Header.Get("Accept-Language"))
+	}
 
 	err = account.Create()
 	if err != nil {
@@ -194,22 +197,7 @@ func (rh *registration) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmplFields := &struct {
-		From    string
-		To      string
-		Subject string
-		BaseUrl string
-		Code    string
-	}{}
-	tmplFields.From = conf.GetSmtpCredentials().From
-	tmplFields.To = account.Email
-	tmplFields.Subject = "GIN account activation"
-	tmplFields.BaseUrl = conf.GetServerConfig().BaseURL
-	tmplFields.Code = account.ActivationCode.String
-
-	content := util.MakeEmailTemplate("emailactivate.txt", tmplFields)
-	email := &data.Email{}
-	err = email.Create(util.NewStringSet(account.Email), content.Bytes())
+	err = sendActivationEmail(account)
 	if err != nil {
 		msg := "An error occurred trying to send registration e-mail. Please contact an administrator."
 		PrintErrorHTML(w, r, msg, http.StatusInternalServerError)
@@ -321,3 +309,18 @@ func Activation(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 }
+
+// sendActivationEmail queues an e-mail with the activation link of an account. The plain
+// activation code has to be available via ActivationCode.
+func sendActivationEmail(account *data.Account) error {
+	tmplFields := &struct {
+		BaseUrl string
+		Code    string
+	}{}
+	tmplFields.BaseUrl = conf.GetServerConfig().BaseURL
+	tmplFields.Code = account.ActivationCode.String
+
+	content := util.MakeEmail(account.Language, "activate", []string{account.Email}, tmplFields)
+	email := &data.Email{}
+	return email.Create(util.NewStringSet(account.Email), content)
+}
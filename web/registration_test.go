@@ -302,9 +302,8 @@ func TestActivation(t *testing.T) {
 	if !exists {
 		t.Errorf("Error on fetching account by activation code '%s'", activationCode)
 	}
-	if account.ActivationCode.String != activationCode {
-		t.Errorf("Expected activation code to be '%s' but got '%s'",
-			activationCode, account.ActivationCode.String)
+	if !account.ActivationCode.Valid {
+		t.Error("Expected activation code to be set")
 	}
 	accountLogin := account.Login
 
@@ -65,7 +65,13 @@ func ResetInit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	account, ok := data.SetPasswordReset(credData.Credential)
+	// reset requests are limited per IP and per login or e-mail address, since each one sends an e-mail
+	if !throttleHTML(w, r, data.RateLimitReset, credData.Credential) {
+		return
+	}
+	data.RecordRateLimitEvent(data.RateLimitReset, clientIP(r), credData.Credential)
+
+	account, reset, ok := data.SetPasswordReset(credData.Credential)
 	if !ok {
 		credData.ErrMessage = "Invalid login or e-mail address"
 		tmpl := conf.MakeTemplate("resetinit.html")
@@ -77,22 +83,7 @@ func ResetInit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmplFields := &struct {
-		From    string
-		To      string
-		Subject string
-		BaseUrl string
-		Code    string
-	}{}
-	tmplFields.From = conf.GetSmtpCredentials().From
-	tmplFields.To = account.Email
-	tmplFields.Subject = "Your GIN Account Password Reset Request"
-	tmplFields.BaseUrl = conf.GetServerConfig().BaseURL
-	tmplFields.Code = account.ResetPWCode.String
-
-	content := util.MakeEmailTemplate("emailreset.txt", tmplFields)
-	email := &data.Email{}
-	err = email.Create(util.NewStringSet(account.Email), content.Bytes())
+	err = sendResetEmail(account, reset)
 	if err != nil {
 		msg := "An error occurred trying to send password reset e-mail. Please try again later."
 		PrintErrorHTML(w, r, msg, http.StatusInternalServerError)
@@ -102,7 +93,8 @@ func ResetInit(w http.ResponseWriter, r *http.Request) {
 	head := "Success!"
 	message := "An e-mail with a password reset token has been sent to your e-mail address. "
 	message += "Please follow the enclosed link to reset your password.<br/><br/>"
-	message += "Please note that your account will stay DEACTIVATED until your password reset has been completed!<br/><br/>"
+	message += fmt.Sprintf("The link is valid for %d minutes. Your current password remains valid until "+
+		"the reset has been completed.<br/><br/>", int(conf.GetServerConfig().ResetCodeLifeTime.Minutes()))
 	message += "You will be automatically redirected to the gin main page, "
 	message += fmt.Sprintf("you can also use <a href=\"%s\">this link</a> to return to the main gin page.",
 		conf.GetExternals().GinUiURL)
@@ -139,7 +131,7 @@ func ResetPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, exists := data.GetAccountByResetPWCode(code)
+	_, exists := data.GetAccountByResetCode(code)
 	if !exists {
 		PrintErrorHTML(w, r, "Your request is invalid or outdated. Please request a new reset code.",
 			http.StatusNotFound)
@@ -162,8 +154,9 @@ func ResetPage(w http.ResponseWriter, r *http.Request) {
 
 // Reset checks whether a submitted password reset code exists and is still valid. It further checks,
 // whether posted password and confirm password are identical and updates the account associated with
-// the password reset code with the new password. This update further removes any existing
-// password reset and account activation codes rendering the account active.
+// the password reset code with the new password. The code can only be used once, the update further
+// removes any other password reset codes and the activation code rendering the account active. All
+// sessions of the account are terminated.
 func Reset(w http.ResponseWriter, r *http.Request) {
 	const redirectionDelay = 8000
 
@@ -179,7 +172,7 @@ func Reset(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	account, exists := data.GetAccountByResetPWCode(formData.ResetCode)
+	account, exists := data.GetAccountByResetCode(formData.ResetCode)
 	if !exists {
 		PrintErrorHTML(w, r, "Your request is invalid or outdated. Please request a new reset code.",
 			http.StatusNotFound)
@@ -215,21 +208,20 @@ func Reset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = account.UpdatePassword(formData.Password)
-	if err != nil {
-		panic(err)
-	}
-
-	account.ResetPWCode.Valid = false
-	err = account.Update()
+	// the code may have been used or expired in the meantime
+	err = account.ResetPassword(formData.ResetCode, formData.Password)
 	if err != nil {
-		panic(err)
+		PrintErrorHTML(w, r, "Your request is invalid or outdated. Please request a new reset code.",
+			http.StatusNotFound)
+		return
 	}
 
-	err = account.RemoveActivationCode()
+	// sessions opened with the old password are no longer valid
+	err = data.DeleteSessionsForAccount(account.UUID, "")
 	if err != nil {
 		panic(err)
 	}
+	recordAudit(r, data.AuditPasswordReset, account.UUID, account.UUID, "", "")
 
 	head := "Success!"
 	message := "Your password has been reset, you can now login using your new password!<br/><br/>"
@@ -257,3 +249,20 @@ func Reset(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 }
+
+// sendResetEmail queues an e-mail with the password reset link of an account. The plain
+// reset code has to be available via Code of the reset.
+func sendResetEmail(account *data.Account, reset *data.PasswordReset) error {
+	tmplFields := &struct {
+		BaseUrl  string
+		Code     string
+		ValidFor int
+	}{}
+	tmplFields.BaseUrl = conf.GetServerConfig().BaseURL
+	tmplFields.Code = reset.Code
+	tmplFields.ValidFor = int(conf.GetServerConfig().ResetCodeLifeTime.Minutes())
+
+	content := util.MakeEmail(account.Language, "reset", []string{account.Email}, tmplFields)
+	email := &data.Email{}
+	return email.Create(util.NewStringSet(account.Email), content)
+}
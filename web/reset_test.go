@@ -277,14 +277,14 @@ func TestReset(t *testing.T) {
 	}
 
 	// Test valid password reset code, reset of pw code
-	account, exists := data.GetAccountByResetPWCode(codeValid)
+	account, exists := data.GetAccountByResetCode(codeValid)
 	if !exists {
 		t.Errorf("Account with reset code '%s' does not exist", codeValid)
 	}
 	id := account.UUID
 	_, exists = data.GetAccount(id)
-	if exists {
-		t.Errorf("Account with id '%s' reset code '%s' should not be active", id, codeValid)
+	if !exists {
+		t.Errorf("Account with id '%s' reset code '%s' should remain active", id, codeValid)
 	}
 	pwHash := account.PWHash
 
@@ -306,12 +306,22 @@ func TestReset(t *testing.T) {
 	if account.PWHash == pwHash {
 		t.Errorf("Password of Account with id '%s' has not been updated", id)
 	}
-	if account.ResetPWCode.String != "" {
+	if _, exists = data.GetAccountByResetCode(codeValid); exists {
 		t.Errorf("Password reset code of Account with id '%s' has not been deleted", id)
 	}
 
+	// Test used password reset code
+	request, _ = http.NewRequest("POST", resetURL, strings.NewReader(mkBody.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected StatusNotFound on used reset code but got '%d'", response.Code)
+	}
+
 	// Test valid password reset code, reset of pw code, reset of activation code
-	account, exists = data.GetAccountByResetPWCode(codeValidInactive)
+	account, exists = data.GetAccountByResetCode(codeValidInactive)
 	if !exists {
 		t.Errorf("Account with reset code '%s' does not exist", codeValidInactive)
 	}
@@ -342,7 +352,7 @@ func TestReset(t *testing.T) {
 	if !account.VerifyPassword("pw") {
 		t.Error("Password has not been properly updated")
 	}
-	if account.ResetPWCode.String != "" {
+	if _, exists = data.GetAccountByResetCode(codeValidInactive); exists {
 		t.Errorf("Password reset code of Account with id '%s' has not been removed", id)
 	}
 	if account.ActivationCode.String != "" {
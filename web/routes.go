@@ -29,10 +29,28 @@ func RegisterRoutes(r *mux.Router) {
 		Methods("POST")
 	oauth.HandleFunc("/login", LoginWithSession).
 		Methods("GET")
+	oauth.HandleFunc("/login_2fa_page", LoginTwoFactorPage).
+		Methods("GET")
+	oauth.HandleFunc("/login_2fa", LoginWithTwoFactor).
+		Methods("POST")
+	oauth.HandleFunc("/webauthn/login_options", WebAuthnLoginOptions).
+		Methods("GET")
+	oauth.HandleFunc("/webauthn/login", LoginWithWebAuthn).
+		Methods("POST")
+	oauth.HandleFunc("/2fa_page", TwoFactorPage).
+		Methods("GET")
+	oauth.HandleFunc("/2fa_enrol", TwoFactorEnrol).
+		Methods("POST")
+	oauth.HandleFunc("/2fa", TwoFactorConfirm).
+		Methods("POST")
 	oauth.HandleFunc("/approve_page", ApprovePage).
 		Methods("GET")
 	oauth.HandleFunc("/approve", Approve).
 		Methods("POST")
+	oauth.HandleFunc("/approvals_page", ApprovalsPage).
+		Methods("GET")
+	oauth.HandleFunc("/approvals", RevokeApproval).
+		Methods("POST")
 	oauth.HandleFunc("/logout/{token}", Logout).
 		Methods("GET")
 	oauth.HandleFunc("/registration_init", RegistrationInit).Methods("GET")
@@ -44,10 +62,39 @@ func RegisterRoutes(r *mux.Router) {
 	oauth.HandleFunc("/reset_init", ResetInit).Methods("POST")
 	oauth.HandleFunc("/reset_page", ResetPage).Methods("GET")
 	oauth.HandleFunc("/reset", Reset).Methods("POST")
+	oauth.HandleFunc("/email_confirm", ConfirmEmailChange).Methods("GET")
+	oauth.HandleFunc("/email_undo_page", UndoEmailChangePage).Methods("GET")
+	oauth.HandleFunc("/email_undo", UndoEmailChange).Methods("POST")
+	oauth.HandleFunc("/device_authorization", DeviceAuthorization).
+		Methods("POST")
+	oauth.HandleFunc("/device", DevicePage).
+		Methods("GET")
+	oauth.HandleFunc("/device", DeviceVerify).
+		Methods("POST")
 	oauth.HandleFunc("/token", Token).
 		Methods("POST")
+	oauth.HandleFunc("/revoke", Revoke).
+		Methods("POST")
+	oauth.HandleFunc("/introspect", Introspect).
+		Methods("POST")
 	oauth.HandleFunc("/validate/{token}", Validate).
 		Methods("GET")
+	oauth.HandleFunc("/register", RegisterClient).
+		Methods("POST")
+	oauth.HandleFunc("/register/{client_id}", GetClientRegistration).
+		Methods("GET")
+	oauth.HandleFunc("/register/{client_id}", UpdateClientRegistration).
+		Methods("PUT")
+	oauth.HandleFunc("/register/{client_id}", DeleteClientRegistration).
+		Methods("DELETE")
+	oauth.Handle("/userinfo", OAuthHandler("openid")(http.HandlerFunc(UserInfo))).
+		Methods("GET", "POST")
+	// well known resources
+	r.HandleFunc("/.well-known/jwks.json", JWKS).
+		Methods("GET")
+	r.HandleFunc("/.well-known/openid-configuration", OpenIDConfiguration).
+		Methods("GET")
+
 	// all for /api
 	api := r.PathPrefix("/api").Subrouter()
 	api.Handle("/accounts", OAuthHandlerPermissive()(http.HandlerFunc(ListAccounts))).
@@ -56,6 +103,18 @@ func RegisterRoutes(r *mux.Router) {
 		Methods("GET")
 	api.Handle("/accounts/{login}", OAuthHandler("account-write", "account-admin")(http.HandlerFunc(UpdateAccount))).
 		Methods("PUT")
+	api.Handle("/accounts/{login}", OAuthHandler("account-admin")(http.HandlerFunc(DeleteAccount))).
+		Methods("DELETE")
+	api.Handle("/accounts/{login}/login", OAuthHandler("account-admin")(http.HandlerFunc(UpdateAccountLogin))).
+		Methods("PUT")
+	api.Handle("/accounts/{login}/disable", OAuthHandler("account-admin")(http.HandlerFunc(DisableAccount))).
+		Methods("POST")
+	api.Handle("/accounts/{login}/enable", OAuthHandler("account-admin")(http.HandlerFunc(EnableAccount))).
+		Methods("POST")
+	api.Handle("/accounts/{login}/password_reset", OAuthHandler("account-admin")(http.HandlerFunc(ForcePasswordReset))).
+		Methods("POST")
+	api.Handle("/accounts/{login}/activation", OAuthHandler("account-admin")(http.HandlerFunc(ResendActivation))).
+		Methods("POST")
 	api.Handle("/accounts/{login}/password", OAuthHandler("account-write")(http.HandlerFunc(UpdateAccountPassword))).
 		Methods("PUT")
 	api.Handle("/accounts/{login}/email", OAuthHandler("account-write")(http.HandlerFunc(UpdateAccountEmail))).
@@ -64,6 +123,62 @@ func RegisterRoutes(r *mux.Router) {
 		Methods("GET")
 	api.Handle("/accounts/{login}/keys", OAuthHandler("account-write")(http.HandlerFunc(CreateKey))).
 		Methods("POST")
+	api.Handle("/accounts/{login}/2fa", OAuthHandler("account-read")(http.HandlerFunc(GetTwoFactor))).
+		Methods("GET")
+	api.Handle("/accounts/{login}/2fa", OAuthHandler("account-write")(http.HandlerFunc(EnrollTwoFactor))).
+		Methods("POST")
+	api.Handle("/accounts/{login}/2fa", OAuthHandler("account-write")(http.HandlerFunc(ConfirmTwoFactor))).
+		Methods("PUT")
+	api.Handle("/accounts/{login}/2fa", OAuthHandler("account-write")(http.HandlerFunc(DisableTwoFactor))).
+		Methods("DELETE")
+	api.Handle("/accounts/{login}/webauthn", OAuthHandler("account-read")(http.HandlerFunc(ListWebAuthnCredentials))).
+		Methods("GET")
+	api.Handle("/accounts/{login}/webauthn", OAuthHandler("account-write")(http.HandlerFunc(RegisterWebAuthnCredential))).
+		Methods("POST")
+	api.Handle("/accounts/{login}/webauthn/options", OAuthHandler("account-write")(http.HandlerFunc(WebAuthnRegistrationOptions))).
+		Methods("POST")
+	api.Handle("/accounts/{login}/webauthn/{id}", OAuthHandler("account-write")(http.HandlerFunc(DeleteWebAuthnCredential))).
+		Methods("DELETE")
+	api.Handle("/accounts/{login}/approvals", OAuthHandler("account-read")(http.HandlerFunc(ListAccountApprovals))).
+		Methods("GET")
+	api.Handle("/accounts/{login}/approvals/{uuid}", OAuthHandler("account-write")(http.HandlerFunc(RevokeAccountApproval))).
+		Methods("DELETE")
+	api.Handle("/accounts/{login}/sessions", OAuthHandler("account-read")(http.HandlerFunc(ListAccountSessions))).
+		Methods("GET")
+	api.Handle("/accounts/{login}/sessions", OAuthHandler("account-write")(http.HandlerFunc(DeleteAccountSessions))).
+		Methods("DELETE")
+	api.Handle("/accounts/{login}/sessions/{uuid}", OAuthHandler("account-write")(http.HandlerFunc(DeleteAccountSession))).
+		Methods("DELETE")
+	api.Handle("/accounts/{login}/logout", OAuthHandler("account-admin")(http.HandlerFunc(LogoutAccount))).
+		Methods("POST")
+	api.Handle("/accounts/{login}/lockouts", OAuthHandler("account-admin")(http.HandlerFunc(ListAccountLockouts))).
+		Methods("GET")
+	api.Handle("/accounts/{login}/lockouts", OAuthHandler("account-admin")(http.HandlerFunc(UnlockAccount))).
+		Methods("DELETE")
+	api.Handle("/accounts/{login}/audit", OAuthHandler("account-read")(http.HandlerFunc(ListAccountAuditEvents))).
+		Methods("GET")
+	api.Handle("/audit", OAuthHandler("account-admin")(http.HandlerFunc(ListAuditEvents))).
+		Methods("GET")
+	api.Handle("/emails", OAuthHandler("account-admin")(http.HandlerFunc(ListEmails))).
+		Methods("GET")
+	api.Handle("/emails/{id}", OAuthHandler("account-admin")(http.HandlerFunc(GetEmail))).
+		Methods("GET")
+	api.Handle("/emails/{id}", OAuthHandler("account-admin")(http.HandlerFunc(DeleteEmail))).
+		Methods("DELETE")
+	api.Handle("/emails/{id}/retry", OAuthHandler("account-admin")(http.HandlerFunc(RetryEmail))).
+		Methods("POST")
+	api.Handle("/clients", OAuthHandler("client-admin")(http.HandlerFunc(ListClients))).
+		Methods("GET")
+	api.Handle("/clients", OAuthHandler("client-admin")(http.HandlerFunc(CreateClient))).
+		Methods("POST")
+	api.Handle("/clients/{uuid}", OAuthHandler("client-admin")(http.HandlerFunc(GetClient))).
+		Methods("GET")
+	api.Handle("/clients/{uuid}", OAuthHandler("client-admin")(http.HandlerFunc(UpdateClient))).
+		Methods("PUT")
+	api.Handle("/clients/{uuid}", OAuthHandler("client-admin")(http.HandlerFunc(DeleteClient))).
+		Methods("DELETE")
+	api.Handle("/clients/{uuid}/secret", OAuthHandler("client-admin")(http.HandlerFunc(RotateClientSecret))).
+		Methods("POST")
 	api.Handle("/keys", http.HandlerFunc(GetKey)).
 		Methods("GET")
 	api.Handle("/keys", OAuthHandler("account-write")(http.HandlerFunc(DeleteKey))).
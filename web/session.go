@@ -0,0 +1,120 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/G-Node/gin-auth/data"
+	"github.com/gorilla/mux"
+)
+
+// sessionToken returns the value of the session cookie of a request or an empty
+// string if the request has no session cookie.
+func sessionToken(r *http.Request) string {
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// ListAccountSessions returns all active sessions of an account as JSON. The session the
+// request was made with, if any, is marked as current.
+func ListAccountSessions(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-read")
+	if !ok {
+		return
+	}
+
+	var current string
+	if session, ok := data.GetSession(sessionToken(r)); ok {
+		current = session.UUID
+	}
+
+	sessions := data.ListSessionsForAccount(account.UUID)
+	marshal := make([]data.SessionMarshaler, 0, len(sessions))
+	for i := 0; i < len(sessions); i++ {
+		marshal = append(marshal, data.SessionMarshaler{
+			Session: &sessions[i],
+			Account: account,
+			Current: sessions[i].UUID == current,
+		})
+	}
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(marshal)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// DeleteAccountSessions terminates all sessions of an account except the session the request
+// was made with. Returns StatusOK and an empty body on success.
+func DeleteAccountSessions(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-write")
+	if !ok {
+		return
+	}
+
+	err := data.DeleteSessionsForAccount(account.UUID, sessionToken(r))
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditSessionEnd, account.UUID, "all other sessions")
+}
+
+// DeleteAccountSession terminates a single session of an account and returns the removed
+// session as JSON.
+func DeleteAccountSession(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-write")
+	if !ok {
+		return
+	}
+
+	session, ok := data.GetSessionByUUID(mux.Vars(r)["uuid"])
+	if !ok || session.AccountUUID != account.UUID {
+		PrintErrorJSON(w, r, "The requested session does not exist", http.StatusNotFound)
+		return
+	}
+
+	err := session.Delete()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditSessionEnd, account.UUID, "session "+session.UUID)
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(&data.SessionMarshaler{Session: session, Account: account})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LogoutAccount signs an account out everywhere. All sessions of the account are terminated
+// and all its access and refresh tokens are revoked. Requires the scope 'account-admin'.
+// Returns StatusOK and an empty body on success.
+func LogoutAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := data.GetAccountByLogin(mux.Vars(r)["login"])
+	if !ok {
+		PrintErrorJSON(w, r, "The requested account does not exist", http.StatusNotFound)
+		return
+	}
+
+	err := account.Logout()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditAdmin, account.UUID, "logout account")
+}
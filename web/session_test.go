@@ -0,0 +1,115 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/data"
+)
+
+const sessionUUIDAliceOther = "a3e4f5d6-7b8c-4d9e-8f0a-1b2c3d4e5f60"
+
+func TestSessionsAPI(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(method, uri string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, uri, strings.NewReader(""))
+		request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+		request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	// wrong account
+	response := mkRequest("GET", "/api/accounts/bob/sessions")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// list sessions
+	response = mkRequest("GET", "/api/accounts/alice/sessions")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	sessions := []map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("Two sessions expected but was %d", len(sessions))
+	}
+	if sessions[0]["current"] != true || sessions[1]["current"] != false {
+		t.Error("Only the first session expected to be the current session")
+	}
+	if sessions[0]["ip"] != "192.0.2.1" || sessions[0]["user_agent"] != "Mozilla/5.0" {
+		t.Errorf("Unexpected session: %v", sessions[0])
+	}
+
+	// session of another account
+	response = mkRequest("DELETE", "/api/accounts/alice/sessions/9f8e7d6c-5b4a-4392-8817-263544536271")
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+
+	// delete one session
+	response = mkRequest("DELETE", "/api/accounts/alice/sessions/"+sessionUUIDAliceOther)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetSessionByUUID(sessionUUIDAliceOther); ok {
+		t.Error("Session should be removed")
+	}
+	events := data.ListAuditEvents(&data.AuditFilter{Type: data.AuditSessionEnd, Limit: 1})
+	if len(events) != 1 || events[0].Detail != "session "+sessionUUIDAliceOther {
+		t.Errorf("Session end event expected but was '%v'", events)
+	}
+
+	// delete all other sessions
+	_ = (&data.Session{AccountUUID: uuidAlice}).Create()
+	response = mkRequest("DELETE", "/api/accounts/alice/sessions")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	remaining := data.ListSessionsForAccount(uuidAlice)
+	if len(remaining) != 1 {
+		t.Errorf("Only the current session should remain but was %d", len(remaining))
+	}
+}
+
+func TestLogoutAccount(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	// insufficient scope
+	request, _ := http.NewRequest("POST", "/api/accounts/alice/logout", strings.NewReader(""))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// admin
+	request, _ = http.NewRequest("POST", "/api/accounts/alice/logout", strings.NewReader(""))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAliceAdmin)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if len(data.ListSessionsForAccount(uuidAlice)) != 0 {
+		t.Error("All sessions should be removed")
+	}
+	if _, ok := data.GetAccessToken(accessTokenAlice); ok {
+		t.Error("Access token should be revoked")
+	}
+}
@@ -0,0 +1,411 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+)
+
+const twoFactorRequired = "Two-factor authentication is required for this login"
+
+// LoginTwoFactorPage shows a page where the user can enter a one-time password or a
+// recovery code or use a security key after the password was verified.
+func LoginTwoFactorPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("request_id")
+	if token == "" {
+		PrintErrorHTML(w, r, "Query parameter 'request_id' was missing", http.StatusBadRequest)
+		return
+	}
+
+	request, ok := data.GetGrantRequest(token)
+	if !ok {
+		PrintErrorHTML(w, r, "Grant request does not exist", http.StatusNotFound)
+		return
+	}
+	if !request.PendingAccountUUID.Valid {
+		PrintErrorHTML(w, r, "Grant request is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	account, ok := data.GetAccount(request.PendingAccountUUID.String)
+	if !ok {
+		PrintErrorHTML(w, r, "Unable to find account associated with the request", http.StatusNotFound)
+		return
+	}
+
+	pageData := &struct {
+		RequestID string
+		TOTP      bool
+		WebAuthn  bool
+	}{request.Token, account.HasTwoFactor(), account.HasWebAuthn()}
+
+	tmpl := conf.MakeTemplate("login2fa.html", "webauthn.html")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "text/html")
+	err := tmpl.ExecuteTemplate(w, "layout", pageData)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LoginWithTwoFactor validates the second factor of an account whose password was already
+// verified and completes the login. If the code is invalid, the login has to be started again.
+func LoginWithTwoFactor(w http.ResponseWriter, r *http.Request) {
+	param := &struct {
+		RequestID string
+		Code      string
+	}{}
+	err := util.ReadFormIntoStruct(r, param, false)
+	if err != nil {
+		PrintErrorHTML(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	request, ok := data.GetGrantRequest(param.RequestID)
+	if !ok {
+		PrintErrorHTML(w, r, "Grant request does not exist", http.StatusNotFound)
+		return
+	}
+	if !request.PendingAccountUUID.Valid {
+		PrintErrorHTML(w, r, "Grant request is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	account, ok := data.GetAccount(request.PendingAccountUUID.String)
+	if !ok {
+		PrintErrorHTML(w, r, "Unable to find account associated with the request", http.StatusNotFound)
+		return
+	}
+
+	request.PendingAccountUUID = sql.NullString{}
+	if !account.VerifySecondFactor(param.Code) {
+		data.RecordRateLimitEvent(data.RateLimitLogin, clientIP(r), account.UUID)
+		recordAudit(r, data.AuditLoginFailure, "", account.UUID, request.ClientUUID, "wrong second factor")
+		err = request.Update()
+		if err != nil {
+			panic(err)
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+		http.Redirect(w, r, "/oauth/login_page?request_id="+request.Token, http.StatusFound)
+		return
+	}
+
+	finishLogin(w, r, request, account)
+}
+
+// sessionAccount returns the account of the session identified by the session cookie.
+func sessionAccount(r *http.Request) (*data.Account, bool) {
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return nil, false
+	}
+
+	session, ok := data.GetSession(cookie.Value)
+	if !ok {
+		return nil, false
+	}
+
+	return data.GetAccount(session.AccountUUID)
+}
+
+// twoFactorPageData contains the values shown on the page for enabling two-factor authentication.
+// The optional RequestID refers to a login which can be continued after the enrolment.
+type twoFactorPageData struct {
+	RequestID string
+	URI       string
+	Secret    string
+	*util.ValidationError
+}
+
+// twoFactorPageURL returns the URL of the page for enabling two-factor authentication.
+func twoFactorPageURL(requestID string) string {
+	if requestID == "" {
+		return "/oauth/2fa_page"
+	}
+	return "/oauth/2fa_page?request_id=" + url.QueryEscape(requestID)
+}
+
+// TwoFactorPage shows the otpauth URI and the secret needed to enroll the logged in account in
+// two-factor authentication and asks for a code in order to confirm the enrolment. If the enrolment
+// was not yet started, the page only offers to start it using TwoFactorEnrol.
+func TwoFactorPage(w http.ResponseWriter, r *http.Request) {
+	account, ok := sessionAccount(r)
+	if !ok {
+		PrintErrorHTML(w, r, "Please sign in before enabling two-factor authentication", http.StatusUnauthorized)
+		return
+	}
+
+	pageData := &twoFactorPageData{RequestID: r.URL.Query().Get("request_id"), ValidationError: &util.ValidationError{}}
+	secret, ok := data.GetTOTPSecret(account.UUID)
+	if ok && secret.Confirmed {
+		PrintErrorHTML(w, r, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if ok {
+		pageData.URI = secret.URI(account.Login)
+		pageData.Secret = secret.Secret
+	}
+
+	tmpl := conf.MakeTemplate("twofactor.html")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "text/html")
+	err := tmpl.ExecuteTemplate(w, "layout", pageData)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// TwoFactorEnrol starts the enrolment of the logged in account in two-factor authentication and
+// redirects to the page showing the new secret.
+func TwoFactorEnrol(w http.ResponseWriter, r *http.Request) {
+	param := &struct{ RequestID string }{}
+	err := util.ReadFormIntoStruct(r, param, true)
+	if err != nil {
+		PrintErrorHTML(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	account, ok := sessionAccount(r)
+	if !ok {
+		PrintErrorHTML(w, r, "Please sign in before enabling two-factor authentication", http.StatusUnauthorized)
+		return
+	}
+
+	// an unconfirmed secret is reused, since it might already be stored in the app
+	secret, ok := data.GetTOTPSecret(account.UUID)
+	if ok && secret.Confirmed {
+		PrintErrorHTML(w, r, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if !ok {
+		_, err = account.EnrollTOTP()
+		if err != nil {
+			panic(err)
+		}
+		recordAudit(r, data.AuditTwoFactorEnrol, account.UUID, account.UUID, "", "totp")
+	}
+
+	w.Header().Add("Cache-Control", "no-store")
+	http.Redirect(w, r, twoFactorPageURL(param.RequestID), http.StatusFound)
+}
+
+// TwoFactorConfirm enables two-factor authentication for the logged in account if the
+// submitted code is valid and shows the recovery codes.
+func TwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	param := &struct {
+		RequestID string
+		Code      string
+	}{}
+	err := util.ReadFormIntoStruct(r, param, true)
+	if err != nil {
+		PrintErrorHTML(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	account, ok := sessionAccount(r)
+	if !ok {
+		PrintErrorHTML(w, r, "Please sign in before enabling two-factor authentication", http.StatusUnauthorized)
+		return
+	}
+	if !throttleHTML(w, r, data.RateLimitLogin, account.UUID) {
+		return
+	}
+
+	secret, ok := data.GetTOTPSecret(account.UUID)
+	if !ok || secret.Confirmed {
+		PrintErrorHTML(w, r, "No two-factor enrolment in progress", http.StatusNotFound)
+		return
+	}
+
+	codes, ok := secret.Confirm(param.Code)
+	if !ok {
+		data.RecordRateLimitEvent(data.RateLimitLogin, clientIP(r), account.UUID)
+		pageData := &twoFactorPageData{param.RequestID, secret.URI(account.Login), secret.Secret, &util.ValidationError{
+			FieldErrors: map[string]string{"code": "Invalid code"}}}
+		tmpl := conf.MakeTemplate("twofactor.html")
+		w.Header().Add("Cache-Control", "no-store")
+		w.Header().Add("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadRequest)
+		err = tmpl.ExecuteTemplate(w, "layout", pageData)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	recordAudit(r, data.AuditTwoFactorEnable, account.UUID, account.UUID, "", "totp")
+
+	tmpl := conf.MakeTemplate("twofactorcodes.html")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "text/html")
+	err = tmpl.ExecuteTemplate(w, "layout", &struct {
+		RequestID string
+		Codes     []string
+	}{param.RequestID, codes})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// GetTwoFactor returns whether two-factor authentication is enabled for an account and the
+// number of unused recovery codes as JSON.
+func GetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-read")
+	if !ok {
+		return
+	}
+
+	status := &struct {
+		Enabled       bool `json:"enabled"`
+		RecoveryCodes int  `json:"recovery_codes"`
+	}{account.HasTwoFactor(), account.CountRecoveryCodes()}
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(status)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// EnrollTwoFactor starts the enrolment of an account in two-factor authentication and returns
+// the new TOTP secret together with its otpauth URI as JSON. The enrolment has to be confirmed
+// using ConfirmTwoFactor.
+func EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-write")
+	if !ok {
+		return
+	}
+
+	secret, err := account.EnrollTOTP()
+	if err != nil {
+		PrintErrorJSON(w, r, err, http.StatusConflict)
+		return
+	}
+	recordTokenAudit(r, data.AuditTwoFactorEnrol, account.UUID, "totp")
+
+	response := &struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}{secret.Secret, secret.URI(account.Login)}
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// twoFactorCode reads a one-time password or recovery code from the JSON request body. Codes are never
+// accepted as query parameters, since these end up in access logs. Writes an error response and returns
+// false if the body is malformed.
+func twoFactorCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	body := &struct {
+		Code string `json:"code"`
+	}{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(body)
+	if err != nil {
+		PrintErrorJSON(w, r, "Error while processing request body", http.StatusBadRequest)
+		return "", false
+	}
+	return body.Code, true
+}
+
+// ConfirmTwoFactor parses a one-time password from the JSON request body and enables two-factor
+// authentication if the code is valid. Returns the recovery codes as JSON.
+func ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-write")
+	if !ok {
+		return
+	}
+	if !throttleJSON(w, r, data.RateLimitLogin, account.UUID) {
+		return
+	}
+
+	code, ok := twoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	secret, ok := data.GetTOTPSecret(account.UUID)
+	if !ok || secret.Confirmed {
+		PrintErrorJSON(w, r, "No two-factor enrolment in progress", http.StatusNotFound)
+		return
+	}
+
+	codes, ok := secret.Confirm(code)
+	if !ok {
+		data.RecordRateLimitEvent(data.RateLimitLogin, clientIP(r), account.UUID)
+		err := &util.ValidationError{
+			Message:     "Unable to enable two-factor authentication",
+			FieldErrors: map[string]string{"code": "Invalid code"}}
+		PrintErrorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+	recordTokenAudit(r, data.AuditTwoFactorEnable, account.UUID, "totp")
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(&struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{codes})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// DisableTwoFactor disables two-factor authentication for an account. The JSON request body has to
+// provide a valid one-time password or recovery code.
+// Returns StatusOK and an empty body on success.
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-write")
+	if !ok {
+		return
+	}
+	if !throttleJSON(w, r, data.RateLimitLogin, account.UUID) {
+		return
+	}
+
+	if !account.HasTwoFactor() {
+		PrintErrorJSON(w, r, "Two-factor authentication is not enabled", http.StatusNotFound)
+		return
+	}
+
+	code, ok := twoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	if !account.VerifySecondFactor(code) {
+		data.RecordRateLimitEvent(data.RateLimitLogin, clientIP(r), account.UUID)
+		err := &util.ValidationError{
+			Message:     "Unable to disable two-factor authentication",
+			FieldErrors: map[string]string{"code": "Invalid code"}}
+		PrintErrorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	err := account.DisableTwoFactor()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditTwoFactorDisable, account.UUID, "totp")
+}
@@ -0,0 +1,354 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+)
+
+// enableTwoFactor enables two-factor authentication for alice and returns the secret,
+// the time step of the code used for confirmation and the recovery codes.
+func enableTwoFactor(t *testing.T) (*data.TOTPSecret, int64, []string) {
+	account, ok := data.GetAccount(uuidAlice)
+	if !ok {
+		t.Fatal("Account does not exist")
+	}
+	secret, err := account.EnrollTOTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := util.TOTPCounter(time.Now())
+	code, _ := util.TOTPCode(secret.Secret, now)
+	codes, ok := secret.Confirm(code)
+	if !ok {
+		t.Fatal("Unable to confirm two-factor enrolment")
+	}
+	return secret, now, codes
+}
+
+func TestLoginWithTwoFactor(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+	_, _, codes := enableTwoFactor(t)
+
+	login := func() *httptest.ResponseRecorder {
+		body := &url.Values{}
+		body.Add("request_id", "U7JIKKYI")
+		body.Add("login", "alice")
+		body.Add("password", "testtest")
+		request, _ := http.NewRequest("POST", "/oauth/login", strings.NewReader(body.Encode()))
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	secondFactor := func(code string) *httptest.ResponseRecorder {
+		body := &url.Values{}
+		body.Add("request_id", "U7JIKKYI")
+		body.Add("code", code)
+		request, _ := http.NewRequest("POST", "/oauth/login_2fa", strings.NewReader(body.Encode()))
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	// password only leads to the second step
+	response := login()
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	redirect, _ := url.Parse(response.Header().Get("Location"))
+	if redirect.Path != "/oauth/login_2fa_page" {
+		t.Errorf("Redirect to second step expected but was '%s'", redirect.Path)
+	}
+	if len(response.Header().Get("Set-Cookie")) > 0 {
+		t.Error("Session should not be created before the second factor was verified")
+	}
+
+	request, _ := http.NewRequest("GET", "/oauth/login_2fa_page?request_id=U7JIKKYI", strings.NewReader(""))
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+
+	// wrong code restarts the login
+	response = secondFactor("000000")
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	redirect, _ = url.Parse(response.Header().Get("Location"))
+	if redirect.Path != "/oauth/login_page" {
+		t.Errorf("Redirect to login page expected but was '%s'", redirect.Path)
+	}
+	response = secondFactor(codes[0])
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// recovery code completes the login
+	login()
+	response = secondFactor(codes[0])
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	redirect, _ = url.Parse(response.Header().Get("Location"))
+	if redirect.Query().Get("code") == "" {
+		t.Error("Code not found")
+	}
+	if len(response.Header().Get("Set-Cookie")) == 0 {
+		t.Error("Session cookie expected")
+	}
+
+	// password grant is not possible with two-factor authentication
+	body := &url.Values{}
+	body.Add("grant_type", "password")
+	body.Add("username", "alice")
+	body.Add("password", "testtest")
+	body.Add("scope", "account-read")
+	request, _ = http.NewRequest("POST", "/oauth/token", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("wb", "secret")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+}
+
+func TestLoginTwoFactorRequired(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	config := conf.GetSecurityConfig()
+	scopes := config.TwoFactorScopes
+	defer func() { config.TwoFactorScopes = scopes }()
+	config.TwoFactorScopes = []string{"repo-write"}
+
+	body := &url.Values{}
+	body.Add("request_id", "U7JIKKYI")
+	body.Add("login", "alice")
+	body.Add("password", "testtest")
+	request, _ := http.NewRequest("POST", "/oauth/login", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Header().Get("Location") != "/oauth/2fa_page?request_id=U7JIKKYI" {
+		t.Fatalf("Redirect to enrolment expected but was '%d' '%s'", response.Code, response.Header().Get("Location"))
+	}
+	cookies := response.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != cookieName {
+		t.Fatal("Session cookie expected")
+	}
+
+	loginWithSession := func() *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", "/oauth/login?request_id=U7JIKKYI", strings.NewReader(""))
+		request.AddCookie(cookies[0])
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	response = loginWithSession()
+	if response.Header().Get("Location") != "/oauth/2fa_page?request_id=U7JIKKYI" {
+		t.Errorf("Redirect to enrolment expected but was '%d' '%s'", response.Code, response.Header().Get("Location"))
+	}
+
+	enableTwoFactor(t)
+	response = loginWithSession()
+	redirect, _ := url.Parse(response.Header().Get("Location"))
+	if response.Code != http.StatusFound || redirect.Path == "/oauth/2fa_page" {
+		t.Errorf("Login expected to continue but was '%d' '%s'", response.Code, redirect.Path)
+	}
+}
+
+func TestTwoFactorAPI(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	mkRequest := func(method, uri, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, uri, bytes.NewBufferString(body))
+		request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	status := func() map[string]interface{} {
+		response := mkRequest("GET", "/api/accounts/alice/2fa", "")
+		if response.Code != http.StatusOK {
+			t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+		}
+		result := map[string]interface{}{}
+		_ = json.NewDecoder(response.Body).Decode(&result)
+		return result
+	}
+
+	// wrong account
+	response := mkRequest("GET", "/api/accounts/bob/2fa", "")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	if status()["enabled"] != false {
+		t.Error("Two-factor authentication expected to be disabled")
+	}
+
+	// enroll
+	response = mkRequest("POST", "/api/accounts/alice/2fa", "")
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	enrolment := &struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}{}
+	_ = json.NewDecoder(response.Body).Decode(enrolment)
+	if enrolment.Secret == "" || !strings.HasPrefix(enrolment.URI, "otpauth://totp/") {
+		t.Errorf("Unexpected enrolment: %v", enrolment)
+	}
+
+	// confirm
+	response = mkRequest("PUT", "/api/accounts/alice/2fa", `{"code": `)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+	response = mkRequest("PUT", "/api/accounts/alice/2fa", `{"code": "000000x"}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+	now := util.TOTPCounter(time.Now())
+	code, _ := util.TOTPCode(enrolment.Secret, now)
+	response = mkRequest("PUT", "/api/accounts/alice/2fa", `{"code": "`+code+`"}`)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	codes := &struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{}
+	_ = json.NewDecoder(response.Body).Decode(codes)
+	if len(codes.RecoveryCodes) == 0 {
+		t.Error("Recovery codes expected")
+	}
+	if status()["enabled"] != true {
+		t.Error("Two-factor authentication expected to be enabled")
+	}
+
+	// disable
+	response = mkRequest("DELETE", "/api/accounts/alice/2fa", `{"code": "wrong"}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+	code, _ = util.TOTPCode(enrolment.Secret, now+1)
+	response = mkRequest("DELETE", "/api/accounts/alice/2fa?code="+code, "")
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Codes in the query should be ignored, response code '%d' expected but was '%d'",
+			http.StatusBadRequest, response.Code)
+	}
+	if status()["enabled"] != true {
+		t.Error("Two-factor authentication expected to be enabled")
+	}
+
+	// wrong codes count as failed logins
+	response = mkRequest("DELETE", "/api/accounts/alice/2fa", `{"code": "`+code+`"}`)
+	if response.Code != http.StatusTooManyRequests {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusTooManyRequests, response.Code)
+	}
+	data.ClearLoginFailures(uuidAlice)
+
+	response = mkRequest("DELETE", "/api/accounts/alice/2fa", `{"code": "`+code+`"}`)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if status()["enabled"] != false {
+		t.Error("Two-factor authentication expected to be disabled")
+	}
+
+	for _, eventType := range []string{data.AuditTwoFactorEnrol, data.AuditTwoFactorEnable, data.AuditTwoFactorDisable} {
+		events := data.ListAuditEvents(&data.AuditFilter{Type: eventType, TargetUUID: uuidAlice})
+		if len(events) != 1 {
+			t.Errorf("One '%s' event expected but was %d", eventType, len(events))
+		}
+	}
+}
+
+func TestTwoFactorPage(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+
+	// no session
+	request, _ := http.NewRequest("GET", "/oauth/2fa_page", strings.NewReader(""))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// session of alice, showing the page has no side effects
+	request, _ = http.NewRequest("GET", "/oauth/2fa_page", strings.NewReader(""))
+	request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if _, ok := data.GetTOTPSecret(uuidAlice); ok {
+		t.Error("No secret expected")
+	}
+
+	// start enrolment
+	body := &url.Values{}
+	body.Add("request_id", "U7JIKKYI")
+	request, _ = http.NewRequest("POST", "/oauth/2fa_enrol", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Header().Get("Location") != "/oauth/2fa_page?request_id=U7JIKKYI" {
+		t.Errorf("Redirect to enrolment page expected but was '%d' '%s'", response.Code, response.Header().Get("Location"))
+	}
+	secret, ok := data.GetTOTPSecret(uuidAlice)
+	if !ok || secret.Confirmed {
+		t.Fatal("Unconfirmed secret expected")
+	}
+
+	// wrong code
+	body = &url.Values{}
+	body.Add("code", "wrong")
+	request, _ = http.NewRequest("POST", "/oauth/2fa", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	code, _ := util.TOTPCode(secret.Secret, util.TOTPCounter(time.Now()))
+	body = &url.Values{}
+	body.Add("code", code)
+	request, _ = http.NewRequest("POST", "/oauth/2fa", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(&http.Cookie{Name: cookieName, Value: "DNM5RS3C"})
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if secret, _ = data.GetTOTPSecret(uuidAlice); !secret.Confirmed {
+		t.Error("Secret expected to be confirmed")
+	}
+}
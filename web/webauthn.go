@@ -0,0 +1,323 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/G-Node/gin-auth/conf"
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+	"github.com/gorilla/mux"
+)
+
+// webAuthnTimeout is the time in milliseconds a client should wait for the user to complete a ceremony.
+const webAuthnTimeout = 120000
+
+// webAuthnDescriptor identifies a credential in the options of a WebAuthn ceremony.
+type webAuthnDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// webAuthnDescriptors returns the descriptors of all credentials registered for an account.
+func webAuthnDescriptors(accountUUID string) []webAuthnDescriptor {
+	descriptors := make([]webAuthnDescriptor, 0)
+	for _, credential := range data.ListWebAuthnCredentials(accountUUID) {
+		descriptors = append(descriptors, webAuthnDescriptor{"public-key", credential.ID})
+	}
+	return descriptors
+}
+
+// decodeBase64URL decodes base64url encoded binary values sent by the client, with or without padding.
+func decodeBase64URL(str string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(str, "="))
+}
+
+// WebAuthnLoginOptions returns the options for a WebAuthn login ceremony of a grant request as JSON.
+// The options contain all binary values base64url encoded. If the password of the request was already
+// verified, the security key is used as second factor and only credentials of the respective account
+// are allowed. Otherwise the login is passwordless and requires user verification by the authenticator.
+func WebAuthnLoginOptions(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("request_id")
+	if token == "" {
+		PrintErrorJSON(w, r, "Query parameter 'request_id' was missing", http.StatusBadRequest)
+		return
+	}
+
+	request, ok := data.GetGrantRequest(token)
+	if !ok {
+		PrintErrorJSON(w, r, "Grant request does not exist", http.StatusNotFound)
+		return
+	}
+
+	userVerification := "required"
+	allowCredentials := make([]webAuthnDescriptor, 0)
+	if request.PendingAccountUUID.Valid {
+		userVerification = "discouraged"
+		allowCredentials = webAuthnDescriptors(request.PendingAccountUUID.String)
+	}
+
+	challenge, err := data.NewWebAuthnChallenge(data.WebAuthnGet, request.PendingAccountUUID)
+	if err != nil {
+		panic(err)
+	}
+
+	options := &struct {
+		Challenge        string               `json:"challenge"`
+		RPID             string               `json:"rpId"`
+		Timeout          int                  `json:"timeout"`
+		UserVerification string               `json:"userVerification"`
+		AllowCredentials []webAuthnDescriptor `json:"allowCredentials"`
+	}{challenge.Challenge, data.WebAuthnRPID(), webAuthnTimeout, userVerification, allowCredentials}
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(options)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LoginWithWebAuthn validates the assertion of a security key and completes the login. The key is
+// either used as second factor of an account whose password was already verified or for a passwordless
+// login. If the assertion is invalid, the login has to be started again.
+func LoginWithWebAuthn(w http.ResponseWriter, r *http.Request) {
+	param := &struct {
+		RequestID         string
+		CredentialID      string
+		ClientData        string
+		AuthenticatorData string
+		Signature         string
+	}{}
+	err := util.ReadFormIntoStruct(r, param, false)
+	if err != nil {
+		PrintErrorHTML(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	clientData, errClient := decodeBase64URL(param.ClientData)
+	authData, errAuth := decodeBase64URL(param.AuthenticatorData)
+	signature, errSig := decodeBase64URL(param.Signature)
+	if errClient != nil || errAuth != nil || errSig != nil {
+		PrintErrorHTML(w, r, "Invalid security key response", http.StatusBadRequest)
+		return
+	}
+
+	request, ok := data.GetGrantRequest(param.RequestID)
+	if !ok {
+		PrintErrorHTML(w, r, "Grant request does not exist", http.StatusNotFound)
+		return
+	}
+
+	pending := request.PendingAccountUUID
+	if !throttleHTML(w, r, data.RateLimitLogin, pending.String) {
+		return
+	}
+	request.PendingAccountUUID = sql.NullString{}
+
+	credential, err := data.VerifyWebAuthnAssertion(pending, param.CredentialID, clientData, authData, signature)
+	if err != nil {
+		data.RecordRateLimitEvent(data.RateLimitLogin, clientIP(r), pending.String)
+		recordAudit(r, data.AuditLoginFailure, "", pending.String, request.ClientUUID, "invalid security key response")
+		err = request.Update()
+		if err != nil {
+			panic(err)
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+		http.Redirect(w, r, "/oauth/login_page?request_id="+request.Token, http.StatusFound)
+		return
+	}
+
+	account, ok := data.GetAccount(credential.AccountUUID)
+	if !ok {
+		PrintErrorHTML(w, r, "Unable to find account associated with the security key", http.StatusNotFound)
+		return
+	}
+	// a passwordless login is only associated with an account after the assertion was verified
+	if !pending.Valid && !throttleHTML(w, r, data.RateLimitLogin, account.UUID) {
+		return
+	}
+
+	finishLogin(w, r, request, account)
+}
+
+// ListWebAuthnCredentials returns all WebAuthn credentials registered for an account as JSON.
+func ListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-read")
+	if !ok {
+		return
+	}
+
+	credentials := data.ListWebAuthnCredentials(account.UUID)
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err := enc.Encode(credentials)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// WebAuthnRegistrationOptions starts the registration of a new security key for an account and
+// returns the options for the registration ceremony as JSON. All binary values are base64url encoded.
+// The registration has to be completed using RegisterWebAuthnCredential.
+func WebAuthnRegistrationOptions(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-write")
+	if !ok {
+		return
+	}
+
+	challenge, err := data.NewWebAuthnChallenge(data.WebAuthnCreate, sql.NullString{String: account.UUID, Valid: true})
+	if err != nil {
+		panic(err)
+	}
+
+	type param struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	}
+	options := &struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"rp"`
+		User struct {
+			ID          string `json:"id"`
+			Name        string `json:"name"`
+			DisplayName string `json:"displayName"`
+		} `json:"user"`
+		PubKeyCredParams       []param              `json:"pubKeyCredParams"`
+		Timeout                int                  `json:"timeout"`
+		Attestation            string               `json:"attestation"`
+		ExcludeCredentials     []webAuthnDescriptor `json:"excludeCredentials"`
+		AuthenticatorSelection map[string]string    `json:"authenticatorSelection"`
+	}{
+		Challenge: challenge.Challenge,
+		PubKeyCredParams: []param{
+			{"public-key", util.COSEAlgES256},
+			{"public-key", util.COSEAlgRS256},
+		},
+		Timeout:            webAuthnTimeout,
+		Attestation:        "none",
+		ExcludeCredentials: webAuthnDescriptors(account.UUID),
+		AuthenticatorSelection: map[string]string{
+			"residentKey":      "preferred",
+			"userVerification": "preferred",
+		},
+	}
+	options.RP.ID = data.WebAuthnRPID()
+	options.RP.Name = conf.GetSecurityConfig().TwoFactorIssuer
+	options.User.ID = base64.RawURLEncoding.EncodeToString([]byte(account.UUID))
+	options.User.Name = account.Login
+	options.User.DisplayName = strings.TrimSpace(account.FirstName + " " + account.LastName)
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(options)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegisterWebAuthnCredential parses the response of the authenticator from the JSON request body,
+// verifies it and stores the new credential. The current password of the account is required in
+// order to register a key. Returns the credential as JSON.
+func RegisterWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-write")
+	if !ok {
+		return
+	}
+	if !throttleJSON(w, r, data.RateLimitLogin, account.UUID) {
+		return
+	}
+
+	body := &struct {
+		Password          string `json:"password"`
+		Description       string `json:"description"`
+		ClientData        string `json:"client_data"`
+		AttestationObject string `json:"attestation_object"`
+	}{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(body)
+	if err != nil {
+		PrintErrorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if !account.VerifyPassword(body.Password) {
+		data.RecordRateLimitEvent(data.RateLimitLogin, clientIP(r), account.UUID)
+		valErr := &util.ValidationError{Message: "Unable to register security key", FieldErrors: map[string]string{
+			"password": "Wrong password"}}
+		PrintErrorJSON(w, r, valErr, http.StatusBadRequest)
+		return
+	}
+
+	clientData, errClient := decodeBase64URL(body.ClientData)
+	attestation, errAtt := decodeBase64URL(body.AttestationObject)
+	if errClient != nil || errAtt != nil {
+		PrintErrorJSON(w, r, "Invalid security key response", http.StatusBadRequest)
+		return
+	}
+
+	credential, err := account.RegisterWebAuthnCredential(body.Description, clientData, attestation)
+	if err != nil {
+		valErr := &util.ValidationError{Message: "Unable to register security key", FieldErrors: map[string]string{
+			"attestation_object": err.Error()}}
+		PrintErrorJSON(w, r, valErr, http.StatusBadRequest)
+		return
+	}
+	recordTokenAudit(r, data.AuditSecurityKeyAdd, account.UUID, "security key "+credential.ID)
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(credential)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// DeleteWebAuthnCredential removes a WebAuthn credential of an account and returns the deleted
+// credential as JSON.
+func DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	account, ok := ownAccount(w, r, "account-write")
+	if !ok {
+		return
+	}
+
+	credential, ok := data.GetWebAuthnCredential(mux.Vars(r)["id"])
+	if !ok || credential.AccountUUID != account.UUID {
+		PrintErrorJSON(w, r, "The requested security key does not exist", http.StatusNotFound)
+		return
+	}
+
+	err := credential.Delete()
+	if err != nil {
+		panic(err)
+	}
+	recordTokenAudit(r, data.AuditSecurityKeyDelete, account.UUID, "security key "+credential.ID)
+
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(credential)
+	if err != nil {
+		panic(err)
+	}
+}
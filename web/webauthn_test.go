@@ -0,0 +1,218 @@
+// Copyright (c) 2016, German Neuroinformatics Node (G-Node)
+//
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted under the terms of the BSD License. See
+// LICENSE file in the root of the Project.
+
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/G-Node/gin-auth/data"
+	"github.com/G-Node/gin-auth/util"
+)
+
+// registerWebAuthn registers a software authenticator for alice using the API.
+func registerWebAuthn(t *testing.T, handler http.Handler) (*util.SoftAuthenticator, string) {
+	request, _ := http.NewRequest("POST", "/api/accounts/alice/webauthn/options", strings.NewReader(""))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	options := &struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+	}{}
+	_ = json.NewDecoder(response.Body).Decode(options)
+	if options.RP.ID != data.WebAuthnRPID() {
+		t.Errorf("RP ID '%s' expected but was '%s'", data.WebAuthnRPID(), options.RP.ID)
+	}
+
+	auth := util.NewSoftAuthenticator()
+	clientData, attestation := auth.Create(options.RP.ID, data.WebAuthnOrigin(), options.Challenge)
+	body, _ := json.Marshal(map[string]string{
+		"password":           "testtest",
+		"description":        "Test key",
+		"client_data":        base64.RawURLEncoding.EncodeToString(clientData),
+		"attestation_object": base64.RawURLEncoding.EncodeToString(attestation),
+	})
+	request, _ = http.NewRequest("POST", "/api/accounts/alice/webauthn", bytes.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	credential := &struct {
+		ID          string `json:"id"`
+		Description string `json:"description"`
+	}{}
+	_ = json.NewDecoder(response.Body).Decode(credential)
+	if credential.Description != "Test key" {
+		t.Errorf("Unexpected description '%s'", credential.Description)
+	}
+
+	return auth, credential.ID
+}
+
+// loginWithWebAuthn performs a login ceremony for the grant request with the software authenticator.
+func loginWithWebAuthn(t *testing.T, handler http.Handler, requestID string, auth *util.SoftAuthenticator, id string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest("GET", "/oauth/webauthn/login_options?request_id="+requestID, strings.NewReader(""))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	options := &struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+	}{}
+	_ = json.NewDecoder(response.Body).Decode(options)
+
+	clientData, authData, sig := auth.Get(options.RPID, data.WebAuthnOrigin(), options.Challenge)
+	body := &url.Values{}
+	body.Add("request_id", requestID)
+	body.Add("credential_id", id)
+	body.Add("client_data", base64.RawURLEncoding.EncodeToString(clientData))
+	body.Add("authenticator_data", base64.RawURLEncoding.EncodeToString(authData))
+	body.Add("signature", base64.RawURLEncoding.EncodeToString(sig))
+	request, _ = http.NewRequest("POST", "/oauth/webauthn/login", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	return response
+}
+
+func TestWebAuthnAPI(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+	_, id := registerWebAuthn(t, handler)
+
+	mkRequest := func(method, uri, token string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, uri, strings.NewReader(""))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	// wrong account
+	response := mkRequest("GET", "/api/accounts/bob/webauthn", accessTokenAlice)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusUnauthorized, response.Code)
+	}
+
+	// wrong password
+	body, _ := json.Marshal(map[string]string{"password": "wrong", "description": "Other key"})
+	request, _ := http.NewRequest("POST", "/api/accounts/alice/webauthn", bytes.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+accessTokenAlice)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusBadRequest, response.Code)
+	}
+
+	response = mkRequest("GET", "/api/accounts/alice/webauthn", accessTokenAlice)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	credentials := []map[string]interface{}{}
+	_ = json.NewDecoder(response.Body).Decode(&credentials)
+	if len(credentials) != 1 || credentials[0]["id"] != id {
+		t.Errorf("Unexpected credentials: %v", credentials)
+	}
+
+	response = mkRequest("DELETE", "/api/accounts/alice/webauthn/doesnotexist", accessTokenAlice)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusNotFound, response.Code)
+	}
+	response = mkRequest("DELETE", "/api/accounts/alice/webauthn/"+id, accessTokenAlice)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if len(data.ListWebAuthnCredentials(uuidAlice)) != 0 {
+		t.Error("Credential expected to be deleted")
+	}
+	events := data.ListAuditEvents(&data.AuditFilter{Type: data.AuditSecurityKeyDelete, TargetUUID: uuidAlice})
+	if len(events) != 1 || events[0].Detail != "security key "+id {
+		t.Errorf("Security key event expected but was '%v'", events)
+	}
+}
+
+func TestLoginWithWebAuthn(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+	auth, id := registerWebAuthn(t, handler)
+
+	// passwordless login
+	response := loginWithWebAuthn(t, handler, "U7JIKKYI", auth, id)
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	redirect, _ := url.Parse(response.Header().Get("Location"))
+	if redirect.Query().Get("code") == "" {
+		t.Error("Code not found")
+	}
+	if len(response.Header().Get("Set-Cookie")) == 0 {
+		t.Error("Session cookie expected")
+	}
+
+	// passwordless login requires user verification
+	auth.UserVerified = false
+	response = loginWithWebAuthn(t, handler, "B4LIMIMB", auth, id)
+	redirect, _ = url.Parse(response.Header().Get("Location"))
+	if response.Code != http.StatusFound || redirect.Path != "/oauth/login_page" {
+		t.Errorf("Redirect to login page expected but was '%d' '%s'", response.Code, redirect.Path)
+	}
+}
+
+func TestLoginWithWebAuthnSecondFactor(t *testing.T) {
+	handler := InitTestHttpHandler(t)
+	auth, id := registerWebAuthn(t, handler)
+	auth.UserVerified = false
+
+	body := &url.Values{}
+	body.Add("request_id", "U7JIKKYI")
+	body.Add("login", "alice")
+	body.Add("password", "testtest")
+	request, _ := http.NewRequest("POST", "/oauth/login", strings.NewReader(body.Encode()))
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	redirect, _ := url.Parse(response.Header().Get("Location"))
+	if response.Code != http.StatusFound || redirect.Path != "/oauth/login_2fa_page" {
+		t.Fatalf("Redirect to second step expected but was '%d' '%s'", response.Code, redirect.Path)
+	}
+
+	request, _ = http.NewRequest("GET", "/oauth/login_2fa_page?request_id=U7JIKKYI", strings.NewReader(""))
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusOK, response.Code)
+	}
+	if !strings.Contains(response.Body.String(), "webauthnButton") {
+		t.Error("Security key login expected on the page")
+	}
+
+	// a security key without user verification is sufficient as second factor
+	response = loginWithWebAuthn(t, handler, "U7JIKKYI", auth, id)
+	if response.Code != http.StatusFound {
+		t.Errorf("Response code '%d' expected but was '%d'", http.StatusFound, response.Code)
+	}
+	redirect, _ = url.Parse(response.Header().Get("Location"))
+	if redirect.Query().Get("code") == "" {
+		t.Error("Code not found")
+	}
+}